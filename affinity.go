@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// setupCores parses a per core --burn value, eg 0:1,3:0.5, into the load of each cpu. Returns
+// nothing when --burn is a plain value
+func setupCores(args Args) (map[int]float64, error) {
+	if !strings.Contains(args.Burn, ":") {
+		return nil, nil
+	}
+	if args.CPUSet != "" || args.NUMANode != "" || args.SMT != "" || args.Placement != "" {
+		return nil, errors.New("a per core --burn cannot be combined with --cpuset, --numa-node, --smt or --placement")
+	}
+	if args.WorkerChurn > 0 {
+		return nil, errors.New("a per core --burn cannot be combined with --worker-churn")
+	}
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("a per core --burn is only supported on linux")
+	}
+	cores, err := parseCores(args.Burn)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := allowedCPUs()
+	if err != nil {
+		return nil, err
+	}
+	for cpu := range cores {
+		if !allowed[cpu] {
+			return nil, fmt.Errorf("cpu %d from --burn is not available to this process", cpu)
+		}
+	}
+	return cores, nil
+}
+
+// parseCores parses a list of cpu:load pairs. Loads are fractions of a single cpu, eg 0.5 or 500m
+func parseCores(spec string) (map[int]float64, error) {
+	invalidInput := fmt.Errorf("invalid burn value: %s", spec)
+	cores := map[int]float64{}
+	for _, part := range strings.Split(spec, ",") {
+		cpuPart, loadPart, found := strings.Cut(part, ":")
+		if !found {
+			return nil, invalidInput
+		}
+		cpu, err := strconv.Atoi(cpuPart)
+		if err != nil || cpu < 0 || cpu >= maxCPUSetCPU {
+			return nil, invalidInput
+		}
+		load, millicores, err := parseMillicores(loadPart)
+		if !millicores {
+			load, err = strconv.ParseFloat(loadPart, 64)
+		}
+		if err != nil || load < 0 || load > 1 {
+			return nil, fmt.Errorf("invalid burn value: %s: the load of a cpu must be between 0 and 1", spec)
+		}
+		if _, duplicate := cores[cpu]; duplicate {
+			return nil, fmt.Errorf("invalid burn value: %s: cpu %d is repeated", spec, cpu)
+		}
+		cores[cpu] = load
+	}
+	return cores, nil
+}
+
+// setupCPUSets returns the sets of cpus workers are pinned to according to --cpuset, --numa-node,
+// --smt and --placement. Returns nothing when workers are free to run anywhere
+func setupCPUSets(args Args) ([][]int, error) {
+	cpuSets, err := selectCPUSets(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case args.SMT != "" && args.Placement != "":
+		return nil, errors.New("--smt and --placement cannot be combined")
+	case args.SMT != "":
+		return smtCPUSets(args.SMT, cpuSets)
+	case args.Placement != "":
+		return placementCPUSets(args.Placement, cpuSets)
+	}
+	return cpuSets, nil
+}
+
+// selectCPUSets returns the sets of cpus --cpuset and --numa-node restrict workers to
+func selectCPUSets(args Args) ([][]int, error) {
+	if args.CPUSet == "" && args.NUMANode == "" {
+		return nil, nil
+	}
+	if args.CPUSet != "" && args.NUMANode != "" {
+		return nil, errors.New("--cpuset and --numa-node cannot be combined")
+	}
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("--cpuset and --numa-node are only supported on linux")
+	}
+	allowed, err := allowedCPUs()
+	if err != nil {
+		return nil, err
+	}
+
+	if args.CPUSet != "" {
+		cpuSet, err := parseCPUSet(args.CPUSet)
+		if err != nil {
+			return nil, err
+		}
+		for _, cpu := range cpuSet {
+			if !allowed[cpu] {
+				return nil, fmt.Errorf("cpu %d from --cpuset is not available to this process", cpu)
+			}
+		}
+		return [][]int{cpuSet}, nil
+	}
+
+	nodes, err := numaNodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect NUMA topology: %w", err)
+	}
+	if args.NUMANode == "spread" {
+		var cpuSets [][]int
+		for _, node := range sortedKeys(nodes) {
+			if cpuSet := filterCPUs(nodes[node], allowed); len(cpuSet) > 0 {
+				cpuSets = append(cpuSets, cpuSet)
+			}
+		}
+		if len(cpuSets) == 0 {
+			return nil, errors.New("no NUMA node has cpus available to this process")
+		}
+		return cpuSets, nil
+	}
+	node, err := strconv.Atoi(args.NUMANode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid numa-node value: %s", args.NUMANode)
+	}
+	cpus, found := nodes[node]
+	if !found {
+		return nil, fmt.Errorf("NUMA node %d does not exist", node)
+	}
+	cpuSet := filterCPUs(cpus, allowed)
+	if len(cpuSet) == 0 {
+		return nil, fmt.Errorf("NUMA node %d has no cpus available to this process", node)
+	}
+	return [][]int{cpuSet}, nil
+}
+
+// smtCPUSets places workers according to --smt among the cpus of cpuSets, or all the allowed cpus
+// when nil. Workers fill the sets returned in order, one each before doubling up:
+//   - avoid gives every physical core a set of its own, so workers do not share cores until there
+//     are more of them than cores
+//   - prefer gives every hardware thread a set of its own, ordered core by core, so workers fill
+//     both threads of a core before moving on to the next one
+//   - only-siblings does the same, leaving out cores without smt siblings
+func smtCPUSets(policy string, cpuSets [][]int) ([][]int, error) {
+	if policy != "avoid" && policy != "prefer" && policy != "only-siblings" {
+		return nil, fmt.Errorf("invalid smt value: %s: must be avoid, prefer or only-siblings", policy)
+	}
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("--smt is only supported on linux")
+	}
+	candidates := map[int]bool{}
+	for _, cpuSet := range cpuSets {
+		for _, cpu := range cpuSet {
+			candidates[cpu] = true
+		}
+	}
+	if len(candidates) == 0 {
+		allowed, err := allowedCPUs()
+		if err != nil {
+			return nil, err
+		}
+		candidates = allowed
+	}
+	siblings, err := threadSiblings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect smt siblings: %w", err)
+	}
+
+	// cores are told apart by their lowest thread, and listed in that order
+	cores := map[int][]int{}
+	for cpu := range candidates {
+		core := cpu
+		for _, sibling := range siblings[cpu] {
+			core = min(core, sibling)
+		}
+		cores[core] = append(cores[core], cpu)
+	}
+	var result [][]int
+	for _, core := range sortedKeys(cores) {
+		threads := cores[core]
+		sort.Ints(threads)
+		switch {
+		case policy == "avoid":
+			result = append(result, threads)
+		case policy == "only-siblings" && len(threads) < 2:
+		default:
+			for _, thread := range threads {
+				result = append(result, []int{thread})
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("--smt only-siblings found no core with smt siblings available to this process")
+	}
+	return result, nil
+}
+
+// filterCPUs keeps only the allowed cpus
+func filterCPUs(cpus []int, allowed map[int]bool) []int {
+	var result []int
+	for _, cpu := range cpus {
+		if allowed[cpu] {
+			result = append(result, cpu)
+		}
+	}
+	return result
+}
+
+// countCPUs returns how many distinct cpus are in the given sets
+func countCPUs(cpuSets [][]int) int {
+	seen := map[int]bool{}
+	for _, cpuSet := range cpuSets {
+		for _, cpu := range cpuSet {
+			seen[cpu] = true
+		}
+	}
+	return len(seen)
+}
+
+func sortedKeys(nodes map[int][]int) []int {
+	keys := make([]int, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// parseCPUSet parses a list of cpus in the format used by cpusets and sysfs, eg 0,2,4-7
+func parseCPUSet(spec string) ([]int, error) {
+	invalidInput := fmt.Errorf("invalid cpuset value: %s", spec)
+	seen := map[int]bool{}
+	var cpus []int
+	for _, part := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		low, err := strconv.Atoi(first)
+		if err != nil || low < 0 {
+			return nil, invalidInput
+		}
+		high := low
+		if isRange {
+			high, err = strconv.Atoi(last)
+			if err != nil || high < low {
+				return nil, invalidInput
+			}
+		}
+		if high >= maxCPUSetCPU {
+			return nil, invalidInput
+		}
+		for cpu := low; cpu <= high; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	return cpus, nil
+}
+
+// formatCPUSet formats a list of cpus in the format parsed by parseCPUSet, collapsing consecutive
+// cpus into ranges
+func formatCPUSet(cpus []int) string {
+	sorted := append([]int(nil), cpus...)
+	sort.Ints(sorted)
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+const maxCPUSetCPU = 1024 // cpu ids must be below the size of the kernel cpu set
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+type BenchCmd struct {
+	Each    time.Duration `arg:"--each" default:"3s" help:"how long each workload runs"`
+	Threads int           `arg:"--threads" default:"0" help:"how many cores run each workload at once, one thread per core. Pass 0 to use all of them"`
+}
+
+// benchmark is a workload the bench subcommand runs, along with how its work is counted
+type benchmark struct {
+	name  string
+	unit  string // of the work counted, per second
+	scale float64
+	new   func() (burn.Workload, func() int64)
+}
+
+var benchmarks = []benchmark{
+	{"int", "Mops", 1e6, func() (burn.Workload, func() int64) { w := burn.NewInt(); return w, w.Ops }},
+	{"float", "Mflops", 1e6, func() (burn.Workload, func() int64) { w := burn.NewFloat(); return w, w.Ops }},
+	{"sha256", "MB", 1e6, func() (burn.Workload, func() int64) { w := burn.NewSHA256(); return w, w.Hashed }},
+}
+
+// runBench runs every benchmark on the given amount of threads and prints how much work each core
+// did per second, along with an overall score: the geometric mean of the per core figures. Scores
+// are comparable between hosts running the same version of the burner
+func runBench(w io.Writer, cmd *BenchCmd) error {
+	if cmd.Each <= 0 {
+		return fmt.Errorf("invalid each value: %s", cmd.Each)
+	}
+	threads := cmd.Threads
+	if threads < 0 {
+		return fmt.Errorf("invalid threads value: %d", cmd.Threads)
+	}
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+
+	fmt.Fprintf(w, "%-8s %16s %16s\n", "workload", "per core", "total")
+	logScore := 0.0
+	for _, b := range benchmarks {
+		workload, work := b.new()
+		elapsed := benchWorkload(workload, threads, cmd.Each)
+		total := float64(work()) / b.scale / elapsed.Seconds()
+		perCore := total / float64(threads)
+		fmt.Fprintf(w, "%-8s %16s %16s\n", b.name, fmt.Sprintf("%.1f %s/s", perCore, b.unit), fmt.Sprintf("%.1f %s/s", total, b.unit))
+		logScore += math.Log(perCore)
+	}
+	fmt.Fprintf(w, "\nscore: %.1f per core, with %d threads burning at once\n", math.Exp(logScore/float64(len(benchmarks))), threads)
+	return nil
+}
+
+// benchWorkload burns the workload on every thread for the given duration, returning how long it
+// actually ran
+func benchWorkload(workload burn.Workload, threads int, each time.Duration) time.Duration {
+	start := time.Now()
+	until := start.Add(each)
+	wg := sync.WaitGroup{}
+	for range threads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			workload.Burn(until)
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
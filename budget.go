@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// budgetCheckEvery is how often the cpu time consumed is compared against --cpu-seconds. The run
+// overshoots the budget by up to this long at the current usage
+const budgetCheckEvery = 100 * time.Millisecond
+
+// stopAtCPUBudget stops the burner once the process consumed the given cpu seconds since it
+// started, or the context is done
+func stopAtCPUBudget(ctx context.Context, b *burn.Burner, seconds float64) {
+	ticker := time.NewTicker(budgetCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if consumed := b.Stats().CPUSeconds; consumed >= seconds {
+			slog.Info("cpu seconds budget consumed, stopping", "pid", os.Getpid(), "cpu_seconds", decimal(consumed, 3), "budget", decimal(seconds, 3))
+			b.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package burn
+
+import "golang.org/x/sys/unix"
+
+// pinThread restricts the calling OS thread to run only on the given cpus
+func pinThread(cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	return unix.SchedSetaffinity(0, &set)
+}
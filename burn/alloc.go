@@ -0,0 +1,61 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const defaultAllocObjectSize = 1024
+
+// Alloc burns through heap allocations and the garbage collection they cause, rather than a spin
+// loop. A live set of the latest allocations is kept reachable, each new allocation replacing the
+// oldest one, so the collector has to trace it on every cycle while everything else is garbage
+type Alloc struct {
+	objectSize int
+	allocated  *pacer
+	next       atomic.Uint64
+	live       []atomic.Pointer[[]byte]
+}
+
+// AllocOptions configures an Alloc workload
+type AllocOptions struct {
+	// ObjectSize is the size of each allocation in bytes. Defaults to 1KiB
+	ObjectSize int
+	// LiveSet is how many bytes of the latest allocations are kept reachable
+	LiveSet int64
+	// Rate caps the bytes allocated per second, between all workers. Workers spin once they are
+	// ahead of it. 0 allocates as fast as possible
+	Rate float64
+}
+
+func NewAlloc(opts AllocOptions) *Alloc {
+	if opts.ObjectSize <= 0 {
+		opts.ObjectSize = defaultAllocObjectSize
+	}
+	return &Alloc{
+		objectSize: opts.ObjectSize,
+		allocated:  newPacer(opts.Rate),
+		// always keep the latest allocation, so the compiler cannot optimize allocations away
+		live: make([]atomic.Pointer[[]byte], max(1, opts.LiveSet/int64(opts.ObjectSize))),
+	}
+}
+
+func (a *Alloc) Burn(until time.Time) {
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if a.allocated.Ahead(now) {
+			continue
+		}
+		object := make([]byte, a.objectSize)
+		a.live[a.next.Add(1)%uint64(len(a.live))].Store(&object)
+		a.allocated.Add(int64(a.objectSize))
+	}
+}
+
+// Allocated returns how many bytes were allocated so far
+func (a *Alloc) Allocated() int64 {
+	return a.allocated.Done()
+}
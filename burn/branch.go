@@ -0,0 +1,53 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// branchCheckEvery is how many branches are taken between checks of the time
+const branchCheckEvery = 4096
+
+// branchSink keeps the results of the branch kernel alive so the compiler cannot drop it
+var branchSink atomic.Uint64
+
+// Branch burns on branches the predictor cannot guess: each worker takes branches that depend on
+// pseudo random data, so about half of them are mispredicted and the pipeline keeps being flushed.
+// The core is busy while getting little done, for a low instructions per cycle profile
+type Branch struct {
+	branches atomic.Int64
+}
+
+func NewBranch() *Branch {
+	return &Branch{}
+}
+
+func (b *Branch) Burn(until time.Time) {
+	// seeded from the clock, so workers do not follow the same pattern
+	x := uint64(time.Now().UnixNano()) | 1
+	var sum uint64
+	var branches int64
+	for time.Now().Before(until) {
+		for range branchCheckEvery {
+			// xorshift, cheap enough for the branches to dominate
+			x ^= x << 13
+			x ^= x >> 7
+			x ^= x << 17
+			// the branch bodies differ enough for the compiler to keep them as branches rather
+			// than turning them into conditional moves
+			if x&1 == 0 {
+				sum += x >> 3
+			} else {
+				sum ^= x * 3
+			}
+		}
+		branches += branchCheckEvery
+	}
+	branchSink.Store(sum)
+	b.branches.Add(branches)
+}
+
+// Branches returns how many unpredictable branches were taken so far
+func (b *Branch) Branches() int64 {
+	return b.branches.Load()
+}
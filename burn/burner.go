@@ -0,0 +1,799 @@
+// Package burn generates controlled cpu load. A Burner splits a target amount of cpus between
+// worker goroutines that alternate between spinning and sleeping, continuously correcting their
+// timings against the actual cpu time consumed by the process. The target can follow a Profile
+// and be changed while running
+package burn
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const retargetEvery = 100 * time.Millisecond // how often the burn target is recomputed from the profile
+const defaultWorkUnit = 1000 * time.Microsecond
+const defaultSampleEvery = time.Second
+
+// maxSteal bounds the steal compensated for, as making up for more would mean running workers
+// over twice as long as the usage they are asked for
+const maxSteal = 0.5
+
+// Options configures a Burner
+type Options struct {
+	// Profile defines the target over time. Defaults to burning no cpu at all
+	Profile Profile
+	// LockOSThread makes each worker lock itself to an OS thread
+	LockOSThread bool
+	// CPUSets restricts workers to run only on the given sets of cpus. Each worker is pinned to a
+	// single set, spreading workers evenly between them, eg one set per NUMA node. Workers are
+	// always locked to an OS thread when sets are given. Only supported on linux
+	CPUSets [][]int
+	// Cores shapes the load per cpu: each of these cpus gets a worker pinned to it, and the target
+	// is split between them proportionally to their values. Eg {0: 1, 3: 0.5} with a target of 1.5
+	// fully loads cpu 0 and half loads cpu 3. Takes precedence over CPUSets and disables
+	// WorkerChurn. Only supported on linux
+	Cores map[int]float64
+	// ThreadStats measures the cpu time consumed by each worker, see Stats.Threads. Workers are
+	// always locked to an OS thread when it is set, as that is what is measured
+	ThreadStats bool
+	// Priority is the scheduling priority workers set on their OS thread when they start, which
+	// keeps them locked to it. nil leaves the priority of threads untouched, see also
+	// SetProcessPriority
+	Priority *Priority
+	// Controller selects how worker timings are corrected against the measured usage. Defaults to
+	// ControllerPID
+	Controller Controller
+	// Workload is what workers do while burning. Defaults to Spin
+	Workload Workload
+	// WorkUnit is the period of the duty cycle of workers. Defaults to 1ms
+	WorkUnit time.Duration
+	// AdaptiveWorkUnit grows or shrinks the work unit while burning, depending on how much sleeps
+	// overshoot on the host, starting at WorkUnit. See Stats.WorkUnit
+	AdaptiveWorkUnit bool
+	// SleepStrategy selects how workers spend the idle part of the duty cycle. Defaults to
+	// SleepStrategySleep
+	SleepStrategy SleepStrategy
+	// WorkerChurn is how many times per second a worker is spawned or reaped while keeping the
+	// aggregate load constant. 0 disables it
+	WorkerChurn float64
+	// Drain is how long the target is ramped linearly down to zero once the context passed to
+	// Start is done, so the run does not end abruptly. Stop still stops right away. 0 stops as
+	// soon as the context is done
+	Drain time.Duration
+	// Slew caps how fast the target changes, in cpus per second, so any change, be it from the
+	// profile or SetTarget, is applied gradually instead of as a step. Pausing and resuming still
+	// take effect right away. 0 applies changes at once
+	Slew float64
+	// Warmup is how long from the start samples are marked as taken while warming up, leaving out
+	// the process start, the creation of workers and cpu frequency ramps from the summary
+	Warmup time.Duration
+	// Offset starts the profile this far into it, eg to resume a run that was interrupted where
+	// it left off
+	Offset time.Duration
+	// SampleEvery is how often the cpu usage is measured. Defaults to 1s
+	SampleEvery time.Duration
+	// Record keeps every sample taken so the run can be summarized
+	Record bool
+	// Isolated measures the usage from the cpu time of the worker threads rather than of the whole
+	// process, so several burners can share a process, each controlling its own usage. Workers are
+	// always locked to an OS thread when it is set. All of it is reported as user time, as thread
+	// cpu time is not split between user space and the kernel
+	Isolated bool
+	// Logger defaults to slog.Default(). Workers log how they split every work unit at
+	// slog.LevelDebug, and every adjustment window of the controller at LevelTrace
+	Logger *slog.Logger
+}
+
+// Stats is a snapshot of the state of a Burner
+type Stats struct {
+	Target       float64
+	Paused       bool
+	Phase        int // index of the phase currently running, -1 when the profile has no phases
+	Workers      int
+	Shares       []float64
+	Threads      []ThreadStats // only available when Options.ThreadStats is set
+	Spawned      int64
+	Reaped       int64
+	LockOSThread bool
+	CPUSets      [][]int
+	WorkUnit     time.Duration
+	Last         Sample // latest sample taken, zero before the first one
+	Start        time.Time
+	Uptime       time.Duration
+	Elapsed      time.Duration // how far into the profile the run is, from zero again once the target is set
+	CPUSeconds   float64       // cpu time consumed by the process since the burner was created
+}
+
+// State is the stage of its lifecycle a Burner is at
+type State string
+
+const (
+	StateStarting State = "starting" // not burning yet, either not started or applying the first target
+	StateBurning  State = "burning"  // burning, which includes being paused
+	StateDraining State = "draining" // stopping, ramping down with Options.Drain or waiting for workers to exit
+	StateStopped  State = "stopped"
+)
+
+// ThreadStats is the cpu time consumed by the OS thread a worker runs on, along with where it is
+// scheduled. It is updated every 100ms or so
+type ThreadStats struct {
+	Worker  int64 // worker id, unique over the run
+	Share   float64
+	CPUTime time.Duration
+	// CPU is the cpu the thread last ran on, -1 when unknown. Only available on linux
+	CPU int
+	// WaitTime is how long the thread waited for a cpu while runnable, which grows when the cpus
+	// it runs on are busy with other work. Only available on linux
+	WaitTime time.Duration
+}
+
+// Burner drives a run: the worker pool burning cpu, the profile changing its target over time and
+// the periodic sampling of usage. It can be controlled while running, eg to change the target or
+// to pause it
+type Burner struct {
+	opts   Options
+	logger *slog.Logger
+	done   chan struct{}
+
+	start           time.Time
+	startCPUTime    int64
+	startUserTime   int64
+	startSystemTime int64
+	recorder        *recorder
+
+	mu           sync.Mutex
+	ctx          context.Context
+	cancel       context.CancelFunc
+	profile      Profile
+	profileStart time.Time
+	drainStart   time.Time // zero until the drain starts
+	slewTarget   float64   // the target as slewed so far, see Options.Slew
+	slewAt       time.Time // when slewTarget was last moved, zero before the first target
+	pool         *pool
+	last         Sample
+	recent       []Sample // latest samples, oldest first, see Dump
+	end          time.Time
+	subscribers  map[chan Sample]struct{}
+
+	currentPhase atomic.Int64
+	paused       atomic.Bool
+	burning      atomic.Bool // set once the first target was applied
+	sampleEvery  atomic.Int64
+	limit        atomicFloat // caps the target, +Inf when there is no cap
+	steal        atomicFloat // see SetSteal
+}
+
+func New(opts Options) *Burner {
+	if opts.Profile == nil {
+		opts.Profile = Constant(0)
+	}
+	if opts.Controller == "" {
+		opts.Controller = ControllerPID
+	}
+	if opts.Workload == nil {
+		opts.Workload = Spin{}
+	}
+	if opts.SleepStrategy == "" {
+		opts.SleepStrategy = SleepStrategySleep
+	}
+	if opts.WorkUnit <= 0 {
+		opts.WorkUnit = defaultWorkUnit
+	}
+	if opts.SampleEvery <= 0 {
+		opts.SampleEvery = defaultSampleEvery
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	b := &Burner{
+		opts:         opts,
+		logger:       opts.Logger,
+		done:         make(chan struct{}),
+		start:        time.Now(),
+		profile:      opts.Profile,
+		profileStart: time.Now().Add(-opts.Offset),
+		subscribers:  map[chan Sample]struct{}{},
+	}
+	b.startUserTime, b.startSystemTime = b.cpuTimes(nil)
+	b.startCPUTime = b.startUserTime + b.startSystemTime
+	if opts.Record {
+		b.recorder = &recorder{}
+	}
+	b.currentPhase.Store(-1)
+	b.limit.Store(math.Inf(1))
+	b.sampleEvery.Store(int64(opts.SampleEvery))
+	return b
+}
+
+// Start begins burning in the background, until the context is done or Stop is called. The
+// profile time starts counting when the Burner is created. A Burner only runs once, so calling
+// Start again, even after it stopped, does nothing
+func (b *Burner) Start(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx != nil {
+		return
+	}
+	parent := ctx
+	if b.opts.Drain > 0 {
+		// workers outlive the context for as long as the drain lasts
+		ctx = context.WithoutCancel(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	b.ctx = ctx
+	b.cancel = cancel
+	b.pool = newPool(ctx, b.logger, b.profile.Target(time.Since(b.profileStart)), b.opts.workerSettings(PhaseOptions{}), b.opts.poolOptions())
+	b.pool.SetSteal(b.steal.Load())
+	if b.opts.Drain > 0 {
+		context.AfterFunc(parent, b.drain)
+	}
+	go b.run()
+}
+
+// drain starts ramping the target down to zero, stopping once it gets there
+func (b *Burner) drain() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx.Err() != nil || !b.drainStart.IsZero() {
+		return
+	}
+	b.logger.Info("draining", "pid", os.Getpid(), "drain_ms", b.opts.Drain.Milliseconds())
+	b.drainStart = time.Now()
+	time.AfterFunc(b.opts.Drain, b.cancel)
+}
+
+// capped applies the limit, the slew rate and the drain to a target of the profile. Must be
+// called with b.mu held
+func (b *Burner) capped(target float64) float64 {
+	target = b.slewed(min(target, b.limit.Load()))
+	if !b.drainStart.IsZero() {
+		target *= max(0, 1-float64(time.Since(b.drainStart))/float64(b.opts.Drain))
+	}
+	return target
+}
+
+// slewed moves the target towards the given one by no more than Options.Slew cpus per second since
+// it was last moved. The first target is applied as is. Must be called with b.mu held
+func (b *Burner) slewed(target float64) float64 {
+	now := time.Now()
+	if b.opts.Slew <= 0 || b.slewAt.IsZero() {
+		b.slewTarget, b.slewAt = target, now
+		return target
+	}
+	step := b.opts.Slew * now.Sub(b.slewAt).Seconds()
+	b.slewTarget += max(-step, min(step, target-b.slewTarget))
+	b.slewAt = now
+	return b.slewTarget
+}
+
+func (o Options) poolOptions() poolOptions {
+	opts := poolOptions{
+		workUnit:   o.WorkUnit,
+		adaptive:   o.AdaptiveWorkUnit,
+		churn:      o.WorkerChurn > 0,
+		threads:    o.ThreadStats,
+		controller: o.Controller,
+		priority:   o.Priority,
+		isolated:   o.Isolated,
+	}
+	for _, core := range slices.Sorted(maps.Keys(o.Cores)) {
+		opts.weights = append(opts.weights, o.Cores[core])
+	}
+	return opts
+}
+
+// workerSettings returns how workers burn during a phase with the given options, the zero
+// PhaseOptions for outside of phases. Phases cannot pin workers when the load is shaped by Cores
+func (o Options) workerSettings(phase PhaseOptions) workerSettings {
+	s := workerSettings{lockOSThread: o.LockOSThread, workload: o.Workload, sleepStrategy: o.SleepStrategy, cpuSets: o.CPUSets}
+	if phase.LockOSThread != nil {
+		s.lockOSThread = *phase.LockOSThread
+	}
+	if phase.Workload != nil {
+		s.workload = phase.Workload
+	}
+	if phase.SleepStrategy != "" {
+		s.sleepStrategy = phase.SleepStrategy
+	}
+	if phase.CPUSets != nil {
+		s.cpuSets = phase.CPUSets
+		if len(s.cpuSets) == 0 {
+			s.cpuSets = nil
+		}
+	}
+	if len(o.Cores) > 0 {
+		s.cpuSets = nil
+		for _, core := range slices.Sorted(maps.Keys(o.Cores)) {
+			s.cpuSets = append(s.cpuSets, []int{core})
+		}
+	}
+	return s
+}
+
+// WorkerPlan describes a worker a Burner would start
+type WorkerPlan struct {
+	Share float64
+	CPUs  []int // cpus the worker is pinned to, nil when it is not pinned
+}
+
+// Plan returns the workers a Burner created with the given options would start to burn cpus,
+// without starting any
+func Plan(opts Options, cpus float64) []WorkerPlan {
+	// planning starts no workers, so the duty cycles they would log are left out
+	p := &pool{opts: opts.poolOptions(), settings: opts.workerSettings(PhaseOptions{}), target: cpus, logger: slog.New(slog.DiscardHandler)}
+	for range p.minWorkers(cpus) {
+		p.workers = append(p.workers, &worker{cpuSet: p.emptiestCPUSet()})
+	}
+	p.rebalance()
+	plan := make([]WorkerPlan, len(p.workers))
+	for i, w := range p.workers {
+		plan[i].Share = w.share.Load()
+		if w.cpuSet >= 0 {
+			plan[i].CPUs = p.settings.cpuSets[w.cpuSet]
+		}
+	}
+	return plan
+}
+
+// Run is like Start but blocks until the burner stops
+func (b *Burner) Run(ctx context.Context) {
+	b.Start(ctx)
+	b.Wait()
+}
+
+// Wait blocks until the burner stops. It returns right away when the burner was never started, as
+// it would never stop then
+func (b *Burner) Wait() {
+	b.mu.Lock()
+	started := b.ctx != nil
+	b.mu.Unlock()
+	if started {
+		<-b.done
+	}
+}
+
+// Done returns a channel that is closed once the burner stops
+func (b *Burner) Done() <-chan struct{} {
+	return b.done
+}
+
+// Stop ends the run. Wait returns shortly after
+func (b *Burner) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// State returns the stage of its lifecycle the burner is at
+func (b *Burner) State() State {
+	select {
+	case <-b.done:
+		return StateStopped
+	default:
+	}
+	b.mu.Lock()
+	ctx, draining := b.ctx, !b.drainStart.IsZero()
+	b.mu.Unlock()
+	switch {
+	case ctx != nil && ctx.Err() != nil, draining:
+		return StateDraining
+	case !b.burning.Load():
+		return StateStarting
+	}
+	return StateBurning
+}
+
+// Target returns the amount of cpus currently being burned
+func (b *Burner) Target() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool != nil {
+		return b.pool.Target()
+	}
+	// what capped would apply first, without moving the slew as nothing is burning yet
+	return min(b.profile.Target(time.Since(b.profileStart)), b.limit.Load())
+}
+
+// SetTarget replaces whatever profile was being burned by a constant target
+func (b *Burner) SetTarget(cpus float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.profile = Constant(cpus)
+	b.profileStart = time.Now()
+	if b.pool != nil && !b.paused.Load() {
+		b.pool.SetTarget(b.capped(cpus))
+	}
+	b.logger.Info("target changed", "pid", os.Getpid(), "cpus", cpus)
+}
+
+// SetLimit caps the target at the given cpus whatever the profile or SetTarget ask for, eg to
+// leave room for other work, until it is changed again. math.Inf(1) removes the cap. Applied on
+// the next retarget
+func (b *Burner) SetLimit(cpus float64) {
+	b.limit.Store(max(0, cpus))
+}
+
+// Limit returns the cap on the target set by SetLimit, +Inf when there is none
+func (b *Burner) Limit() float64 {
+	return b.limit.Load()
+}
+
+// SetSteal tells the burner which fraction of the cpu time of the host the hypervisor steals, from
+// 0 to maxSteal, so workers run long enough for the usage the guest sees to still reach the target,
+// instead of falling short once they run all the time. 0, the default, assumes nothing is stolen
+func (b *Burner) SetSteal(fraction float64) {
+	fraction = min(maxSteal, max(0, fraction))
+	if b.steal.Swap(fraction) == fraction {
+		return
+	}
+	b.mu.Lock()
+	p := b.pool
+	b.mu.Unlock()
+	if p != nil {
+		p.SetSteal(fraction)
+	}
+	b.logger.Debug("compensating for steal", "pid", os.Getpid(), "steal", fraction)
+}
+
+// Steal returns the fraction of cpu time compensated for as stolen, see SetSteal
+func (b *Burner) Steal() float64 {
+	return b.steal.Load()
+}
+
+// Rescale multiplies the target of whatever is being burned by factor from now on, keeping the
+// shape of the profile and how far into it the run is, eg when the capacity percentages were
+// relative to changed
+func (b *Burner) Rescale(factor float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.profile.(Scale); ok {
+		s.Factor *= factor
+		b.profile = s
+	} else {
+		b.profile = Scale{Profile: b.profile, Factor: factor}
+	}
+	if b.pool != nil && !b.paused.Load() {
+		b.pool.SetTarget(b.capped(b.profile.Target(time.Since(b.profileStart))))
+	}
+	b.logger.Info("target rescaled", "pid", os.Getpid(), "factor", factor)
+}
+
+// AdjustTarget changes the current target by delta cpus, never going below 0. As with SetTarget,
+// the resulting target becomes constant
+func (b *Burner) AdjustTarget(delta float64) {
+	// round away floating point noise so repeated adjustments land on the expected values
+	b.SetTarget(max(0, math.Round((b.Target()+delta)*1e6)/1e6))
+}
+
+// Pause makes all workers go idle until Resume is called. The run clock keeps ticking, so the
+// profile carries on as if burning
+func (b *Burner) Pause() {
+	if b.paused.Swap(true) {
+		return
+	}
+	b.logger.Info("pausing", "pid", os.Getpid())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool != nil {
+		b.pool.SetTarget(0)
+	}
+}
+
+// Resume undoes Pause
+func (b *Burner) Resume() {
+	if !b.paused.Swap(false) {
+		return
+	}
+	b.logger.Info("resuming", "pid", os.Getpid())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool != nil {
+		b.pool.SetTarget(b.capped(b.profile.Target(time.Since(b.profileStart))))
+	}
+}
+
+// Paused returns whether the burner is paused
+func (b *Burner) Paused() bool {
+	return b.paused.Load()
+}
+
+// SetSampleEvery changes how often the cpu usage is measured. Values of 0 or less restore the
+// default
+func (b *Burner) SetSampleEvery(every time.Duration) {
+	if every <= 0 {
+		every = defaultSampleEvery
+	}
+	b.sampleEvery.Store(int64(every))
+}
+
+// Stats returns a snapshot of the current state of the burner
+func (b *Burner) Stats() Stats {
+	b.mu.Lock()
+	p := b.pool
+	s := Stats{
+		Paused:       b.paused.Load(),
+		Phase:        int(b.currentPhase.Load()),
+		LockOSThread: b.opts.LockOSThread,
+		WorkUnit:     b.opts.WorkUnit,
+		Last:         b.last,
+		Start:        b.start,
+		Uptime:       b.elapsed(),
+		Elapsed:      time.Since(b.profileStart),
+	}
+	if p == nil {
+		s.Target = b.profile.Target(time.Since(b.profileStart))
+	}
+	b.mu.Unlock()
+	user, system := b.cpuTimes(p)
+	s.CPUSeconds = float64(user+system-b.startCPUTime) / float64(time.Second)
+	if p != nil {
+		s.WorkUnit = p.WorkUnit()
+		s.Target = p.Target()
+		s.Shares = p.Shares()
+		s.Threads = p.Threads()
+		s.CPUSets = p.CPUSets()
+		s.Workers = len(s.Shares)
+		s.Spawned = p.spawned.Load()
+		s.Reaped = p.reaped.Load()
+		s.LockOSThread = p.LockOSThread()
+	}
+	return s
+}
+
+// elapsed is the wall time of the run so far, or of the whole run once it ended. Must be called
+// with b.mu held
+func (b *Burner) elapsed() time.Duration {
+	if b.end.IsZero() {
+		return time.Since(b.start)
+	}
+	return b.end.Sub(b.start)
+}
+
+// Samples returns every sample taken so far. Only available when Options.Record is set
+func (b *Burner) Samples() []Sample {
+	if b.recorder == nil {
+		return nil
+	}
+	return b.recorder.Samples()
+}
+
+// Summary summarizes the run so far, or the whole run once it ended. Only covers individual
+// samples when Options.Record is set
+func (b *Burner) Summary() Summary {
+	s := Summarize(b.Samples())
+	b.mu.Lock()
+	s.WallTime = b.elapsed()
+	p, end := b.pool, b.end
+	b.mu.Unlock()
+	user, system := b.cpuTimes(p)
+	s.UserSeconds = float64(user-b.startUserTime) / float64(time.Second)
+	s.SystemSeconds = float64(system-b.startSystemTime) / float64(time.Second)
+	s.CPUSeconds = s.UserSeconds + s.SystemSeconds
+	if s.Samples == 0 && s.WallTime > 0 {
+		// runs shorter than the sampling interval still get an overall figure, with the target
+		// averaged over the targets actually applied
+		s.MeanAchieved = s.CPUSeconds / s.WallTime.Seconds()
+		s.MinAchieved = s.MeanAchieved
+		s.MaxAchieved = s.MeanAchieved
+		s.MedianAchieved = s.MeanAchieved
+		s.P95Achieved = s.MeanAchieved
+		if p != nil {
+			if end.IsZero() {
+				end = time.Now()
+			}
+			s.MeanTarget = p.TargetSeconds(end) / s.WallTime.Seconds()
+		}
+		if s.MeanTarget > 0 {
+			s.MeanAbsDeltaPct = math.Abs(s.MeanAchieved-s.MeanTarget) / s.MeanTarget * 100
+		}
+	}
+	return s
+}
+
+// cpuTimes returns the user and system cpu time consumed so far by what the burner measures: the
+// whole process, or the workers of the pool when isolated, which consumed nothing before it exists
+func (b *Burner) cpuTimes(p *pool) (int64, int64) {
+	if !b.opts.Isolated {
+		return CPUTimes()
+	}
+	if p == nil {
+		return 0, 0
+	}
+	return p.cpuTime(), 0
+}
+
+// Subscribe returns a channel that receives every usage sample taken from now on. Samples are
+// dropped for subscribers that are not keeping up. The returned function ends the subscription
+func (b *Burner) Subscribe() (<-chan Sample, func()) {
+	ch := make(chan Sample, 1)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *Burner) run() {
+	defer close(b.done)
+	b.mu.Lock()
+	ctx, cancel, pool := b.ctx, b.cancel, b.pool
+	b.mu.Unlock()
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.retarget(ctx, pool)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pool.adjust()
+	}()
+
+	if b.opts.AdaptiveWorkUnit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.adaptWorkUnit()
+		}()
+	}
+
+	if b.opts.WorkerChurn > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / b.opts.WorkerChurn))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					pool.Churn()
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.sample(ctx, pool)
+	}()
+
+	pool.Wait()
+	wg.Wait()
+
+	b.mu.Lock()
+	b.end = time.Now()
+	b.mu.Unlock()
+}
+
+// retarget periodically recomputes the target from the profile and applies it to the pool, also
+// applying per phase options whenever a new phase starts
+func (b *Burner) retarget(ctx context.Context, pool *pool) {
+	ticker := time.NewTicker(retargetEvery)
+	defer ticker.Stop()
+	for {
+		// profiles are not safe for concurrent use, and stateful ones move on when asked for a phase
+		b.mu.Lock()
+		elapsed := time.Since(b.profileStart)
+		target := b.capped(b.profile.Target(elapsed))
+		phases, hasPhases := FindPhased(b.profile)
+		index, options := -1, PhaseOptions{}
+		if hasPhases {
+			index, options = phases.Phase(elapsed)
+		}
+		b.mu.Unlock()
+		if b.paused.Load() {
+			target = 0
+		}
+
+		if hasPhases {
+			if int64(index) != b.currentPhase.Load() {
+				settings := b.opts.workerSettings(options)
+				attrs := []any{"pid", os.Getpid(), "phase", index, "name", options.Name, "cpus", target,
+					"lock_os_thread", settings.lockOSThread, "sleep_strategy", settings.sleepStrategy}
+				if settings.cpuSets != nil {
+					attrs = append(attrs, "cpusets", settings.cpuSets)
+				}
+				b.logger.Info("entering phase", attrs...)
+				pool.SetWorkerSettings(settings)
+				b.currentPhase.Store(int64(index))
+			}
+		} else if b.currentPhase.Load() >= 0 {
+			pool.SetWorkerSettings(b.opts.workerSettings(PhaseOptions{}))
+			b.currentPhase.Store(-1)
+		}
+		pool.SetTarget(target)
+		b.burning.Store(true)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample periodically measures the cpu usage, recording it and handing it to subscribers
+func (b *Burner) sample(ctx context.Context, pool *pool) {
+	every := time.Duration(b.sampleEvery.Load())
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	previousUser, previousSystem := b.cpuTimes(pool)
+	previous := previousUser + previousSystem
+	previousWallTime := time.Now()
+	previousTarget := pool.Target()
+	started := previousWallTime
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		currentUser, currentSystem := b.cpuTimes(pool)
+		current := currentUser + currentSystem
+		currentWallTime := time.Now()
+		interval := currentWallTime.Sub(previousWallTime)
+		// the target may have changed during the interval, approximate it by the midpoint
+		currentTarget := pool.Target()
+		s := Sample{
+			Time:     currentWallTime,
+			Interval: interval,
+			Target:   (previousTarget + currentTarget) / 2,
+			Phase:    int(b.currentPhase.Load()),
+			Paused:   b.paused.Load(),
+			Warmup:   previousWallTime.Sub(started) < b.opts.Warmup,
+			Achieved: float64(current-previous) / float64(interval),
+			User:     float64(currentUser-previousUser) / float64(interval),
+			System:   float64(currentSystem-previousSystem) / float64(interval),
+		}
+		// a late sample is only frozen when the cpu time did not keep up with the gap, otherwise the
+		// burn went on and only this goroutine was held up. How long it was stopped is estimated from
+		// how long burning at the target takes to consume what was consumed
+		if gap := interval - every; gap > every && float64(current-previous) < s.Target*float64(every+gap/2) {
+			running := time.Duration(float64(current-previous) / s.Target)
+			s.Frozen = min(interval, max(gap, interval-running))
+		}
+		if b.recorder != nil {
+			b.recorder.Add(s)
+		}
+		b.mu.Lock()
+		b.last = s
+		b.recent = append(b.recent, s)
+		if len(b.recent) > dumpRecentSamples {
+			b.recent = b.recent[1:]
+		}
+		for ch := range b.subscribers {
+			select {
+			case ch <- s:
+			default:
+			}
+		}
+		b.mu.Unlock()
+		previous, previousUser, previousSystem = current, currentUser, currentSystem
+		previousWallTime = currentWallTime
+		previousTarget = currentTarget
+		if latest := time.Duration(b.sampleEvery.Load()); latest != every {
+			every = latest
+			ticker.Reset(every)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package burn
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// newTestBurner returns a burner sampling often and burning little, so tests are quick and leave
+// room for each other
+func newTestBurner(t *testing.T, opts Options) *Burner {
+	t.Helper()
+	opts.SampleEvery = 50 * time.Millisecond
+	opts.Logger = slog.New(slog.DiscardHandler)
+	b := New(opts)
+	t.Cleanup(func() {
+		b.Stop()
+		b.Wait()
+	})
+	return b
+}
+
+// waitFor fails the test unless cond holds within a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	if state := b.State(); state != StateStarting {
+		t.Fatalf("state before start is %s, want %s", state, StateStarting)
+	}
+	b.Start(context.Background())
+	waitFor(t, "the burner to burn", func() bool { return b.State() == StateBurning })
+
+	b.Stop()
+	done := make(chan struct{})
+	go func() {
+		b.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after Stop")
+	}
+	if state := b.State(); state != StateStopped {
+		t.Fatalf("state after stop is %s, want %s", state, StateStopped)
+	}
+}
+
+func TestStopOnContextDone(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Start(ctx)
+	cancel()
+	select {
+	case <-b.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the burner did not stop once its context was done")
+	}
+}
+
+func TestStartTwice(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	b.Start(context.Background())
+	b.mu.Lock()
+	pool := b.pool
+	b.mu.Unlock()
+	b.Start(context.Background())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pool != pool {
+		t.Fatal("starting twice replaced the pool")
+	}
+}
+
+func TestWaitBeforeStart(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	done := make(chan struct{})
+	go func() {
+		b.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked on a burner that was never started")
+	}
+}
+
+func TestTargetBeforeStart(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(2), Slew: 1})
+	b.SetLimit(1.5)
+	for range 3 {
+		if target := b.Target(); target != 1.5 {
+			t.Fatalf("target before start is %v, want the limit of 1.5", target)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.slewAt.IsZero() {
+		t.Fatal("Target moved the slew before starting")
+	}
+}
+
+func TestSetTarget(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	b.Start(context.Background())
+	b.SetTarget(0.2)
+	if target := b.Target(); target != 0.2 {
+		t.Fatalf("target is %v, want 0.2", target)
+	}
+	if target := b.Stats().Target; target != 0.2 {
+		t.Fatalf("stats target is %v, want 0.2", target)
+	}
+	b.AdjustTarget(-0.05)
+	if target := b.Target(); target != 0.15 {
+		t.Fatalf("target after adjusting is %v, want 0.15", target)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	b.Start(context.Background())
+	b.Pause()
+	if !b.Paused() || !b.Stats().Paused {
+		t.Fatal("the burner is not paused")
+	}
+	if target := b.Stats().Target; target != 0 {
+		t.Fatalf("target while paused is %v, want 0", target)
+	}
+	b.Resume()
+	if b.Paused() {
+		t.Fatal("the burner is still paused")
+	}
+	if target := b.Stats().Target; target != 0.1 {
+		t.Fatalf("target after resuming is %v, want 0.1", target)
+	}
+}
+
+func TestStats(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1), Record: true})
+	b.Start(context.Background())
+	waitFor(t, "a sample", func() bool { return b.Stats().Last.Interval > 0 })
+	stats := b.Stats()
+	if stats.Workers != 1 || len(stats.Shares) != 1 {
+		t.Fatalf("%d workers with %d shares, want 1", stats.Workers, len(stats.Shares))
+	}
+	if stats.Last.Target != 0.1 {
+		t.Fatalf("target of the latest sample is %v, want 0.1", stats.Last.Target)
+	}
+	if stats.CPUSeconds <= 0 {
+		t.Fatalf("%v cpu seconds consumed, want some", stats.CPUSeconds)
+	}
+	if stats.Uptime <= 0 || stats.Start.IsZero() {
+		t.Fatal("uptime and start are not set")
+	}
+	if len(b.Samples()) == 0 {
+		t.Fatal("no samples were recorded")
+	}
+}
+
+func TestDumpWhileBurning(t *testing.T) {
+	states := []MarkovState{
+		{CPUs: 0.1, MinDwell: 10 * time.Millisecond, Next: []float64{0, 1}, Options: PhaseOptions{Name: "low"}},
+		{CPUs: 0.2, MinDwell: 10 * time.Millisecond, Next: []float64{1, 0}, Options: PhaseOptions{Name: "high"}},
+	}
+	b := newTestBurner(t, Options{Profile: NewMarkov(states, 0, 1)})
+	b.Start(context.Background())
+	for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); {
+		if name := b.Dump().PhaseName; name != "low" && name != "high" {
+			t.Fatalf("phase while burning is %q, want low or high", name)
+		}
+	}
+}
+
+func TestSummaryMeanTarget(t *testing.T) {
+	b := newTestBurner(t, Options{Profile: Constant(0.1)})
+	// no samples are taken, so the mean target comes from the targets applied
+	b.SetSampleEvery(time.Hour)
+	b.Start(context.Background())
+	time.Sleep(200 * time.Millisecond)
+	b.SetTarget(0.3)
+	time.Sleep(200 * time.Millisecond)
+	b.Stop()
+	b.Wait()
+	s := b.Summary()
+	if s.Samples != 0 {
+		t.Fatalf("%d samples were taken, want none", s.Samples)
+	}
+	if s.MeanTarget < 0.15 || s.MeanTarget > 0.25 {
+		t.Fatalf("mean target is %v, want about 0.2", s.MeanTarget)
+	}
+}
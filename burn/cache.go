@@ -0,0 +1,87 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const defaultCacheSize = 32 << 20
+const defaultCacheStride = 64
+
+// cacheCheckEvery is how many accesses are made between checks of the time
+const cacheCheckEvery = 1024
+
+// Cache burns while thrashing cpu caches: each worker walks a buffer sized to overflow them,
+// updating a byte every stride bytes, so most accesses miss and evict lines other programs on the
+// same cores, or sharing the last level cache, would use
+type Cache struct {
+	size      int64
+	stride    int
+	memPolicy MemPolicy
+	accesses  atomic.Int64
+	buffers   chan *cacheBuffer
+}
+
+// CacheOptions configures a Cache workload
+type CacheOptions struct {
+	// Size is the size of the buffer each worker walks, in bytes. Defaults to 32MiB, which
+	// overflows the last level cache of most cpus
+	Size int64
+	// Stride is how many bytes apart each access is. Defaults to 64, a cache line on most cpus
+	Stride int
+	// MemPolicy is where buffers are allocated, eg on a node other than the one workers are pinned
+	// to. Defaults to wherever the kernel allocates them
+	MemPolicy MemPolicy
+}
+
+type cacheBuffer struct {
+	data []byte
+	pos  int
+}
+
+// maxCacheBuffers bounds how many idle buffers are kept around for reuse
+const maxCacheBuffers = 1024
+
+func NewCache(opts CacheOptions) *Cache {
+	if opts.Size <= 0 {
+		opts.Size = defaultCacheSize
+	}
+	if opts.Stride <= 0 {
+		opts.Stride = defaultCacheStride
+	}
+	return &Cache{size: opts.Size, stride: opts.Stride, memPolicy: opts.MemPolicy, buffers: make(chan *cacheBuffer, maxCacheBuffers)}
+}
+
+func (c *Cache) Burn(until time.Time) {
+	// workers take a buffer while burning, so each buffer has a single worker walking it
+	var buf *cacheBuffer
+	select {
+	case buf = <-c.buffers:
+	default:
+		buf = &cacheBuffer{data: make([]byte, c.size)}
+		bindSlice(c.memPolicy, buf.data)
+	}
+	defer func() {
+		select {
+		case c.buffers <- buf:
+		default:
+		}
+	}()
+	var accesses int64
+	defer func() { c.accesses.Add(accesses) }()
+	for time.Now().Before(until) {
+		for range cacheCheckEvery {
+			buf.data[buf.pos]++
+			buf.pos += c.stride
+			if buf.pos >= len(buf.data) {
+				buf.pos = 0
+			}
+		}
+		accesses += cacheCheckEvery
+	}
+}
+
+// Accesses returns how many memory accesses were made so far
+func (c *Cache) Accesses() int64 {
+	return c.accesses.Load()
+}
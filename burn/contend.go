@@ -0,0 +1,101 @@
+package burn
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContendMode selects what workers of a Contend workload fight over
+type ContendMode string
+
+const (
+	ContendMutex  ContendMode = "mutex"  // shared state behind mutexes, parking waiters on futexes
+	ContendAtomic ContendMode = "atomic" // shared atomic counters, bouncing their cache lines
+)
+
+// criticalSection is how many times shared state is updated every time it is accessed
+const criticalSection = 64
+
+// contendedLock is a lock and the state it protects, padded to its own cache line so that only
+// contention on it is measured, not false sharing with its neighbours
+type contendedLock struct {
+	mu      sync.Mutex
+	value   int64
+	counter atomic.Int64
+	_       [40]byte
+}
+
+// Contend burns by having workers contend on shared locks, generating cache line bouncing and
+// futex activity: high cpu usage with little useful work, like a service fighting over a hot lock
+type Contend struct {
+	mode   ContendMode
+	ratio  float64
+	locks  []contendedLock
+	ops    atomic.Int64
+	shared atomic.Int64
+}
+
+// ContendOptions configures a Contend workload
+type ContendOptions struct {
+	// Mode defaults to ContendMutex
+	Mode ContendMode
+	// Ratio is the fraction of operations that touch shared state, from 0 to 1. The rest only
+	// touch state private to the worker
+	Ratio float64
+	// Locks is how many shared locks operations are spread over. The fewer, the more contention.
+	// Defaults to 1
+	Locks int
+}
+
+func NewContend(opts ContendOptions) *Contend {
+	if opts.Mode == "" {
+		opts.Mode = ContendMutex
+	}
+	return &Contend{mode: opts.Mode, ratio: opts.Ratio, locks: make([]contendedLock, max(1, opts.Locks))}
+}
+
+func (c *Contend) Burn(until time.Time) {
+	var private, ops, shared int64
+	defer func() {
+		c.ops.Add(ops)
+		c.shared.Add(shared)
+	}()
+	for time.Now().Before(until) {
+		ops++
+		if rand.Float64() >= c.ratio {
+			for range criticalSection {
+				private++
+			}
+			continue
+		}
+		shared++
+		lock := &c.locks[rand.IntN(len(c.locks))]
+		if c.mode == ContendAtomic {
+			for range criticalSection {
+				lock.counter.Add(1)
+			}
+			continue
+		}
+		lock.mu.Lock()
+		for range criticalSection {
+			lock.value++
+		}
+		lock.mu.Unlock()
+	}
+	privateSink.Store(private)
+}
+
+// privateSink keeps the private work of Contend from being optimized away
+var privateSink atomic.Int64
+
+// Ops returns how many operations were completed so far
+func (c *Contend) Ops() int64 {
+	return c.ops.Load()
+}
+
+// SharedOps returns how many of the operations completed so far touched shared state
+func (c *Contend) SharedOps() int64 {
+	return c.shared.Load()
+}
@@ -0,0 +1,50 @@
+package burn
+
+import "time"
+
+// Controller selects how the pool corrects worker timings against the measured cpu usage
+type Controller string
+
+const (
+	// ControllerStep nudges the correction factor by a fixed 1% whenever the usage is off by more
+	// than 0.5%. Slow but steady
+	ControllerStep Controller = "step"
+	// ControllerPID computes the correction factor with a proportional-integral-derivative
+	// controller over the relative error between target and usage. Converges faster and keeps
+	// tracking under contention or frequency scaling
+	ControllerPID Controller = "pid"
+)
+
+const pidProportionalGain = 0.3
+const pidIntegralGain = 1.5 // per second
+const pidDerivativeGain = 0.01
+
+// pidController turns the relative error between the target and the achieved usage into a run
+// time correction factor
+type pidController struct {
+	integral float64
+	previous float64
+	primed   bool
+}
+
+// update feeds the error measured over the last dt and returns the new correction factor, bounded
+// to [minScale, maxScale]. The integral stops accumulating while the output is saturated, so it
+// does not wind up when the target cannot be reached
+func (c *pidController) update(err float64, dt time.Duration) float64 {
+	seconds := dt.Seconds()
+	derivative := 0.0
+	if c.primed && seconds > 0 {
+		derivative = (err - c.previous) / seconds
+	}
+	c.previous = err
+	c.primed = true
+
+	integral := c.integral + err*seconds
+	output := 1 + pidProportionalGain*err + pidIntegralGain*integral + pidDerivativeGain*derivative
+	if output > maxScale || output < minScale {
+		output = min(maxScale, max(minScale, output))
+	} else {
+		c.integral = integral
+	}
+	return output
+}
@@ -0,0 +1,8 @@
+package burn
+
+// CPUTime returns the cpu time consumed so far by the whole process, in user space and in the
+// kernel, in nanoseconds
+func CPUTime() int64 {
+	user, system := CPUTimes()
+	return user + system
+}
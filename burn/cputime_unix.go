@@ -0,0 +1,24 @@
+//go:build unix
+
+package burn
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// CPUTimes returns the cpu time consumed so far by the whole process in user space and in the
+// kernel, in nanoseconds
+func CPUTimes() (int64, int64) {
+	var usage syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	return usage.Utime.Nano(), usage.Stime.Nano()
+}
+
+// threadCPUTime returns the cpu time consumed so far by the calling OS thread, in nanoseconds
+func threadCPUTime() int64 {
+	var ts unix.Timespec
+	unix.ClockGettime(unix.CLOCK_THREAD_CPUTIME_ID, &ts)
+	return ts.Nano()
+}
@@ -0,0 +1,30 @@
+package burn
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var getThreadTimes = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetThreadTimes")
+
+// CPUTimes returns the cpu time consumed so far by the whole process in user space and in the
+// kernel, in nanoseconds
+func CPUTimes() (int64, int64) {
+	var creation, exit, kernel, user windows.Filetime
+	windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &user)
+	return filetimeNanos(user), filetimeNanos(kernel)
+}
+
+// threadCPUTime returns the cpu time consumed so far by the calling OS thread, in nanoseconds
+func threadCPUTime() int64 {
+	var creation, exit, kernel, user windows.Filetime
+	thread, _ := windows.GetCurrentThread()
+	getThreadTimes.Call(uintptr(thread), uintptr(unsafe.Pointer(&creation)), uintptr(unsafe.Pointer(&exit)), uintptr(unsafe.Pointer(&kernel)), uintptr(unsafe.Pointer(&user)))
+	return filetimeNanos(kernel) + filetimeNanos(user)
+}
+
+// filetimeNanos converts a duration expressed as a filetime, in 100 nanosecond intervals
+func filetimeNanos(ft windows.Filetime) int64 {
+	return (int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)) * 100
+}
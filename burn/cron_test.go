@@ -0,0 +1,113 @@
+package burn
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// at returns the given wall clock time in UTC
+func at(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"60 * * * *", `"60" is out of the 0-59 range`},
+		{"* 24 * * *", `"24" is out of the 0-23 range`},
+		{"* * 0 * *", `"0" is out of the 1-31 range`},
+		{"* * 32 * *", `"32" is out of the 1-31 range`},
+		{"* * * 13 *", `"13" is out of the 1-12 range`},
+		{"* * * * 8", `"8" is out of the 0-7 range`},
+		{"5-1 * * * *", `"5-1" is out of the 0-59 range`},
+		{"*/0 * * * *", `invalid step in "*/0"`},
+		{"*/x * * * *", `invalid step in "*/x"`},
+		{"a * * * *", `invalid value in "a"`},
+		{"1-b * * * *", `invalid range in "1-b"`},
+		{"1,,2 * * * *", `invalid value in ""`},
+	}
+	for _, test := range tests {
+		_, err := ParseCron(test.spec)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseCron(%q) returned %v, want an error with %q", test.spec, err, test.err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 14 oct 2026 is a wednesday
+	wednesday := at(2026, time.October, 14, 10, 7)
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", wednesday, at(2026, time.October, 14, 10, 8)},
+		{"strictly after", "7 10 * * *", wednesday, at(2026, time.October, 15, 10, 7)},
+		{"seconds are ignored", "8 * * * *", wednesday.Add(59 * time.Second), at(2026, time.October, 14, 10, 8)},
+		{"step", "*/15 * * * *", wednesday, at(2026, time.October, 14, 10, 15)},
+		{"step over the hour", "*/15 * * * *", at(2026, time.October, 14, 10, 45), at(2026, time.October, 14, 11, 0)},
+		{"range step", "10-40/20 * * * *", at(2026, time.October, 14, 10, 31), at(2026, time.October, 14, 11, 10)},
+		{"value step", "50/5 * * * *", at(2026, time.October, 14, 10, 51), at(2026, time.October, 14, 10, 55)},
+		{"range", "0 9-17 * * *", at(2026, time.October, 14, 17, 30), at(2026, time.October, 15, 9, 0)},
+		{"list", "0 8,12,18 * * *", at(2026, time.October, 14, 12, 0), at(2026, time.October, 14, 18, 0)},
+		{"list of ranges", "0 1-2,22-23 * * *", at(2026, time.October, 14, 3, 0), at(2026, time.October, 14, 22, 0)},
+		{"weekdays", "0 9 * * 1-5", at(2026, time.October, 16, 9, 0), at(2026, time.October, 19, 9, 0)},
+		{"sunday as 0", "0 0 * * 0", wednesday, at(2026, time.October, 18, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", wednesday, at(2026, time.October, 18, 0, 0)},
+		{"day of month", "0 0 13 * *", wednesday, at(2026, time.November, 13, 0, 0)},
+		// both day fields restricted: either the 20th or a monday, whichever comes first
+		{"day of month or week, week first", "0 0 20 * 1", wednesday, at(2026, time.October, 19, 0, 0)},
+		{"day of month or week, month first", "0 0 15 * 1", wednesday, at(2026, time.October, 15, 0, 0)},
+		{"across a month", "0 0 1 * *", wednesday, at(2026, time.November, 1, 0, 0)},
+		{"across a short month", "0 0 31 * *", at(2026, time.October, 31, 0, 0), at(2026, time.December, 31, 0, 0)},
+		{"across a year", "30 6 * 1 *", wednesday, at(2027, time.January, 1, 6, 30)},
+		{"new year", "0 0 1 1 *", at(2026, time.December, 31, 23, 59), at(2027, time.January, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", wednesday, at(2028, time.February, 29, 0, 0)},
+		{"impossible date", "0 0 31 2 *", wednesday, time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.spec)
+		if err != nil {
+			t.Errorf("%s: ParseCron(%q) returned %v", test.name, test.spec, err)
+			continue
+		}
+		if next := schedule.Next(test.from); !next.Equal(test.want) {
+			t.Errorf("%s: next of %q after %v is %v, want %v", test.name, test.spec, test.from, next, test.want)
+		}
+	}
+}
+
+func TestCronTarget(t *testing.T) {
+	schedule, err := ParseCron("0,30 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// starts in the middle of the window of 10:00
+	c := Cron{Profile: Constant(2), Schedule: schedule, Duration: 10 * time.Minute, Start: at(2026, time.October, 14, 10, 5)}
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 2},
+		{5*time.Minute - time.Second, 2},
+		{5 * time.Minute, 0},
+		{20 * time.Minute, 0},
+		{25*time.Minute - time.Second, 0},
+		{25 * time.Minute, 2},
+		{35*time.Minute - time.Second, 2},
+		{35 * time.Minute, 0},
+		{55 * time.Minute, 2},
+	}
+	for _, test := range tests {
+		if target := c.Target(test.elapsed); target != test.want {
+			t.Errorf("target %v into the run, at %s, is %v, want %v", test.elapsed, c.Start.Add(test.elapsed).Format("15:04:05"), target, test.want)
+		}
+	}
+}
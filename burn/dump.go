@@ -0,0 +1,82 @@
+package burn
+
+import (
+	"slices"
+	"time"
+)
+
+// dumpRecentSamples is how many of the latest samples a Dump holds
+const dumpRecentSamples = 10
+
+// Dump is a detailed snapshot of the internals of a Burner, to debug long runs that drifted from
+// their target without restarting them
+type Dump struct {
+	Stats Stats
+	State State
+	// ProfileTarget is what the profile asks for at this point of the run, before the limit, the
+	// slew and the drain are applied
+	ProfileTarget float64
+	Limit         float64       // +Inf when there is no cap
+	PhaseName     string        // name of the phase currently running, if any
+	Draining      time.Duration // how long the drain has been going on, 0 when not draining
+	Controller    ControllerState
+	Workers       []WorkerState
+	Recent        []Sample // latest samples, oldest first
+}
+
+// ControllerState is how the pool is correcting worker timings against the measured usage
+type ControllerState struct {
+	Controller Controller
+	// Scale is the correction factor applied to the run time of every worker
+	Scale float64
+	// Error is the relative error between the target and the usage over the latest window,
+	// positive when burning too little
+	Error float64
+	// Integral is the error accumulated by ControllerPID
+	Integral float64
+	WorkUnit time.Duration
+	// Steal is the fraction of cpu time compensated for as stolen by the hypervisor, see SetSteal
+	Steal float64
+}
+
+// WorkerState is how a single worker burns
+type WorkerState struct {
+	ID            int64
+	Share         float64
+	CPUs          []int // the cpus the worker is pinned to, nil when not pinned
+	LockOSThread  bool
+	Workload      Workload
+	SleepStrategy SleepStrategy
+	// CPUTime, CPU and WaitTime are as in ThreadStats, only available when Options.ThreadStats or
+	// Options.Isolated is set. CPU is -1 when unknown
+	CPUTime  time.Duration
+	CPU      int
+	WaitTime time.Duration
+}
+
+// Dump returns a detailed snapshot of the internals of the burner
+func (b *Burner) Dump() Dump {
+	d := Dump{Stats: b.Stats(), State: b.State(), Limit: b.Limit()}
+	b.mu.Lock()
+	elapsed := time.Since(b.profileStart)
+	d.ProfileTarget = b.profile.Target(elapsed)
+	if phases, ok := FindPhased(b.profile); ok {
+		_, options := phases.Phase(elapsed)
+		d.PhaseName = options.Name
+	}
+	if !b.drainStart.IsZero() {
+		d.Draining = time.Since(b.drainStart)
+	}
+	d.Recent = slices.Clone(b.recent)
+	p := b.pool
+	b.mu.Unlock()
+	d.Controller = ControllerState{Controller: b.opts.Controller, Scale: 1, WorkUnit: b.opts.WorkUnit, Steal: b.steal.Load()}
+	if p != nil {
+		d.Controller.Scale = p.scale.Load()
+		d.Controller.Error = p.controllerError.Load()
+		d.Controller.Integral = p.controllerIntegral.Load()
+		d.Controller.WorkUnit = p.WorkUnit()
+		d.Workers = p.WorkerStates()
+	}
+	return d
+}
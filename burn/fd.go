@@ -0,0 +1,122 @@
+package burn
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FDMode selects what a FD workload opens and closes
+type FDMode string
+
+const (
+	// FDOpen opens and closes the null device, churning the file descriptor table and path
+	// lookups of the kernel
+	FDOpen FDMode = "open"
+	// FDCreate creates and removes a file, which also churns dentries and inodes of the filesystem
+	// it is in
+	FDCreate FDMode = "create"
+	// FDSocket opens and closes an udp socket bound to localhost, churning the socket allocation
+	// and port binding paths
+	FDSocket FDMode = "socket"
+)
+
+// FD burns by opening and closing file descriptors in a tight loop, pressuring the paths of the
+// kernel that allocate and release them rather than spinning in user space. Each worker holds a
+// single descriptor at a time, so it never runs the process out of them
+type FD struct {
+	mode   FDMode
+	dir    string
+	opens  *pacer
+	failed atomic.Int64
+	files  atomic.Int64 // names the files created, unique over the run
+}
+
+// FDOptions configures a FD workload
+type FDOptions struct {
+	// Mode defaults to FDCreate
+	Mode FDMode
+	// Dir is where FDCreate creates its files. Defaults to os.TempDir()
+	Dir string
+	// Rate caps how many descriptors are opened per second, between all workers. Workers spin once
+	// they are ahead of it. 0 opens as fast as possible
+	Rate float64
+}
+
+func NewFD(opts FDOptions) (*FD, error) {
+	if opts.Mode == "" {
+		opts.Mode = FDCreate
+	}
+	switch opts.Mode {
+	case FDOpen, FDCreate, FDSocket:
+	default:
+		return nil, fmt.Errorf("invalid fd mode: %s", opts.Mode)
+	}
+	if opts.Dir == "" {
+		opts.Dir = os.TempDir()
+	}
+	f := &FD{mode: opts.Mode, dir: opts.Dir, opens: newPacer(opts.Rate)}
+	// make sure descriptors can be opened at all before burning with them
+	if err := f.churn(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FD) Burn(until time.Time) {
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if f.opens.Ahead(now) {
+			continue
+		}
+		if err := f.churn(); err != nil {
+			// eg out of descriptors because of something else in the process, which may pass
+			f.failed.Add(1)
+			Spin{}.Burn(earliest(until, now.Add(time.Millisecond)))
+			continue
+		}
+		f.opens.Add(1)
+	}
+}
+
+// churn opens a single descriptor and closes it right away
+func (f *FD) churn() error {
+	switch f.mode {
+	case FDOpen:
+		file, err := os.Open(os.DevNull)
+		if err != nil {
+			return err
+		}
+		return file.Close()
+	case FDSocket:
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		path := filepath.Join(f.dir, fmt.Sprintf("cpu-burner-fd-%d-%d", os.Getpid(), f.files.Add(1)))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		file.Close()
+		return os.Remove(path)
+	}
+}
+
+// Opens returns how many descriptors were opened and closed so far
+func (f *FD) Opens() int64 {
+	return f.opens.Done()
+}
+
+// Failed returns how many descriptors failed to be opened or closed so far
+func (f *FD) Failed() int64 {
+	return f.failed.Load()
+}
@@ -0,0 +1,64 @@
+package burn
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// floatCheckEvery is how many iterations of the float kernel run between checks of the time
+const floatCheckEvery = 4096
+
+// floatChains is how many independent fused multiply-add chains the float kernel runs. Enough of
+// them cover the latency of the instruction, keeping the floating point units busy at every cycle
+const floatChains = 8
+
+// floatSink keeps the results of the float kernel alive so the compiler cannot drop it
+var floatSink atomic.Uint64
+
+// Float burns on floating point arithmetic: each worker runs independent chains of fused
+// multiply-adds, keeping the vector and floating point units of the core busy rather than only the
+// integer and branch units a spin loop uses. That draws more power, useful to test thermal and
+// turbo behavior
+type Float struct {
+	ops atomic.Int64
+}
+
+func NewFloat() *Float {
+	return &Float{}
+}
+
+func (f *Float) Burn(until time.Time) {
+	var acc [floatChains]float64
+	for i := range acc {
+		acc[i] = float64(i)
+	}
+	// the chains converge to 1 and stay there, never going denormal, which is much slower
+	const m, c = 0.999999, 0.000001
+	var iterations int64
+	for time.Now().Before(until) {
+		for range floatCheckEvery {
+			acc[0] = math.FMA(acc[0], m, c)
+			acc[1] = math.FMA(acc[1], m, c)
+			acc[2] = math.FMA(acc[2], m, c)
+			acc[3] = math.FMA(acc[3], m, c)
+			acc[4] = math.FMA(acc[4], m, c)
+			acc[5] = math.FMA(acc[5], m, c)
+			acc[6] = math.FMA(acc[6], m, c)
+			acc[7] = math.FMA(acc[7], m, c)
+		}
+		iterations += floatCheckEvery
+	}
+	var sum float64
+	for _, v := range acc {
+		sum += v
+	}
+	floatSink.Store(math.Float64bits(sum))
+	// a fused multiply-add counts as two floating point operations
+	f.ops.Add(2 * floatChains * iterations)
+}
+
+// Ops returns how many floating point operations were made so far
+func (f *Float) Ops() int64 {
+	return f.ops.Load()
+}
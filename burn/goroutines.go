@@ -0,0 +1,74 @@
+package burn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultGoroutineWork = 10 * time.Microsecond
+
+// maxLiveGoroutines bounds how many goroutines each worker can have alive at once, so spawning
+// faster than they finish does not queue up work beyond the burn window
+const maxLiveGoroutines = 1000
+
+// Goroutines burns by continuously spawning short-lived goroutines, each spinning for a little
+// while before exiting, to stress how the runtime scheduler handles goroutine lifecycle. Workers
+// wait for the goroutines they spawned at the end of each burn, which keeps the load controlled
+type Goroutines struct {
+	work    time.Duration
+	spawned *pacer
+	live    atomic.Int64
+}
+
+// GoroutinesOptions configures a Goroutines workload
+type GoroutinesOptions struct {
+	// Work is how long each goroutine spins before exiting. Defaults to 10µs
+	Work time.Duration
+	// Rate caps the goroutines spawned per second, between all workers. Workers spin once they are
+	// ahead of it. 0 spawns as fast as possible
+	Rate float64
+}
+
+func NewGoroutines(opts GoroutinesOptions) *Goroutines {
+	if opts.Work <= 0 {
+		opts.Work = defaultGoroutineWork
+	}
+	return &Goroutines{work: opts.Work, spawned: newPacer(opts.Rate)}
+}
+
+func (g *Goroutines) Burn(until time.Time) {
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	var live atomic.Int64
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if g.spawned.Ahead(now) || live.Load() >= maxLiveGoroutines {
+			continue
+		}
+		live.Add(1)
+		g.live.Add(1)
+		g.spawned.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer live.Add(-1)
+			defer g.live.Add(-1)
+			// goroutines still queued once the burn is over exit right away
+			Spin{}.Burn(earliest(until, time.Now().Add(g.work)))
+		}()
+	}
+}
+
+// Spawned returns how many goroutines were spawned so far
+func (g *Goroutines) Spawned() int64 {
+	return g.spawned.Done()
+}
+
+// Live returns how many spawned goroutines are currently alive
+func (g *Goroutines) Live() int64 {
+	return g.live.Load()
+}
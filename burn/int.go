@@ -0,0 +1,49 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// intCheckEvery is how many iterations of the int kernel run between checks of the time
+const intCheckEvery = 4096
+
+// intChains is how many independent chains the int kernel runs, so the core can execute them in
+// parallel
+const intChains = 4
+
+// intSink keeps the results of the int kernel alive so the compiler cannot drop it
+var intSink atomic.Uint64
+
+// Int burns on integer arithmetic: each worker runs independent chains of multiplies, adds, shifts
+// and xors, keeping the integer units of the core busy with little branching or memory access
+type Int struct {
+	ops atomic.Int64
+}
+
+func NewInt() *Int {
+	return &Int{}
+}
+
+func (n *Int) Burn(until time.Time) {
+	acc := [intChains]uint64{1, 2, 3, 4}
+	var iterations int64
+	for time.Now().Before(until) {
+		for range intCheckEvery {
+			// a multiply and add followed by a xorshift, as in pcg and splitmix generators
+			for i := range acc {
+				x := acc[i]*6364136223846793005 + 1442695040888963407
+				acc[i] = x ^ x>>29
+			}
+		}
+		iterations += intCheckEvery
+	}
+	intSink.Store(acc[0] ^ acc[1] ^ acc[2] ^ acc[3])
+	// every step is a multiply, an add, a shift and a xor
+	n.ops.Add(4 * intChains * iterations)
+}
+
+// Ops returns how many integer operations were made so far
+func (n *Int) Ops() int64 {
+	return n.ops.Load()
+}
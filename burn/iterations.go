@@ -0,0 +1,41 @@
+package burn
+
+import "time"
+
+// iterationsMinSleep is the shortest sleep of workers ahead of the rate. Shorter ones keep waking
+// the worker before anything else gets to run, starving the other goroutines of its thread
+const iterationsMinSleep = 100 * time.Microsecond
+
+// Iterations burns a fixed number of spin kernel iterations per second, between all workers,
+// rather than a share of cpu time. Workers sleep whenever they are ahead of the rate instead of
+// spinning, so the work done over a run only depends on the rate and its duration, not on clock
+// and scheduler jitter or on how fast the cores are
+type Iterations struct {
+	done *pacer
+}
+
+func NewIterations(rate float64) *Iterations {
+	return &Iterations{done: newPacer(rate)}
+}
+
+func (it *Iterations) Burn(until time.Time) {
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if it.done.Ahead(now) {
+			// sleep until the rate catches up with what was done
+			caughtUp := it.done.start.Add(time.Duration(float64(it.done.Done()) / it.done.rate * float64(time.Second)))
+			time.Sleep(min(max(caughtUp.Sub(now), iterationsMinSleep), until.Sub(now)))
+			continue
+		}
+		spinKernel(spinCheckEvery)
+		it.done.Add(spinCheckEvery)
+	}
+}
+
+// Done returns how many iterations were run so far
+func (it *Iterations) Done() int64 {
+	return it.done.Done()
+}
@@ -0,0 +1,85 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const defaultMatrixSize = 128
+
+// Matrix burns on dense matrix multiplication, the kind of work numeric and machine learning code
+// does: each worker repeatedly multiplies two square matrices, mixing floating point arithmetic
+// with memory accesses that mostly hit cpu caches
+type Matrix struct {
+	size    int
+	flops   atomic.Int64
+	buffers chan *matrixBuffer
+}
+
+// MatrixOptions configures a Matrix workload
+type MatrixOptions struct {
+	// Size is the number of rows and columns of the matrices. Defaults to 128, which fits the
+	// three matrices every worker uses in the l2 cache of most cpus
+	Size int
+}
+
+type matrixBuffer struct {
+	a, b, c []float64
+	row     int
+}
+
+// maxMatrixBuffers bounds how many idle buffers are kept around for reuse
+const maxMatrixBuffers = 1024
+
+func NewMatrix(opts MatrixOptions) *Matrix {
+	if opts.Size <= 0 {
+		opts.Size = defaultMatrixSize
+	}
+	return &Matrix{size: opts.Size, buffers: make(chan *matrixBuffer, maxMatrixBuffers)}
+}
+
+func (m *Matrix) Burn(until time.Time) {
+	// workers take a buffer while burning, so each buffer has a single worker multiplying it
+	var buf *matrixBuffer
+	select {
+	case buf = <-m.buffers:
+	default:
+		n := m.size * m.size
+		buf = &matrixBuffer{a: make([]float64, n), b: make([]float64, n), c: make([]float64, n)}
+		for i := range n {
+			buf.a[i] = float64(i%7) / 7
+			buf.b[i] = float64(i%5) / 5
+		}
+	}
+	defer func() {
+		select {
+		case m.buffers <- buf:
+		default:
+		}
+	}()
+	n := m.size
+	var rows int64
+	for time.Now().Before(until) {
+		// one row of c = a * b at a time, in i-k-j order so the inner loop goes through memory
+		// sequentially
+		i := buf.row
+		c := buf.c[i*n : (i+1)*n]
+		clear(c)
+		for k := range n {
+			aik := buf.a[i*n+k]
+			b := buf.b[k*n : (k+1)*n]
+			for j := range c {
+				c[j] += aik * b[j]
+			}
+		}
+		buf.row = (i + 1) % n
+		rows++
+	}
+	// every row takes a multiply and an add per element of b
+	m.flops.Add(2 * rows * int64(n) * int64(n))
+}
+
+// Flops returns how many floating point operations were made so far
+func (m *Matrix) Flops() int64 {
+	return m.flops.Load()
+}
@@ -0,0 +1,46 @@
+package burn
+
+import "unsafe"
+
+// MemPolicyMode selects where the memory of a workload is allocated, relative to the numa nodes
+type MemPolicyMode string
+
+const (
+	// MemPolicyDefault leaves it to the kernel, which usually allocates on the node first touching
+	// the memory
+	MemPolicyDefault MemPolicyMode = ""
+	// MemPolicyLocal allocates on the node of the worker using the memory, moving what was allocated
+	// elsewhere
+	MemPolicyLocal MemPolicyMode = "local"
+	// MemPolicyInterleave spreads the memory over MemPolicy.Nodes page by page
+	MemPolicyInterleave MemPolicyMode = "interleave"
+	// MemPolicyBind allocates only on MemPolicy.Nodes, eg a node other than the one workers are
+	// pinned to, so every access crosses the interconnect
+	MemPolicyBind MemPolicyMode = "bind"
+)
+
+// MemPolicy is where the buffers of memory workloads are allocated. Only supported on linux
+type MemPolicy struct {
+	Mode MemPolicyMode
+	// Nodes are the numa nodes MemPolicyInterleave and MemPolicyBind allocate on
+	Nodes []int
+}
+
+// Bind applies the policy to the memory of buf, moving the pages already allocated. Only the
+// whole pages within buf are bound. Does nothing for MemPolicyDefault
+func (p MemPolicy) Bind(buf []byte) error {
+	if p.Mode == MemPolicyDefault || len(buf) == 0 {
+		return nil
+	}
+	return p.bind(unsafe.Pointer(unsafe.SliceData(buf)), uintptr(len(buf)))
+}
+
+// bindSlice applies the policy to the backing memory of a slice, ignoring failures, which
+// workloads cannot report. See Bind
+func bindSlice[T any](p MemPolicy, s []T) {
+	if p.Mode == MemPolicyDefault || len(s) == 0 {
+		return
+	}
+	var zero T
+	p.bind(unsafe.Pointer(unsafe.SliceData(s)), uintptr(len(s))*unsafe.Sizeof(zero))
+}
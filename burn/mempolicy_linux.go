@@ -0,0 +1,56 @@
+package burn
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// memory policy modes and flags of mbind(2)
+const (
+	mpolBind       = 2
+	mpolInterleave = 3
+	mpolLocal      = 4
+	mpolMFMove     = 1 << 1
+)
+
+func (p MemPolicy) bind(addr unsafe.Pointer, size uintptr) error {
+	var mode uintptr
+	switch p.Mode {
+	case MemPolicyLocal:
+		mode = mpolLocal
+	case MemPolicyInterleave:
+		mode = mpolInterleave
+	case MemPolicyBind:
+		mode = mpolBind
+	default:
+		return fmt.Errorf("invalid memory policy: %s", p.Mode)
+	}
+	page := uintptr(os.Getpagesize())
+	start := (uintptr(addr) + page - 1) &^ (page - 1)
+	end := (uintptr(addr) + size) &^ (page - 1)
+	if end <= start {
+		return nil
+	}
+	var mask []uint64
+	for _, node := range p.Nodes {
+		for len(mask) <= node/64 {
+			mask = append(mask, 0)
+		}
+		mask[node/64] |= 1 << (node % 64)
+	}
+	var maskAddr, maxNode uintptr
+	if len(mask) > 0 {
+		// the kernel reads one node less than it is told to, which libnuma makes up for the same way
+		maskAddr, maxNode = uintptr(unsafe.Pointer(&mask[0])), uintptr(len(mask)*64+1)
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_MBIND, start, end-start, mode, maskAddr, maxNode, mpolMFMove)
+	runtime.KeepAlive(mask)
+	if errno != 0 {
+		return fmt.Errorf("failed to apply the %s memory policy: %w", p.Mode, errno)
+	}
+	return nil
+}
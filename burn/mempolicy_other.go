@@ -0,0 +1,12 @@
+//go:build !linux
+
+package burn
+
+import (
+	"errors"
+	"unsafe"
+)
+
+func (p MemPolicy) bind(addr unsafe.Pointer, size uintptr) error {
+	return errors.New("memory policies are only supported on linux")
+}
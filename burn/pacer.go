@@ -0,0 +1,32 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// pacer caps how fast something is done between all workers, eg bytes allocated per second
+type pacer struct {
+	rate  float64 // per second, 0 means unlimited
+	start time.Time
+	done  atomic.Int64
+}
+
+func newPacer(rate float64) *pacer {
+	return &pacer{rate: rate, start: time.Now()}
+}
+
+// Ahead returns whether more was done than the rate allows by now
+func (p *pacer) Ahead(now time.Time) bool {
+	return p.rate > 0 && float64(p.done.Load()) >= p.rate*now.Sub(p.start).Seconds()
+}
+
+// Add records n more done
+func (p *pacer) Add(n int64) {
+	p.done.Add(n)
+}
+
+// Done returns how much was done so far
+func (p *pacer) Done() int64 {
+	return p.done.Load()
+}
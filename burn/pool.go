@@ -0,0 +1,652 @@
+package burn
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pool manages the set of goroutines burning cpu. The aggregate target is split into shares, one
+// per worker, and workers can be spawned and reaped at any time while keeping the aggregate constant
+type pool struct {
+	ctx    context.Context
+	logger *slog.Logger
+	opts   poolOptions
+
+	// scale is a correction factor applied to the run time of every worker. It is adjusted over
+	// time by adjust() to compensate for scheduling and timing inaccuracies
+	scale atomicFloat
+	// workUnit is the current period of the duty cycle, which only changes when adaptive
+	workUnit atomic.Int64
+	// steal is the fraction of cpu time the hypervisor steals, which workers make up for by
+	// running that much longer, see SetSteal
+	steal atomicFloat
+	// sleeps and overshoot measure how long workers slept past what they asked for,
+	// when adaptive
+	sleeps    atomic.Int64
+	overshoot atomic.Int64
+	// controllerError and controllerIntegral are the relative error between the target and the
+	// usage over the latest window of the controller, and the error accumulated by the pid
+	// controller, for Burner.Dump
+	controllerError    atomicFloat
+	controllerIntegral atomicFloat
+
+	mu       sync.Mutex
+	target   float64
+	targetAt time.Time // when target was applied
+	// targets applied before the current one, integrated over time in cpu seconds
+	targetSeconds float64
+	settings      workerSettings
+	workers       []*worker
+	wg            sync.WaitGroup
+
+	spawned atomic.Int64
+	reaped  atomic.Int64
+	// consumed is the cpu time consumed by worker threads, including those reaped, when isolated
+	consumed atomic.Int64
+}
+
+type poolOptions struct {
+	workUnit time.Duration
+	adaptive bool
+	churn    bool
+	// weights shape the load, giving each cpu set a fixed worker burning this fraction of the
+	// target. nil when the target is split freely between workers
+	weights    []float64
+	threads    bool
+	controller Controller
+	// priority is the scheduling priority of worker threads, nil to leave it untouched
+	priority *Priority
+	// isolated measures the usage of the pool from the cpu time of its worker threads
+	isolated bool
+}
+
+// workerSettings are how workers burn, which phases of the profile can change. Workers only read
+// them when spawned, so changing them replaces every worker
+type workerSettings struct {
+	lockOSThread bool
+	workload     Workload
+	// sleepStrategy is how workers spend the idle part of the duty cycle
+	sleepStrategy SleepStrategy
+	// cpuSets are the sets of cpus workers are pinned to, nil when they are not pinned. When the
+	// load is shaped by weights, each set is a single cpu of Options.Cores
+	cpuSets [][]int
+}
+
+// equal tells whether workers spawned with either settings would burn the same way
+func (s workerSettings) equal(other workerSettings) bool {
+	return s.lockOSThread == other.lockOSThread && s.sleepStrategy == other.sleepStrategy &&
+		sameWorkload(s.workload, other.workload) &&
+		slices.EqualFunc(s.cpuSets, other.cpuSets, slices.Equal[[]int])
+}
+
+// sameWorkload tells whether two workloads are the same one, without panicking on workloads that
+// cannot be compared
+func sameWorkload(a, b Workload) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	return va.Type() == vb.Type() && va.Comparable() && va.Equal(vb)
+}
+
+type worker struct {
+	share         atomicFloat
+	stop          chan struct{}
+	lockOSThread  bool
+	workload      Workload
+	sleepStrategy SleepStrategy
+	cpuSet        int   // index of the cpu set the worker is pinned to, -1 when not pinned
+	cpus          []int // the cpus of that set, nil when not pinned
+	id            int64
+	cpuTime       atomic.Int64 // cpu time consumed by the worker thread, when measuring threads
+	cpu           atomic.Int64 // cpu the worker thread last ran on, when measuring threads
+	waitTime      atomic.Int64 // time the worker thread waited for a cpu, when measuring threads
+}
+
+func newPool(ctx context.Context, logger *slog.Logger, cpus float64, settings workerSettings, opts poolOptions) *pool {
+	p := &pool{
+		logger:   logger,
+		ctx:      ctx,
+		opts:     opts,
+		settings: settings,
+		target:   cpus,
+		targetAt: time.Now(),
+	}
+	p.scale.Store(1)
+	p.workUnit.Store(int64(opts.workUnit))
+	p.mu.Lock()
+	p.resize(p.minWorkers(cpus))
+	p.mu.Unlock()
+	return p
+}
+
+// minWorkers is the least amount of workers that can burn the given amount of cpus, each one
+// burning at most maxShare. When the load is shaped there is always one worker per cpu set
+func (p *pool) minWorkers(cpus float64) int {
+	if p.opts.weights != nil {
+		return len(p.opts.weights)
+	}
+	// round away floating point noise, so eg 0.9/0.9 does not take 2 workers
+	return max(1, int(math.Ceil(math.Round(cpus/p.maxShare()*1e9)/1e9)))
+}
+
+// maxShare is the most a single worker can burn: a whole cpu, less what the hypervisor steals
+func (p *pool) maxShare() float64 {
+	return 1 - p.steal.Load()
+}
+
+// SetSteal changes the fraction of cpu time the hypervisor steals, spawning the workers needed to
+// make up for it
+func (p *pool) SetSteal(fraction float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steal.Store(fraction)
+	n := p.minWorkers(p.target)
+	if p.opts.churn {
+		n = min(max(len(p.workers), n), 2*n)
+	}
+	p.resize(n)
+}
+
+// Target returns the aggregate amount of cpus the pool is currently burning
+func (p *pool) Target() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.target
+}
+
+// TargetSeconds returns the targets applied since the pool was created integrated over time up to
+// the given time, in cpu seconds
+func (p *pool) TargetSeconds(until time.Time) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.targetSeconds + p.target*max(0, until.Sub(p.targetAt)).Seconds()
+}
+
+// SetTarget changes the aggregate amount of cpus to burn, spawning or reaping workers as needed.
+// When churning, the current amount of workers is kept as long as it is within the churn bounds
+func (p *pool) SetTarget(cpus float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.targetSeconds += p.target * now.Sub(p.targetAt).Seconds()
+	p.target, p.targetAt = cpus, now
+	n := p.minWorkers(cpus)
+	if p.opts.churn {
+		n = min(max(len(p.workers), n), 2*n)
+	}
+	p.resize(n)
+}
+
+// LockOSThread returns whether new workers lock themselves to an OS thread
+func (p *pool) LockOSThread() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.settings.lockOSThread
+}
+
+// CPUSets returns the sets of cpus new workers are pinned to, nil when they are not pinned
+func (p *pool) CPUSets() [][]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.settings.cpuSets
+}
+
+// SetWorkerSettings changes how workers burn. As locking to an OS thread and pinning can only be
+// done by a goroutine to itself, all workers are replaced by new ones when the settings change
+func (p *pool) SetWorkerSettings(settings workerSettings) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.settings.equal(settings) {
+		return
+	}
+	p.settings = settings
+	n := len(p.workers)
+	p.resize(0)
+	p.resize(n)
+}
+
+// Shares returns the share of each worker currently alive
+func (p *pool) Shares() []float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	shares := make([]float64, len(p.workers))
+	for i, w := range p.workers {
+		shares[i] = w.share.Load()
+	}
+	return shares
+}
+
+// Threads returns the share and the cpu time consumed by each worker currently alive. Only
+// available when measuring threads
+func (p *pool) Threads() []ThreadStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.opts.threads {
+		return nil
+	}
+	threads := make([]ThreadStats, len(p.workers))
+	for i, w := range p.workers {
+		threads[i] = ThreadStats{
+			Worker:   w.id,
+			Share:    w.share.Load(),
+			CPUTime:  time.Duration(w.cpuTime.Load()),
+			CPU:      int(w.cpu.Load()),
+			WaitTime: time.Duration(w.waitTime.Load()),
+		}
+	}
+	return threads
+}
+
+// WorkerStates returns how each worker currently alive burns
+func (p *pool) WorkerStates() []WorkerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	states := make([]WorkerState, len(p.workers))
+	for i, w := range p.workers {
+		states[i] = WorkerState{
+			ID:            w.id,
+			Share:         w.share.Load(),
+			CPUs:          w.cpus,
+			LockOSThread:  w.lockOSThread,
+			Workload:      w.workload,
+			SleepStrategy: w.sleepStrategy,
+			CPU:           -1,
+		}
+		if p.opts.threads {
+			states[i].CPUTime = time.Duration(w.cpuTime.Load())
+			states[i].CPU = int(w.cpu.Load())
+			states[i].WaitTime = time.Duration(w.waitTime.Load())
+		}
+	}
+	return states
+}
+
+// Workers returns how many workers are currently alive
+func (p *pool) Workers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+// Churn spawns or reaps a single worker at random, redistributing shares so the aggregate load
+// stays the same. The amount of workers is kept between the minimum needed to burn the target
+// and twice that
+func (p *pool) Churn() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opts.weights != nil {
+		return
+	}
+	minCount := p.minWorkers(p.target)
+	maxCount := 2 * minCount
+	n := len(p.workers)
+	switch {
+	case n <= minCount:
+		n++
+	case n >= maxCount:
+		n--
+	case rand.IntN(2) == 0:
+		n++
+	default:
+		n--
+	}
+	p.resize(n)
+}
+
+// Wait blocks until all workers exited, which happens once the pool context is done
+func (p *pool) Wait() {
+	p.wg.Wait()
+}
+
+// resize spawns or reaps workers until there are exactly n of them, then rebalances shares.
+// Reaped workers are picked at random. Must be called with p.mu held
+func (p *pool) resize(n int) {
+	for len(p.workers) < n {
+		w := &worker{
+			stop:          make(chan struct{}),
+			lockOSThread:  p.settings.lockOSThread || p.opts.threads || p.opts.isolated,
+			workload:      p.settings.workload,
+			sleepStrategy: p.settings.sleepStrategy,
+			cpuSet:        p.emptiestCPUSet(),
+		}
+		if w.cpuSet >= 0 {
+			w.cpus = p.settings.cpuSets[w.cpuSet]
+		}
+		w.id = p.spawned.Add(1)
+		p.workers = append(p.workers, w)
+		p.wg.Add(1)
+		go p.run(w)
+	}
+	for len(p.workers) > n {
+		i := rand.IntN(len(p.workers))
+		close(p.workers[i].stop)
+		p.workers = append(p.workers[:i], p.workers[i+1:]...)
+		p.reaped.Add(1)
+	}
+	p.rebalance()
+}
+
+// emptiestCPUSet returns the cpu set with the least workers pinned to it, so workers end up spread
+// evenly between sets. Returns -1 when workers are not pinned. Must be called with p.mu held
+func (p *pool) emptiestCPUSet() int {
+	if len(p.settings.cpuSets) == 0 {
+		return -1
+	}
+	counts := make([]int, len(p.settings.cpuSets))
+	for _, w := range p.workers {
+		counts[w.cpuSet]++
+	}
+	emptiest := 0
+	for i, count := range counts {
+		if count < counts[emptiest] {
+			emptiest = i
+		}
+	}
+	return emptiest
+}
+
+// rebalance distributes the target between workers. When the load is shaped each worker burns the
+// fraction of its cpu set. Otherwise, when running with the minimum amount of workers all but one
+// will be running all the time, and the target is split evenly if there are more. Must be called
+// with p.mu held
+func (p *pool) rebalance() {
+	n := len(p.workers)
+	if p.opts.weights != nil {
+		total := 0.0
+		for _, weight := range p.opts.weights {
+			total += weight
+		}
+		for _, w := range p.workers {
+			p.setShare(w, min(p.maxShare(), p.target*p.opts.weights[w.cpuSet]/total))
+		}
+		return
+	}
+	if n == p.minWorkers(p.target) {
+		work := p.target
+		for _, w := range p.workers {
+			share := min(p.maxShare(), work)
+			work -= share
+			p.setShare(w, share)
+		}
+		return
+	}
+	for _, w := range p.workers {
+		p.setShare(w, p.target/float64(n))
+	}
+}
+
+// setShare changes the share of a worker, logging how it splits its work units when it changes
+func (p *pool) setShare(w *worker, share float64) {
+	if w.share.Swap(share) == share {
+		return
+	}
+	workUnit := p.WorkUnit()
+	runFor := min(workUnit, time.Duration(float64(workUnit)*share*p.scale.Load()))
+	p.logger.Debug("worker duty cycle", "pid", os.Getpid(), "worker", w.id, "share", share,
+		"run_us", runFor.Microseconds(), "sleep_us", (workUnit - runFor).Microseconds())
+}
+
+func (p *pool) run(w *worker) {
+	defer p.wg.Done()
+	if w.cpuSet >= 0 || p.opts.priority != nil {
+		// affinity and priority are properties of the OS thread, so the worker has to stay on it.
+		// The thread is never unlocked, which makes the runtime terminate it once the worker exits
+		// instead of handing it to other goroutines
+		runtime.LockOSThread()
+		if w.cpuSet >= 0 {
+			if err := pinThread(w.cpus); err != nil {
+				p.logger.Error("failed to pin worker to cpuset", "pid", os.Getpid(), "cpuset", w.cpus, "error", err)
+			}
+		}
+		if p.opts.priority != nil {
+			if err := setThreadPriority(0, *p.opts.priority); err != nil {
+				p.logger.Error("failed to set worker priority", "pid", os.Getpid(), "error", err)
+			}
+		}
+	} else if w.lockOSThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	var threadStart, waitStart int64
+	if p.opts.threads {
+		threadStart = threadCPUTime()
+		w.cpu.Store(-1)
+		_, waitStart, _ = threadSched()
+	}
+	var consumedUntil int64
+	if p.opts.isolated {
+		consumedUntil = threadCPUTime()
+		defer func() { p.consumed.Add(threadCPUTime() - consumedUntil) }()
+	}
+	sleeper := sleeper{strategy: w.sleepStrategy}
+	var iterations int64 = 1
+	// idle time owed from work units whose idle part was too short to sleep through
+	var owed time.Duration
+	for {
+		workUnit := p.WorkUnit()
+		// stolen time passes while running without being consumed, so the worker runs longer
+		runFor := min(workUnit, time.Duration(float64(workUnit)*w.share.Load()*p.scale.Load()/p.maxShare()))
+		sleepFor := workUnit - runFor
+
+		if runFor > 0 {
+			w.workload.Burn(time.Now().Add(runFor))
+		}
+		// a locked worker sleeping only a few microseconds at a time can keep other goroutines
+		// from ever running when there is a single P, so short idle parts add up into a longer
+		// sleep instead
+		if owed += sleepFor; owed >= minSleep {
+			slept := sleeper.Sleep(owed)
+			if p.opts.adaptive {
+				p.sleeps.Add(1)
+				p.overshoot.Add(int64(slept - owed))
+			}
+			owed = 0
+		}
+		if p.opts.isolated {
+			now := threadCPUTime()
+			p.consumed.Add(now - consumedUntil)
+			consumedUntil = now
+		}
+
+		// check the context every 100ms or so, however long the work unit is
+		checkEvery := max(1, int64(checkContextEvery/workUnit))
+
+		// listen for ctx.Done() every few iterations to avoid doing it too often
+		if iterations%checkEvery == 0 {
+			if p.opts.threads {
+				w.cpuTime.Store(threadCPUTime() - threadStart)
+				if cpu, wait, ok := threadSched(); ok {
+					w.cpu.Store(int64(cpu))
+					w.waitTime.Store(wait - waitStart)
+				}
+			}
+			select {
+			case <-p.ctx.Done():
+				return
+			default:
+			}
+		}
+		// reaped workers stop right away, as their replacement may already be burning their share
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		iterations++
+	}
+}
+
+// WorkUnit returns the current period of the duty cycle of workers
+func (p *pool) WorkUnit() time.Duration {
+	return time.Duration(p.workUnit.Load())
+}
+
+// adaptWorkUnit periodically resizes the work unit according to how much sleeps overshoot. Every
+// overshoot makes workers burn a bit less than their share, which the controller can only make up
+// for to a point, and is proportionally smaller on longer work units. Short work units are kept
+// when sleeps are accurate, as they spread the load more evenly over time
+func (p *pool) adaptWorkUnit() {
+	ticker := time.NewTicker(adaptWorkUnitEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sleeps, overshoot := p.sleeps.Swap(0), p.overshoot.Swap(0)
+		if sleeps == 0 {
+			// every worker burns all the time, nothing to measure
+			continue
+		}
+		workUnit := p.WorkUnit()
+		meanOvershoot := time.Duration(overshoot / sleeps)
+		ratio := float64(meanOvershoot) / float64(workUnit)
+		newWorkUnit := workUnit
+		if ratio > growWorkUnitAbove {
+			newWorkUnit = min(maxWorkUnit, workUnit*2)
+		} else if ratio < shrinkWorkUnitBelow {
+			newWorkUnit = max(minWorkUnit, workUnit/2)
+		}
+		if newWorkUnit != workUnit {
+			p.logger.Info("work unit changed", "pid", os.Getpid(), "work_unit_us", newWorkUnit.Microseconds(), "sleep_overshoot_us", meanOvershoot.Microseconds())
+			p.workUnit.Store(int64(newWorkUnit))
+		}
+	}
+}
+
+const adaptWorkUnitEvery = time.Second
+const minWorkUnit = 100 * time.Microsecond // lower bound of the adaptive work unit
+const maxWorkUnit = 50 * time.Millisecond  // upper bound of the adaptive work unit
+const growWorkUnitAbove = 0.05             // double the work unit when sleeps overshoot by more than 5% of it
+const shrinkWorkUnitBelow = 0.01           // halve the work unit when sleeps overshoot by less than 1% of it
+
+// cpuTime returns the cpu time consumed so far by the worker threads when isolated, or by the
+// whole process otherwise
+func (p *pool) cpuTime() int64 {
+	if p.opts.isolated {
+		return p.consumed.Load()
+	}
+	return CPUTime()
+}
+
+// adjust periodically compares the actual cpu usage (which is global to the process unless
+// isolated) with the target and tweaks the scale correction factor accordingly. Only workers not
+// running all the time are affected by it
+func (p *pool) adjust() {
+	every := p.adjustEvery()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	pid := pidController{}
+	previousCPUTime := p.cpuTime()
+	previousWallTime := time.Now()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		currentCPUTime := p.cpuTime()
+		currentWallTime := time.Now()
+		interval := currentWallTime.Sub(previousWallTime)
+		actualCPUs := float64(currentCPUTime-previousCPUTime) / float64(interval)
+		previousCPUTime = currentCPUTime
+		previousWallTime = currentWallTime
+		stopped := interval > 2*every
+		// follow the work unit as it adapts, keeping enough cycles in every window
+		if newEvery := p.adjustEvery(); newEvery != every {
+			every = newEvery
+			ticker.Reset(every)
+		}
+		if stopped {
+			// the process was most likely stopped, eg by SIGSTOP, which says nothing about the timings
+			continue
+		}
+
+		p.mu.Lock()
+		cpus := p.target
+		fractional := false
+		for _, w := range p.workers {
+			if share := w.share.Load(); share > 0 && share < 1 {
+				fractional = true
+			}
+		}
+		p.mu.Unlock()
+		if !fractional {
+			continue
+		}
+
+		scale := p.scale.Load()
+		newScale := scale
+		delta := actualCPUs - cpus
+		p.controllerError.Store(-delta / cpus)
+		p.logger.Log(p.ctx, LevelTrace, "controller window", "pid", os.Getpid(), "interval_ms", interval.Milliseconds(),
+			"cpus", actualCPUs, "target", cpus, "scale", scale)
+		switch p.opts.controller {
+		case ControllerPID:
+			newScale = pid.update(-delta/cpus, interval)
+			p.controllerIntegral.Store(pid.integral)
+		default:
+			if delta < -cpus*detectionFactor {
+				newScale = scale * (1 + adjustmentFactor)
+			} else if delta > cpus*detectionFactor {
+				newScale = scale * (1 - adjustmentFactor)
+			}
+		}
+		newScale = min(maxScale, max(minScale, newScale))
+		if newScale != scale {
+			p.logger.Debug("adjusting burn timings", "pid", os.Getpid(), "scale", scale, "new_scale", newScale)
+			p.scale.Store(newScale)
+		}
+	}
+}
+
+// adjustEvery returns how long the adjustment windows of the controller last for the current work
+// unit, as long work units need a longer window to measure enough cycles
+func (p *pool) adjustEvery() time.Duration {
+	return max(adjustTimingsEvery, p.WorkUnit()*minAdjustmentCycles)
+}
+
+// LevelTrace is the log level below slog.LevelDebug that the pool logs every adjustment window of
+// the controller at, too often to be useful unless following it step by step
+const LevelTrace = slog.LevelDebug - 4
+
+const adjustTimingsEvery = 100 * time.Millisecond
+const minAdjustmentCycles = 10 // least amount of work units measured before adjusting timings
+const checkContextEvery = 100 * time.Millisecond
+const minScale = 0.5          // lower bound for the run time correction factor
+const maxScale = 2.0          // upper bound for the run time correction factor
+const detectionFactor = 0.005 // if actual cpu usage is off by more than .5% from the target, adjust sleep and run times
+const adjustmentFactor = 0.01 // when adjusting sleep and run times, adjust them by 1% (eg if sleepFor is 100ms and we need to increase it, we will increase it to 101ms)
+
+// minSleep is the shortest idle part workers sleep through, see pool.run
+const minSleep = 50 * time.Microsecond
+
+// atomicFloat is a float64 that can be safely shared between goroutines
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func (f *atomicFloat) Store(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+func (f *atomicFloat) Swap(value float64) float64 {
+	return math.Float64frombits(f.bits.Swap(math.Float64bits(value)))
+}
@@ -0,0 +1,111 @@
+package burn
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// powerLanes is how many float64 accumulators the power kernel keeps going: 10 chains of 4 lane
+// vectors, enough to cover the latency of fused multiply-adds on both vector units of a core
+const powerLanes = 40
+
+// powerChunk is how many float64 the power kernel copies between checks of the time
+const powerChunk = 16384
+
+// defaultPowerSize is the size of the buffers each worker copies through, well over the last level
+// cache so the copy reaches memory
+const defaultPowerSize = 32 << 20
+
+// the accumulators converge to 1 and stay there, never going denormal, which is much slower
+const powerMul, powerAdd = 0.999999, 0.000001
+
+// powerSink keeps the results of the power kernel alive so the compiler cannot drop it
+var powerSink atomic.Uint64
+
+// Power burns as much power as it can: each worker keeps both vector units of its core busy with
+// wide fused multiply-adds while copying through buffers too large for cpu caches, loading the
+// cores, caches and memory controller all at once. It is meant for facility and thermal testing
+// and may draw more than the cooling handles, throttling or even shutting down the host
+type Power struct {
+	flops  atomic.Int64
+	moved  atomic.Int64
+	size   int
+	states chan *powerState
+}
+
+type powerState struct {
+	acc      [powerLanes]float64
+	src, dst []float64
+	pos      int
+}
+
+// maxPowerStates bounds how many idle worker states are kept around for reuse
+const maxPowerStates = 1024
+
+func NewPower() *Power {
+	return &Power{size: defaultPowerSize / 8, states: make(chan *powerState, maxPowerStates)}
+}
+
+func (p *Power) Burn(until time.Time) {
+	// workers take a state while burning, so each buffer has a single worker copying through it
+	var state *powerState
+	select {
+	case state = <-p.states:
+	default:
+		state = &powerState{src: make([]float64, p.size), dst: make([]float64, p.size)}
+		for i := range state.acc {
+			state.acc[i] = float64(i)
+		}
+		for i := range state.src {
+			state.src[i] = 1
+		}
+	}
+	defer func() {
+		select {
+		case p.states <- state:
+		default:
+		}
+	}()
+	var iterations, moved int64
+	for time.Now().Before(until) {
+		end := min(state.pos+powerChunk, len(state.src))
+		iterations += powerKernel(&state.acc, state.src[state.pos:end], state.dst[state.pos:end])
+		moved += 16 * int64(end-state.pos)
+		state.pos = end
+		if state.pos == len(state.src) {
+			state.pos = 0
+		}
+	}
+	var sum float64
+	for _, v := range state.acc {
+		sum += v
+	}
+	powerSink.Store(math.Float64bits(sum))
+	// every iteration runs a fused multiply-add, two floating point operations, on every lane
+	p.flops.Add(2 * powerLanes * iterations)
+	p.moved.Add(moved)
+}
+
+// Ops returns how many floating point operations were made so far
+func (p *Power) Ops() int64 {
+	return p.flops.Load()
+}
+
+// Moved returns how many bytes were read and written so far
+func (p *Power) Moved() int64 {
+	return p.moved.Load()
+}
+
+// powerKernelGeneric is the power kernel for cpus without wide vector units the kernel knows of,
+// leaving vectorization to the compiler
+func powerKernelGeneric(acc *[powerLanes]float64, src, dst []float64) int64 {
+	n := len(src) / 4
+	for i := range n {
+		copy(dst[i*4:i*4+4], src[i*4:i*4+4])
+		for j := range acc {
+			acc[j] = math.FMA(acc[j], powerMul, powerAdd)
+		}
+	}
+	return int64(n)
+}
@@ -0,0 +1,24 @@
+package burn
+
+import "golang.org/x/sys/cpu"
+
+// powerVector tells whether the power kernel can use avx2 fused multiply-adds
+var powerVector = cpu.X86.HasAVX2 && cpu.X86.HasFMA
+
+// powerKernel copies src into dst, which must be as long, running a step of every accumulator
+// chain for each 4 float64 copied. Returns how many steps it ran
+func powerKernel(acc *[powerLanes]float64, src, dst []float64) int64 {
+	if !powerVector {
+		return powerKernelGeneric(acc, src, dst)
+	}
+	n := len(src) / 4
+	if n > 0 {
+		powerAVX2(acc, src[:n*4], dst[:n*4])
+	}
+	return int64(n)
+}
+
+// powerAVX2 is powerKernel for cpus with avx2 and fma, for src lengths multiple of 4
+//
+//go:noescape
+func powerAVX2(acc *[powerLanes]float64, src, dst []float64)
@@ -0,0 +1,58 @@
+#include "textflag.h"
+
+DATA powerMul<>+0(SB)/8, $0.999999
+GLOBL powerMul<>(SB), RODATA|NOPTR, $8
+DATA powerAdd<>+0(SB)/8, $0.000001
+GLOBL powerAdd<>(SB), RODATA|NOPTR, $8
+
+// func powerAVX2(acc *[powerLanes]float64, src, dst []float64)
+TEXT ·powerAVX2(SB), NOSPLIT, $0-56
+	MOVQ acc+0(FP), AX
+	MOVQ src_base+8(FP), SI
+	MOVQ src_len+16(FP), CX
+	MOVQ dst_base+32(FP), DI
+	SHRQ $2, CX
+	VBROADCASTSD powerMul<>(SB), Y14
+	VBROADCASTSD powerAdd<>(SB), Y15
+	VMOVUPD 0(AX), Y0
+	VMOVUPD 32(AX), Y1
+	VMOVUPD 64(AX), Y2
+	VMOVUPD 96(AX), Y3
+	VMOVUPD 128(AX), Y4
+	VMOVUPD 160(AX), Y5
+	VMOVUPD 192(AX), Y6
+	VMOVUPD 224(AX), Y7
+	VMOVUPD 256(AX), Y8
+	VMOVUPD 288(AX), Y9
+
+loop:
+	// each accumulator becomes acc*mul + add, 4 lanes at a time, while 32 bytes are copied
+	VMOVUPD (SI), Y10
+	VFMADD213PD Y15, Y14, Y0
+	VFMADD213PD Y15, Y14, Y1
+	VFMADD213PD Y15, Y14, Y2
+	VFMADD213PD Y15, Y14, Y3
+	VFMADD213PD Y15, Y14, Y4
+	VMOVUPD Y10, (DI)
+	VFMADD213PD Y15, Y14, Y5
+	VFMADD213PD Y15, Y14, Y6
+	VFMADD213PD Y15, Y14, Y7
+	VFMADD213PD Y15, Y14, Y8
+	VFMADD213PD Y15, Y14, Y9
+	ADDQ $32, SI
+	ADDQ $32, DI
+	DECQ CX
+	JNZ loop
+
+	VMOVUPD Y0, 0(AX)
+	VMOVUPD Y1, 32(AX)
+	VMOVUPD Y2, 64(AX)
+	VMOVUPD Y3, 96(AX)
+	VMOVUPD Y4, 128(AX)
+	VMOVUPD Y5, 160(AX)
+	VMOVUPD Y6, 192(AX)
+	VMOVUPD Y7, 224(AX)
+	VMOVUPD Y8, 256(AX)
+	VMOVUPD Y9, 288(AX)
+	VZEROUPPER
+	RET
@@ -0,0 +1,9 @@
+//go:build !amd64
+
+package burn
+
+// powerKernel copies src into dst, which must be as long, running a step of every accumulator
+// chain for each 4 float64 copied. Returns how many steps it ran
+func powerKernel(acc *[powerLanes]float64, src, dst []float64) int64 {
+	return powerKernelGeneric(acc, src, dst)
+}
@@ -0,0 +1,30 @@
+package burn
+
+// SchedPolicy is the linux scheduling policy of the OS threads burning cpu
+type SchedPolicy string
+
+const (
+	// SchedOther is the default time sharing policy, where threads get cpu time according to their
+	// niceness
+	SchedOther SchedPolicy = "other"
+	// SchedBatch shares time like SchedOther, but is preempted less often, as suits cpu bound work
+	SchedBatch SchedPolicy = "batch"
+	// SchedIdle only runs when cpus would otherwise be idle
+	SchedIdle SchedPolicy = "idle"
+	// SchedFIFO is a realtime policy: threads run until they block or a thread with a higher
+	// realtime priority becomes runnable
+	SchedFIFO SchedPolicy = "fifo"
+	// SchedRR is like SchedFIFO, but threads with the same realtime priority take turns
+	SchedRR SchedPolicy = "rr"
+)
+
+// Priority is the scheduling priority of OS threads. Only niceness is supported outside of linux
+type Priority struct {
+	// Policy defaults to SchedOther
+	Policy SchedPolicy
+	// Nice goes from -20, the highest priority, to 19, the lowest. Only used by SchedOther and
+	// SchedBatch
+	Nice int
+	// RealtimePriority goes from 1, the lowest, to 99. Only used by SchedFIFO and SchedRR
+	RealtimePriority int
+}
@@ -0,0 +1,52 @@
+package burn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetProcessPriority sets the scheduling priority of every OS thread of the process. Threads
+// created afterwards inherit it from the thread creating them
+func SetProcessPriority(p Priority) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		// threads can exit while being iterated
+		if err := setThreadPriority(tid, p); err != nil && !errors.Is(err, unix.ESRCH) {
+			return err
+		}
+	}
+	return nil
+}
+
+// setThreadPriority sets the scheduling priority of the given OS thread, 0 being the calling one
+func setThreadPriority(tid int, p Priority) error {
+	attr := unix.SchedAttr{Nice: int32(p.Nice)}
+	switch p.Policy {
+	case SchedOther, "":
+		attr.Policy = unix.SCHED_NORMAL
+	case SchedBatch:
+		attr.Policy = unix.SCHED_BATCH
+	case SchedIdle:
+		attr.Policy = unix.SCHED_IDLE
+	case SchedFIFO:
+		attr.Policy = unix.SCHED_FIFO
+		attr.Priority = uint32(p.RealtimePriority)
+	case SchedRR:
+		attr.Policy = unix.SCHED_RR
+		attr.Priority = uint32(p.RealtimePriority)
+	default:
+		return fmt.Errorf("unknown scheduling policy %q", p.Policy)
+	}
+	return unix.SchedSetAttr(tid, &attr, 0)
+}
@@ -0,0 +1,23 @@
+//go:build unix && !linux
+
+package burn
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetProcessPriority sets the niceness of the process, which outside of linux applies to all of
+// its threads. Scheduling policies are only supported on linux
+func SetProcessPriority(p Priority) error {
+	if p.Policy != "" && p.Policy != SchedOther {
+		return errors.New("scheduling policies are only supported on linux")
+	}
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, p.Nice)
+}
+
+// setThreadPriority has nothing to do, as the niceness is shared by all threads of the process
+func setThreadPriority(tid int, p Priority) error {
+	return nil
+}
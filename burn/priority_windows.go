@@ -0,0 +1,13 @@
+package burn
+
+import "errors"
+
+// SetProcessPriority is not supported on windows
+func SetProcessPriority(p Priority) error {
+	return errors.New("scheduling priorities are not supported on windows")
+}
+
+// setThreadPriority is not supported on windows
+func setThreadPriority(tid int, p Priority) error {
+	return errors.New("scheduling priorities are not supported on windows")
+}
@@ -0,0 +1,419 @@
+package burn
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Profile computes the burn target, in cpus, at a given point of the run
+type Profile interface {
+	Target(elapsed time.Duration) float64
+}
+
+// Phased is implemented by profiles made of a sequence of phases, each of which can override some
+// of the burn options
+type Phased interface {
+	Phase(elapsed time.Duration) (int, PhaseOptions)
+}
+
+// PhaseOptions are burn options a phase can override. nil and empty values keep the Options
+// setting. Workers are replaced by new ones when entering a phase that burns differently
+type PhaseOptions struct {
+	Name          string
+	LockOSThread  *bool
+	Workload      Workload
+	SleepStrategy SleepStrategy
+	// CPUSets pins the workers of the phase as Options.CPUSets does, where an empty non nil slice
+	// leaves them unpinned. Ignored when the load is shaped by Options.Cores
+	CPUSets [][]int
+}
+
+// Wrapper is implemented by profiles that modify another profile
+type Wrapper interface {
+	Unwrap() Profile
+}
+
+// FindPhased looks for a Phased profile, unwrapping profiles as needed
+func FindPhased(profile Profile) (Phased, bool) {
+	for {
+		if p, ok := profile.(Phased); ok {
+			return p, true
+		}
+		w, ok := profile.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		profile = w.Unwrap()
+	}
+}
+
+// Constant is a profile that always burns the same amount of cpus
+type Constant float64
+
+func (c Constant) Target(time.Duration) float64 {
+	return float64(c)
+}
+
+// Sine is a profile that smoothly oscillates between Min and Max, starting at Min
+type Sine struct {
+	Min    float64
+	Max    float64
+	Period time.Duration
+}
+
+func (s Sine) Target(elapsed time.Duration) float64 {
+	phase := 2 * math.Pi * float64(elapsed) / float64(s.Period)
+	return s.Min + (s.Max-s.Min)*(1-math.Cos(phase))/2
+}
+
+const randomWalkStepFactor = 0.1 // each random walk step moves the target by up to 10% of the min-max range
+
+// RandomWalk is a profile that drifts randomly between min and max, taking a step every stepEvery.
+// The walk is fully determined by the seed so runs can be reproduced. Not safe for concurrent use
+type RandomWalk struct {
+	min       float64
+	max       float64
+	stepEvery time.Duration
+	rand      *rand.Rand
+
+	steps   int64
+	current float64
+}
+
+func NewRandomWalk(min float64, max float64, stepEvery time.Duration, seed uint64) *RandomWalk {
+	return &RandomWalk{
+		min:       min,
+		max:       max,
+		stepEvery: stepEvery,
+		rand:      rand.New(rand.NewPCG(seed, seed)),
+		current:   (min + max) / 2,
+	}
+}
+
+func (w *RandomWalk) Target(elapsed time.Duration) float64 {
+	for steps := int64(elapsed / w.stepEvery); w.steps < steps; w.steps++ {
+		step := (w.rand.Float64()*2 - 1) * randomWalkStepFactor * (w.max - w.min)
+		w.current += step
+		// reflect on the bounds so the walk does not get stuck on them
+		if w.current > w.max {
+			w.current = 2*w.max - w.current
+		}
+		if w.current < w.min {
+			w.current = 2*w.min - w.current
+		}
+	}
+	return w.current
+}
+
+// RandomRange is a profile that picks a new target uniformly between min and max every changeEvery.
+// The targets are fully determined by the seed so runs can be reproduced. Not safe for concurrent use
+type RandomRange struct {
+	min         float64
+	max         float64
+	changeEvery time.Duration
+	rand        *rand.Rand
+
+	changes int64
+	current float64
+}
+
+func NewRandomRange(min float64, max float64, changeEvery time.Duration, seed uint64) *RandomRange {
+	r := &RandomRange{
+		min:         min,
+		max:         max,
+		changeEvery: changeEvery,
+		rand:        rand.New(rand.NewPCG(seed, seed)),
+	}
+	r.current = r.roll()
+	return r
+}
+
+func (r *RandomRange) Target(elapsed time.Duration) float64 {
+	for changes := int64(elapsed / r.changeEvery); r.changes < changes; r.changes++ {
+		r.current = r.roll()
+	}
+	return r.current
+}
+
+func (r *RandomRange) roll() float64 {
+	return r.min + r.rand.Float64()*(r.max-r.min)
+}
+
+// Poisson is a profile burning base, plus size for every burst in progress. Bursts last length and
+// arrive as a Poisson process averaging rate bursts per second, so they may overlap and stack. The
+// arrivals are fully determined by the seed so runs can be reproduced. Not safe for concurrent use
+type Poisson struct {
+	base   float64
+	size   float64
+	length time.Duration
+	rate   float64
+	rand   *rand.Rand
+
+	next     time.Duration   // when the next burst arrives
+	arrivals []time.Duration // bursts that may still be in progress
+}
+
+func NewPoisson(base float64, size float64, length time.Duration, rate float64, seed uint64) *Poisson {
+	p := &Poisson{
+		base:   base,
+		size:   size,
+		length: length,
+		rate:   rate,
+		rand:   rand.New(rand.NewPCG(seed, seed)),
+	}
+	p.next = p.interval()
+	return p
+}
+
+func (p *Poisson) Target(elapsed time.Duration) float64 {
+	for ; p.next <= elapsed; p.next += p.interval() {
+		p.arrivals = append(p.arrivals, p.next)
+	}
+	// arrivals are in order, bursts that ended are dropped from the front
+	for len(p.arrivals) > 0 && p.arrivals[0]+p.length <= elapsed {
+		p.arrivals = p.arrivals[1:]
+	}
+	return p.base + float64(len(p.arrivals))*p.size
+}
+
+// interval draws the time until the next burst, exponentially distributed
+func (p *Poisson) interval() time.Duration {
+	return time.Duration(p.rand.ExpFloat64() / p.rate * float64(time.Second))
+}
+
+// Step is a single burn level of a Steps profile
+type Step struct {
+	CPUs     float64
+	Duration time.Duration
+	Options  PhaseOptions
+}
+
+// Steps is a profile running a sequence of burn levels, each one for a given duration. The last
+// level is kept if the run outlasts the sequence
+type Steps []Step
+
+func (s Steps) Target(elapsed time.Duration) float64 {
+	for _, step := range s {
+		if elapsed < step.Duration {
+			return step.CPUs
+		}
+		elapsed -= step.Duration
+	}
+	return s[len(s)-1].CPUs
+}
+
+func (s Steps) Phase(elapsed time.Duration) (int, PhaseOptions) {
+	for i, step := range s {
+		if elapsed < step.Duration {
+			return i, step.Options
+		}
+		elapsed -= step.Duration
+	}
+	return len(s) - 1, s[len(s)-1].Options
+}
+
+// Duration is how long it takes to go through all steps
+func (s Steps) Duration() time.Duration {
+	var total time.Duration
+	for _, step := range s {
+		total += step.Duration
+	}
+	return total
+}
+
+// MarkovState is a load state of a Markov profile
+type MarkovState struct {
+	CPUs float64
+	// how long the state lasts once entered, picked uniformly between both. Equal for a fixed dwell
+	MinDwell time.Duration
+	MaxDwell time.Duration
+	// probability of moving to every state once the dwell is over, by index, adding up to 1. The
+	// state is kept for good when empty
+	Next    []float64
+	Options PhaseOptions
+}
+
+// Markov is a profile switching between load states, each held for its dwell time before moving on
+// to the next one drawn from its transition probabilities. Phases are the states. The switches are
+// fully determined by the seed so runs can be reproduced. Not safe for concurrent use
+type Markov struct {
+	states []MarkovState
+	rand   *rand.Rand
+
+	current int
+	until   time.Duration // when the current state is over
+}
+
+func NewMarkov(states []MarkovState, initial int, seed uint64) *Markov {
+	m := &Markov{states: states, rand: rand.New(rand.NewPCG(seed, seed)), current: initial}
+	m.until = m.dwell()
+	return m
+}
+
+func (m *Markov) Target(elapsed time.Duration) float64 {
+	m.advance(elapsed)
+	return m.states[m.current].CPUs
+}
+
+func (m *Markov) Phase(elapsed time.Duration) (int, PhaseOptions) {
+	m.advance(elapsed)
+	return m.current, m.states[m.current].Options
+}
+
+// Duration is always 0, as the states switch on until the run is over
+func (m *Markov) Duration() time.Duration {
+	return 0
+}
+
+func (m *Markov) advance(elapsed time.Duration) {
+	for m.until <= elapsed {
+		next := m.states[m.current].Next
+		if len(next) == 0 {
+			m.until = math.MaxInt64
+			return
+		}
+		draw := m.rand.Float64()
+		for i, probability := range next {
+			if probability <= 0 {
+				continue
+			}
+			// rounding may leave the draw a bit over the total, which lands on the last possible state
+			m.current = i
+			if draw -= probability; draw < 0 {
+				break
+			}
+		}
+		m.until += m.dwell()
+	}
+}
+
+func (m *Markov) dwell() time.Duration {
+	s := m.states[m.current]
+	if s.MaxDwell <= s.MinDwell {
+		return s.MinDwell
+	}
+	return s.MinDwell + time.Duration(m.rand.Int64N(int64(s.MaxDwell-s.MinDwell)))
+}
+
+// TracePoint is a single sample of a Trace profile
+type TracePoint struct {
+	Offset time.Duration // since the start of the trace
+	CPUs   float64
+}
+
+// Trace is a profile replaying a recorded utilization trace, burning each point from its offset
+// until the next one. Points are sorted by offset, the first one being at 0. The trace ends at
+// End, and the last point is kept if the run outlasts it
+type Trace struct {
+	Points []TracePoint
+	End    time.Duration
+}
+
+func (t Trace) Target(elapsed time.Duration) float64 {
+	i := sort.Search(len(t.Points), func(i int) bool { return t.Points[i].Offset > elapsed })
+	return t.Points[max(0, i-1)].CPUs
+}
+
+func (t Trace) Duration() time.Duration {
+	return t.End
+}
+
+// Burst wraps a profile, alternating between burning it for the On period and staying idle for
+// the Off period
+type Burst struct {
+	Profile Profile
+	On      time.Duration
+	Off     time.Duration
+}
+
+func (b Burst) Unwrap() Profile {
+	return b.Profile
+}
+
+func (b Burst) Target(elapsed time.Duration) float64 {
+	if elapsed%(b.On+b.Off) >= b.On {
+		return 0
+	}
+	return b.Profile.Target(elapsed)
+}
+
+// Ramp wraps a profile, linearly scaling it up from zero during the first Up period of the run and
+// back down to zero during the last Down period of a run lasting Duration
+type Ramp struct {
+	Profile  Profile
+	Up       time.Duration
+	Down     time.Duration
+	Duration time.Duration
+}
+
+func (r Ramp) Unwrap() Profile {
+	return r.Profile
+}
+
+func (r Ramp) Target(elapsed time.Duration) float64 {
+	target := r.Profile.Target(elapsed)
+	factor := 1.0
+	if r.Up > 0 && elapsed < r.Up {
+		factor = float64(elapsed) / float64(r.Up)
+	}
+	if r.Down > 0 && r.Duration > 0 {
+		remaining := r.Duration - elapsed
+		if remaining < r.Down {
+			factor = min(factor, max(0, float64(remaining)/float64(r.Down)))
+		}
+	}
+	return target * factor
+}
+
+// Scale wraps a profile, multiplying its target by Factor. Useful to split a profile between
+// several burners
+type Scale struct {
+	Profile Profile
+	Factor  float64
+}
+
+func (s Scale) Unwrap() Profile {
+	return s.Profile
+}
+
+func (s Scale) Target(elapsed time.Duration) float64 {
+	return s.Profile.Target(elapsed) * s.Factor
+}
+
+// Live is a profile whose target is set while burning, eg to follow a measurement taken
+// elsewhere. Safe for concurrent use
+type Live struct {
+	cpus atomic.Uint64
+}
+
+func NewLive(cpus float64) *Live {
+	l := &Live{}
+	l.Set(cpus)
+	return l
+}
+
+// Set changes the target, which the burner picks up on its next retarget
+func (l *Live) Set(cpus float64) {
+	l.cpus.Store(math.Float64bits(cpus))
+}
+
+func (l *Live) Target(time.Duration) float64 {
+	return math.Float64frombits(l.cpus.Load())
+}
+
+// FindLive looks for a Live profile, unwrapping profiles as needed
+func FindLive(profile Profile) (*Live, bool) {
+	for {
+		if l, ok := profile.(*Live); ok {
+			return l, true
+		}
+		w, ok := profile.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		profile = w.Unwrap()
+	}
+}
@@ -0,0 +1,87 @@
+package burn
+
+import (
+	"testing"
+	"time"
+)
+
+// markovVisit is a state a Markov profile was in, and for how long
+type markovVisit struct {
+	state int
+	dwell time.Duration
+}
+
+// markovVisits steps through a Markov profile every millisecond for the given duration, returning
+// the states it went through. The last one is cut short by the end of the walk
+func markovVisits(m *Markov, duration time.Duration) []markovVisit {
+	var visits []markovVisit
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += time.Millisecond {
+		state, _ := m.Phase(elapsed)
+		if len(visits) == 0 || visits[len(visits)-1].state != state {
+			visits = append(visits, markovVisit{state: state})
+		}
+		visits[len(visits)-1].dwell += time.Millisecond
+	}
+	return visits
+}
+
+func TestMarkov(t *testing.T) {
+	states := []MarkovState{
+		{CPUs: 0.5, MinDwell: 10 * time.Millisecond, MaxDwell: 30 * time.Millisecond, Next: []float64{0, 0.75, 0.25}},
+		{CPUs: 1, MinDwell: 20 * time.Millisecond, MaxDwell: 20 * time.Millisecond, Next: []float64{1, 0, 0}},
+		{CPUs: 2, MinDwell: 5 * time.Millisecond, MaxDwell: 15 * time.Millisecond, Next: []float64{0.5, 0.5, 0}},
+	}
+	visits := markovVisits(NewMarkov(states, 1, 42), 10*time.Second)
+	if len(visits) < 100 {
+		t.Fatalf("%d states visited, want many more", len(visits))
+	}
+	if visits[0].state != 1 {
+		t.Fatalf("started in state %d, want the initial state 1", visits[0].state)
+	}
+	transitions := map[[2]int]int{}
+	for i, visit := range visits[:len(visits)-1] {
+		s := states[visit.state]
+		if visit.dwell < s.MinDwell || visit.dwell > s.MaxDwell {
+			t.Fatalf("state %d held for %v, want between %v and %v", visit.state, visit.dwell, s.MinDwell, s.MaxDwell)
+		}
+		next := visits[i+1].state
+		if s.Next[next] == 0 {
+			t.Fatalf("moved from state %d to %d, which has no probability", visit.state, next)
+		}
+		transitions[[2]int{visit.state, next}]++
+	}
+	// every possible transition is taken, at about its probability
+	from0 := transitions[[2]int{0, 1}] + transitions[[2]int{0, 2}]
+	if share := float64(transitions[[2]int{0, 1}]) / float64(from0); share < 0.65 || share > 0.85 {
+		t.Fatalf("moved from state 0 to 1 %.0f%% of the time, want about 75%%", share*100)
+	}
+	for _, transition := range [][2]int{{0, 1}, {0, 2}, {1, 0}, {2, 0}, {2, 1}} {
+		if transitions[transition] == 0 {
+			t.Fatalf("never moved from state %d to %d", transition[0], transition[1])
+		}
+	}
+
+	// the same seed takes the same path, whatever the targets were asked at
+	again := NewMarkov(states, 1, 42)
+	again.Target(10*time.Second - time.Millisecond)
+	if state, _ := again.Phase(10*time.Second - time.Millisecond); state != visits[len(visits)-1].state {
+		t.Fatalf("state at the end is %d when jumping there, want %d", state, visits[len(visits)-1].state)
+	}
+}
+
+func TestMarkovAbsorbing(t *testing.T) {
+	states := []MarkovState{
+		{CPUs: 1, MinDwell: 10 * time.Millisecond, MaxDwell: 10 * time.Millisecond, Next: []float64{0, 1}},
+		{CPUs: 3, MinDwell: 10 * time.Millisecond, MaxDwell: 10 * time.Millisecond},
+	}
+	m := NewMarkov(states, 0, 1)
+	if target := m.Target(9 * time.Millisecond); target != 1 {
+		t.Fatalf("target during the initial dwell is %v, want 1", target)
+	}
+	// a state without transitions is kept for good
+	for _, elapsed := range []time.Duration{10 * time.Millisecond, time.Second, time.Hour} {
+		if target := m.Target(elapsed); target != 3 {
+			t.Fatalf("target at %v is %v, want 3", elapsed, target)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package burn
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownWorkload is returned by NewWorkload for names nothing was registered under
+var ErrUnknownWorkload = errors.New("unknown workload")
+
+// WorkloadFactory builds a workload, failing if it cannot run on this system
+type WorkloadFactory func() (Workload, error)
+
+var workloads = struct {
+	mu        sync.RWMutex
+	factories map[string]WorkloadFactory
+}{factories: map[string]WorkloadFactory{}}
+
+func init() {
+	RegisterWorkload("spin", func() (Workload, error) { return Spin{}, nil })
+	RegisterWorkload("int", func() (Workload, error) { return NewInt(), nil })
+	RegisterWorkload("float", func() (Workload, error) { return NewFloat(), nil })
+	RegisterWorkload("sha256", func() (Workload, error) { return NewSHA256(), nil })
+	RegisterWorkload("branch", func() (Workload, error) { return NewBranch(), nil })
+}
+
+// RegisterWorkload makes a workload available by name, so new ones can be compiled in without
+// changes to the burner, eg from the init function of a package imported for its side effects.
+// Panics if the name is already taken
+func RegisterWorkload(name string, factory WorkloadFactory) {
+	workloads.mu.Lock()
+	defer workloads.mu.Unlock()
+	if _, found := workloads.factories[name]; found {
+		panic(fmt.Sprintf("workload %s registered twice", name))
+	}
+	workloads.factories[name] = factory
+}
+
+// NewWorkload builds the workload registered under the given name
+func NewWorkload(name string) (Workload, error) {
+	workloads.mu.RLock()
+	factory, found := workloads.factories[name]
+	workloads.mu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWorkload, name)
+	}
+	return factory()
+}
@@ -0,0 +1,49 @@
+package burn
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// threadSched returns the cpu the calling OS thread last ran on and how long it spent waiting for
+// a cpu while runnable so far, in nanoseconds, which grows when its cpu is busy with other work.
+// Returns false when the kernel does not expose them
+func threadSched() (int, int64, bool) {
+	dir := fmt.Sprintf("/proc/self/task/%d", unix.Gettid())
+	// schedstat holds the time spent on a cpu, the time spent waiting on a run queue and the
+	// amount of time slices run
+	schedstat, err := os.ReadFile(dir + "/schedstat")
+	if err != nil {
+		return 0, 0, false
+	}
+	fields := strings.Fields(string(schedstat))
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+	wait, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	stat, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return 0, 0, false
+	}
+	// the cpu is the 39th field, counted from the end of the command name which may have spaces
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return 0, 0, false
+	}
+	fields = strings.Fields(string(stat[end+1:]))
+	if len(fields) < 37 {
+		return 0, 0, false
+	}
+	cpu, err := strconv.Atoi(fields[36])
+	if err != nil {
+		return 0, 0, false
+	}
+	return cpu, wait, true
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package burn
+
+// threadSched is only supported on linux
+func threadSched() (int, int64, bool) {
+	return 0, 0, false
+}
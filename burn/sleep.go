@@ -0,0 +1,53 @@
+package burn
+
+import (
+	"runtime"
+	"time"
+)
+
+// SleepStrategy selects how workers spend the idle part of their duty cycle
+type SleepStrategy string
+
+const (
+	// SleepStrategySleep sleeps through the idle part with time.Sleep. Cheapest, but sleeps can
+	// overshoot by a lot on hosts with coarse timers, making workers burn less than their share
+	SleepStrategySleep SleepStrategy = "sleep"
+	// SleepStrategyYield sleeps through most of the idle part, then yields the thread with
+	// runtime.Gosched until the end of it. The yielding is on cpu, but lets other goroutines run
+	SleepStrategyYield SleepStrategy = "yield"
+	// SleepStrategySpinWait sleeps through most of the idle part, then spins on the clock until
+	// the end of it. The most accurate, at the cost of burning the spin on cpu
+	SleepStrategySpinWait SleepStrategy = "spinwait"
+)
+
+// sleeper waits for the idle part of the duty cycle of a single worker. Other than plain sleeps,
+// it stops sleeping early by however much sleeps have been overshooting lately and waits for the
+// rest on cpu, so the idle part ends close to when it should
+type sleeper struct {
+	strategy SleepStrategy
+	// slack is the recent mean overshoot of sleeps, which is how early they are cut short
+	slack time.Duration
+}
+
+// Sleep waits for d and returns how long it actually waited
+func (s *sleeper) Sleep(d time.Duration) time.Duration {
+	start := time.Now()
+	if s.strategy == SleepStrategySleep || s.strategy == "" {
+		time.Sleep(d)
+		return time.Since(start)
+	}
+	// always sleep through at least half of it, so the slack keeps being measured
+	if sleepFor := d - min(s.slack, d/2); sleepFor > 0 {
+		time.Sleep(sleepFor)
+		overshoot := time.Since(start) - sleepFor
+		s.slack += (overshoot - s.slack) / sleepSlackSmoothing
+	}
+	for time.Since(start) < d {
+		if s.strategy == SleepStrategyYield {
+			runtime.Gosched()
+		}
+	}
+	return time.Since(start)
+}
+
+const sleepSlackSmoothing = 8 // weight of the latest overshoot in the slack is 1/8
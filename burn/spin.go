@@ -0,0 +1,18 @@
+package burn
+
+import "sync/atomic"
+
+// spinSink keeps the results of the xorshift kernel alive so the compiler cannot drop it
+var spinSink atomic.Uint64
+
+// spinXorshift runs n iterations of a xorshift, a chain of dependent operations the compiler can
+// neither drop nor fold. It is the spin kernel on architectures without an assembly one
+func spinXorshift(n int64) {
+	x := spinSink.Load() | 1
+	for range n {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+	}
+	spinSink.Store(x)
+}
@@ -0,0 +1,14 @@
+#include "textflag.h"
+
+// func spinKernel(n int64)
+TEXT ·spinKernel(SB), NOSPLIT, $0-8
+	MOVQ n+0(FP), CX
+	TESTQ CX, CX
+	JLE done
+
+loop:
+	DECQ CX
+	JNZ loop
+
+done:
+	RET
@@ -0,0 +1,14 @@
+#include "textflag.h"
+
+// func spinKernel(n int64)
+TEXT ·spinKernel(SB), NOSPLIT, $0-8
+	MOVD n+0(FP), R0
+	CMP $0, R0
+	BLE done
+
+loop:
+	SUBS $1, R0, R0
+	BNE loop
+
+done:
+	RET
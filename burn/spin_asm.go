@@ -0,0 +1,7 @@
+//go:build amd64 || arm64
+
+package burn
+
+// spinKernel runs n iterations of a decrement and branch loop. It returns right away when n <= 0,
+// which would otherwise count down through every int64
+func spinKernel(n int64)
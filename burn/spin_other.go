@@ -0,0 +1,7 @@
+//go:build !amd64 && !arm64
+
+package burn
+
+func spinKernel(n int64) {
+	spinXorshift(n)
+}
@@ -0,0 +1,56 @@
+package burn
+
+import (
+	"testing"
+	"time"
+)
+
+// runsWithin fails the test unless f returns within a few seconds
+func runsWithin(t *testing.T, what string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s did not return", what)
+	}
+}
+
+func TestSpinKernel(t *testing.T) {
+	kernels := []struct {
+		name string
+		spin func(int64)
+	}{
+		{"kernel", spinKernel},
+		{"xorshift", spinXorshift},
+	}
+	for _, k := range kernels {
+		for _, n := range []int64{-1, 0, 1, 2, spinCheckEvery, 100_000_000} {
+			runsWithin(t, k.name, func() { k.spin(n) })
+		}
+	}
+}
+
+func TestSpinKernelXorshift(t *testing.T) {
+	before := spinSink.Load()
+	spinXorshift(spinCheckEvery)
+	if spinSink.Load() == before {
+		t.Fatal("the xorshift kernel left its sink untouched")
+	}
+}
+
+func TestSpinBurn(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Millisecond, 50 * time.Millisecond} {
+		until := time.Now().Add(d)
+		Spin{}.Burn(until)
+		if late := time.Since(until); late < 0 {
+			t.Fatalf("burning for %v returned %v early", d, -late)
+		} else if late > 100*time.Millisecond {
+			t.Fatalf("burning for %v returned %v late", d, late)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package burn
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a single measurement of the cpu usage over an interval
+type Sample struct {
+	Time     time.Time
+	Interval time.Duration
+	Target   float64
+	Achieved float64
+	User     float64 // part of Achieved spent in user space
+	System   float64 // part of Achieved spent in the kernel
+	Phase    int     // index of the phase the run was at when the sample was taken, -1 when there are no phases
+	Paused   bool    // whether the burner was paused when the sample was taken
+	Warmup   bool    // whether the interval started during Options.Warmup
+	// Frozen is how long the whole process was stopped during the interval, eg by SIGSTOP, which
+	// shows as a wall clock gap the cpu time did not grow along with. 0 when it was not stopped
+	Frozen time.Duration
+}
+
+// DeltaPct is how far the achieved usage was from the target, in percent of the target
+func (s Sample) DeltaPct() float64 {
+	if s.Target == 0 {
+		return 0
+	}
+	return (s.Achieved - s.Target) / s.Target * 100
+}
+
+// recorder accumulates samples over the run so they can be summarized once it finishes
+type recorder struct {
+	mu      sync.Mutex
+	samples []Sample
+}
+
+func (r *recorder) Add(s Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, s)
+}
+
+func (r *recorder) Samples() []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Sample(nil), r.samples...)
+}
+
+// Summary aggregates a set of samples
+type Summary struct {
+	Samples         int
+	WallTime        time.Duration
+	CPUSeconds      float64
+	UserSeconds     float64 // part of CPUSeconds spent in user space
+	SystemSeconds   float64 // part of CPUSeconds spent in the kernel
+	MeanAchieved    float64
+	MinAchieved     float64
+	MaxAchieved     float64
+	MedianAchieved  float64
+	P95Achieved     float64
+	MeanTarget      float64
+	MeanAbsDeltaPct float64
+	// percentiles of the absolute delta, which unlike the mean show short episodes far off the
+	// target, eg when throttled
+	P50AbsDeltaPct float64
+	P90AbsDeltaPct float64
+	P99AbsDeltaPct float64
+	// Frozen is how long the process was stopped over the run, eg by SIGSTOP. The intervals it was
+	// stopped in are left out of every other figure
+	Frozen time.Duration
+}
+
+// Accuracy is a 0-100 score of how close the achieved usage was to the target over the run
+func (s Summary) Accuracy() float64 {
+	return max(0, 100-s.MeanAbsDeltaPct)
+}
+
+// Summarize aggregates samples. Samples taken while paused, warming up or frozen are not taken into
+// account
+func Summarize(samples []Sample) Summary {
+	var active []Sample
+	var frozen time.Duration
+	for _, sample := range samples {
+		frozen += sample.Frozen
+		if !sample.Paused && !sample.Warmup && sample.Frozen == 0 {
+			active = append(active, sample)
+		}
+	}
+	samples = active
+	s := Summary{Samples: len(samples), Frozen: frozen}
+	if len(samples) == 0 {
+		return s
+	}
+	s.MinAchieved = math.Inf(1)
+	s.MaxAchieved = math.Inf(-1)
+	var achieved, target, absDelta float64
+	values := make([]float64, 0, len(samples))
+	deltas := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Achieved)
+		deltas = append(deltas, math.Abs(sample.DeltaPct()))
+		s.WallTime += sample.Interval
+		achieved += sample.Achieved
+		target += sample.Target
+		absDelta += math.Abs(sample.DeltaPct())
+		s.MinAchieved = min(s.MinAchieved, sample.Achieved)
+		s.MaxAchieved = max(s.MaxAchieved, sample.Achieved)
+	}
+	n := float64(len(samples))
+	s.MeanAchieved = achieved / n
+	s.MeanTarget = target / n
+	s.MeanAbsDeltaPct = absDelta / n
+	sort.Float64s(values)
+	s.MedianAchieved = percentile(values, 50)
+	s.P95Achieved = percentile(values, 95)
+	sort.Float64s(deltas)
+	s.P50AbsDeltaPct = percentile(deltas, 50)
+	s.P90AbsDeltaPct = percentile(deltas, 90)
+	s.P99AbsDeltaPct = percentile(deltas, 99)
+	return s
+}
+
+// percentile returns the p-th percentile of sorted values, using the nearest rank method
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
@@ -0,0 +1,126 @@
+package burn
+
+import "time"
+
+const defaultStreamSize = 64 << 20
+
+// streamChunk is how many elements are processed between checks of the time and the rate
+const streamChunk = 4096
+
+// streamScalar is the constant the scale and triad kernels multiply by
+const streamScalar = 3.0
+
+// Stream burns memory bandwidth like the STREAM benchmark: each worker runs the copy, scale, add
+// and triad kernels in turn over arrays too large for cpu caches, so the load is bound by memory
+// rather than by the cpu
+type Stream struct {
+	moved     *pacer
+	size      int
+	memPolicy MemPolicy
+	buffers   chan *streamBuffer
+}
+
+// StreamOptions configures a Stream workload
+type StreamOptions struct {
+	// Size is the size of each of the three arrays every worker streams through, in bytes. Defaults
+	// to 64MiB
+	Size int64
+	// Rate caps the bytes moved per second, between all workers. Workers spin once they are ahead
+	// of it. 0 moves as fast as possible
+	Rate float64
+	// MemPolicy is where the arrays are allocated, eg interleaved over every node. Defaults to
+	// wherever the kernel allocates them
+	MemPolicy MemPolicy
+}
+
+type streamBuffer struct {
+	a, b, c []float64
+	kernel  int
+	pos     int
+}
+
+// maxStreamBuffers bounds how many idle buffers are kept around for reuse
+const maxStreamBuffers = 1024
+
+func NewStream(opts StreamOptions) *Stream {
+	if opts.Size <= 0 {
+		opts.Size = defaultStreamSize
+	}
+	return &Stream{
+		moved:     newPacer(opts.Rate),
+		size:      max(streamChunk, int(opts.Size/8)),
+		memPolicy: opts.MemPolicy,
+		buffers:   make(chan *streamBuffer, maxStreamBuffers),
+	}
+}
+
+func (s *Stream) Burn(until time.Time) {
+	// workers take a buffer while burning, so each buffer has a single worker streaming through it
+	var buf *streamBuffer
+	select {
+	case buf = <-s.buffers:
+	default:
+		buf = &streamBuffer{a: make([]float64, s.size), b: make([]float64, s.size), c: make([]float64, s.size)}
+		bindSlice(s.memPolicy, buf.a)
+		bindSlice(s.memPolicy, buf.b)
+		bindSlice(s.memPolicy, buf.c)
+		for i := range buf.a {
+			buf.a[i] = 1
+		}
+	}
+	defer func() {
+		select {
+		case s.buffers <- buf:
+		default:
+		}
+	}()
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if s.moved.Ahead(now) {
+			continue
+		}
+		s.moved.Add(buf.step())
+	}
+}
+
+// step runs the current kernel over the next chunk of the arrays, moving on to the next kernel at
+// their end. Returns how many bytes were read and written
+func (buf *streamBuffer) step() int64 {
+	end := min(buf.pos+streamChunk, len(buf.a))
+	a, b, c := buf.a[buf.pos:end], buf.b[buf.pos:end], buf.c[buf.pos:end]
+	var perElement int64
+	switch buf.kernel {
+	case 0: // copy
+		copy(c, a)
+		perElement = 16
+	case 1: // scale
+		for i := range b {
+			b[i] = streamScalar * c[i]
+		}
+		perElement = 16
+	case 2: // add
+		for i := range c {
+			c[i] = a[i] + b[i]
+		}
+		perElement = 24
+	default: // triad
+		for i := range a {
+			a[i] = b[i] + streamScalar*c[i]
+		}
+		perElement = 24
+	}
+	buf.pos = end
+	if buf.pos == len(buf.a) {
+		buf.pos = 0
+		buf.kernel = (buf.kernel + 1) % 4
+	}
+	return perElement * int64(len(a))
+}
+
+// Moved returns how many bytes were read and written so far
+func (s *Stream) Moved() int64 {
+	return s.moved.Done()
+}
@@ -0,0 +1,73 @@
+package burn
+
+import "time"
+
+// Switch burns by forcing context switches: each worker ping-pongs a byte with a partner OS thread
+// through a pair of pipes, blocking in the kernel on every read. That load is dominated by the
+// scheduler and system time rather than user space spinning. Not supported on windows
+type Switch struct {
+	switches *pacer
+	pairs    chan *switchPair
+}
+
+// SwitchOptions configures a Switch workload
+type SwitchOptions struct {
+	// Rate caps the context switches per second, between all workers. Workers spin once they are
+	// ahead of it. 0 switches as fast as possible
+	Rate float64
+}
+
+// maxSwitchPairs bounds how many idle partner threads are kept around for reuse
+const maxSwitchPairs = 1024
+
+func NewSwitch(opts SwitchOptions) (*Switch, error) {
+	// make sure pairs can be created at all before burning with them
+	pair, err := newSwitchPair()
+	if err != nil {
+		return nil, err
+	}
+	s := &Switch{switches: newPacer(opts.Rate), pairs: make(chan *switchPair, maxSwitchPairs)}
+	s.pairs <- pair
+	return s, nil
+}
+
+func (s *Switch) Burn(until time.Time) {
+	// workers take a pair while burning, so each pair has a single worker using it
+	var pair *switchPair
+	select {
+	case pair = <-s.pairs:
+	default:
+		var err error
+		if pair, err = newSwitchPair(); err != nil {
+			Spin{}.Burn(until)
+			return
+		}
+	}
+	defer func() {
+		select {
+		case s.pairs <- pair:
+		default:
+			pair.Close()
+		}
+	}()
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if s.switches.Ahead(now) {
+			continue
+		}
+		if err := pair.RoundTrip(); err != nil {
+			Spin{}.Burn(until)
+			return
+		}
+		// a round trip switches to the partner thread and back
+		s.switches.Add(2)
+	}
+}
+
+// Switches returns how many context switches were forced so far
+func (s *Switch) Switches() int64 {
+	return s.switches.Done()
+}
@@ -0,0 +1,82 @@
+//go:build unix
+
+package burn
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// switchPair is a partner OS thread echoing back every byte written to ping through pong. The
+// pipes are blocking, so both ends sleep in the kernel until the other one writes
+type switchPair struct {
+	ping [2]int
+	pong [2]int
+}
+
+func newSwitchPair() (*switchPair, error) {
+	p := &switchPair{}
+	if err := unix.Pipe(p.ping[:]); err != nil {
+		return nil, err
+	}
+	if err := unix.Pipe(p.pong[:]); err != nil {
+		unix.Close(p.ping[0])
+		unix.Close(p.ping[1])
+		return nil, err
+	}
+	go p.echo()
+	return p, nil
+}
+
+func (p *switchPair) echo() {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer unix.Close(p.pong[1])
+	defer unix.Close(p.ping[0])
+	buf := []byte{0}
+	for {
+		if n, err := read(p.ping[0], buf); err != nil || n == 0 {
+			return
+		}
+		if _, err := write(p.pong[1], buf); err != nil {
+			return
+		}
+	}
+}
+
+// RoundTrip sends a byte to the partner thread and waits for it to come back
+func (p *switchPair) RoundTrip() error {
+	buf := []byte{0}
+	if _, err := write(p.ping[1], buf); err != nil {
+		return err
+	}
+	_, err := read(p.pong[0], buf)
+	return err
+}
+
+// read is unix.Read retrying when interrupted, which the runtime does often to preempt goroutines
+func read(fd int, buf []byte) (int, error) {
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != unix.EINTR {
+			return n, err
+		}
+	}
+}
+
+// write is unix.Write retrying when interrupted
+func write(fd int, buf []byte) (int, error) {
+	for {
+		n, err := unix.Write(fd, buf)
+		if err != unix.EINTR {
+			return n, err
+		}
+	}
+}
+
+// Close stops the partner thread
+func (p *switchPair) Close() {
+	unix.Close(p.ping[1])
+	unix.Close(p.pong[0])
+}
@@ -0,0 +1,15 @@
+package burn
+
+import "errors"
+
+type switchPair struct{}
+
+func newSwitchPair() (*switchPair, error) {
+	return nil, errors.New("the switch workload is not supported on windows")
+}
+
+func (p *switchPair) RoundTrip() error {
+	return errors.New("the switch workload is not supported on windows")
+}
+
+func (p *switchPair) Close() {}
@@ -0,0 +1,75 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SyscallKind selects which system call a Syscalls workload makes
+type SyscallKind string
+
+const (
+	SyscallGetpid SyscallKind = "getpid" // the cheapest round trip to the kernel
+	SyscallRead   SyscallKind = "read"   // reads a page from /dev/zero, which also copies memory
+)
+
+// syscallBatch is how many system calls are made between checks of the time split
+const syscallBatch = 16
+
+// syscallSpin is how long workers spin in user space between batches of system calls
+const syscallSpin = 10 * time.Microsecond
+
+// Syscalls burns system time by making system calls in a tight loop, alternating with user space
+// spinning to reach the requested split between both. The split is measured in wall time, so the
+// user time spent in the system call wrappers makes the actual system share a bit lower. Not
+// supported on windows
+type Syscalls struct {
+	call   func()
+	system float64
+	calls  atomic.Int64
+}
+
+// SyscallsOptions configures a Syscalls workload
+type SyscallsOptions struct {
+	// Kind defaults to SyscallRead
+	Kind SyscallKind
+	// System is the fraction of the burn spent making system calls, from 0 to 1. The rest is spent
+	// spinning in user space
+	System float64
+}
+
+func NewSyscalls(opts SyscallsOptions) (*Syscalls, error) {
+	if opts.Kind == "" {
+		opts.Kind = SyscallRead
+	}
+	call, err := newSyscall(opts.Kind)
+	if err != nil {
+		return nil, err
+	}
+	return &Syscalls{call: call, system: opts.System}, nil
+}
+
+func (s *Syscalls) Burn(until time.Time) {
+	start := time.Now()
+	var system time.Duration
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if float64(system) > s.system*float64(now.Sub(start)) {
+			Spin{}.Burn(earliest(until, now.Add(syscallSpin)))
+			continue
+		}
+		for range syscallBatch {
+			s.call()
+		}
+		s.calls.Add(syscallBatch)
+		system += time.Since(now)
+	}
+}
+
+// Calls returns how many system calls were made so far
+func (s *Syscalls) Calls() int64 {
+	return s.calls.Load()
+}
@@ -0,0 +1,7 @@
+package burn
+
+import "errors"
+
+func newSyscall(kind SyscallKind) (func(), error) {
+	return nil, errors.New("the syscall workload is not supported on windows")
+}
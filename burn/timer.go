@@ -0,0 +1,96 @@
+package burn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultTimerInterval is how long after being armed timers fire by default
+const defaultTimerInterval = 10 * time.Microsecond
+
+// timersPerWorker is how many timers each worker keeps armed at once, re-arming them round robin
+const timersPerWorker = 64
+
+// maxTimerSets bounds how many idle sets of timers are kept around for reuse
+const maxTimerSets = 1024
+
+// Timer burns by arming short high resolution timers and spinning while they fire, so every
+// expiry raises a timer interrupt on the cpu the worker runs on. That reproduces the hrtimer and
+// softirq pressure of services juggling many timeouts, on top of the system time spent arming
+// them. Only supported on linux
+type Timer struct {
+	interval time.Duration
+	armed    *pacer
+	fired    atomic.Int64
+	sets     chan *timerSet
+}
+
+// TimerOptions configures a Timer workload
+type TimerOptions struct {
+	// Rate caps how many timers are armed per second, between all workers. Workers spin once they
+	// are ahead of it. 0 arms them as fast as possible
+	Rate float64
+	// Interval is how long after being armed timers fire. Defaults to 10µs
+	Interval time.Duration
+}
+
+func NewTimer(opts TimerOptions) (*Timer, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultTimerInterval
+	}
+	// make sure timers can be created at all before burning with them
+	set, err := newTimerSet(timersPerWorker)
+	if err != nil {
+		return nil, err
+	}
+	t := &Timer{interval: opts.Interval, armed: newPacer(opts.Rate), sets: make(chan *timerSet, maxTimerSets)}
+	t.sets <- set
+	return t, nil
+}
+
+func (t *Timer) Burn(until time.Time) {
+	// workers take a set while burning, so each set has a single worker arming it
+	var set *timerSet
+	select {
+	case set = <-t.sets:
+	default:
+		var err error
+		if set, err = newTimerSet(timersPerWorker); err != nil {
+			Spin{}.Burn(until)
+			return
+		}
+	}
+	defer func() {
+		select {
+		case t.sets <- set:
+		default:
+			set.Close()
+		}
+	}()
+	for {
+		now := time.Now()
+		if !now.Before(until) {
+			return
+		}
+		if t.armed.Ahead(now) {
+			continue
+		}
+		fired, err := set.Rearm(t.interval)
+		if err != nil {
+			Spin{}.Burn(until)
+			return
+		}
+		t.fired.Add(fired)
+		t.armed.Add(1)
+	}
+}
+
+// Armed returns how many timers were armed so far
+func (t *Timer) Armed() int64 {
+	return t.armed.Done()
+}
+
+// Fired returns how many of the armed timers fired so far. Timers re-armed before firing never do
+func (t *Timer) Fired() int64 {
+	return t.fired.Load()
+}
@@ -0,0 +1,51 @@
+package burn
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// timerSet is a set of one shot timerfds, which are high resolution timers that can be armed and
+// checked without blocking
+type timerSet struct {
+	fds  []int
+	next int
+	buf  []byte
+}
+
+func newTimerSet(n int) (*timerSet, error) {
+	s := &timerSet{buf: make([]byte, 8)}
+	for range n {
+		fd, err := unix.TimerfdCreate(unix.CLOCK_MONOTONIC, unix.TFD_NONBLOCK|unix.TFD_CLOEXEC)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.fds = append(s.fds, fd)
+	}
+	return s, nil
+}
+
+// Rearm arms the next timer of the set to fire after interval, returning how many times it fired
+// since it was last armed, 0 or 1
+func (s *timerSet) Rearm(interval time.Duration) (int64, error) {
+	fd := s.fds[s.next]
+	s.next = (s.next + 1) % len(s.fds)
+	var fired int64
+	// reading a timer that did not fire yet fails with EAGAIN
+	if _, err := unix.Read(fd, s.buf); err == nil {
+		fired = 1
+	} else if !errors.Is(err, unix.EAGAIN) {
+		return 0, err
+	}
+	spec := unix.ItimerSpec{Value: unix.NsecToTimespec(interval.Nanoseconds())}
+	return fired, unix.TimerfdSettime(fd, 0, &spec, nil)
+}
+
+func (s *timerSet) Close() {
+	for _, fd := range s.fds {
+		unix.Close(fd)
+	}
+}
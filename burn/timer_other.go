@@ -0,0 +1,20 @@
+//go:build !linux
+
+package burn
+
+import (
+	"errors"
+	"time"
+)
+
+type timerSet struct{}
+
+func newTimerSet(n int) (*timerSet, error) {
+	return nil, errors.New("the timer workload is only supported on linux")
+}
+
+func (s *timerSet) Rearm(interval time.Duration) (int64, error) {
+	return 0, errors.New("the timer workload is only supported on linux")
+}
+
+func (s *timerSet) Close() {}
@@ -0,0 +1,32 @@
+package burn
+
+import "time"
+
+// Workload is what workers do while burning. Burn is called by every worker, concurrently, for
+// the busy part of each work unit and must return once until is reached. Whatever cpu time the
+// process consumes meanwhile, eg on garbage collection, is accounted for by the controller
+type Workload interface {
+	Burn(until time.Time)
+}
+
+// spinCheckEvery is how many iterations of the spin kernel run between checks of the time, a
+// fraction of a microsecond on current cpus
+const spinCheckEvery = 1024
+
+// Spin burns by spinning in a tight loop, which takes 100% of a core in user space. It is the
+// default workload. The loop is written in assembly where possible so what it runs does not depend
+// on what the compiler makes of an empty loop
+type Spin struct{}
+
+func (Spin) Burn(until time.Time) {
+	for time.Now().Before(until) {
+		spinKernel(spinCheckEvery)
+	}
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
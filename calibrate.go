@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+type CalibrateCmd struct {
+	Samples int    `arg:"--samples" default:"200" help:"how many times each measurement is repeated"`
+	Save    string `arg:"--save" help:"write the recommended settings to this file, which can then be passed to --config"`
+}
+
+// calibrationUnits are the work units considered when recommending one, from the most to the least
+// responsive
+var calibrationUnits = []time.Duration{
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+}
+
+// calibrationMaxError is the largest duty cycle error accepted for a recommended work unit
+const calibrationMaxError = 0.01
+
+// calibrationBurn is how long a half cpu duty cycle is run with each work unit to measure its error
+const calibrationBurn = 500 * time.Millisecond
+
+// calibration holds how accurately the host can time the duty cycle of workers
+type calibration struct {
+	timerResolution time.Duration
+	loopOverhead    time.Duration
+	// overshoot is the mean extra time slept when sleeping for half of each calibration unit
+	overshoot map[time.Duration]time.Duration
+	// dutyError is how far from half a cpu a worker burning half a cpu with each calibration unit
+	// ended up, without any correction, relative to the target. Negative values are undershoots
+	dutyError map[time.Duration]float64
+}
+
+// runCalibrate measures the timing accuracy of the host, prints the results along with the
+// recommended work unit and optionally saves the recommendation as a config file
+func runCalibrate(w io.Writer, cmd *CalibrateCmd) error {
+	if cmd.Samples <= 0 {
+		return fmt.Errorf("invalid samples value: %d", cmd.Samples)
+	}
+	c := calibrate(cmd.Samples)
+
+	fmt.Fprintf(w, "timer resolution: %s\n", c.timerResolution)
+	fmt.Fprintf(w, "busy loop overhead: %s per iteration\n\n", c.loopOverhead)
+	fmt.Fprintf(w, "%-10s %-12s %s\n", "work unit", "overshoot", "error at half a cpu")
+	recommended := calibrationUnits[0]
+	found := false
+	for _, unit := range calibrationUnits {
+		dutyError := c.dutyError[unit]
+		fmt.Fprintf(w, "%-10s %-12s %+.1f%%\n", unit, c.overshoot[unit].Round(time.Microsecond), dutyError*100)
+		if !found && math.Abs(dutyError) <= calibrationMaxError {
+			recommended = unit
+			found = true
+		}
+		if !found && math.Abs(dutyError) < math.Abs(c.dutyError[recommended]) {
+			recommended = unit
+		}
+	}
+	fmt.Fprintf(w, "\nrecommended: --work-unit %s\n", recommended)
+	if !found {
+		fmt.Fprintf(w, "no work unit got within %.0f%% of the target on this host, the one closest to it was picked and accuracy will rely on the controller\n", calibrationMaxError*100)
+	}
+
+	if cmd.Save != "" {
+		if err := os.WriteFile(cmd.Save, []byte(fmt.Sprintf("work-unit: %s\n", recommended)), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "saved to %s\n", cmd.Save)
+	}
+	return nil
+}
+
+func calibrate(samples int) calibration {
+	c := calibration{overshoot: map[time.Duration]time.Duration{}, dutyError: map[time.Duration]float64{}}
+
+	// the timer resolution is the smallest observable difference between two readings of the clock
+	c.timerResolution = time.Hour
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		now := time.Now()
+		for now == start {
+			now = time.Now()
+		}
+		c.timerResolution = min(c.timerResolution, now.Sub(start))
+	}
+
+	// workers spin checking the clock, so the loop overhead is the cost of a check
+	const iterations = 100000
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if time.Since(start) < 0 {
+			break
+		}
+	}
+	c.loopOverhead = time.Since(start) / iterations
+
+	// workers burning half a cpu sleep for half of each work unit
+	for _, unit := range calibrationUnits {
+		// keep each measurement under a second
+		n := min(samples, max(10, int(time.Second/unit)))
+		overshoots := make([]time.Duration, n)
+		for i := range overshoots {
+			start := time.Now()
+			time.Sleep(unit / 2)
+			overshoots[i] = time.Since(start) - unit/2
+		}
+		var total time.Duration
+		for _, overshoot := range overshoots {
+			total += overshoot
+		}
+		c.overshoot[unit] = total / time.Duration(n)
+		c.dutyError[unit] = measureDutyCycle(unit)*2 - 1
+	}
+	return c
+}
+
+// measureDutyCycle spins for half of every work unit and sleeps for the other half, the same way
+// workers burn half a cpu, and returns the amount of cpus actually burned. Besides timing
+// inaccuracies this also captures how the host accounts cpu time, eg when running on a VM
+func measureDutyCycle(unit time.Duration) float64 {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	startCPUTime := burn.CPUTime()
+	start := time.Now()
+	for time.Since(start) < calibrationBurn {
+		unitStart := time.Now()
+		for time.Since(unitStart) < unit/2 {
+			// spin
+		}
+		time.Sleep(unit / 2)
+	}
+	return float64(burn.CPUTime()-startCPUTime) / float64(time.Since(start))
+}
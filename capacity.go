@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// capacityCheckEvery is how often watchCapacity looks for cpus coming online or going offline and
+// for changes to the cgroup cpu limit
+const capacityCheckEvery = 10 * time.Second
+
+// cpuBudget returns how many cpus this process can actually use: the cpus it is allowed to run
+// on, capped by the cpu limit of its cgroup. Returns true when the cgroup limit is what caps it
+func cpuBudget() (float64, bool) {
+	host := float64(runtime.NumCPU())
+	limit, limited, err := cgroupCPUs()
+	if err != nil {
+		slog.Debug("failed to read cgroup cpu limit", "pid", os.Getpid(), "error", err)
+		return host, false
+	}
+	if !limited || limit >= host {
+		return host, false
+	}
+	return limit, true
+}
+
+// setupGOMAXPROCS caps the threads running go code to the cpu budget when the cgroup limits it,
+// as the runtime only does by default from go 1.25 on, so the garbage collector and every other
+// goroutine do not get the process throttled. It is never capped below the cpus to burn, as
+// burning over the limit is how throttling is tested, and is left alone when GOMAXPROCS is set in
+// the environment
+func setupGOMAXPROCS(budget float64, limited bool, cpus float64) {
+	if !limited || os.Getenv("GOMAXPROCS") != "" {
+		return
+	}
+	procs := min(runtime.NumCPU(), max(minGOMAXPROCS, int(math.Ceil(budget)), int(math.Ceil(cpus))))
+	if procs < runtime.GOMAXPROCS(0) {
+		runtime.GOMAXPROCS(procs)
+		slog.Debug("limited gomaxprocs to the cgroup cpu limit", "pid", os.Getpid(), "gomaxprocs", procs, "cgroup_cpus", budget)
+	}
+}
+
+// minGOMAXPROCS keeps some parallelism in tightly limited cgroups, the same floor go applies
+const minGOMAXPROCS = 2
+
+// onlineCPUs returns how many cpus the process can run on right now, which unlike runtime.NumCPU
+// follows cpus hot added to or removed from the host
+func onlineCPUs() float64 {
+	if allowed, err := allowedCPUs(); err == nil && len(allowed) > 0 {
+		return float64(len(allowed))
+	}
+	return float64(runtime.NumCPU())
+}
+
+// measureCapacity returns what percentages are relative to as per --relative-to, measured again,
+// capped by --self-limit when given
+func measureCapacity(relativeTo string, selfLimit float64) float64 {
+	host := onlineCPUs()
+	if relativeTo == "host" {
+		return host
+	}
+	limit, limited, err := cgroupCPUs()
+	if err != nil {
+		slog.Debug("failed to read cgroup cpu limit", "pid", os.Getpid(), "error", err)
+		limited = false
+	}
+	if selfLimit > 0 && (!limited || selfLimit < limit) {
+		limit, limited = selfLimit, true
+	}
+	if !limited || (relativeTo == "auto" && limit >= host) {
+		return host
+	}
+	return limit
+}
+
+// relativeTarget is a burner whose target depends on the capacity, as a percentage or an
+// expression of host facts
+type relativeTarget struct {
+	b *burn.Burner
+	// spec is the burn value the target was parsed from, evaluated again to tell how much the
+	// target changes. Empty when it cannot be, in which case it changes as much as the capacity
+	spec string
+}
+
+// relativeTargets returns the burners whose targets depend on the capacity, and so need updating
+// when it changes. Targets following a live source, eg --target-url, are left out, as values they
+// read are evaluated against the capacity of the moment already
+func relativeTargets(args Args, b *burn.Burner, groups []*burnGroup) []relativeTarget {
+	var targets []relativeTarget
+	live := args.FollowPID != 0 || args.Antagonist != "" || args.OfLimit != "" || args.FillTo != "" ||
+		args.TargetURL != "" || args.BurnFromFile != ""
+	if !live {
+		// patterns move between their bounds, so those tell best how much the whole run changes
+		for _, value := range []string{args.Max, args.Min, args.Burn, args.BurstSize, args.CronBurn} {
+			if referencesCapacity(value) {
+				targets = append(targets, relativeTarget{b: b, spec: value})
+				break
+			}
+		}
+		if len(targets) == 0 && (referencesCapacity(args.BurnRange) || referencesCapacity(args.Steps)) {
+			targets = append(targets, relativeTarget{b: b})
+		}
+	}
+	for _, g := range groups {
+		if referencesCapacity(g.spec) {
+			targets = append(targets, relativeTarget{b: g.b, spec: g.spec})
+		}
+	}
+	return targets
+}
+
+// watchCapacity measures the capacity again every capacityCheckEvery until the context is done,
+// eg as vcpus are hot added to a virtual machine or a pod is resized in place. Once it changes,
+// values given from then on are evaluated against the new capacity, and the given targets are
+// updated by as much as their burn values change, so a 50% burn stays half of the cpus and a
+// numcpu-2 one keeps leaving two cpus idle
+func watchCapacity(ctx context.Context, relativeTo string, selfLimit float64, targets []relativeTarget) {
+	// changes are told apart from what was measured before rather than from the capacity, as the
+	// cgroup of --self-limit hides the limits of the cgroups it was created in once entered
+	last := measureCapacity(relativeTo, selfLimit)
+	ticker := time.NewTicker(capacityCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := measureCapacity(relativeTo, selfLimit)
+		if current <= 0 || math.Abs(current-last) < 0.001 {
+			continue
+		}
+		last = current
+		previous := cpuCapacity()
+		before := make([]float64, len(targets))
+		for i, t := range targets {
+			before[i], _ = parseBurn(t.spec)
+		}
+		setCapacity(current)
+		slog.Info("cpu capacity changed", "pid", os.Getpid(), "from_cpus", decimal(previous, 3), "to_cpus", decimal(current, 3), "targets", len(targets))
+		for i, t := range targets {
+			factor := current / previous
+			if after, err := parseBurn(t.spec); t.spec != "" && err == nil {
+				if before[i] == 0 {
+					// nothing to scale from, eg numcpu-2 on a host that had two cpus
+					t.b.SetTarget(after)
+					continue
+				}
+				factor = after / before[i]
+			}
+			t.b.Rescale(factor)
+		}
+	}
+}
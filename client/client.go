@@ -0,0 +1,209 @@
+// Package client drives a burner remotely through its http control api, as served with --listen.
+// Every call takes a context, so harnesses can bound how long they wait for a burner that is gone
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// Target is the current target of a burner
+type Target struct {
+	CPUs   float64 `json:"cpus"`
+	Paused bool    `json:"paused"`
+}
+
+// Stats describes a burner and what it consumed so far
+type Stats struct {
+	Time       time.Time  `json:"time"`
+	State      burn.State `json:"state"`
+	Target     float64    `json:"target"`
+	Achieved   float64    `json:"achieved"` // over the latest sample
+	Paused     bool       `json:"paused"`
+	Workers    int        `json:"workers"`
+	UptimeMs   int64      `json:"uptime_ms"`
+	CPUSeconds float64    `json:"cpu_seconds"`
+}
+
+// Sample is a measurement of the usage of a burner over an interval
+type Sample struct {
+	Time       time.Time `json:"time"`
+	IntervalMs float64   `json:"interval_ms"`
+	Target     float64   `json:"target"`
+	Achieved   float64   `json:"achieved"`
+	User       float64   `json:"user"`
+	System     float64   `json:"system"`
+	Paused     bool      `json:"paused"`
+	Warmup     bool      `json:"warmup,omitempty"`
+}
+
+// Error is an error returned by the control api
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("control api returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls the control api of a single burner. It is safe for concurrent use
+type Client struct {
+	base string
+	http *http.Client
+}
+
+// New returns a client for the burner listening at address, either host:port as given to --listen
+// or a http url. httpClient may be nil to use http.DefaultClient
+func New(address string, httpClient *http.Client) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(address, "/"), http: httpClient}
+}
+
+// Target returns the current target
+func (c *Client) Target(ctx context.Context) (Target, error) {
+	var target Target
+	return target, c.call(ctx, http.MethodGet, "/target", nil, &target)
+}
+
+// SetTarget changes the target, given in the same format as --burn, eg 2.5 or 50%
+func (c *Client) SetTarget(ctx context.Context, burn string) (Target, error) {
+	var target Target
+	return target, c.call(ctx, http.MethodPut, "/target", map[string]string{"burn": burn}, &target)
+}
+
+// Stats returns the state, target, latest usage and cpu seconds consumed so far
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	return stats, c.call(ctx, http.MethodGet, "/stats", nil, &stats)
+}
+
+// Pause makes all workers go idle
+func (c *Client) Pause(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/pause", nil, nil)
+}
+
+// Resume resumes burning after a pause
+func (c *Client) Resume(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/resume", nil, nil)
+}
+
+// Stop stops the run. The burner drains and exits on its own after it
+func (c *Client) Stop(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/stop", nil, nil)
+}
+
+// State returns the state of the burner, from its liveness probe
+func (c *Client) State(ctx context.Context) (burn.State, error) {
+	var health struct {
+		State burn.State `json:"state"`
+	}
+	err := c.call(ctx, http.MethodGet, "/healthz", nil, &health)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+		// a stopped burner fails its probe, which is still an answer
+		return burn.StateStopped, nil
+	}
+	return health.State, err
+}
+
+// Samples calls fn with every usage sample the burner takes from now on, until the context is
+// done, the burner stops or fn returns an error, which is then returned
+func (c *Client) Samples(ctx context.Context, fn func(Sample) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/samples", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	// server-sent events, of which only the data lines matter
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+		var sample Sample
+		if err := json.Unmarshal([]byte(data), &sample); err != nil {
+			return fmt.Errorf("invalid sample: %w", err)
+		}
+		if err := fn(sample); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+func (c *Client) call(ctx context.Context, method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// responseError turns a failed response into an Error, with the message the api sent when any
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &body) == nil {
+		message = body.Error
+		if message == "" {
+			// a json body without an error, eg the state returned by a failing probe
+			message = http.StatusText(resp.StatusCode)
+		}
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: message}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexflint/go-arg"
+)
+
+type CPUCmd struct {
+	Burn string `arg:"positional" help:"how much cpu to burn, same as --burn"`
+}
+
+type MemCmd struct {
+	Size       string        `arg:"positional,required" help:"how much memory to hold, same as --mem"`
+	TouchEvery time.Duration `arg:"--touch-every" help:"how often to touch every page of the memory held, same as --mem-touch-every"`
+	Policy     string        `arg:"--policy" help:"where the memory is allocated, same as --mem-policy"`
+}
+
+type IOCmd struct {
+	Rate      string `arg:"positional,required" help:"disk io throughput to generate, same as --io"`
+	Path      string `arg:"--path" help:"directory in which the scratch file is created, same as --io-path"`
+	Mode      string `arg:"--mode" help:"which io operations to perform, same as --io-mode"`
+	BlockSize string `arg:"--block-size" help:"size of each io operation, same as --io-block-size"`
+	FileSize  string `arg:"--file-size" help:"size of the scratch file, same as --io-file-size"`
+	Fsync     bool   `arg:"--fsync" help:"fsync after every write, same as --io-fsync"`
+	Random    bool   `arg:"--random" help:"access the scratch file at random offsets, same as --io-random"`
+}
+
+// ChaosCmd takes the cpu stress settings the way chaos experiments hand them to their stress image:
+// the CPU_CORES, CPU_LOAD and TOTAL_CHAOS_DURATION variables of the litmus cpu hog experiments, or
+// the workers and load of the cpu stressor of chaos mesh. NODE_CPU_CORE, from the litmus node cpu
+// hog, is read when CPU_CORES is not set
+type ChaosCmd struct {
+	Workers  *int `arg:"--workers,env:CPU_CORES" help:"how many cpus to stress. Use 0 to stress all of them"`
+	Load     int  `arg:"--load,env:CPU_LOAD" default:"100" help:"how busy to keep every stressed cpu, in percent"`
+	Duration int  `arg:"--timeout,env:TOTAL_CHAOS_DURATION" default:"0" help:"for how many seconds to stress. Use 0 to stress until stopped"`
+}
+
+// mustParseArgs parses the command line like arg.MustParse, except that the help of the cpu, mem
+// and io subcommands only lists their own flags instead of every global one
+func mustParseArgs(args *Args) *arg.Parser {
+	parser, err := arg.NewParser(arg.Config{}, args)
+	if err != nil {
+		fmt.Fprintln(os.Stdout, err)
+		os.Exit(-1)
+	}
+	if err := parser.Parse(os.Args[1:]); err == arg.ErrHelp {
+		var cmd any
+		globals := "Duration, schedule and reporting flags"
+		switch parser.Subcommand().(type) {
+		case *CPUCmd:
+			cmd, globals = &CPUCmd{}, "All flags"
+		case *MemCmd:
+			cmd = &MemCmd{}
+		case *IOCmd:
+			cmd = &IOCmd{}
+		}
+		if cmd != nil {
+			program := filepath.Base(os.Args[0]) + " " + strings.Join(parser.SubcommandNames(), " ")
+			help, err := arg.NewParser(arg.Config{Program: program}, cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stdout, err)
+				os.Exit(-1)
+			}
+			help.WriteHelp(os.Stdout)
+			fmt.Fprintf(os.Stdout, "\n%s of %s --help apply too\n", globals, filepath.Base(os.Args[0]))
+			os.Exit(0)
+		}
+	}
+	// parse again from scratch, so everything else is handled the way arg.MustParse does
+	*args = Args{}
+	parser.MustParse(os.Args[1:])
+	return parser
+}
+
+// givenArgs returns only the options explicitly given, in the config file when there is one and
+// on the command line, leaving every other option unset
+func givenArgs(config string, cli []string) (*Args, error) {
+	given := &Args{}
+	parser, err := arg.NewParser(arg.Config{IgnoreDefault: true}, given)
+	if err != nil {
+		return nil, err
+	}
+	if config != "" {
+		fileArgs, err := readConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.Parse(fileArgs); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", config, err)
+		}
+	}
+	if err := parser.Parse(cli); err != nil {
+		return nil, err
+	}
+	return given, nil
+}
+
+// resourceFlags returns which of the given options make the burner burn cpu or set up the memory
+// or io loads
+func (given *Args) resourceFlags() []string {
+	var names []string
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"--burn", given.Burn != ""},
+		{"--group", len(given.Groups) > 0},
+		{"--workload", given.Workload != ""},
+		{"--iterations", given.Iterations != 0},
+		{"--follow-pid", given.FollowPID != 0},
+		{"--antagonist", given.Antagonist != ""},
+		{"--target-url", given.TargetURL != ""},
+		{"--burn-from-env", given.BurnFromEnv != ""},
+		{"--burn-from-file", given.BurnFromFile != ""},
+		{"--of-limit", given.OfLimit != ""},
+		{"--fill-to", given.FillTo != ""},
+		{"--pattern", given.Pattern != ""},
+		{"--min", given.Min != ""},
+		{"--max", given.Max != ""},
+		{"--burn-range", given.BurnRange != ""},
+		{"--steps", given.Steps != ""},
+		{"--schedule", given.Schedule != ""},
+		{"--replay", given.Replay != ""},
+		{"--burst", given.Burst != ""},
+		{"--cron", given.Cron != ""},
+		{"--mem", given.Mem != ""},
+		{"--mem-touch-every", given.MemTouchEvery != 0},
+		{"--mem-policy", given.MemPolicy != ""},
+		{"--io", given.IO != ""},
+		{"--io-path", given.IOPath != ""},
+		{"--io-mode", given.IOMode != ""},
+		{"--io-block-size", given.IOBlockSize != ""},
+		{"--io-file-size", given.IOFileSize != ""},
+		{"--io-fsync", given.IOFsync},
+		{"--io-random", given.IORandom},
+	} {
+		if flag.set {
+			names = append(names, flag.name)
+		}
+	}
+	return names
+}
+
+// applyCommand turns the resource subcommands into the flags of the bare invocation, which keeps
+// working as before: cpu burns cpu along with whatever else the flags ask for, while mem and io
+// only burn their own resource, and chaos burns what the chaos experiment asks for. Given holds
+// the options explicitly given, so global flags conflicting with the subcommand are rejected
+func (args *Args) applyCommand(given *Args) error {
+	switch {
+	case args.BurnCPU != nil:
+		if args.BurnCPU.Burn != "" {
+			if given.Burn != "" {
+				return fmt.Errorf("the cpu subcommand takes how much to burn either as an argument or with --burn, not both")
+			}
+			args.Burn = args.BurnCPU.Burn
+		}
+	case args.BurnMem != nil:
+		if flags := given.resourceFlags(); len(flags) > 0 {
+			return fmt.Errorf("the mem subcommand only holds memory and cannot be combined with %s", strings.Join(flags, ", "))
+		}
+		cmd := args.BurnMem
+		args.Burn = "0"
+		args.Mem = cmd.Size
+		if cmd.TouchEvery != 0 {
+			args.MemTouchEvery = cmd.TouchEvery
+		}
+		if cmd.Policy != "" {
+			args.MemPolicy = cmd.Policy
+		}
+	case args.BurnIO != nil:
+		if flags := given.resourceFlags(); len(flags) > 0 {
+			return fmt.Errorf("the io subcommand only generates disk io and cannot be combined with %s", strings.Join(flags, ", "))
+		}
+		cmd := args.BurnIO
+		args.Burn = "0"
+		args.IO = cmd.Rate
+		if cmd.Path != "" {
+			args.IOPath = cmd.Path
+		}
+		if cmd.Mode != "" {
+			args.IOMode = cmd.Mode
+		}
+		if cmd.BlockSize != "" {
+			args.IOBlockSize = cmd.BlockSize
+		}
+		if cmd.FileSize != "" {
+			args.IOFileSize = cmd.FileSize
+		}
+		args.IOFsync = cmd.Fsync
+		args.IORandom = cmd.Random
+	case args.Chaos != nil:
+		return args.applyChaos()
+	}
+	return nil
+}
+
+func (args *Args) applyChaos() error {
+	c := args.Chaos
+	if c.Workers == nil {
+		if value, found := os.LookupEnv("NODE_CPU_CORE"); found {
+			workers, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid NODE_CPU_CORE value: %s", value)
+			}
+			c.Workers = &workers
+		}
+	}
+	workers := 0
+	if c.Workers != nil {
+		workers = *c.Workers
+	}
+	if workers < 0 {
+		return fmt.Errorf("invalid workers value: %d", workers)
+	}
+	if c.Load < 0 || c.Load > 100 {
+		return fmt.Errorf("invalid load value: %d: must be between 0 and 100", c.Load)
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf("invalid timeout value: %d", c.Duration)
+	}
+	if workers == 0 {
+		// like stress-ng, no workers means one per cpu
+		args.Burn = fmt.Sprintf("%d%%", c.Load)
+	} else {
+		args.Burn = strconv.FormatFloat(float64(workers)*float64(c.Load)/100, 'f', -1, 64)
+	}
+	args.Duration = time.Duration(c.Duration) * time.Second
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/bcap/cpu-burner/burn"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig parses the command line on top of the options read from a --config file, so flags
+// always take precedence over the file. Keys in the file are the long flag names, with either
+// dashes or underscores. Options that can be repeated take a list, in which case values from the
+// file and from the command line are combined. Eg:
+//
+//	burn: 50%
+//	duration: 10m
+//	log-every: 30s
+//	label:
+//	  - team=payments
+//	  - env=staging
+func loadConfig(path string, cli []string) (Args, error) {
+	fileArgs, err := readConfig(path)
+	if err != nil {
+		return Args{}, err
+	}
+
+	args := Args{}
+	parser, err := arg.NewParser(arg.Config{}, &args)
+	if err != nil {
+		return Args{}, err
+	}
+	if err := parser.Parse(fileArgs); err != nil {
+		return Args{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	// defaults were already filled in when parsing the file, ignoring them keeps the values it set
+	parser, err = arg.NewParser(arg.Config{IgnoreDefault: true}, &args)
+	if err != nil {
+		return Args{}, err
+	}
+	if err := parser.Parse(cli); err != nil {
+		return Args{}, err
+	}
+	return args, nil
+}
+
+// readConfig reads a config file and turns it into the equivalent command line flags
+func readConfig(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var options map[string]any
+	if err := yaml.Unmarshal(data, &options); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var flags []string
+	for _, key := range keys {
+		flag := "--" + strings.ReplaceAll(key, "_", "-")
+		if flag == "--config" {
+			return nil, fmt.Errorf("invalid config file %s: config files cannot include other config files", path)
+		}
+		switch value := options[key].(type) {
+		case nil:
+			return nil, fmt.Errorf("invalid config file %s: missing value for %s", path, key)
+		case map[string]any:
+			return nil, fmt.Errorf("invalid config file %s: invalid value for %s", path, key)
+		case time.Time:
+			// unquoted timestamps, eg for start-at
+			flags = append(flags, fmt.Sprintf("%s=%s", flag, value.Format(time.RFC3339Nano)))
+		case []any:
+			for _, item := range value {
+				flags = append(flags, fmt.Sprintf("%s=%v", flag, item))
+			}
+		default:
+			flags = append(flags, fmt.Sprintf("%s=%v", flag, value))
+		}
+	}
+	return flags, nil
+}
+
+// reloadConfig reads the config file again and applies the options that can change while running:
+// the burn target and how often usage is logged. The target is only replaced when the burn option
+// itself changed, so reloading keeps adjustments made through signals or the control api
+func reloadConfig(b *burn.Burner, current *Args, cli []string, usage *usageLog) {
+	args, err := loadConfig(current.Config, cli)
+	if err != nil {
+		slog.Warn("failed to reload config", "pid", os.Getpid(), "path", current.Config, "error", err)
+		return
+	}
+	given, err := givenArgs(current.Config, cli)
+	if err == nil {
+		err = args.applyCommand(given)
+	}
+	if err != nil {
+		slog.Warn("failed to reload config", "pid", os.Getpid(), "path", current.Config, "error", err)
+		return
+	}
+	if err := args.burnFromEnv(); err != nil {
+		slog.Warn("failed to reload config", "pid", os.Getpid(), "path", current.Config, "error", err)
+		return
+	}
+	var cpus float64
+	if args.Burn != current.Burn {
+		if strings.Contains(args.Burn, ":") || strings.Contains(current.Burn, ":") {
+			slog.Warn("failed to reload config", "pid", os.Getpid(), "path", current.Config, "error", "changing a per core burn requires a restart")
+			return
+		}
+		cpus, err = parseBurn(args.Burn)
+		if err != nil {
+			slog.Warn("failed to reload config", "pid", os.Getpid(), "path", current.Config, "error", err)
+			return
+		}
+	}
+
+	slog.Info("config reloaded", "pid", os.Getpid(), "path", current.Config)
+	if args.Burn != current.Burn {
+		b.SetTarget(cpus * processShare())
+		current.Burn = args.Burn
+	}
+	if args.LogEvery != current.LogEvery {
+		if current.SampleEvery == 0 {
+			b.SetSampleEvery(args.LogEvery)
+		}
+		usage.enabled.Store(args.LogEvery > 0)
+		usage.every.Store(int64(args.LogEvery))
+		slog.Info("log interval changed", "pid", os.Getpid(), "log_every_ms", args.LogEvery.Milliseconds())
+		current.LogEvery = args.LogEvery
+	}
+}
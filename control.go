@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+type targetRequest struct {
+	Burn string `json:"burn"`
+}
+
+type targetResponse struct {
+	CPUs   float64 `json:"cpus"`
+	Paused bool    `json:"paused"`
+}
+
+type statsResponse struct {
+	Time       time.Time  `json:"time"`
+	State      burn.State `json:"state"`
+	Target     float64    `json:"target"`
+	Achieved   float64    `json:"achieved"`
+	Paused     bool       `json:"paused"`
+	Workers    int        `json:"workers"`
+	UptimeMs   int64      `json:"uptime_ms"`
+	CPUSeconds float64    `json:"cpu_seconds"`
+}
+
+type healthResponse struct {
+	State burn.State `json:"state"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// webDashboard is the page served at / by the control api, charting target and achieved usage
+// live along with controls to change the target, pause, resume and stop
+//
+//go:embed web/dashboard.html
+var webDashboard []byte
+
+// newControlHandler exposes the http control api of a burner:
+//
+//	GET  /target  returns the current target
+//	PUT  /target  changes the target, eg {"burn":"2.5"} or {"burn":"50%"}
+//	POST /pause   makes all workers go idle
+//	POST /resume  resumes burning after a pause
+//	POST /stop    stops the run
+//	GET  /stats   returns the target, state, latest usage and cpu seconds consumed so far
+//	GET  /samples streams every usage sample as it is taken, as server-sent events
+//	GET  /metrics returns prometheus metrics
+//	GET  /healthz and /readyz, see handleHealth
+//	GET  /        serves a web dashboard charting the usage, built on the endpoints above
+func newControlHandler(b *burn.Burner, labels Labels) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webDashboard)
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		stats := b.Stats()
+		writeJSON(w, http.StatusOK, statsResponse{
+			Time:       time.Now(),
+			State:      b.State(),
+			Target:     stats.Target,
+			Achieved:   stats.Last.Achieved,
+			Paused:     stats.Paused,
+			Workers:    stats.Workers,
+			UptimeMs:   stats.Uptime.Milliseconds(),
+			CPUSeconds: stats.CPUSeconds,
+		})
+	})
+	mux.HandleFunc("GET /samples", func(w http.ResponseWriter, r *http.Request) {
+		streamSamples(r.Context(), w, b)
+	})
+	mux.Handle("GET /metrics", newMetricsHandler(b, labels))
+	handleHealth(mux, b)
+	mux.HandleFunc("GET /target", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, targetResponse{CPUs: b.Target(), Paused: b.Paused()})
+	})
+	mux.HandleFunc("PUT /target", func(w http.ResponseWriter, r *http.Request) {
+		var req targetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+			return
+		}
+		cpus, err := parseBurn(req.Burn)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		b.SetTarget(cpus)
+		writeJSON(w, http.StatusOK, targetResponse{CPUs: cpus, Paused: b.Paused()})
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		b.Pause()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		b.Resume()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /stop", func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("stop requested through the control api", "pid", os.Getpid(), "remote", r.RemoteAddr)
+		b.Stop()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// streamSamples sends every usage sample as a server-sent event named sample, its data being the
+// sample as json, until the client goes away or the burner stops. Samples are the ones the usage
+// logs are made of, taken every --sample-every or --log-every
+func streamSamples(ctx context.Context, w http.ResponseWriter, b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// send the headers right away, so clients know the stream is up before the first sample
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	controller.Flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.Done():
+			return
+		case s := <-samples:
+			data, err := json.Marshal(newProcessSample(s))
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: sample\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			controller.Flush()
+		}
+	}
+}
+
+// handleHealth adds liveness and readiness probes to the mux, both returning the burner state:
+//
+//	GET /healthz succeeds until the burner stopped
+//	GET /readyz  only succeeds while burning
+func handleHealth(mux *http.ServeMux, b *burn.Burner) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		state := b.State()
+		status := http.StatusOK
+		if state == burn.StateStopped {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, healthResponse{State: state})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		state := b.State()
+		status := http.StatusOK
+		if state != burn.StateBurning {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, healthResponse{State: state})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// serveHTTP serves the handler on the listener until the context is done
+func serveHTTP(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	server := &http.Server{Handler: handler}
+	context.AfterFunc(ctx, func() { server.Close() })
+	slog.Info("http server listening", "pid", os.Getpid(), "address", listener.Addr().String())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
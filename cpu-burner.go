@@ -2,71 +2,1243 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/alexflint/go-arg"
+	"github.com/bcap/cpu-burner/burn"
 )
 
+// capacity is the amount of cpus that percentages given to --burn and other burn options are
+// relative to. Only written before burning, and by watchCapacity through setCapacity after that
+var (
+	capacity   = float64(runtime.NumCPU())
+	capacityMu sync.RWMutex
+)
+
+// cpuCapacity returns the current capacity, for reads that can happen while burning
+func cpuCapacity() float64 {
+	capacityMu.RLock()
+	defer capacityMu.RUnlock()
+	return capacity
+}
+
+func setCapacity(cpus float64) {
+	capacityMu.Lock()
+	defer capacityMu.Unlock()
+	capacity = cpus
+}
+
+type SinkCmd struct {
+	Listen string `arg:"--listen" default:":9000" help:"address to listen on for network load"`
+	Echo   bool   `arg:"--echo" default:"false" help:"send back everything received instead of discarding it"`
+}
+
 type Args struct {
-	Burn           string        `arg:"-b,--burn" default:"1" help:"how much cpu to burn. Can be specified in 2 different ways: as a float/integer, representing how many cores/fraction of a core. Eg 1.5 means 1 core and a half; as a percentage, indicating total system capacity percentage. Eg on a 4 cores system, 100% means all 4 cores, 50% means 2 cores and 62.5% means 2 cores and a half"`
-	Duration       time.Duration `arg:"-d,--duration" default:"0" help:"for how long to run. Pass 0 to run indefinitely"`
-	NoLockOSThread bool          `arg:"--lock-os-thread" default:"false" help:"will make each goroutine used to consume cpu lock itself to a single OS thread, which should cause load to be concentrated on fewer cpus"`
-	LogEvery       time.Duration `arg:"-l,--log-every" default:"10s" help:"how often to log actual cpu usage. Use 0 to disable it"`
-	Verbose        bool          `arg:"-v,--verbose" default:"false" help:"enable debug logging"`
-	Quiet          bool          `arg:"-q,--quiet" default:"false" help:"disable all logging"`
+	BurnCPU     *CPUCmd         `arg:"subcommand:cpu" help:"burn cpu, the same as running without a subcommand. All flags apply"`
+	BurnMem     *MemCmd         `arg:"subcommand:mem" help:"only hold memory, eg mem 4GiB, burning no cpu. Duration, schedule and reporting flags work as with cpu, flags burning cpu or setting up other loads are rejected"`
+	BurnIO      *IOCmd          `arg:"subcommand:io" help:"only generate disk io load, eg io 50MB/s, burning no cpu. Duration, schedule and reporting flags work as with cpu, flags burning cpu or setting up other loads are rejected"`
+	Sink        *SinkCmd        `arg:"subcommand:sink" help:"run a server that receives the network load generated by --net"`
+	Calibrate   *CalibrateCmd   `arg:"subcommand:calibrate" help:"measure how accurately this host can time the duty cycle of workers and recommend a --work-unit"`
+	Serve       *ServeCmd       `arg:"subcommand:serve" help:"run an agent that burns when told to by the orchestrate subcommand"`
+	Orchestrate *OrchestrateCmd `arg:"subcommand:orchestrate" help:"drive a synchronized run on a fleet of hosts running the serve subcommand, reporting their aggregate usage. Agents burn as told by --burn, --duration, --pattern, --min, --max, --period and --steps"`
+	Ctl         *CtlCmd         `arg:"subcommand:ctl" help:"send a command to a burner running with --control-socket or --listen, eg ctl --socket /run/cpu-burner.sock set 2.5 or ctl --address host:8080 pause"`
+	Bench       *BenchCmd       `arg:"subcommand:bench" help:"run the int, float and sha256 workloads on every core for a few seconds and print a per core throughput score, comparable across hosts"`
+	Chaos       *ChaosCmd       `arg:"subcommand:chaos" help:"burn what a chaos experiment asks its stress image for, from the environment variables of litmus cpu hog experiments or the workers and load of chaos mesh stressors, so cpu-burner can stand in for stress-ng. Running cpu-burner as stress-ng, through a symlink or with stress-ng as the first argument, takes the --cpu, --cpu-load and --timeout options of stress-ng instead"`
+	Record      *RecordCmd      `arg:"subcommand:record" help:"sample the cpu usage of the host or of a process over time and write it as a trace that --replay burns"`
+
+	Config           string        `arg:"-c,--config" help:"read options from this YAML or JSON file, using the long flag names as keys. Flags passed on the command line take precedence. The file is reloaded on SIGHUP, applying changes to burn and log-every"`
+	Burn             string        `arg:"-b,--burn" default:"1" help:"how much cpu to burn. Can be specified in 3 different ways: as a float/integer, representing how many cores/fraction of a core. Eg 1.5 means 1 core and a half; in kubernetes millicores, eg 1500m also means 1 core and a half; as a percentage, indicating total system capacity percentage (see --relative-to). Eg on a 4 cores system, 100% means all 4 cores, 50% means 2 cores and 62.5% means 2 cores and a half. A per core load can also be given as a list of cpu:load pairs, eg 0:1,3:0.5 fully loads cpu 0 and half loads cpu 3, pinning a worker to each (linux only). Targets set later, eg by patterns or the control api, scale that shape. Finally, an expression of host facts, eg numcpu-2 or min(4, numcpu*0.5), see the README"`
+	RelativeTo       string        `arg:"--relative-to" default:"auto" help:"what percentages given to --burn and other burn options are relative to: auto uses the cpus this process can actually use, which are the ones it is allowed to run on capped by the cpu limit of its cgroup, eg inside a container; host uses all cpus of the system; cgroup uses the cpu limit of the cgroup the process runs in (cpu.max on cgroup v2, cpu.cfs_quota_us on v1), eg inside a container. Falls back to host when there is no limit. Measured again every 10s, so cpus hot added to a virtual machine or a pod resized in place rescale targets given as percentages"`
+	SelfLimit        string        `arg:"--self-limit" help:"move the process into a cgroup of its own limited to this many cpus before burning, eg 2cpus, 1.5 or 500m, to test behavior under a known limit without setting one up. A command given after -- runs under the limit too. The cgroup is removed on exit. Supports cgroup v1 and v2, where it needs the cpu controller next to the cgroup of the process, or the process to be alone in its cgroup, eg in a container. Linux only, usually needs root"`
+	Duration         time.Duration `arg:"-d,--duration" default:"0" help:"for how long to run. Pass 0 to run indefinitely"`
+	CPUSeconds       float64       `arg:"--cpu-seconds" default:"0" help:"stop once the process consumed this much cpu time, in cpu seconds, however long it takes. Can be combined with --duration, stopping at whichever comes first. Use 0 to disable it"`
+	StateFile        string        `arg:"--state-file" help:"checkpoint how far into the schedule the run is and the cpu seconds burnt to this file every 10s, and resume from it when restarted with the same arguments, eg after a reboot or being killed for lack of memory, instead of starting the timeline over. --duration and --cpu-seconds cover every attempt. A run that finished is not started again, pair with Restart=on-failure under systemd"`
+	NoLockOSThread   bool          `arg:"--lock-os-thread" default:"false" help:"will make each goroutine used to consume cpu lock itself to a single OS thread, which should cause load to be concentrated on fewer cpus"`
+	CPUSet           string        `arg:"--cpuset" help:"only burn on these cpus, eg 0,2,4-7. Workers are locked to OS threads pinned to the set. Only supported on linux"`
+	Groups           []string      `arg:"--group,separate" help:"burn a named group alongside --burn in the same process, with its own target, cpus and priority, as name:burn followed by cpuset=CPUS and nice=N options, eg --group api:2:cpuset=0-3 --group batch:1.5:nice=10. Can be repeated. Every burner then measures only the cpu time of its own workers, and groups log their usage and summary apart. Pass --burn 0 to only burn the groups"`
+	NUMANode         string        `arg:"--numa-node" help:"only burn on the cpus of this NUMA node, or pass spread to balance workers over all nodes, pinning each one to a node. Only supported on linux"`
+	SMT              string        `arg:"--smt" help:"place workers according to smt siblings, the hardware threads sharing a physical core: avoid pins every worker to a core of its own, as long as there are enough of them; prefer pins workers to both threads of a core before moving on to the next one; only-siblings does the same using only cores that have smt siblings. Applies within --cpuset or --numa-node when given. Only supported on linux"`
+	Placement        string        `arg:"--placement" help:"place workers according to the cpu topology: spread-by-socket and spread-by-l3 balance workers between sockets or l3 cache domains, pinning each one to a domain; pack-by-socket and pack-by-l3 pin workers to the cpus of a socket or l3 cache domain before moving on to the next one. Applies within --cpuset or --numa-node when given. The detected topology is logged at startup. Only supported on linux"`
+	WorkUnit         time.Duration `arg:"--work-unit" default:"1ms" help:"period of the duty cycle of workers: during each work unit a worker spins for its share and sleeps for the rest. Shorter units spread the load more evenly over time, longer ones are more accurate on hosts with coarse timers. See the calibrate subcommand"`
+	AdaptiveWorkUnit bool          `arg:"--adaptive-work-unit" default:"false" help:"start at --work-unit and keep resizing it while burning: doubled when sleeps overshoot by more than 5% of it, as on virtual machines with coarse timers, and halved when they overshoot by less than 1%, between 100us and 50ms"`
+	SleepStrategy    string        `arg:"--sleep-strategy" default:"sleep" help:"how workers spend the idle part of the duty cycle: sleep sleeps through it; yield and spinwait sleep through most of it and wait for the rest on cpu, yielding to other goroutines or spinning on the clock, which is more accurate on hosts where sleeps overshoot at the cost of some extra cpu"`
+	Controller       string        `arg:"--controller" default:"pid" help:"how worker timings are corrected against the measured cpu usage: pid uses a proportional-integral-derivative feedback loop that converges quickly; step nudges timings by 1% whenever usage is off by more than 0.5%"`
+	Workload         string        `arg:"--workload" default:"spin" help:"what workers do while burning: spin runs a tight loop in user space; int runs chains of integer multiplies, adds, shifts and xors; float runs fused multiply-adds, keeping the floating point and vector units busy, which draws more power and heat than spin; sha256 hashes with crypto/sha256; branch takes data dependent branches the cpu cannot predict, keeping cores busy at a low instructions per cycle rate; matrix multiplies dense matrices, mixing floating point arithmetic with cached memory accesses (see --matrix-size); alloc allocates heap memory, burning cpu on allocations and garbage collection, to exercise the memory subsystem like a gc heavy service; goroutines continuously spawns short-lived goroutines, to stress the runtime scheduler (see --goroutine-*); switch forces context switches by ping-ponging between pairs of threads over pipes, burning mostly system time (see --switch-rate, not supported on windows); contend has workers fight over shared locks, burning cpu on cache line bouncing and futexes with little useful work (see --contend-*); syscall makes system calls in a tight loop, burning system time with a configurable user/system split (see --syscall*, not supported on windows); fd opens and closes file descriptors in a tight loop, pressuring the fd, dentry and socket paths of the kernel (see --fd-*); timer arms short high resolution timers and spins while they fire, generating timer interrupt and softirq pressure (see --timer-*, linux only); cache walks buffers sized to overflow cpu caches, thrashing them for whatever else runs on the same cores (see --cache-*); stream runs STREAM like copy, scale, add and triad kernels over large arrays, saturating memory bandwidth (see --stream-*); power keeps the vector units busy with wide fused multiply-adds while copying through memory, drawing as much power as it can for facility and thermal testing (needs --allow-power-virus)"`
+	AllocObjectSize  string        `arg:"--alloc-object-size" default:"1KiB" help:"size of each allocation made by the alloc workload"`
+	AllocLiveSet     string        `arg:"--alloc-live-set" default:"64MiB" help:"how much of the latest allocations the alloc workload keeps reachable, which the garbage collector traces on every cycle"`
+	AllocRate        string        `arg:"--alloc-rate" help:"cap the heap allocation rate of the alloc workload, eg 500MB/s. Workers spin once they are ahead of it. Allocates as fast as possible by default"`
+	GoroutineRate    float64       `arg:"--goroutine-rate" default:"0" help:"cap how many goroutines the goroutines workload spawns per second. Workers spin once they are ahead of it. Spawns as fast as possible by default"`
+	GoroutineWork    time.Duration `arg:"--goroutine-work" default:"10us" help:"how long each goroutine spawned by the goroutines workload spins before exiting"`
+	SwitchRate       float64       `arg:"--switch-rate" default:"0" help:"cap how many context switches per second the switch workload forces. Workers spin once they are ahead of it. Switches as fast as possible by default"`
+	ContendMode      string        `arg:"--contend-mode" default:"mutex" help:"what workers of the contend workload fight over: mutex takes shared mutexes; atomic updates shared atomic counters"`
+	ContendRatio     float64       `arg:"--contend-ratio" default:"0.5" help:"fraction of the operations of the contend workload that touch shared state, from 0 to 1. The rest only touch state private to each worker"`
+	ContendLocks     int           `arg:"--contend-locks" default:"1" help:"how many shared locks the contend workload spreads operations over. The fewer, the more contention"`
+	Syscall          string        `arg:"--syscall" default:"read" help:"which system call the syscall workload makes: getpid is the cheapest round trip to the kernel; read reads a page from /dev/zero"`
+	SyscallSystem    float64       `arg:"--syscall-system" default:"1" help:"fraction of the burn the syscall workload spends making system calls, from 0 to 1. The rest is spent spinning in user space"`
+	FDMode           string        `arg:"--fd-mode" default:"create" help:"what the fd workload opens and closes: open opens the null device, churning the file descriptor table; create creates and removes a file in --fd-dir, also churning dentries and inodes; socket opens an udp socket on localhost"`
+	FDRate           float64       `arg:"--fd-rate" default:"0" help:"cap how many file descriptors per second the fd workload opens and closes. Workers spin once they are ahead of it. Opens as fast as possible by default"`
+	FDDir            string        `arg:"--fd-dir" help:"directory the fd workload creates its files in with --fd-mode create. Defaults to the temporary directory of the system"`
+	TimerRate        float64       `arg:"--timer-rate" default:"0" help:"cap how many timers per second the timer workload arms. Workers spin once they are ahead of it. Arms them as fast as possible by default"`
+	TimerInterval    time.Duration `arg:"--timer-interval" default:"10us" help:"how long after being armed the timers of the timer workload fire. Shorter intervals fire more of them before they are re-armed"`
+	CacheSize        string        `arg:"--cache-size" default:"32MiB" help:"size of the buffer each worker of the cache workload walks. Pick it above the size of the cache level to thrash, eg L2 or L3"`
+	CacheStride      string        `arg:"--cache-stride" default:"64B" help:"distance between the accesses of the cache workload. 64B touches every cache line on most cpus, larger strides can also defeat prefetchers"`
+	StreamSize       string        `arg:"--stream-size" default:"64MiB" help:"size of each of the three arrays every worker of the stream workload goes through. Should be several times the last level cache"`
+	StreamRate       string        `arg:"--stream-rate" help:"target memory bandwidth of the stream workload, counting bytes read and written, eg 10GB/s. Workers spin once they are ahead of it. Moves as fast as possible by default"`
+	AllowPowerVirus  bool          `arg:"--allow-power-virus" help:"allow the power workload, which may draw more power than the host cooling or power supply is rated for, throttling or even shutting it down"`
+	Iterations       float64       `arg:"--iterations" default:"0" help:"burn this many iterations of the spin loop per second, between all workers, instead of a share of cpu time, so the work done is the same on every run regardless of clock and scheduler jitter. Workers sleep once they are ahead of it. --burn then caps how many cpus the rate may take, so it should leave room for it. Only works with the spin workload"`
+	MatrixSize       int           `arg:"--matrix-size" default:"128" help:"number of rows and columns of the matrices the matrix workload multiplies. Every worker uses three of them"`
+	Nice             int           `arg:"--nice" default:"0" help:"niceness of every thread of the process, from -20 (highest priority, needs privileges) to 19 (lowest priority), eg 19 for background pressure that yields to real work"`
+	Sched            string        `arg:"--sched" help:"linux scheduling policy of every thread of the process: other, batch, idle, or the realtime fifo and rr which need --rtprio and privileges, eg fifo for pressure that preempts regular work [default: other]"`
+	RTPrio           int           `arg:"--rtprio" default:"0" help:"realtime priority from 1 to 99 for --sched fifo or rr"`
+	IdleOnly         bool          `arg:"--idle-only" default:"false" help:"run workers under the linux SCHED_IDLE policy, so they only burn cycles no other work wants and get out of the way of anything else. Combine with a --burn as high as the cpus available, eg 100%, to keep every spare cycle busy"`
+	ThreadStats      bool          `arg:"--thread-stats" default:"false" help:"measure the cpu time of the OS thread of each worker and log how close each one is to its share alongside the cpu usage, along with the cpu it last ran on and how long it waited for a cpu (linux only), which points at threads sharing their cpu with other work. Workers are always locked to OS threads when enabled"`
+	SelfStats        bool          `arg:"--self-stats" default:"false" help:"log the resident memory, threads and voluntary and involuntary context switches of the burner itself alongside the cpu usage, to prove its own footprint is not what is being measured (linux only)"`
+	HostStats        bool          `arg:"--host-stats" default:"false" help:"log the cpu usage of the whole host, how much of it others than the burner used and the host load average alongside the cpu usage of the burner, to tell an undershoot apart from a host that was already saturated. The load average is not available on windows"`
+	StealCompensate  bool          `arg:"--steal-compensate" default:"false" help:"on virtual machines, measure the share of the busy cpu time of the host the hypervisor steals and run workers that much longer, adding workers when needed, so the usage the guest sees still reaches the target instead of falling short. Steal is always logged alongside the cpu usage once some is seen, and up to 50% of it is made up for (linux only)"`
+	LatencyProbe     time.Duration `arg:"--latency-probe" default:"0" help:"measure scheduling latency while burning: a thread repeatedly sleeps for this long, eg 1ms, and how late it wakes up is logged as the p50, p99 and max latency of every log interval and of the whole run. Use 0 to disable it"`
+	FollowPID        int           `arg:"--follow-pid" help:"mirror the cpu usage of this process, measured every second, instead of burning --burn. The run stops once the process exits. See --follow-scale"`
+	FollowScale      float64       `arg:"--follow-scale" default:"1" help:"multiply the usage of the process followed by --follow-pid by this factor, eg 2 burns twice as much as it uses"`
+	Antagonist       string        `arg:"--antagonist" help:"burn this multiple of the cpu usage of the command given after --, eg 1.5x, instead of burning --burn, to emulate a noisy neighbor proportional to it. The usage is measured every second over the command and all its descendants, on windows over the command alone. Not supported on darwin"`
+	TargetURL        string        `arg:"--target-url" help:"burn the number returned by this http url, polled every --target-every, instead of --burn. The response accepts the same syntax as --burn, eg 2.5 or 50%. See --target-query to poll prometheus instead"`
+	TargetQuery      string        `arg:"--target-query" help:"poll this prometheus query instead, with --target-url being the address of the prometheus server, eg http://prometheus:9090. The query must return a scalar or a single sample, in cpus"`
+	TargetEvery      time.Duration `arg:"--target-every" default:"15s" help:"how often --target-url is polled, --burn-from-file read or the cgroup limit of --of-limit read. The current target is kept when a poll fails"`
+	TargetScale      float64       `arg:"--target-scale" default:"1" help:"multiply the value polled from --target-url or read from --burn-from-file by this factor, eg 0.001 when it is in millicores"`
+	BurnFromEnv      string        `arg:"--burn-from-env" help:"burn the value of this environment variable instead of --burn, eg BURN_TARGET. Accepts the same syntax as --burn"`
+	BurnFromFile     string        `arg:"--burn-from-file" help:"burn the number in this file instead of --burn, re-read every --target-every and scaled by --target-scale, eg the cpu limit of a kubernetes pod exposed through the downward api at /etc/podinfo/cpu_limit. Accepts the same syntax as --burn. The current target is kept when a read fails"`
+	OfLimit          string        `arg:"--of-limit" help:"burn this percentage of the cpu limit of the cgroup the process runs in instead of --burn, eg 75% in a kubernetes pod, re-reading the limit every --target-every so in place resizes are followed. Linux only"`
+	FillTo           string        `arg:"--fill-to" help:"keep the whole host at this cpu utilization, eg 80%, instead of burning --burn: the usage of everything else running on the host is read from /proc/stat every --fill-every and only the difference is burned, backing off as other workloads ramp up. Not supported on darwin"`
+	FillEvery        time.Duration `arg:"--fill-every" default:"1s" help:"how often --fill-to measures the host usage"`
+	MaxTemp          string        `arg:"--max-temp" help:"keep the cpu temperature under this limit, eg 85C, reading the hottest cpu sensor every second from hwmon or thermal zones (linux only). See --max-temp-action"`
+	MaxTempAction    string        `arg:"--max-temp-action" default:"pause" help:"what to do once the cpu temperature reaches --max-temp: pause stops burning until it falls 5C under the limit; stop ends the run"`
+	MaxLoadavg       float64       `arg:"--max-loadavg" help:"pause the burn while the 1 minute load average of the host is over this, eg 16, resuming once it falls under 90% of it. The load of the burner itself counts too, and as the load average moves slowly resuming takes a while. Not supported on windows"`
+	MaxHostCPU       string        `arg:"--max-host-cpu" help:"cap the burn so the whole host stays under this cpu utilization, eg 90%: the usage of everything else running on the host is read every second and the burn is reduced, down to nothing, to stay under it. Not supported on darwin"`
+	Processes        int           `arg:"--processes" default:"1" help:"split the burn between this many worker processes, each one a copy of this process burning an equal part of the target. The parent aggregates the usage they report. Cannot be combined with the http, metrics and exporter options, --out, --report-file, --pause-signals, --thread-stats or a per core --burn"`
+	Supervise        bool          `arg:"--supervise" default:"false" help:"with --processes, restart worker processes that crash or get killed, eg by the OOM killer, instead of stopping the run. The running processes take over the share of the missing ones until they are back"`
+	RestartDelay     time.Duration `arg:"--restart-delay" default:"1s" help:"how long --supervise waits before restarting a failed worker process. The wait doubles every time the same process fails again soon after being restarted, up to a minute"`
+	MaxRestarts      int64         `arg:"--max-restarts" default:"0" help:"with --supervise, stop the run once worker processes were restarted this many times in total. Use 0 to restart them for as long as the run lasts"`
+	StartAfter       time.Duration `arg:"--start-after" default:"0" help:"wait this long before burning. --duration counts from the start of the burn"`
+	StartJitter      time.Duration `arg:"--start-jitter" default:"0" help:"wait up to this much longer before burning, picked at random, so a fleet started at once does not spike all at the same time"`
+	StartAt          string        `arg:"--start-at" help:"start burning at this time, in RFC 3339 format, eg 2024-07-01T12:00:00Z, so instances launched independently on many hosts spike at the same moment. Relies on the clocks of the hosts being in sync, eg through ntp. Starts right away when the time already passed"`
+	Align            time.Duration `arg:"--align" default:"0" help:"delay the start to the next multiple of this duration in wall-clock time, counted from the unix epoch, eg 1m starts on the next minute. Applies after --start-at or --start-after"`
+	DryRun           bool          `arg:"--dry-run" default:"false" help:"print what the run would do, the workers it would start and how the target changes over time, then exit without burning"`
+	LogEvery         time.Duration `arg:"-l,--log-every" default:"10s" help:"how often to log actual cpu usage. Use 0 to disable it"`
+	SampleEvery      time.Duration `arg:"--sample-every" default:"0" help:"measure the cpu usage this often, eg 100ms, instead of once per --log-every. Every log line then covers all samples taken since the previous one, with their min, max and standard deviation, which shows short gaps such as throttling that the average hides. Summaries, --out and metrics get every sample. Pass 0 to sample as often as logging"`
+	LogFormat        string        `arg:"--log-format" default:"text" help:"log format: text or json"`
+	LogTarget        string        `arg:"--log-target" default:"stderr" help:"where to log: stderr, syslog or journald, eg when running as a systemd service. Warnings and errors keep their priority. Not supported on windows"`
+	Verbose          bool          `arg:"-v,--verbose" default:"false" help:"enable debug logging, the same as --log-level debug, which adds how every worker splits its work units. -vv is the same as --log-level trace"`
+	LogLevel         string        `arg:"--log-level" default:"info" help:"least severe level to log: error; warn, adding throttling, thermal and failed polls; info, adding the periodic usage; debug, adding how every worker splits its work units; or trace, adding every adjustment window of the controller"`
+	Quiet            bool          `arg:"-q,--quiet" default:"false" help:"disable all logging. Combine with --summary-json or --summary-line to still get the result of the run on stdout"`
+	LogFile          string        `arg:"--log-file" help:"write logs to this file instead of stderr, rotating it by size and age, eg for soak runs lasting days. Logs of --processes children go there too"`
+	LogMaxSize       string        `arg:"--log-max-size" default:"100MiB" help:"rotate the --log-file once it would grow over this size, eg 100MiB. Use 0 to disable it"`
+	LogMaxAge        time.Duration `arg:"--log-max-age" default:"24h" help:"rotate the --log-file once it has been written to for this long. Use 0 to disable it"`
+	LogKeep          int           `arg:"--log-keep" default:"5" help:"how many rotated log files to keep, named after the --log-file with a .1 to .<keep> suffix, .1 being the most recent. Use 0 to only keep the current one"`
+	Pattern          string        `arg:"--pattern" default:"constant" help:"how the burn target changes over time: constant burns --burn all the time; sine oscillates between --min and --max every --period; randomwalk drifts randomly between --min and --max, taking a step every --period (1s by default); poisson burns --burn plus --burst-size for every burst in progress, with bursts lasting --burst-len and arriving at random, --burst-rate times on average"`
+	Period           time.Duration `arg:"--period" default:"0" help:"period of the sine pattern, or how often the randomwalk pattern takes a step"`
+	Seed             uint64        `arg:"--seed" default:"0" help:"seed for randomized patterns, so runs can be reproduced. Use 0 to pick a random one"`
+	Min              string        `arg:"--min" help:"lowest burn target used by patterns. Same syntax as --burn"`
+	Max              string        `arg:"--max" help:"highest burn target used by patterns. Same syntax as --burn"`
+	BurstRate        string        `arg:"--burst-rate" help:"how often bursts of the poisson pattern arrive on average, eg 2/min or 0.5/s"`
+	BurstSize        string        `arg:"--burst-size" help:"how much every burst of the poisson pattern burns on top of --burn. Same syntax as --burn"`
+	BurstLen         time.Duration `arg:"--burst-len" default:"5s" help:"how long every burst of the poisson pattern lasts"`
+	BurnRange        string        `arg:"--burn-range" help:"burn a random target picked uniformly within this range, eg 0.5-2.0, and pick a new one every --change-every. Bounds use the same syntax as --burn. Reproducible with --seed"`
+	ChangeEvery      time.Duration `arg:"--change-every" default:"30s" help:"how often --burn-range picks a new target"`
+	Steps            string        `arg:"--steps" help:"run a sequence of burn levels, each for a given duration, then exit. Eg 1:30s,2.5:2m,50%:1m. Levels use the same syntax as --burn"`
+	Schedule         string        `arg:"--schedule" help:"load a timeline of burn levels from a YAML or JSON file. Each phase has a burn and a duration, and can override lock_os_thread, workload, sleep_strategy and cpuset, where a cpuset of all leaves workers unpinned. The run exits at the end of the timeline. The file may list load states instead, switching between them at random: each has a burn, a dwell time such as 2m or 1m-5m and the probabilities of moving to every other state once over, and runs until --duration or interrupted. Reproducible with --seed"`
+	Replay           string        `arg:"--replay" help:"replay a recorded cpu utilization trace as the burn target, from a csv file with timestamp and cores columns or a JSON list of {timestamp, cores} samples. Each sample is burned until the next one, and the run exits at the end of the trace. Cores use the same syntax as --burn"`
+	ReplaySpeed      float64       `arg:"--replay-speed" default:"1" help:"how many times faster than it was recorded --replay plays the trace, eg 2 to replay it in half the time or 0.5 to stretch it to twice as long"`
+	Burst            string        `arg:"--burst" help:"alternate between burning the target and staying idle, eg on=5s,off=25s"`
+	Cron             string        `arg:"--cron" help:"stay idle and only burn during windows starting every time this cron expression fires, eg \"*/15 * * * *\""`
+	CronBurn         string        `arg:"--cron-burn" help:"how much cpu to burn during cron windows. Same syntax as --burn. Defaults to --burn"`
+	CronDuration     time.Duration `arg:"--cron-duration" default:"0" help:"how long each cron window lasts"`
+	RampUp           time.Duration `arg:"--ramp-up" default:"0" help:"linearly increase the burn from 0 to the target during this initial period"`
+	RampDown         time.Duration `arg:"--ramp-down" default:"0" help:"linearly decrease the burn from the target to 0 during this final period. Requires --duration"`
+	Drain            time.Duration `arg:"--drain" default:"0" help:"once the run is over, be it at the end of --duration or on SIGINT or SIGTERM, linearly decrease the burn to 0 during this period instead of stopping abruptly. With --duration the drain is its last part. A second signal stops right away"`
+	Slew             string        `arg:"--slew" help:"apply every change of the target gradually, at most this fast, instead of as a step, be it from a pattern, a schedule, the control api or a signal, eg 0.5cores/s, 2cpus/m or 10%/s. Avoids the measurement artifacts of instant retargets and tripping rate-based alerts. Pausing and resuming still take effect right away"`
+	Warmup           time.Duration `arg:"--warmup" default:"0" help:"leave the first part of the run, with the process start, the creation of workers and cpu frequency ramps, out of the run summary, reports and --assert-tolerance. Usage logged meanwhile is marked with warmup=true"`
+	Mem              string        `arg:"-m,--mem" help:"how much memory to hold resident while burning cpu. Can be specified as a size, eg 512MiB, 2GiB or 1GB, or as a percentage of the total system memory, eg 30%"`
+	MemTouchEvery    time.Duration `arg:"--mem-touch-every" default:"5s" help:"how often to touch every page of the memory held by --mem so it stays resident. Use 0 to only touch it once"`
+	MemPolicy        string        `arg:"--mem-policy" help:"where the memory of --mem and of the cache and stream workloads is allocated: local on the numa node of the worker using it; interleave page by page over every node; node=N only on node N, or on a list of nodes, eg node=1 or node=0-1. Pinning workers with --numa-node to one node and memory to another makes every access cross the interconnect. Only supported on linux"`
+	IO               string        `arg:"--io" help:"generate disk io load at this throughput while burning cpu, eg 50MB/s. It idles whenever the cpu burn is paused or at 0, following its schedule"`
+	IOPath           string        `arg:"--io-path" help:"directory in which a scratch file is created for --io, and removed once done. Defaults to the system temporary directory"`
+	IOMode           string        `arg:"--io-mode" default:"write" help:"which io operations to perform for --io: read, write or mixed. Note that reads are likely to be served from the page cache"`
+	IOBlockSize      string        `arg:"--io-block-size" default:"64KiB" help:"size of each io operation performed by --io"`
+	IOFileSize       string        `arg:"--io-file-size" default:"256MiB" help:"size of the scratch file used by --io"`
+	IOFsync          bool          `arg:"--io-fsync" default:"false" help:"fsync after every write performed by --io"`
+	IORandom         bool          `arg:"--io-random" default:"false" help:"access the scratch file at random offsets instead of sequentially"`
+	Net              string        `arg:"--net" help:"generate network load at this throughput while burning cpu, eg 100Mbps or 10MB/s. Follows the schedule of the cpu burn like --io. Requires --net-target"`
+	NetTarget        string        `arg:"--net-target" help:"host:port to send network load to. Use the sink subcommand to run a receiving end"`
+	Spawn            float64       `arg:"--spawn" default:"0" help:"spawn this many short lived child processes per second while burning cpu, stressing process creation, exec and reaping like ci agents or cron storms do. Follows the schedule of the cpu burn like --io"`
+	SpawnCommand     string        `arg:"--spawn-command" help:"command the children of --spawn run, split on spaces, eg '/bin/true'. Defaults to a copy of the burner exiting as soon as it starts"`
+	SpawnMax         int           `arg:"--spawn-max" default:"64" help:"the most children of --spawn running at once. Spawns beyond it are skipped, so slow commands cannot pile processes up"`
+	WorkerChurn      float64       `arg:"--worker-churn" default:"0" help:"how many times per second a worker goroutine is spawned or reaped while keeping the aggregate load constant. Useful to stress the scheduler handling of goroutine lifecycle. Use 0 to disable it"`
+	Listen           string        `arg:"--listen" help:"serve an http control api on this address, eg :8080. Supports GET /target, PUT /target with a {\"burn\": \"2.5\"} body, POST /pause, POST /resume, POST /stop, GET /stats and GET /samples, streaming every usage sample as server-sent events, a web dashboard at / charting the usage live with controls to change the target, along with GET /healthz and GET /readyz probes returning the burner state: starting, burning or draining. /readyz only succeeds while burning"`
+	MetricsListen    string        `arg:"--metrics-listen" help:"serve prometheus metrics at /metrics on this address, eg :9100, along with the /healthz and /readyz probes. Metrics are also served by --listen"`
+	GRPCListen       string        `arg:"--grpc-listen" help:"serve a grpc control api on this address, eg :9090, over cleartext http/2. Supports SetTarget, GetStats, StreamStats, Pause and Resume, see proto/burner.proto"`
+	ControlSocket    string        `arg:"--control-socket" help:"accept commands on a unix socket at this path, eg /run/cpu-burner.sock, for hosts where opening tcp ports is not allowed. Commands are sent one per line: set <burn>, status, pause, resume and stop. See the ctl subcommand"`
+	TargetFile       string        `arg:"--target-file" help:"watch this file, checked every second, and set the target to its contents whenever they change, eg echo 2.5 > /tmp/burn-target. Accepts the same syntax as --burn. A missing or empty file leaves the target alone"`
+	Interactive      bool          `arg:"--interactive" default:"false" help:"read commands from stdin, one per line, and print their responses to stdout: set <burn>, status, pause, resume, and stop or quit"`
+	Dashboard        bool          `arg:"--dashboard" default:"false" help:"show a live view of the run on the terminal, redrawn every half second instead of scrolling logs: target and achieved usage, a bar per worker, cpu frequency and cgroup throttling. The latest log lines are shown under it, unless they go to --log-file or another --log-target. Pair with --thread-stats to see what each worker burned"`
+	Pprof            string        `arg:"--pprof" help:"serve the go runtime profiles of net/http/pprof at /debug/pprof/ on this address, eg :6060, to inspect how the burner itself is scheduled"`
+	CPUProfile       string        `arg:"--cpuprofile" help:"write a cpu profile of the burner itself over the run to this file, to inspect with go tool pprof"`
+	TraceProfile     string        `arg:"--traceprofile" help:"write an execution trace of the burner itself over the run to this file, to inspect with go tool trace, eg to check which os threads the workers ran on and how they were scheduled"`
+	OTelEndpoint     string        `arg:"--otel-endpoint" help:"push target and achieved cpus and worker counts to this OpenTelemetry collector using OTLP over http, eg http://localhost:4318. Metrics are pushed every time usage is sampled"`
+	Statsd           string        `arg:"--statsd" help:"push target and achieved cpus gauges over udp to this statsd agent, eg localhost:8125. Gauges are pushed every time usage is sampled"`
+	StatsdFormat     string        `arg:"--statsd-format" default:"dogstatsd" help:"statsd protocol flavor: statsd or dogstatsd. Only dogstatsd sends labels, as tags"`
+	Out              string        `arg:"--out" help:"write every usage sample (timestamp, target, achieved and delta) as csv to this file"`
+	SignalStep       float64       `arg:"--signal-step" default:"0.25" help:"how many cpus SIGUSR1 adds to and SIGUSR2 removes from the target. Use 0 to ignore those signals"`
+	PauseSignals     bool          `arg:"--pause-signals" default:"false" help:"pause burning on SIGTSTP (eg ctrl+z) and resume on SIGCONT instead of suspending the process. The duration clock keeps running while paused"`
+	SummaryJSON      bool          `arg:"--summary-json" default:"false" help:"print a json summary of the run to stdout once it finishes: mean, median and p95 achieved cpus, cpu seconds, samples and cgroup throttling among others"`
+	SummaryLine      bool          `arg:"--summary-line" default:"false" help:"print a single line summary of the run to stdout once it finishes, as key=value pairs: mean and p95 achieved cpus, mean target, accuracy, cpu seconds, wall time and samples"`
+	AssertTolerance  string        `arg:"--assert-tolerance" help:"exit with a non-zero status when the mean achieved cpu usage deviates from the mean target by more than this percentage of it, eg 5%, for validating cpu limits in CI"`
+	FailOnThrottle   bool          `arg:"--fail-on-throttle" default:"false" help:"stop and exit with status 3 as soon as the cgroup cpu limit throttles the process, eg to prove limits are not in effect. Runs without a cgroup cpu limit are never throttled"`
+	ReportFile       string        `arg:"--report-file" help:"write a markdown report of the run to this file once it finishes"`
+	ReportURL        string        `arg:"--report-url" help:"POST the usage samples, every --log-every, and the summary of the run once it finishes to this url as json, retrying with backoff when the collector is unreachable. Meant for runs whose output is lost, eg in ephemeral ci runners"`
+	CPUHeatmap       string        `arg:"--cpu-heatmap" help:"record how busy every cpu of the host was each time usage is sampled and write it to this file once the run finishes, drawn as a heatmap with a row per cpu, or as csv with a column per cpu when the file ends in .csv. Shows which cores the burn landed on, eg with and without --lock-os-thread. Also added to --report-file. Linux only"`
+	PerfCounters     bool          `arg:"--perf-counters" help:"count cpu cycles, instructions, cache references and cache misses in user space for every thread of the burner with hardware performance counters, logging the instructions per cycle and cache miss rate with the usage and in the summary. Tells apart what workloads do with the same cpu time. Linux only, needs a pmu, which virtual machines often lack, and a kernel.perf_event_paranoid of 2 or less"`
+	Labels           []string      `arg:"--label,separate" help:"custom key=value label attached to every log line and metric. Can be repeated. Eg --label team=payments --label env=staging. The worker key is reserved"`
+	// Command is what follows -- on the command line, see splitCommand
+	Command []string `arg:"-"`
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the burner, or the subcommand given, returning the exit status of the process. Exiting
+// only once it returned lets deferred cleanups run, like removing the io scratch file
+func run() int {
+	if os.Getenv(spawnEnv) != "" {
+		// a child of --spawn, which only has to start
+		return 0
+	}
+	command := splitCommand()
+	applyStressNG()
+	expandVerbosity()
 	args := Args{}
-	parser := arg.MustParse(&args)
+	parser := mustParseArgs(&args)
+	if args.Config != "" {
+		var err error
+		args, err = loadConfig(args.Config, os.Args[1:])
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	args.Command = command
+	given, err := givenArgs(args.Config, os.Args[1:])
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	if err := args.applyCommand(given); err != nil {
+		parser.FailSubcommand(err.Error(), parser.SubcommandNames()...)
+	}
+	if err := args.burnFromEnv(); err != nil {
+		parser.Fail(err.Error())
+	}
+
+	labels, err := parseLabels(args.Labels)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
 
-	level := slog.LevelInfo
+	_, _, child := childProcess()
+	level, err := parseLogLevel(args.LogLevel)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
 	if args.Verbose {
-		level = slog.LevelDebug
+		level = min(level, slog.LevelDebug)
+	} else if child && level == slog.LevelInfo {
+		// the parent process logs the run, children only log problems
+		level = slog.LevelWarn
+	}
+	if args.LogFile != "" && args.LogTarget != "stderr" {
+		parser.Fail("--log-file requires --log-target stderr")
+	}
+	if args.LogFile != "" && !child {
+		// children write to the stderr the parent gave them, which ends up in the same file
+		maxSize, err := parseBytes(args.LogMaxSize)
+		if err != nil {
+			parser.Fail(fmt.Sprintf("invalid log max size value: %s", args.LogMaxSize))
+		}
+		file, err := newRotatingFile(args.LogFile, maxSize, args.LogMaxAge, args.LogKeep)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+		defer file.Close()
+		logOutput = file
+	}
+	if args.Dashboard && args.Interactive {
+		parser.Fail("--dashboard cannot be combined with --interactive")
+	}
+	var dashboardLogs *dashboardLog
+	if args.Dashboard && args.LogFile == "" && args.LogTarget == "stderr" && !child {
+		// logs would scroll the dashboard away, it shows the latest ones instead
+		dashboardLogs = &dashboardLog{}
+		logOutput = dashboardLogs
+	}
+	handler, err := newTargetHandler(args.LogTarget, logOutput, args.LogFormat, level, labels)
+	if err != nil {
+		parser.Fail(err.Error())
 	}
-	opts := &slog.HandlerOptions{Level: level}
-	var handler slog.Handler
 	if args.Quiet {
 		handler = slog.DiscardHandler
-	} else {
-		handler = slog.NewTextHandler(os.Stderr, opts)
 	}
 	slog.SetDefault(slog.New(handler))
 
-	cpus, err := parseBurn(args.Burn)
+	if args.Sink != nil {
+		if err := runSink(context.Background(), args.Sink.Listen, args.Sink.Echo, args.LogEvery); err != nil {
+			slog.Error("sink failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if args.Ctl != nil {
+		if err := runCtl(os.Stdout, args.Ctl); err != nil {
+			slog.Error("command failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if args.Record != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnSignal(cancel)
+		if err := runRecord(ctx, args.Record); err != nil {
+			slog.Error("recording failed", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if args.Serve != nil || args.Orchestrate != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancelOnSignal(cancel)
+		if args.Serve != nil {
+			err = runServe(ctx, args.Serve)
+		} else {
+			err = runOrchestrate(ctx, args.Orchestrate, &args)
+		}
+		if err != nil {
+			slog.Error("run failed", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	selfLimit, err := parseSelfLimit(args.SelfLimit)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	budget, limited := cpuBudget()
+	if selfLimit > 0 && (!limited || selfLimit < budget) && selfLimit < float64(runtime.NumCPU()) {
+		// the limit is only in effect once the burn starts, percentages are relative to it already
+		budget, limited = selfLimit, true
+	}
+	switch args.RelativeTo {
+	case "auto":
+		capacity = budget
+		if limited {
+			slog.Debug("percentages are relative to the cgroup cpu limit", "pid", os.Getpid(), "cpus", budget)
+		}
+	case "host":
+	case "cgroup":
+		limit, limited, err := cgroupCPUs()
+		if err != nil {
+			parser.Fail(fmt.Sprintf("failed to read cgroup cpu limit: %s", err))
+		}
+		if selfLimit > 0 && (!limited || selfLimit < limit) {
+			limit, limited = selfLimit, true
+		}
+		if limited {
+			capacity = limit
+			slog.Info("percentages are relative to the cgroup cpu limit", "cpus", limit)
+		} else {
+			slog.Warn("no cgroup cpu limit found, percentages are relative to host cpus", "cpus", capacity)
+		}
+	default:
+		parser.Fail(fmt.Sprintf("invalid relative-to value: %s", args.RelativeTo))
+	}
+
+	if args.Calibrate != nil {
+		if err := runCalibrate(os.Stdout, args.Calibrate); err != nil {
+			slog.Error("calibration failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if args.Bench != nil {
+		if err := runBench(os.Stdout, args.Bench); err != nil {
+			slog.Error("benchmark failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if args.WorkUnit <= 0 {
+		parser.Fail("work unit must be positive")
+	}
+
+	cores, err := setupCores(args)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	var cpus float64
+	if cores != nil {
+		for _, load := range cores {
+			cpus += load
+		}
+	} else {
+		cpus, err = parseBurn(args.Burn)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+
+	workload, err := newWorkload(args)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+
+	var thermal *thermalGuard
+	if args.MaxTemp != "" {
+		thermal, err = newThermalGuard(args.MaxTemp, args.MaxTempAction)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+
+	var pressure *pressureGuard
+	if args.MaxLoadavg != 0 || args.MaxHostCPU != "" {
+		pressure, err = newPressureGuard(args.MaxLoadavg, args.MaxHostCPU)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+
+	if args.SummaryJSON && args.SummaryLine {
+		parser.Fail("--summary-json and --summary-line cannot be combined")
+	}
+	if args.AssertTolerance != "" {
+		if _, err := parseTolerance(args.AssertTolerance); err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+
+	if args.Controller != string(burn.ControllerPID) && args.Controller != string(burn.ControllerStep) {
+		parser.Fail(fmt.Sprintf("invalid controller value: %s", args.Controller))
+	}
+
+	switch burn.SleepStrategy(args.SleepStrategy) {
+	case burn.SleepStrategySleep, burn.SleepStrategyYield, burn.SleepStrategySpinWait:
+	default:
+		parser.Fail(fmt.Sprintf("invalid sleep-strategy value: %s", args.SleepStrategy))
+	}
+
+	if args.WorkerChurn < 0 {
+		parser.Fail("worker churn cannot be negative")
+	}
+	if args.SelfStats {
+		if _, err := selfResources(); err != nil {
+			parser.Fail(fmt.Sprintf("cannot use --self-stats: %s", err))
+		}
+	}
+	if args.HostStats {
+		if _, _, _, err := hostCPUTimes(); err != nil {
+			parser.Fail(fmt.Sprintf("cannot use --host-stats: %s", err))
+		}
+	}
+	if args.StealCompensate {
+		if _, _, err := hostStealTime(); err != nil {
+			parser.Fail(fmt.Sprintf("cannot use --steal-compensate: %s", err))
+		}
+	}
+	if args.CPUHeatmap != "" {
+		if _, err := perCPUTimes(); err != nil {
+			parser.Fail(fmt.Sprintf("cannot use --cpu-heatmap: %s", err))
+		}
+	}
+	if args.PerfCounters {
+		perf, err := newPerfMonitor()
+		if err != nil {
+			parser.Fail(fmt.Sprintf("cannot use --perf-counters: %s", err))
+		}
+		perf.Close()
+	}
+	var statsd *statsdExporter
+	if args.Statsd != "" {
+		statsd, err = newStatsdExporter(args.Statsd, args.StatsdFormat, labels)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	if args.LatencyProbe < 0 {
+		parser.Fail(fmt.Sprintf("invalid latency probe value: %s", args.LatencyProbe))
+	}
+	if args.Warmup < 0 {
+		parser.Fail("warmup cannot be negative")
+	}
+	if args.Duration > 0 && args.Warmup >= args.Duration {
+		parser.Fail("warmup must be shorter than the duration")
+	}
+
+	if err := validateProcesses(args); err != nil {
+		parser.Fail(err.Error())
+	}
+
+	if args.CPUSeconds < 0 {
+		parser.Fail("cpu seconds cannot be negative")
+	}
+
+	if args.StartAfter < 0 || args.StartJitter < 0 || args.Align < 0 {
+		parser.Fail("start after, start jitter and align cannot be negative")
+	}
+	if args.StartAt != "" && args.StartAfter > 0 {
+		parser.Fail("--start-at and --start-after cannot be combined")
+	}
+	var jitter time.Duration
+	if args.StartJitter > 0 {
+		jitter = rand.N(args.StartJitter)
+	}
+	start, err := startTime(args, time.Now(), jitter)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	if args.StartAt != "" && !start.After(time.Now()) {
+		slog.Warn("the start time already passed, starting right away", "pid", os.Getpid(), "start_at", args.StartAt)
+	}
+	if child {
+		// the parent already waited before spawning the children
+		start = time.Time{}
+	}
+
+	if args.Seed == 0 {
+		args.Seed = rand.Uint64()
+	}
+	if args.Pattern == "randomwalk" || args.Pattern == "poisson" || args.BurnRange != "" {
+		slog.Info("randomized pattern seed", "seed", args.Seed)
+	}
+	prof, duration, err := newProfile(args, cpus)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	args.Duration = duration
+	var checkpoint *stateCheckpointer
+	if args.StateFile != "" && !child {
+		checkpoint, err = newStateCheckpointer(args.StateFile, os.Args[1:])
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+		if checkpoint.Finished() {
+			slog.Info("the run already finished, as per its state file", "pid", os.Getpid(), "path", args.StateFile)
+			return 0
+		}
+		if checkpoint.Resuming() {
+			// the start was already waited for by the first attempt
+			start = time.Time{}
+			slog.Info("resuming the run from its state file", "pid", os.Getpid(), "path", args.StateFile,
+				"elapsed_ms", checkpoint.Offset().Milliseconds(), "cpu_seconds", decimal(checkpoint.PriorCPUSeconds(), 3))
+		}
+	}
+	offset, priorCPUSeconds := checkpoint.Offset(), checkpoint.PriorCPUSeconds()
+	if child {
+		// a child restarted by --supervise carries on where the run is instead of starting over
+		offset, priorCPUSeconds = childResume()
+	}
+	var follow *follower
+	if args.FollowPID != 0 {
+		follow, err = newFollower(args.FollowPID, args.FollowScale, time.Second, prof, false)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	var antagonist float64
+	if args.Antagonist != "" {
+		if len(args.Command) == 0 {
+			parser.Fail("--antagonist requires a command after --")
+		}
+		antagonist, err = parseAntagonist(args.Antagonist)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	var ofLimit *limitTracker
+	if args.OfLimit != "" {
+		ofLimit, err = newLimitTracker(args.OfLimit, args.TargetEvery, prof)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	var fill *filler
+	if args.FillTo != "" {
+		fill, err = newFiller(args.FillTo, args.FillEvery, prof)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	var external *externalTarget
+	if args.TargetURL != "" || args.BurnFromFile != "" {
+		external, err = newExternalTarget(args, prof)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	if child {
+		share := newShareProfile(prof)
+		go share.Follow(os.Stdin)
+		prof = share
+	}
+
+	var memBytes int64
+	if args.Mem != "" {
+		memBytes, err = parseMem(args.Mem)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+
+	if cpus > budget && limited {
+		slog.Warn("burn value exceeds the cgroup cpu limit", "burn", cpus, "cpus", budget)
+	} else if cpus > budget {
+		slog.Warn("burn value exceeds available CPUs", "burn", cpus, "cpus", budget)
+	}
+	setupGOMAXPROCS(budget, limited, cpus)
+
+	if topology, err := readTopology(); err != nil {
+		slog.Debug("failed to detect cpu topology", "pid", os.Getpid(), "error", err)
+	} else if !child {
+		sockets, dies, cores, threads, l3s := topology.counts()
+		slog.Info("cpu topology", "pid", os.Getpid(), "sockets", sockets, "dies", dies, "cores", cores, "threads", threads, "l3_domains", l3s)
+	}
+	cpuSets, err := setupCPUSets(args)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	if pinned := countCPUs(cpuSets); pinned > 0 && cpus > float64(pinned) {
+		slog.Warn("burn value exceeds the cpus workers are pinned to", "burn", cpus, "pinned_cpus", pinned)
+	} else if args.SMT == "avoid" && cpus > float64(len(cpuSets)) {
+		slog.Warn("burn value exceeds the physical cores, workers will share some", "burn", cpus, "cores", len(cpuSets))
+	}
+
+	priority, workerPriority, err := setupPriority(args)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+
+	var ioOpts ioOptions
+	if args.IO != "" {
+		ioOpts, err = parseIOOptions(args)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+
+	var netLoad *netBurner
+	if args.Net != "" {
+		rate, err := parseBitRate(args.Net)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+		if args.NetTarget == "" {
+			parser.Fail("--net requires --net-target")
+		}
+		netLoad = &netBurner{rate: rate, target: args.NetTarget}
+	}
+	var spawnLoad *spawnBurner
+	if args.Spawn < 0 {
+		parser.Fail(fmt.Sprintf("invalid spawn rate: %v", args.Spawn))
+	}
+	if args.Spawn > 0 {
+		if args.SpawnMax <= 0 {
+			parser.Fail(fmt.Sprintf("invalid spawn max: %d", args.SpawnMax))
+		}
+		spawnLoad, err = newSpawnBurner(args.Spawn, args.SpawnMax, args.SpawnCommand)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+	}
+	memPolicy, err := parseMemPolicy(args.MemPolicy)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	// with --processes only the parent generates the loads besides cpu, so children neither hold
+	// memory, nor create scratch files, nor send traffic of their own
+	var loads resources
+	if !child {
+		loads = resources{memBytes: memBytes, memPolicy: memPolicy, net: netLoad, spawn: spawnLoad}
+	}
+
+	if args.SampleEvery < 0 {
+		parser.Fail(fmt.Sprintf("invalid sample every value: %s", args.SampleEvery))
+	}
+	if args.SampleEvery > 0 && args.LogEvery > 0 && args.SampleEvery > args.LogEvery {
+		parser.Fail("--sample-every cannot be longer than --log-every")
+	}
+	sampleEvery := args.LogEvery
+	if args.SampleEvery > 0 {
+		sampleEvery = args.SampleEvery
+	}
+	if sampleEvery <= 0 {
+		sampleEvery = time.Second
+	}
+	slew, err := parseSlew(args.Slew)
+	if err != nil {
+		parser.Fail(err.Error())
+	}
+	opts := burn.Options{
+		Profile:          prof,
+		LockOSThread:     !args.NoLockOSThread,
+		CPUSets:          cpuSets,
+		Cores:            cores,
+		ThreadStats:      args.ThreadStats,
+		Controller:       burn.Controller(args.Controller),
+		Workload:         workload,
+		WorkUnit:         args.WorkUnit,
+		AdaptiveWorkUnit: args.AdaptiveWorkUnit,
+		SleepStrategy:    burn.SleepStrategy(args.SleepStrategy),
+		Priority:         workerPriority,
+		WorkerChurn:      args.WorkerChurn,
+		Drain:            args.Drain,
+		Slew:             slew * processShare(),
+		Warmup:           args.Warmup,
+		SampleEvery:      sampleEvery,
+		Offset:           offset,
+		Record:           true,
+	}
+	groups, err := parseGroups(args.Groups)
 	if err != nil {
 		parser.Fail(err.Error())
 	}
+	// the burners share the process, so each one can only tell its own usage by its threads
+	opts.Isolated = len(groups) > 0
+	if args.DryRun {
+		printPlan(os.Stdout, args, prof, args.Duration, opts, groups)
+		return 0
+	}
 
-	if cpus > float64(runtime.NumCPU()) {
-		slog.Warn("burn value exceeds available CPUs", "burn", cpus, "cpus", runtime.NumCPU())
+	// the scratch file is only created once the invocation is validated, and never by dry runs
+	if args.IO != "" && !child {
+		loads.io, err = newIOBurner(ioOpts)
+		if err != nil {
+			parser.Fail(err.Error())
+		}
+		defer loads.io.Close()
 	}
 
-	ctx := context.Background()
+	if priority != nil {
+		// every thread gets it, and threads created later inherit it. Workers set theirs again on
+		// their own thread when they start
+		if err := burn.SetProcessPriority(*priority); err != nil {
+			slog.Error("failed to set scheduling priority", "pid", os.Getpid(), "priority", formatPriority(*priority), "error", err)
+			return 1
+		}
+	}
+
+	startAttrs := []any{"pid", os.Getpid(), "cpus", cpus}
+	if _, ok := prof.(burn.Constant); !ok {
+		startAttrs = []any{"pid", os.Getpid(), "initial_cpus", prof.Target(offset)}
+	}
+	if args.CPUSeconds > 0 {
+		startAttrs = append(startAttrs, "cpu_seconds_budget", args.CPUSeconds)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnSignal(cancel)
+	if !waitForStart(ctx) || !waitStart(ctx, start) {
+		return 0
+	}
+	var limitGroup *limitCgroup
+	if selfLimit > 0 && !child {
+		limitGroup, err = enterSelfLimit(selfLimit)
+		if err != nil {
+			slog.Error("failed to limit the process", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+		// the cgroup is only left once done with its statistics, as the last deferred cleanup
+		defer limitGroup.Leave()
+	}
+	var notifier *sdNotifier
+	if !child {
+		notifier = newSDNotifier()
+	}
 	if args.Duration > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, args.Duration)
+		// the drain starts once the context is done, and ends with the duration
+		ctx, cancel = context.WithTimeout(ctx, args.Duration-args.Drain-offset)
 		defer cancel()
-		slog.Info("consuming cpus", "pid", os.Getpid(), "cpus", cpus, "duration_ms", args.Duration.Milliseconds())
+		slog.Info("consuming cpus", append(startAttrs, "duration_ms", args.Duration.Milliseconds())...)
+	} else {
+		slog.Info("consuming cpus until interrupted", startAttrs...)
+	}
+
+	var wrapped *wrappedCommand
+	if len(args.Command) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		defer stop()
+		wrapped, err = startCommand(args.Command, stop)
+		if err != nil {
+			slog.Error("failed to start command", "pid", os.Getpid(), "command", args.Command[0], "error", err)
+			return 1
+		}
+		if args.Antagonist != "" {
+			// the command is measured along with whatever it spawns, eg through a shell or make
+			follow, err = newFollower(wrapped.cmd.Process.Pid, antagonist, time.Second, prof, true)
+			if err != nil {
+				slog.Error("failed to measure command", "pid", os.Getpid(), "command", args.Command[0], "error", err)
+				return 1
+			}
+		}
+	}
+
+	if args.Processes > 1 && !child {
+		if code := runProcesses(ctx, args, labels, loads, notifier, sampleEvery); code != 0 {
+			return code
+		}
+		if wrapped != nil {
+			return wrapped.Wait()
+		}
+		return 0
+	}
+
+	var heatmap *cpuHeatmap
+	if args.CPUHeatmap != "" {
+		heatmap, err = newCPUHeatmap()
+		if err != nil {
+			slog.Error("failed to record the cpu heatmap", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+	}
+	var perf *perfMonitor
+	if args.PerfCounters {
+		perf, err = newPerfMonitor()
+		if err != nil {
+			slog.Error("failed to open performance counters", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+		defer perf.Close()
+	}
+	profile, err := startSelfProfile(args.CPUProfile, args.TraceProfile)
+	if err != nil {
+		slog.Error("failed to start profiling", "pid", os.Getpid(), "error", err)
+		return 1
+	}
+	b := burn.New(opts)
+	b.Start(ctx)
+	for _, g := range groups {
+		g.Start(ctx, opts, b)
+	}
+	notifier.Notify("READY=1")
+
+	// everything running alongside the burner stops with it, including when stopped through the api,
+	// and keeps going while it drains
+	runCtx, stopRun := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopRun()
+	// servers outlive the run context, so probes can tell the burner is draining while it stops
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
+	go func() {
+		<-b.Done()
+		stopRun()
+		stopServing()
+	}()
+
+	if thermal != nil {
+		go thermal.Run(runCtx, b)
+	}
+	if heatmap != nil {
+		go heatmap.Run(runCtx, b)
+	}
+	if notifier != nil {
+		go notifier.Follow(runCtx, b)
+		go notifier.Watchdog(runCtx, sampleEvery)
+		go func() {
+			// the drain starts once the context is done
+			select {
+			case <-ctx.Done():
+			case <-b.Done():
+			}
+			notifier.Notify("STOPPING=1")
+		}()
+	}
+	if perf != nil {
+		go perf.Run(runCtx, b)
+	}
+	if pressure != nil {
+		go pressure.Run(runCtx, b)
+	}
+	if follow != nil {
+		go follow.Run(runCtx, b)
+	}
+	if args.CPUSeconds > 0 {
+		// every process spawned by --processes consumes its share of the budget
+		go stopAtCPUBudget(runCtx, b, args.CPUSeconds*processShare()-priorCPUSeconds)
+	}
+	if external != nil {
+		go external.Run(runCtx)
+	}
+	if ofLimit != nil {
+		go ofLimit.Run(runCtx)
+	}
+	if fill != nil {
+		go fill.Run(runCtx)
+	}
+
+	wg := sync.WaitGroup{}
+	throttling := newThrottleMonitor()
+	frequency := newFrequencyMonitor()
+	psi := newPSIMonitor()
+	runqueue := newRunqueueMonitor()
+	steal := newStealMonitor(args.StealCompensate)
+	energy := newEnergyMonitor()
+	go energy.Run(runCtx)
+	go watchCapacity(runCtx, args.RelativeTo, selfLimit, relativeTargets(args, b, groups))
+	if checkpoint != nil {
+		go checkpoint.Run(runCtx, b)
+	}
+	if args.StealCompensate {
+		burners := []*burn.Burner{b}
+		for _, g := range groups {
+			burners = append(burners, g.b)
+		}
+		go compensateSteal(runCtx, sampleEvery, burners)
+	}
+	if args.FailOnThrottle {
+		if throttling.Available() {
+			go throttling.StopOnThrottle(runCtx, b)
+		} else {
+			slog.Info("no cgroup cpu limit found, the run cannot be throttled", "pid", os.Getpid())
+		}
+	}
+	usage := &usageLog{churn: args.WorkerChurn > 0, threads: args.ThreadStats, throttling: throttling, frequency: frequency, psi: psi, runqueue: runqueue, steal: steal, energy: energy, perf: perf, resources: args.SelfStats, host: args.HostStats}
+	var latency *latencyProbe
+	if args.LatencyProbe > 0 && !child {
+		latency = newLatencyProbe(args.LatencyProbe)
+		usage.latency = latency
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency.Run(runCtx)
+		}()
+	}
+	if args.Dashboard && !child {
+		dash := &dashboard{out: os.Stdout, logs: dashboardLogs, throttling: throttling, frequency: frequency}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dash.Run(runCtx, b)
+		}()
+	}
+	usage.enabled.Store(args.LogEvery > 0)
+	usage.every.Store(int64(args.LogEvery))
+	if child {
+		// children only burn cpu, reporting their usage to the parent which runs everything else
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reportToParent(b)
+		}()
 	} else {
-		slog.Info("consuming cpus until interrupted", "pid", os.Getpid(), "cpus", cpus)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			usage.Run(runCtx, b)
+		}()
+		loads.Run(runCtx, &wg, args, burnGate(b, prof))
+		if args.LogEvery > 0 {
+			go logWorkload(runCtx, workload, args.LogEvery)
+			for _, g := range groups {
+				go g.Log(runCtx)
+			}
+		}
+		if reportingToParent() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reportToParent(b)
+			}()
+		}
+	}
+
+	if args.Listen != "" {
+		listener, err := net.Listen("tcp", args.Listen)
+		if err != nil {
+			slog.Error("failed to listen", "pid", os.Getpid(), "address", args.Listen, "error", err)
+			return 1
+		}
+		go func() {
+			if err := serveHTTP(serveCtx, listener, newControlHandler(b, labels)); err != nil {
+				slog.Error("http server failed", "error", err)
+			}
+		}()
+	}
+
+	if args.GRPCListen != "" {
+		listener, err := net.Listen("tcp", args.GRPCListen)
+		if err != nil {
+			slog.Error("failed to listen", "pid", os.Getpid(), "address", args.GRPCListen, "error", err)
+			return 1
+		}
+		go func() {
+			if err := serveGRPC(serveCtx, listener, newGRPCHandler(b)); err != nil {
+				slog.Error("grpc server failed", "error", err)
+			}
+		}()
+	}
+
+	if args.Interactive {
+		go runInteractive(os.Stdin, os.Stdout, b)
+	}
+
+	if args.ControlSocket != "" {
+		listener, err := listenControlSocket(args.ControlSocket)
+		if err != nil {
+			slog.Error("failed to listen", "pid", os.Getpid(), "path", args.ControlSocket, "error", err)
+			return 1
+		}
+		// closing the listener removes the socket
+		defer listener.Close()
+		go serveControlSocket(serveCtx, listener, b)
+	}
+
+	if args.MetricsListen != "" {
+		listener, err := net.Listen("tcp", args.MetricsListen)
+		if err != nil {
+			slog.Error("failed to listen", "pid", os.Getpid(), "address", args.MetricsListen, "error", err)
+			return 1
+		}
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", newMetricsHandler(b, labels))
+		handleHealth(mux, b)
+		go func() {
+			if err := serveHTTP(serveCtx, listener, mux); err != nil {
+				slog.Error("metrics server failed", "error", err)
+			}
+		}()
 	}
 
-	burn(ctx, cpus, !args.NoLockOSThread, args.LogEvery)
+	if args.Pprof != "" {
+		listener, err := net.Listen("tcp", args.Pprof)
+		if err != nil {
+			slog.Error("failed to listen", "pid", os.Getpid(), "address", args.Pprof, "error", err)
+			return 1
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		go func() {
+			if err := serveHTTP(serveCtx, listener, mux); err != nil {
+				slog.Error("pprof server failed", "error", err)
+			}
+		}()
+	}
+
+	if args.OTelEndpoint != "" {
+		exporter := newOTelExporter(args.OTelEndpoint, labels)
+		go exporter.Run(runCtx, b)
+	}
+
+	var pusher *reportPusher
+	if args.ReportURL != "" {
+		every := args.LogEvery
+		if every <= 0 {
+			every = 10 * time.Second
+		}
+		pusher = newReportPusher(args.ReportURL, every, labels)
+		go pusher.Run(runCtx, b)
+	}
+
+	if statsd != nil {
+		go statsd.Run(runCtx, b)
+	}
+
+	if args.Out != "" {
+		out, err := newCSVWriter(args.Out)
+		if err != nil {
+			slog.Error("failed to write samples", "pid", os.Getpid(), "path", args.Out, "error", err)
+			return 1
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			out.Run(runCtx, b)
+		}()
+		defer func() {
+			<-done
+			out.Close()
+		}()
+	}
+
+	if args.SignalStep > 0 {
+		go handleAdjustSignals(runCtx, b, args.SignalStep*processShare())
+	}
+	if args.PauseSignals {
+		go handlePauseSignals(runCtx, b)
+	}
+	go handleDumpSignal(runCtx, func() { writeDump(logOutput, b, groups) })
+	if args.TargetFile != "" {
+		go watchTargetFile(runCtx, b, args.TargetFile)
+	}
+	if args.Config != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handleReloadSignal(runCtx, func() { reloadConfig(b, &args, os.Args[1:], usage) })
+		}()
+	}
+
+	b.Wait()
+	wg.Wait()
+	profile.Stop()
+	if child {
+		return 0
+	}
+	if checkpoint != nil {
+		// a run stopped early, eg by a signal, resumes when started again
+		budget := args.CPUSeconds*processShare() - checkpoint.PriorCPUSeconds()
+		finished := errors.Is(ctx.Err(), context.DeadlineExceeded) || (args.CPUSeconds > 0 && b.Stats().CPUSeconds >= budget)
+		if err := checkpoint.Save(b, finished); err != nil {
+			slog.Error("failed to write state file", "pid", os.Getpid(), "path", args.StateFile, "error", err)
+		}
+	}
+
+	s := b.Summary()
+	summary := newRunSummary(s, labels)
+	summaryAttrs := loads.Summarize(&summary)
+	for _, g := range groups {
+		g.Summarize(&summary)
+	}
+	if iterations, ok := workload.(*burn.Iterations); ok {
+		summary.Iterations = iterations.Done()
+		summaryAttrs = append(summaryAttrs, "iterations", summary.Iterations)
+	}
+	if throttled, ok := throttling.Total(); ok {
+		periods, ms := throttled.throttledPeriods, throttled.throttledTime.Milliseconds()
+		summaryAttrs = append(summaryAttrs, "throttled_periods", periods, "throttled_ms", ms)
+		summary.ThrottledPeriods, summary.ThrottledMs = &periods, &ms
+	}
+	if mhz, ok := frequency.Mean(); ok {
+		summaryAttrs = append(summaryAttrs, "mean_mhz", decimal(mhz, 0))
+		summary.MeanMHz = &mhz
+	}
+	summaryAttrs = append(summaryAttrs, psi.Summarize(&summary)...)
+	summaryAttrs = append(summaryAttrs, runqueue.Summarize(&summary)...)
+	summaryAttrs = append(summaryAttrs, steal.Summarize(&summary)...)
+	summaryAttrs = append(summaryAttrs, energy.Summarize(&summary)...)
+	summaryAttrs = append(summaryAttrs, perf.Summarize(&summary)...)
+	summaryAttrs = append(summaryAttrs, checkpoint.Summarize(&summary)...)
+	if latency != nil {
+		summaryAttrs = append(summaryAttrs, latency.Summarize(&summary)...)
+	}
+	logSummary(s, summaryAttrs...)
+	if args.SummaryJSON && !reportingToParent() {
+		summary.Write(os.Stdout)
+	} else if args.SummaryLine && !reportingToParent() {
+		summary.WriteLine(os.Stdout)
+	}
+	pusher.Summary(summary)
+
+	if heatmap != nil {
+		if err := heatmap.Write(args.CPUHeatmap, b.Stats().LockOSThread); err != nil {
+			slog.Error("failed to write cpu heatmap", "path", args.CPUHeatmap, "error", err)
+			return 1
+		}
+		slog.Info("cpu heatmap written", "path", args.CPUHeatmap)
+	}
+	if args.ReportFile != "" {
+		if err := writeReport(args.ReportFile, args, cpus, b, throttling, steal, energy, heatmap); err != nil {
+			slog.Error("failed to write report", "path", args.ReportFile, "error", err)
+			return 1
+		}
+		slog.Info("report written", "path", args.ReportFile)
+	}
+
+	if args.FailOnThrottle {
+		if throttled, ok := throttling.Total(); ok && throttled.throttledPeriods > 0 {
+			slog.Error("the run was throttled by the cgroup cpu limit", "pid", os.Getpid(), "throttled_periods", throttled.throttledPeriods, "throttled_ms", throttled.throttledTime.Milliseconds())
+			return throttledExitCode
+		}
+	}
+	if args.AssertTolerance != "" {
+		if err := checkTolerance(s, args.AssertTolerance); err != nil {
+			slog.Error("assertion failed", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+		slog.Info("assertion passed", "pid", os.Getpid(), "tolerance", args.AssertTolerance)
+	}
+	if wrapped != nil {
+		return wrapped.Wait()
+	}
+	return 0
+}
+
+// logSummary logs the summary of the run, followed by any extra attributes
+func logSummary(s burn.Summary, extra ...any) {
+	attrs := []any{"pid", os.Getpid(),
+		"wall_time_ms", s.WallTime.Milliseconds(),
+		"cpu_seconds", decimal(s.CPUSeconds, 3),
+		"user_seconds", decimal(s.UserSeconds, 3),
+		"system_seconds", decimal(s.SystemSeconds, 3),
+		"mean_cpus", decimal(s.MeanAchieved, 3),
+		"min_cpus", decimal(s.MinAchieved, 3),
+		"max_cpus", decimal(s.MaxAchieved, 3),
+		"p50_abs_delta_pct", decimal(s.P50AbsDeltaPct, 1),
+		"p90_abs_delta_pct", decimal(s.P90AbsDeltaPct, 1),
+		"p99_abs_delta_pct", decimal(s.P99AbsDeltaPct, 1),
+		"samples", s.Samples,
+	}
+	if s.Frozen > 0 {
+		attrs = append(attrs, "frozen_ms", s.Frozen.Milliseconds())
+	}
+	slog.Info("run summary", append(attrs, extra...)...)
+}
+
+// parseMillicores parses an amount of cpus expressed in millicores, as in kubernetes resource
+// requests and limits, eg 1500m. Returns false when the value is not in millicores
+func parseMillicores(value string) (float64, bool, error) {
+	millis, found := strings.CutSuffix(value, "m")
+	if !found {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(millis)
+	if err != nil || n < 0 {
+		return 0, true, fmt.Errorf("invalid millicores value: %s", value)
+	}
+	return float64(n) / 1000, true, nil
+}
+
+// burnFromEnv replaces --burn with the value of the --burn-from-env variable, when given
+func (args *Args) burnFromEnv() error {
+	if args.BurnFromEnv == "" {
+		return nil
+	}
+	value, found := os.LookupEnv(args.BurnFromEnv)
+	if !found || strings.TrimSpace(value) == "" {
+		return fmt.Errorf("--burn-from-env: environment variable %s is not set", args.BurnFromEnv)
+	}
+	args.Burn = strings.TrimSpace(value)
+	return nil
 }
 
 func parseBurn(burn string) (float64, error) {
 	invalidInput := fmt.Errorf("invalid burn value: %s", burn)
-	cpus := float64(runtime.NumCPU())
-
 	// float-like parsing, eg: 3.5 means 3 cores and a half
 	value, err := strconv.ParseFloat(burn, 64)
 	if err == nil {
@@ -76,6 +1248,19 @@ func parseBurn(burn string) (float64, error) {
 		return value, nil
 	}
 
+	// expressions of host facts, eg numcpu-2 means all but two cores
+	if isBurnExpr(burn) {
+		return evalBurnExpr(burn)
+	}
+
+	// kubernetes-like millicores, eg 1500m means 1 core and a half
+	if value, ok, err := parseMillicores(burn); ok {
+		if err != nil {
+			return 0, invalidInput
+		}
+		return value, nil
+	}
+
 	// percentage-like parsing, eg 50% on a 4 core system means 2 cores
 	if strings.LastIndex(burn, "%") != len(burn)-1 {
 		return 0, invalidInput
@@ -85,118 +1270,75 @@ func parseBurn(burn string) (float64, error) {
 		return 0, invalidInput
 	}
 
-	return value / 100.0 * cpus, nil
+	return value / 100.0 * cpuCapacity(), nil
 }
 
-const adjustTimingsEveryXIterations = 100
-const checkContextEveryXIterations = 100
-const detectionFactor = 0.005 // if actual cpu usage is off by more than .5% from the target, adjust sleep and run times
-const adjustmentFactor = 0.01 // when adjusting sleep and run times, adjust them by 1% (eg if sleepFor is 100ms and we need to increase it, we will increase it to 101ms)
-
-func burn(ctx context.Context, cpus float64, lockOSThread bool, logEvery time.Duration) {
-	workUnit := 1000 * time.Microsecond
-	work := cpus
-
-	wg := sync.WaitGroup{}
-	for work > 0 {
-		share := 1.0
-		if work < 1 {
-			share = work
+// parseSlew parses a --slew value: how much the target may change per unit of time, as a burn
+// value optionally followed by cores or cpus, eg 0.5cores/s, 500m/s, 2cpus/m or 10%/30s. Returns
+// it in cpus per second, 0 when the target is not slewed
+func parseSlew(spec string) (float64, error) {
+	if spec == "" {
+		return 0, nil
+	}
+	invalidInput := fmt.Errorf("invalid slew value: %s: expected an amount of cpus per unit of time, eg 0.5cores/s or 10%%/m", spec)
+	amount, unit, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, invalidInput
+	}
+	for _, suffix := range []string{"cores", "core", "cpus", "cpu"} {
+		if trimmed, found := strings.CutSuffix(amount, suffix); found {
+			amount = trimmed
+			break
 		}
-		work -= share
-		wg.Add(1)
-		go func(share float64) {
-			defer wg.Done()
-			if lockOSThread {
-				runtime.LockOSThread()
-				defer runtime.UnlockOSThread()
-			}
-			runFor := time.Duration(float64(workUnit) * share)
-			sleepFor := workUnit - runFor
-			var iterations int64 = 1
-			var previousCPUTime int64 = cpuTime()
-			previousWallTime := time.Now()
-			for {
-				unitStart := time.Now()
-				for time.Since(unitStart) < runFor {
-					// this tight loop should take 100% of a core
-				}
-
-				// In practice only one goroutine will be splitting its time between sleeping and running.
-				// All others (if any) will be running all the time
-				// For that reason its ok for this goroutine to use cpuTime() (which gives global cpu utilizaiton)
-				// and make sleep adjustments based on that
-				if sleepFor > 0 {
-					time.Sleep(sleepFor)
-
-					// Check if we need to adjust sleepFor
-					if iterations%adjustTimingsEveryXIterations == 0 {
-						currentCPUTime := cpuTime()
-						currentWallTime := time.Now()
-						actualCPUs := float64(currentCPUTime-previousCPUTime) / float64(currentWallTime.Sub(previousWallTime))
-						delta := actualCPUs - cpus
-						newSleepFor := sleepFor
-						newRunFor := runFor
-						if delta < -cpus*detectionFactor {
-							newSleepFor = time.Duration(float64(sleepFor) * (1 - adjustmentFactor))
-							newRunFor = time.Duration(float64(runFor) * (1 + adjustmentFactor))
-						} else if delta > cpus*detectionFactor {
-							newSleepFor = time.Duration(float64(sleepFor) * (1 + adjustmentFactor))
-							newRunFor = time.Duration(float64(runFor) * (1 - adjustmentFactor))
-						}
-						if newSleepFor != sleepFor {
-							slog.Debug("adjusting burn timings", "pid", os.Getpid(), "run_for", runFor, "new_run_for", newRunFor, "sleep_for", sleepFor, "new_sleep_for", newSleepFor)
-							sleepFor = newSleepFor
-							runFor = newRunFor
-						}
-						previousCPUTime = currentCPUTime
-						previousWallTime = currentWallTime
-					}
-				}
-
-				// listen for ctx.Done() every few iterations to avoid doing it too often
-				if iterations%checkContextEveryXIterations == 0 {
-					select {
-					case <-ctx.Done():
-						return
-					default:
-					}
-				}
-
-				iterations++
-			}
-		}(share)
 	}
-
-	if logEvery > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			ticker := time.NewTicker(logEvery)
-			defer ticker.Stop()
-
-			previous := cpuTime()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					current := cpuTime()
-					cpuBurned := float64(current-previous) / float64(logEvery)
-					deltaPct := (cpuBurned - cpus) / cpus * 100
-					slog.Info("cpu usage", "pid", os.Getpid(), "cpus", fmt.Sprintf("%.3f", cpuBurned), "delta_pct", fmt.Sprintf("%+.1f%%", deltaPct))
-					previous = current
-				}
-			}
-		}()
+	cpus, err := parseBurn(amount)
+	if err != nil || cpus <= 0 {
+		return 0, invalidInput
 	}
+	if unit != "" && (unit[0] < '0' || unit[0] > '9') {
+		unit = "1" + unit
+	}
+	per, err := time.ParseDuration(unit)
+	if err != nil || per <= 0 {
+		return 0, invalidInput
+	}
+	return cpus / per.Seconds(), nil
+}
 
-	wg.Wait()
+// startTime returns when to start burning: at --start-at, or --start-after from now, delayed to the
+// next --align boundary and then by the given jitter
+func startTime(args Args, now time.Time, jitter time.Duration) (time.Time, error) {
+	start := now.Add(args.StartAfter)
+	if args.StartAt != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339Nano, args.StartAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid start time %q, expected RFC 3339 format, eg 2024-07-01T12:00:00Z", args.StartAt)
+		}
+	}
+	if args.Align > 0 {
+		// counted from the unix epoch, so every host lands on the same boundary whatever its time zone
+		if rem := time.Duration(start.UnixNano() % int64(args.Align)); rem != 0 {
+			start = start.Add(args.Align - rem)
+		}
+	}
+	return start.Add(jitter), nil
 }
 
-func cpuTime() int64 {
-	var usage syscall.Rusage
-	syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
-	return usage.Utime.Nano()
+// waitStart blocks until the given start time, not waiting at all when it is not in the future.
+// Returns false if the context was done before that
+func waitStart(ctx context.Context, start time.Time) bool {
+	delay := time.Until(start)
+	if delay <= 0 {
+		return true
+	}
+	slog.Info("waiting before starting", "pid", os.Getpid(), "delay_ms", delay.Milliseconds(), "start_at", start.Format(time.RFC3339Nano))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
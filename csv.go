@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// csvWriter writes every usage sample taken by the burner as a row of a csv file
+type csvWriter struct {
+	file *os.File
+	csv  *csv.Writer
+}
+
+func newCSVWriter(path string) (*csvWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &csvWriter{file: file, csv: csv.NewWriter(file)}
+	w.csv.Write([]string{"timestamp", "interval_seconds", "target_cpus", "achieved_cpus", "delta_pct", "user_cpus", "system_cpus"})
+	w.csv.Flush()
+	return w, w.csv.Error()
+}
+
+// Run writes samples until the context is done. Rows are flushed as they are written so the file
+// is usable while the run is still going
+func (w *csvWriter) Run(ctx context.Context, b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-samples:
+			w.csv.Write([]string{
+				s.Time.Format(time.RFC3339Nano),
+				strconv.FormatFloat(s.Interval.Seconds(), 'f', 3, 64),
+				strconv.FormatFloat(s.Target, 'f', 3, 64),
+				strconv.FormatFloat(s.Achieved, 'f', 3, 64),
+				strconv.FormatFloat(s.DeltaPct(), 'f', 2, 64),
+				strconv.FormatFloat(s.User, 'f', 3, 64),
+				strconv.FormatFloat(s.System, 'f', 3, 64),
+			})
+			w.csv.Flush()
+			if err := w.csv.Error(); err != nil {
+				slog.Error("failed to write csv samples, stopping", "pid", os.Getpid(), "path", w.file.Name(), "error", err)
+				return
+			}
+		}
+	}
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	return w.file.Close()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// dashboardEvery is how often the dashboard is redrawn
+const dashboardEvery = 500 * time.Millisecond
+
+// dashboardBarWidth is how many characters a full bar takes
+const dashboardBarWidth = 40
+
+// dashboardMaxWorkers is how many workers get a bar of their own, the rest are only counted
+const dashboardMaxWorkers = 16
+
+// dashboardLogLines is how many of the latest log lines the dashboard shows under the stats
+const dashboardLogLines = 8
+
+// dashboardLog keeps the latest log lines for the dashboard to show, as writing them to the
+// terminal would scroll it away. Once released, lines are written through instead
+type dashboardLog struct {
+	mu    sync.Mutex
+	lines []string
+	out   io.Writer
+}
+
+func (l *dashboardLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.out != nil {
+		return l.out.Write(p)
+	}
+	for line := range strings.SplitSeq(strings.TrimRight(string(p), "\n"), "\n") {
+		l.lines = append(l.lines, line)
+	}
+	if len(l.lines) > dashboardLogLines {
+		l.lines = append(l.lines[:0], l.lines[len(l.lines)-dashboardLogLines:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the latest log lines, oldest first
+func (l *dashboardLog) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// release writes the lines kept so far to w, along with every line logged from then on
+func (l *dashboardLog) release(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		fmt.Fprintln(w, line)
+	}
+	l.lines, l.out = nil, w
+}
+
+// dashboard is the live view of --dashboard: target and achieved usage, a bar per worker, cpu
+// frequency and throttling, redrawn in place with ansi escape codes
+type dashboard struct {
+	out        io.Writer
+	logs       *dashboardLog // nil when logs go somewhere else than the terminal
+	throttling *throttleMonitor
+	frequency  *frequencyMonitor
+
+	lastTime    time.Time
+	lastSeconds float64
+	lastThreads map[int64]burn.ThreadStats
+}
+
+// Run redraws the dashboard until the context is done, leaving the last frame on the terminal
+func (d *dashboard) Run(ctx context.Context, b *burn.Burner) {
+	fmt.Fprint(d.out, "\x1b[?25l\x1b[2J")
+	defer func() {
+		fmt.Fprint(d.out, "\x1b[?25h")
+		if d.logs != nil {
+			d.logs.release(os.Stderr)
+		}
+	}()
+	d.lastTime, d.lastSeconds = time.Now(), b.Stats().CPUSeconds
+	ticker := time.NewTicker(dashboardEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.draw(b)
+	}
+}
+
+func (d *dashboard) draw(b *burn.Burner) {
+	stats := b.Stats()
+	now := time.Now()
+	interval := now.Sub(d.lastTime)
+	achieved := (stats.CPUSeconds - d.lastSeconds) / interval.Seconds()
+	d.lastTime, d.lastSeconds = now, stats.CPUSeconds
+
+	var s strings.Builder
+	// every line clears what is left of the previous frame after it
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&s, format, args...)
+		s.WriteString("\x1b[K\n")
+	}
+	state := string(b.State())
+	if stats.Paused {
+		state = "paused"
+	}
+	s.WriteString("\x1b[H")
+	line("cpu-burner  pid %d  %s  uptime %s", os.Getpid(), state, stats.Uptime.Truncate(time.Second))
+	line("")
+	scale := max(cpuCapacity(), stats.Target, achieved)
+	line("target    %7.3f cpus  %s", stats.Target, dashboardBar(stats.Target, scale))
+	delta := ""
+	if stats.Target > 0 {
+		delta = fmt.Sprintf("  %+.1f%%", (achieved-stats.Target)/stats.Target*100)
+	}
+	line("achieved  %7.3f cpus  %s%s", achieved, dashboardBar(achieved, scale), delta)
+	line("")
+
+	line("workers   %d, work unit %s", stats.Workers, stats.WorkUnit)
+	threads := threadsByWorker(stats.Threads)
+	if len(stats.Threads) > 0 {
+		// with thread stats every worker shows what it burned against its share
+		for i, thread := range stats.Threads {
+			if i == dashboardMaxWorkers {
+				line("  and %d more", len(stats.Threads)-i)
+				break
+			}
+			burned := ""
+			if before, found := d.lastThreads[thread.Worker]; found {
+				burned = fmt.Sprintf("  burned %.3f", float64(thread.CPUTime-before.CPUTime)/float64(interval))
+			}
+			line("  %-6d  %s  share %.3f%s", thread.Worker, dashboardBar(thread.Share, 1), thread.Share, burned)
+		}
+	} else {
+		for i, share := range stats.Shares {
+			if i == dashboardMaxWorkers {
+				line("  and %d more", len(stats.Shares)-i)
+				break
+			}
+			line("  %-6d  %s  share %.3f", i, dashboardBar(share, 1), share)
+		}
+	}
+	d.lastThreads = threads
+	line("")
+
+	if f, ok := d.frequency.Sample(); ok {
+		line("frequency %.0f MHz, from %.0f to %.0f", f.mean, f.min, f.max)
+	} else {
+		line("frequency unknown")
+	}
+	if t, ok := d.throttling.Total(); ok {
+		line("throttled %d of %d periods, %s", t.throttledPeriods, t.periods, t.throttledTime.Truncate(time.Millisecond))
+	} else {
+		line("throttled never, no cgroup cpu limit")
+	}
+
+	if d.logs != nil {
+		line("")
+		for _, l := range d.logs.Lines() {
+			line("%s", l)
+		}
+	}
+	s.WriteString("\x1b[J")
+	if _, err := io.WriteString(d.out, s.String()); err != nil {
+		slog.Debug("failed to draw dashboard", "pid", os.Getpid(), "error", err)
+	}
+}
+
+// dashboardBar draws value as a bar, full at scale
+func dashboardBar(value, scale float64) string {
+	filled := 0
+	if scale > 0 {
+		filled = min(dashboardBarWidth, max(0, int(value/scale*dashboardBarWidth+0.5)))
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(" ", dashboardBarWidth-filled) + "]"
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// dryRunTimelinePoints is how many points of the run the dry run shows the target at, for profiles
+// that change continuously
+const dryRunTimelinePoints = 10
+
+// dryRunCronWindows is how many of the upcoming cron windows the dry run lists
+const dryRunCronWindows = 3
+
+// printPlan describes what the run would do with the given options: the target, the workers
+// started to burn it and how the target changes over the run
+func printPlan(w io.Writer, args Args, prof burn.Profile, duration time.Duration, opts burn.Options, groups []*burnGroup) {
+	initial := prof.Target(0)
+	fmt.Fprintf(w, "initial target: %.3f cpus (%.1f%% of %v cpus)\n", initial, initial/capacity*100, capacity)
+	if duration > 0 {
+		fmt.Fprintf(w, "duration: %s\n", duration)
+	} else {
+		fmt.Fprintf(w, "duration: until interrupted\n")
+	}
+	if args.CPUSeconds > 0 {
+		fmt.Fprintf(w, "cpu seconds budget: %v\n", args.CPUSeconds)
+	}
+	if len(args.Command) > 0 {
+		fmt.Fprintf(w, "command: %s, the burn stops once it exits\n", strings.Join(args.Command, " "))
+	}
+	if args.StartAt != "" || args.Align > 0 {
+		if start, err := startTime(args, time.Now(), 0); err == nil {
+			fmt.Fprintf(w, "start at: %s plus up to %s of jitter\n", start.Format(time.RFC3339Nano), args.StartJitter)
+		}
+	} else if delay := args.StartAfter; delay > 0 || args.StartJitter > 0 {
+		fmt.Fprintf(w, "start delay: %s plus up to %s of jitter\n", delay, args.StartJitter)
+	}
+	if topology, err := readTopology(); err == nil {
+		fmt.Fprintf(w, "topology: %s\n", topology.describe())
+	}
+	workUnit := opts.WorkUnit.String()
+	if opts.AdaptiveWorkUnit {
+		workUnit += " adapting to the host"
+	}
+	fmt.Fprintf(w, "workload: %s, work unit %s, controller %s, sleep strategy %s\n", args.Workload, workUnit, opts.Controller, opts.SleepStrategy)
+	if args.Iterations > 0 {
+		fmt.Fprintf(w, "iterations: %.0f per second, %.0f over the run\n", args.Iterations, args.Iterations*args.Duration.Seconds())
+	}
+	if opts.Priority != nil {
+		fmt.Fprintf(w, "worker priority: %s\n", formatPriority(*opts.Priority))
+	}
+
+	perProcess := initial
+	if args.Processes > 1 {
+		perProcess /= float64(args.Processes)
+		fmt.Fprintf(w, "\n%d processes, each one starting these workers:\n", args.Processes)
+	} else {
+		fmt.Fprintf(w, "\nworkers at start:\n")
+	}
+	for i, worker := range burn.Plan(opts, perProcess) {
+		cpus := "any cpu"
+		if worker.CPUs != nil {
+			cpus = "cpus " + formatCPUSet(worker.CPUs)
+		}
+		locked := opts.LockOSThread || opts.ThreadStats || opts.Isolated || worker.CPUs != nil
+		fmt.Fprintf(w, "  worker %d: share %.3f, %s, locked to an os thread: %v\n", i+1, worker.Share, cpus, locked)
+	}
+	for _, g := range groups {
+		fmt.Fprintf(w, "  group %s: %s, measured apart\n", g.name, g.describe())
+	}
+	if args.WorkerChurn > 0 {
+		fmt.Fprintf(w, "  workers churn %v times per second, up to twice as many\n", args.WorkerChurn)
+	}
+
+	fmt.Fprintf(w, "\ntimeline:\n")
+	printTimeline(w, args, prof, duration)
+	for wrapped := prof; ; {
+		switch p := wrapped.(type) {
+		case burn.Ramp:
+			fmt.Fprintf(w, "  ramping up for %s and down for %s\n", p.Up, p.Down)
+		case burn.Burst:
+			fmt.Fprintf(w, "  bursting %s on, %s off\n", p.On, p.Off)
+		}
+		wrapper, ok := wrapped.(burn.Wrapper)
+		if !ok {
+			break
+		}
+		wrapped = wrapper.Unwrap()
+	}
+	if args.Drain > 0 {
+		fmt.Fprintf(w, "  draining for %s once the run is over\n", args.Drain)
+	}
+	if opts.Slew > 0 {
+		fmt.Fprintf(w, "  changing the target by at most %.3f cpus per second\n", opts.Slew)
+	}
+	if args.Warmup > 0 {
+		fmt.Fprintf(w, "  leaving the first %s out of the summary as warmup\n", args.Warmup)
+	}
+}
+
+func printTimeline(w io.Writer, args Args, prof burn.Profile, duration time.Duration) {
+	if _, live := burn.FindLive(prof); live {
+		if args.FollowPID != 0 {
+			fmt.Fprintf(w, "  follows the usage of process %d, times %v\n", args.FollowPID, args.FollowScale)
+		} else if args.Antagonist != "" {
+			fmt.Fprintf(w, "  follows the usage of the command, times %s\n", strings.TrimSuffix(args.Antagonist, "x"))
+		} else if args.FillTo != "" {
+			fmt.Fprintf(w, "  fills the host up to %s utilization, measured every %s\n", args.FillTo, args.FillEvery)
+		} else if args.OfLimit != "" {
+			fmt.Fprintf(w, "  %s of the cgroup cpu limit, read every %s\n", args.OfLimit, args.TargetEvery)
+		} else if args.BurnFromFile != "" {
+			fmt.Fprintf(w, "  read from %s every %s, times %v\n", args.BurnFromFile, args.TargetEvery, args.TargetScale)
+		} else {
+			fmt.Fprintf(w, "  polled from %s every %s, times %v\n", args.TargetURL, args.TargetEvery, args.TargetScale)
+		}
+		return
+	}
+	if _, constant := prof.(burn.Constant); constant {
+		fmt.Fprintf(w, "  constant\n")
+		return
+	}
+	if cron, ok := findCron(prof); ok {
+		next := time.Now()
+		for range dryRunCronWindows {
+			next = cron.Schedule.Next(next)
+			fmt.Fprintf(w, "  cron window at %s for %s\n", next.Format(time.RFC3339), cron.Duration)
+		}
+		return
+	}
+	if phases, ok := burn.FindPhased(prof); ok {
+		if steps, ok := phases.(burn.Steps); ok {
+			var start time.Duration
+			for i, step := range steps {
+				fmt.Fprintf(w, "  %-10s phase %d", start, i)
+				if step.Options.Name != "" {
+					fmt.Fprintf(w, " (%s)", step.Options.Name)
+				}
+				fmt.Fprintf(w, ": %.3f cpus for %s\n", step.CPUs, step.Duration)
+				start += step.Duration
+			}
+			return
+		}
+	}
+	// profiles changing continuously are sampled, over the whole run when it has a duration
+	span := duration
+	if span <= 0 {
+		span = max(args.Period, time.Minute)
+	}
+	step := span / dryRunTimelinePoints
+	for i := 0; i <= dryRunTimelinePoints; i++ {
+		elapsed := time.Duration(i) * step
+		fmt.Fprintf(w, "  %-10s %.3f cpus\n", elapsed.Round(time.Millisecond), prof.Target(elapsed))
+	}
+}
+
+// findCron looks for a Cron profile, unwrapping profiles as needed
+func findCron(prof burn.Profile) (burn.Cron, bool) {
+	for {
+		if cron, ok := prof.(burn.Cron); ok {
+			return cron, true
+		}
+		wrapper, ok := prof.(burn.Wrapper)
+		if !ok {
+			return burn.Cron{}, false
+		}
+		prof = wrapper.Unwrap()
+	}
+}
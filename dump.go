@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// writeDump writes a report of the internal state of the burner and of every group: the share,
+// pinning and usage of each worker, the state of the controller, where the run is in its profile
+// and the latest samples. It is built in full before being written, so it is not interleaved with
+// logs
+func writeDump(w io.Writer, b *burn.Burner, groups []*burnGroup) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=== cpu-burner state dump, pid %d, %s ===\n", os.Getpid(), time.Now().Format(time.RFC3339Nano))
+	fmt.Fprintf(&buf, "capacity: %v cpus, %d goroutines\n", cpuCapacity(), runtime.NumGoroutine())
+	writeBurnerDump(&buf, "", b.Dump())
+	for _, g := range groups {
+		fmt.Fprintf(&buf, "\ngroup %s: %s\n", g.name, g.describe())
+		writeBurnerDump(&buf, "  ", g.b.Dump())
+	}
+	fmt.Fprintf(&buf, "=== end of state dump ===\n")
+	w.Write(buf.Bytes())
+}
+
+func writeBurnerDump(w io.Writer, indent string, d burn.Dump) {
+	s := d.Stats
+	fmt.Fprintf(w, "%sstate: %s, paused: %v, uptime %s, %.3f cpu seconds\n", indent, d.State, s.Paused, s.Uptime.Round(time.Millisecond), s.CPUSeconds)
+	position := fmt.Sprintf("%s into the profile", s.Elapsed.Round(time.Millisecond))
+	if s.Phase >= 0 {
+		position = fmt.Sprintf("phase %d", s.Phase)
+		if d.PhaseName != "" {
+			position += fmt.Sprintf(" (%s)", d.PhaseName)
+		}
+		position += fmt.Sprintf(", %s into the profile", s.Elapsed.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "%sschedule: %s\n", indent, position)
+	limit := "none"
+	if !math.IsInf(d.Limit, 1) {
+		limit = fmt.Sprintf("%.3f cpus", d.Limit)
+	}
+	fmt.Fprintf(w, "%starget: %.3f cpus, the profile asks for %.3f, limit %s", indent, s.Target, d.ProfileTarget, limit)
+	if d.Draining > 0 {
+		fmt.Fprintf(w, ", draining for %s", d.Draining.Round(time.Millisecond))
+	}
+	fmt.Fprintln(w)
+	c := d.Controller
+	fmt.Fprintf(w, "%scontroller: %s, scale %.4f, error %+.2f%%, integral %.4f, work unit %s", indent, c.Controller, c.Scale, c.Error*100, c.Integral, c.WorkUnit)
+	if c.Steal > 0 {
+		fmt.Fprintf(w, ", steal %.0f%%", c.Steal*100)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%sworkers: %d alive, %d spawned, %d reaped\n", indent, len(d.Workers), s.Spawned, s.Reaped)
+	for _, worker := range d.Workers {
+		cpus := "any cpu"
+		if worker.CPUs != nil {
+			cpus = "cpus " + formatCPUSet(worker.CPUs)
+		}
+		fmt.Fprintf(w, "%s  worker %d: share %.3f, %s, locked to an os thread: %v, workload %s, sleep strategy %s", indent, worker.ID, worker.Share, cpus, worker.LockOSThread, workloadName(worker.Workload), worker.SleepStrategy)
+		if worker.CPU >= 0 {
+			fmt.Fprintf(w, ", %.3f cpu seconds, last on cpu %d, waited %s", worker.CPUTime.Seconds(), worker.CPU, worker.WaitTime.Round(time.Millisecond))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(d.Recent) == 0 {
+		fmt.Fprintf(w, "%srecent samples: none yet\n", indent)
+		return
+	}
+	fmt.Fprintf(w, "%srecent samples:\n", indent)
+	for _, sample := range d.Recent {
+		fmt.Fprintf(w, "%s  %s: target %.3f, achieved %.3f (%+.1f%%), user %.3f, system %.3f", indent, sample.Time.Format(time.RFC3339Nano), sample.Target, sample.Achieved, sample.DeltaPct(), sample.User, sample.System)
+		var flags []string
+		if sample.Paused {
+			flags = append(flags, "paused")
+		}
+		if sample.Warmup {
+			flags = append(flags, "warmup")
+		}
+		if sample.Frozen > 0 {
+			flags = append(flags, "frozen for "+sample.Frozen.Round(time.Millisecond).String())
+		}
+		if len(flags) > 0 {
+			fmt.Fprintf(w, ", %s", strings.Join(flags, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// workloadName names a workload by its type, eg spin or sha256
+func workloadName(workload burn.Workload) string {
+	name := fmt.Sprintf("%T", workload)
+	return strings.ToLower(name[strings.LastIndex(name, ".")+1:])
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// energyPollEvery is how often the energy counters are read when nothing else reads them, often
+// enough to never miss a wrap around of the counters even at hundreds of watts
+const energyPollEvery = 10 * time.Second
+
+// raplCounter is the energy counter of a rapl package zone, in microjoules, which wraps around
+// once it reaches maxRange
+type raplCounter struct {
+	energy   uint64
+	maxRange uint64
+}
+
+// energyMonitor tracks the energy the cpu packages of the host consumed over the run, read from the
+// rapl counters of intel and amd cpus. It covers the whole host, not only the burn, and is a no-op
+// when the counters cannot be read, eg outside of linux, in virtual machines or without root
+type energyMonitor struct {
+	mu        sync.Mutex
+	available bool
+	start     time.Time
+	last      map[string]raplCounter
+	lastTime  time.Time
+	joules    float64 // consumed since the start
+	// consumed since the last usage log
+	intervalJoules float64
+	intervalStart  time.Time
+}
+
+func newEnergyMonitor() *energyMonitor {
+	m := &energyMonitor{}
+	counters, available, err := raplCounters()
+	if errors.Is(err, os.ErrPermission) {
+		slog.Info("rapl energy counters are only readable by root, energy is not reported", "pid", os.Getpid())
+	} else if err != nil {
+		slog.Debug("failed to read rapl energy counters", "pid", os.Getpid(), "error", err)
+	}
+	m.available = available && err == nil
+	now := time.Now()
+	m.start, m.last, m.lastTime, m.intervalStart = now, counters, now, now
+	return m
+}
+
+// Run reads the counters regularly until the context is done, so wrap arounds are accounted for
+// even when usage is not logged
+func (m *energyMonitor) Run(ctx context.Context) {
+	if !m.available {
+		return
+	}
+	ticker := time.NewTicker(energyPollEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			m.read()
+			m.mu.Unlock()
+		}
+	}
+}
+
+// read adds the energy consumed since the last read. Must be called with m.mu held
+func (m *energyMonitor) read() {
+	counters, _, err := raplCounters()
+	if err != nil {
+		slog.Debug("failed to read rapl energy counters", "pid", os.Getpid(), "error", err)
+		return
+	}
+	for zone, current := range counters {
+		previous, found := m.last[zone]
+		if !found {
+			continue
+		}
+		delta := current.energy - previous.energy
+		if current.energy < previous.energy {
+			delta = current.maxRange - previous.energy + current.energy
+		}
+		m.joules += float64(delta) / 1e6
+		m.intervalJoules += float64(delta) / 1e6
+	}
+	m.last, m.lastTime = counters, time.Now()
+}
+
+// Sample returns the power drawn since the previous sample as log attributes
+func (m *energyMonitor) Sample() []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return nil
+	}
+	m.read()
+	elapsed := m.lastTime.Sub(m.intervalStart)
+	joules := m.intervalJoules
+	m.intervalJoules, m.intervalStart = 0, m.lastTime
+	if elapsed <= 0 {
+		return nil
+	}
+	return []any{"watts", decimal(joules/elapsed.Seconds(), 1)}
+}
+
+// Total returns the energy consumed since the start, in joules, and the mean power drawn, in watts
+func (m *energyMonitor) Total() (float64, float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return 0, 0, false
+	}
+	m.read()
+	elapsed := m.lastTime.Sub(m.start)
+	if elapsed <= 0 {
+		return 0, 0, false
+	}
+	return m.joules, m.joules / elapsed.Seconds(), true
+}
+
+// Summarize adds the energy consumed during the run to the summary, returning it as log attributes too
+func (m *energyMonitor) Summarize(summary *runSummary) []any {
+	joules, watts, ok := m.Total()
+	if !ok {
+		return nil
+	}
+	summary.EnergyJoules, summary.MeanWatts = &joules, &watts
+	return []any{"energy_joules", decimal(joules, 1), "mean_watts", decimal(watts, 1)}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// burnExprFuncs are the functions burn expressions can call, along with the number of arguments
+// they take, -1 for any
+var burnExprFuncs = map[string]struct {
+	args int
+	fn   func(...float64) float64
+}{
+	"min":   {-1, func(v ...float64) float64 { return slices.Min(v) }},
+	"max":   {-1, func(v ...float64) float64 { return slices.Max(v) }},
+	"floor": {1, func(v ...float64) float64 { return math.Floor(v[0]) }},
+	"ceil":  {1, func(v ...float64) float64 { return math.Ceil(v[0]) }},
+	"round": {1, func(v ...float64) float64 { return math.Round(v[0]) }},
+}
+
+// burnExprVarNames are the host facts burn expressions can refer to, see burnExprVars
+var burnExprVarNames = []string{"numcpu", "hostcpus"}
+
+// burnExprVars returns the host facts burn expressions can refer to, measured when evaluated:
+// numcpu is the capacity percentages are relative to, see --relative-to, and hostcpus the cpus
+// the process is allowed to run on
+func burnExprVars() map[string]float64 {
+	return map[string]float64{
+		"numcpu":   cpuCapacity(),
+		"hostcpus": onlineCPUs(),
+	}
+}
+
+// isBurnExpr tells whether a burn value is an expression rather than a plain amount of cpus
+func isBurnExpr(value string) bool {
+	return strings.ContainsAny(value, "+-*/(),") || referencesCapacity(value)
+}
+
+// referencesCapacity tells whether a burn value depends on the cpus of the host, as a percentage
+// or an expression of host facts
+func referencesCapacity(value string) bool {
+	if strings.Contains(value, "%") {
+		return true
+	}
+	for _, name := range burnExprVarNames {
+		if strings.Contains(value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalBurnExpr evaluates a burn expression, eg numcpu-2 or min(4, numcpu*0.5), made of numbers,
+// percentages and millicores with the same meaning as in --burn, the host facts of burnExprVars,
+// + - * / and parentheses, and the functions min, max, floor, ceil and round. Results below 0 are
+// invalid, max(0, numcpu-2) burns nothing rather than failing on hosts with two cores or less
+func evalBurnExpr(expr string) (float64, error) {
+	p := &burnExprParser{input: expr, vars: burnExprVars()}
+	value, err := p.sum()
+	if err == nil && p.skipSpaces() < len(p.input) {
+		err = fmt.Errorf("unexpected %q", p.input[p.pos:])
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid burn expression: %s: %w", expr, err)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid burn expression: %s: not a finite number", expr)
+	}
+	// round away floating point noise, eg 0.8-0.5 is 0.3
+	value = math.Round(value*1e6) / 1e6
+	if value < 0 {
+		return 0, fmt.Errorf("invalid burn value: %s", expr)
+	}
+	return value, nil
+}
+
+// burnExprParser is a recursive descent parser evaluating burn expressions as it goes
+type burnExprParser struct {
+	input string
+	pos   int
+	vars  map[string]float64
+}
+
+func (p *burnExprParser) skipSpaces() int {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	return p.pos
+}
+
+// next consumes the given operator when it is the next token
+func (p *burnExprParser) next(op byte) bool {
+	if p.skipSpaces() < len(p.input) && p.input[p.pos] == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// sum parses terms added or subtracted
+func (p *burnExprParser) sum() (float64, error) {
+	value, err := p.product()
+	for err == nil {
+		var other float64
+		switch {
+		case p.next('+'):
+			other, err = p.product()
+			value += other
+		case p.next('-'):
+			other, err = p.product()
+			value -= other
+		default:
+			return value, nil
+		}
+	}
+	return 0, err
+}
+
+// product parses factors multiplied or divided
+func (p *burnExprParser) product() (float64, error) {
+	value, err := p.factor()
+	for err == nil {
+		var other float64
+		switch {
+		case p.next('*'):
+			other, err = p.factor()
+			value *= other
+		case p.next('/'):
+			other, err = p.factor()
+			if err == nil && other == 0 {
+				err = fmt.Errorf("division by zero")
+			}
+			value /= other
+		default:
+			return value, nil
+		}
+	}
+	return 0, err
+}
+
+// factor parses a number, a host fact, a function call, a negated factor or a parenthesized sum
+func (p *burnExprParser) factor() (float64, error) {
+	if p.next('-') {
+		value, err := p.factor()
+		return -value, err
+	}
+	if p.next('(') {
+		value, err := p.sum()
+		if err == nil && !p.next(')') {
+			err = fmt.Errorf("missing )")
+		}
+		return value, err
+	}
+	start := p.skipSpaces()
+	if start == len(p.input) {
+		return 0, fmt.Errorf("unexpected end")
+	}
+	if c := rune(p.input[start]); unicode.IsLetter(c) {
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		return p.name(p.input[start:p.pos])
+	}
+	for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected %q", p.input[start:])
+	}
+	switch {
+	case p.pos < len(p.input) && p.input[p.pos] == '%':
+		p.pos++
+		value = value / 100 * p.vars["numcpu"]
+	case p.pos < len(p.input) && p.input[p.pos] == 'm':
+		p.pos++
+		value /= 1000
+	}
+	return value, nil
+}
+
+// name evaluates a host fact, or the function call it starts
+func (p *burnExprParser) name(name string) (float64, error) {
+	if value, found := p.vars[name]; found {
+		return value, nil
+	}
+	f, found := burnExprFuncs[name]
+	if !found {
+		return 0, fmt.Errorf("unknown name %s", name)
+	}
+	if !p.next('(') {
+		return 0, fmt.Errorf("missing ( after %s", name)
+	}
+	var args []float64
+	for {
+		value, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, value)
+		if p.next(')') {
+			break
+		}
+		if !p.next(',') {
+			return 0, fmt.Errorf("missing ) after the arguments of %s", name)
+		}
+	}
+	if f.args >= 0 && len(args) != f.args {
+		return 0, fmt.Errorf("%s takes %d argument(s), got %d", name, f.args, len(args))
+	}
+	return f.fn(args...), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// withCapacity sets what percentages and numcpu are relative to for the duration of the test
+func withCapacity(t *testing.T, cpus float64) {
+	t.Helper()
+	previous := cpuCapacity()
+	setCapacity(cpus)
+	t.Cleanup(func() { setCapacity(previous) })
+}
+
+func TestParseBurn(t *testing.T) {
+	withCapacity(t, 4)
+	host := onlineCPUs()
+
+	tests := []struct {
+		burn string
+		want float64
+		err  string
+	}{
+		{burn: "0", want: 0},
+		{burn: "1.5", want: 1.5},
+		{burn: "1500m", want: 1.5},
+		{burn: "250m", want: 0.25},
+		{burn: "50%", want: 2},
+		{burn: "62.5%", want: 2.5},
+		{burn: "numcpu", want: 4},
+		{burn: "numcpu-2", want: 2},
+		{burn: "numcpu-500m", want: 3.5},
+		{burn: "50%+1", want: 3},
+		{burn: "min(4, numcpu*0.5)", want: 2},
+		{burn: "max(0, numcpu-8)", want: 0},
+		{burn: "floor(numcpu/3)", want: 1},
+		{burn: "0.8-0.5", want: 0.3},
+		{burn: "hostcpus", want: host},
+		{burn: "hostcpus/hostcpus", want: 1},
+
+		{burn: "-1", err: "invalid burn value"},
+		{burn: "-50%", err: "invalid burn value"},
+		{burn: "1-2", err: "invalid burn value"},
+		{burn: "50%-80%", err: "invalid burn value"},
+		{burn: "numcpu-8", err: "invalid burn value"},
+		{burn: "-1500m", err: "invalid burn value"},
+		{burn: "abc", err: "invalid burn value"},
+		{burn: "numcpu/0", err: "division by zero"},
+		{burn: "min(1", err: "missing ) after the arguments of min"},
+		{burn: "floor(1, 2)", err: "floor takes 1 argument(s), got 2"},
+		{burn: "nope(1)", err: "unknown name nope"},
+		{burn: "(1+2", err: "missing )"},
+	}
+	for _, test := range tests {
+		got, err := parseBurn(test.burn)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseBurn(%q) = %v, %v, want an error with %q", test.burn, got, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseBurn(%q) = %v, %v, want %v", test.burn, got, err, test.want)
+		}
+	}
+}
+
+func TestEvalBurnExprNegative(t *testing.T) {
+	withCapacity(t, 4)
+	for _, expr := range []string{"1-2", "-numcpu", "50%-80%", "round(-0.6)"} {
+		if value, err := evalBurnExpr(expr); err == nil {
+			t.Errorf("evalBurnExpr(%q) = %v, want an error", expr, value)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// externalTimeout bounds every request made to the external target source
+const externalTimeout = 10 * time.Second
+
+// maxExternalBody bounds how much of a response is read, as only a number is expected
+const maxExternalBody = 1 << 20
+
+// externalTarget sets the target of a live profile to a number polled from an http endpoint, a
+// prometheus query or a file, scaled
+type externalTarget struct {
+	url    string
+	file   string
+	query  string
+	scale  float64
+	every  time.Duration
+	client *http.Client
+	live   *burn.Live
+}
+
+func newExternalTarget(args Args, prof burn.Profile) (*externalTarget, error) {
+	if args.TargetEvery <= 0 {
+		return nil, fmt.Errorf("invalid target every value: %s", args.TargetEvery)
+	}
+	if args.TargetScale < 0 {
+		return nil, fmt.Errorf("invalid target scale value: %v", args.TargetScale)
+	}
+	live, ok := burn.FindLive(prof)
+	if !ok {
+		return nil, errors.New("cannot poll the target: the profile is not live")
+	}
+	t := &externalTarget{
+		url:    args.TargetURL,
+		file:   args.BurnFromFile,
+		query:  args.TargetQuery,
+		scale:  args.TargetScale,
+		every:  args.TargetEvery,
+		client: &http.Client{Timeout: externalTimeout},
+		live:   live,
+	}
+	// fail early on a bad source, also starting the run at the right target
+	cpus, err := t.Fetch(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll the target: %w", err)
+	}
+	t.live.Set(cpus * t.scale)
+	return t, nil
+}
+
+// Run polls the target every interval until the context is done. Failed polls keep the current
+// target
+func (t *externalTarget) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cpus, err := t.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("failed to poll the target, keeping the current one", "pid", os.Getpid(), "error", err)
+			}
+			continue
+		}
+		slog.Debug("polled target", "pid", os.Getpid(), "value", decimal(cpus, 3))
+		t.live.Set(cpus * t.scale)
+	}
+}
+
+// Fetch polls the source once. Files and urls without a query must hold a number, which accepts
+// the same syntax as --burn. With a query, the url is that of a prometheus server, which must
+// respond with a single sample
+func (t *externalTarget) Fetch(ctx context.Context) (float64, error) {
+	if t.file != "" {
+		data, err := os.ReadFile(t.file)
+		if err != nil {
+			return 0, err
+		}
+		return parseBurn(strings.TrimSpace(string(data)))
+	}
+	target := t.url
+	if t.query != "" {
+		target = strings.TrimSuffix(t.url, "/") + "/api/v1/query?query=" + url.QueryEscape(t.query)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxExternalBody))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if t.query == "" {
+		return parseBurn(strings.TrimSpace(string(body)))
+	}
+	return parsePrometheusValue(body)
+}
+
+// prometheusResponse is the part of a prometheus query api response holding the result, see
+// https://prometheus.io/docs/prometheus/latest/querying/api/
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// parsePrometheusValue extracts the value of a query returning a scalar or a single sample vector
+func parsePrometheusValue(body []byte) (float64, error) {
+	var resp prometheusResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, fmt.Errorf("invalid prometheus response: %w", err)
+	}
+	if resp.Status != "success" {
+		return 0, fmt.Errorf("prometheus query failed: %s", resp.Error)
+	}
+	// values are [<unix time>, "<value>"] pairs
+	var value []any
+	switch resp.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(resp.Data.Result, &value); err != nil {
+			return 0, fmt.Errorf("invalid prometheus response: %w", err)
+		}
+	case "vector":
+		var samples []struct {
+			Value []any `json:"value"`
+		}
+		if err := json.Unmarshal(resp.Data.Result, &samples); err != nil {
+			return 0, fmt.Errorf("invalid prometheus response: %w", err)
+		}
+		if len(samples) != 1 {
+			return 0, fmt.Errorf("prometheus query returned %d samples, expected 1", len(samples))
+		}
+		value = samples[0].Value
+	default:
+		return 0, fmt.Errorf("unsupported prometheus result type %q, expected scalar or vector", resp.Data.ResultType)
+	}
+	if len(value) != 2 {
+		return 0, errors.New("invalid prometheus response: malformed sample")
+	}
+	text, _ := value[1].(string)
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid prometheus sample value %q", text)
+	}
+	return number, nil
+}
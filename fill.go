@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// filler sets the target of a live profile to whatever keeps the whole host busy at a given
+// utilization. The usage of everything else running on the host is measured every interval, and
+// the burner makes up the difference, backing off as other workloads ramp up
+type filler struct {
+	utilization float64 // fraction of the host cpus to keep busy
+	every       time.Duration
+	live        *burn.Live
+}
+
+func newFiller(spec string, every time.Duration, prof burn.Profile) (*filler, error) {
+	value, found := strings.CutSuffix(spec, "%")
+	pct, err := strconv.ParseFloat(value, 64)
+	if !found || err != nil || pct < 0 || pct > 100 {
+		return nil, fmt.Errorf("invalid fill to value: %s: must be a percentage of the host cpus, eg 80%%", spec)
+	}
+	if every <= 0 {
+		return nil, fmt.Errorf("invalid fill every value: %s", every)
+	}
+	if _, _, _, err := hostCPUTimes(); err != nil {
+		return nil, fmt.Errorf("cannot fill the host: %w", err)
+	}
+	live, ok := burn.FindLive(prof)
+	if !ok {
+		return nil, fmt.Errorf("cannot fill the host: the profile is not live")
+	}
+	return &filler{utilization: pct / 100, every: every, live: live}, nil
+}
+
+// Run measures the usage of the host every interval until the context is done
+func (f *filler) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.every)
+	defer ticker.Stop()
+	previousBusy, previousTotal, _, _ := hostCPUTimes()
+	previousOwn := time.Duration(burn.CPUTime())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		busy, total, cpus, err := hostCPUTimes()
+		if err != nil {
+			slog.Warn("failed to read the host cpu usage", "pid", os.Getpid(), "error", err)
+			continue
+		}
+		own := time.Duration(burn.CPUTime())
+		if total <= previousTotal {
+			continue
+		}
+		// host times are in the units of all cpus together, scale them back into cpus
+		interval := float64(total-previousTotal) / float64(cpus)
+		hostUsage := float64(busy-previousBusy) / interval
+		othersUsage := max(0, hostUsage-float64(own-previousOwn)/interval)
+		target := min(float64(runtime.NumCPU()), max(0, f.utilization*float64(cpus)-othersUsage))
+		slog.Debug("host usage", "pid", os.Getpid(), "host_cpus", decimal(hostUsage, 3), "others_cpus", decimal(othersUsage, 3), "cpus", decimal(target, 3))
+		f.live.Set(target)
+		previousBusy, previousTotal, previousOwn = busy, total, own
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// follower sets the target of a live profile to the cpu usage of another process, scaled
+type follower struct {
+	pid     int
+	scale   float64
+	every   time.Duration
+	live    *burn.Live
+	measure func(pid int) (time.Duration, error)
+}
+
+// newFollower follows the usage of a process. With tree set, the usage of all its descendants is
+// added to it
+func newFollower(pid int, scale float64, every time.Duration, prof burn.Profile, tree bool) (*follower, error) {
+	if pid <= 0 {
+		return nil, fmt.Errorf("invalid follow pid value: %d", pid)
+	}
+	if scale < 0 {
+		return nil, fmt.Errorf("invalid follow scale value: %v", scale)
+	}
+	measure := processCPUTime
+	if tree {
+		measure = processTreeCPUTime
+	}
+	if _, err := measure(pid); err != nil {
+		return nil, fmt.Errorf("cannot follow process %d: %w", pid, err)
+	}
+	live, ok := burn.FindLive(prof)
+	if !ok {
+		return nil, fmt.Errorf("cannot follow process %d: the profile is not live", pid)
+	}
+	return &follower{pid: pid, scale: scale, every: every, live: live, measure: measure}, nil
+}
+
+// Run measures the usage of the followed process every interval until the context is done. The
+// run is stopped once the process exits, as there is nothing left to follow
+func (f *follower) Run(ctx context.Context, b *burn.Burner) {
+	ticker := time.NewTicker(f.every)
+	defer ticker.Stop()
+	previous, err := f.measure(f.pid)
+	previousTime := time.Now()
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var current time.Duration
+		current, err = f.measure(f.pid)
+		if err != nil {
+			break
+		}
+		now := time.Now()
+		usage := float64(current-previous) / float64(now.Sub(previousTime))
+		slog.Debug("followed process usage", "pid", os.Getpid(), "follow_pid", f.pid, "cpus", decimal(usage, 3))
+		f.live.Set(usage * f.scale)
+		previous, previousTime = current, now
+	}
+	slog.Warn("followed process is gone, stopping", "pid", os.Getpid(), "follow_pid", f.pid, "error", err)
+	b.Stop()
+}
+
+// parseAntagonist parses the --antagonist multiple, eg 1.5x
+func parseAntagonist(spec string) (float64, error) {
+	scale, err := strconv.ParseFloat(strings.TrimSuffix(spec, "x"), 64)
+	if err != nil || scale < 0 {
+		return 0, fmt.Errorf("invalid antagonist value: %s: must be a multiple of the command usage, eg 1.5x", spec)
+	}
+	return scale, nil
+}
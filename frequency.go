@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+)
+
+// cpuFrequency summarizes the current frequency of a set of cpus, in MHz
+type cpuFrequency struct {
+	mean float64
+	min  float64
+	max  float64
+}
+
+// frequencyMonitor tracks the frequency of the cpus the process may run on over the run, which
+// explains usage deltas caused by frequency scaling, turbo or thermal throttling. It is a no-op
+// when frequencies cannot be read, eg outside of linux or in virtual machines without cpufreq
+type frequencyMonitor struct {
+	mu        sync.Mutex
+	available bool
+	allowed   map[int]bool
+	total     float64
+	samples   int
+}
+
+func newFrequencyMonitor() *frequencyMonitor {
+	m := &frequencyMonitor{}
+	_, available, err := cpuFrequencies()
+	if err != nil {
+		slog.Debug("failed to read cpu frequencies", "pid", os.Getpid(), "error", err)
+	}
+	m.available = available && err == nil
+	// cpus the process cannot run on are left out, their frequency says nothing about the burn
+	m.allowed, _ = allowedCPUs()
+	return m
+}
+
+// Sample returns the current frequency of the cpus, recording its mean for Mean
+func (m *frequencyMonitor) Sample() (cpuFrequency, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return cpuFrequency{}, false
+	}
+	frequencies, _, err := cpuFrequencies()
+	if err != nil {
+		slog.Debug("failed to read cpu frequencies", "pid", os.Getpid(), "error", err)
+		return cpuFrequency{}, false
+	}
+	f := cpuFrequency{min: math.Inf(1)}
+	count := 0
+	for cpu, mhz := range frequencies {
+		if m.allowed != nil && !m.allowed[cpu] {
+			continue
+		}
+		f.mean += mhz
+		f.min = min(f.min, mhz)
+		f.max = max(f.max, mhz)
+		count++
+	}
+	if count == 0 {
+		return cpuFrequency{}, false
+	}
+	f.mean /= float64(count)
+	m.total += f.mean
+	m.samples++
+	return f, true
+}
+
+// Mean returns the mean frequency over all the samples taken so far
+func (m *frequencyMonitor) Mean() (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.samples == 0 {
+		return 0, false
+	}
+	return m.total / float64(m.samples), true
+}
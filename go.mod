@@ -3,6 +3,9 @@ module github.com/bcap/cpu-burner
 go 1.24
 
 require (
-	github.com/alexflint/go-arg v1.5.1 // indirect
-	github.com/alexflint/go-scalar v1.2.0 // indirect
+	github.com/alexflint/go-arg v1.5.1
+	golang.org/x/sys v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/alexflint/go-scalar v1.2.0 // indirect
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// burnGroup is a --group: a burner of its own running alongside the main one in the same process,
+// with its own target, cpus and priority, measuring only the cpu time of its workers
+type burnGroup struct {
+	name   string
+	cpus   float64
+	spec   string // the burn value cpus was parsed from
+	cpuSet []int  // nil when the workers may run on any cpu
+	nice   *int   // nil when the priority is left untouched
+	b      *burn.Burner
+}
+
+// groupSummary is the summary of a group in the --summary-json output
+type groupSummary struct {
+	MeanTarget   float64 `json:"mean_target_cpus"`
+	MeanAchieved float64 `json:"mean_cpus"`
+	AccuracyPct  float64 `json:"accuracy_pct"`
+	CPUSeconds   float64 `json:"cpu_seconds"`
+}
+
+// parseGroup parses a --group value: a name and how much to burn, followed by options, eg
+// api:2:cpuset=0-3 or batch:1.5:nice=10
+func parseGroup(spec string) (*burnGroup, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid group value: %s: must be name:burn followed by options, eg api:2:cpuset=0-3", spec)
+	}
+	cpus, err := parseBurn(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid group value: %s: %w", spec, err)
+	}
+	g := &burnGroup{name: parts[0], cpus: cpus, spec: parts[1]}
+	for _, option := range parts[2:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "cpuset":
+			if runtime.GOOS != "linux" {
+				return nil, errors.New("group cpusets are only supported on linux")
+			}
+			g.cpuSet, err = parseCPUSet(value)
+			if err != nil {
+				return nil, err
+			}
+			allowed, err := allowedCPUs()
+			if err != nil {
+				return nil, err
+			}
+			for _, cpu := range g.cpuSet {
+				if !allowed[cpu] {
+					return nil, fmt.Errorf("cpu %d from group %s is not available to this process", cpu, g.name)
+				}
+			}
+		case "nice":
+			nice, err := strconv.Atoi(value)
+			if err != nil || nice < -20 || nice > 19 {
+				return nil, fmt.Errorf("invalid group nice value: %s: must be between -20 and 19", value)
+			}
+			g.nice = &nice
+		default:
+			return nil, fmt.Errorf("invalid group option: %s: must be cpuset or nice", option)
+		}
+	}
+	return g, nil
+}
+
+// parseGroups parses every --group, which must have distinct names
+func parseGroups(specs []string) ([]*burnGroup, error) {
+	var groups []*burnGroup
+	names := map[string]bool{}
+	for _, spec := range specs {
+		g, err := parseGroup(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[g.name] {
+			return nil, fmt.Errorf("group %s defined twice", g.name)
+		}
+		names[g.name] = true
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// options derives the burner options of the group from the ones of the main burner: the same
+// workload and timings, with its own target, cpus and priority
+func (g *burnGroup) options(main burn.Options) burn.Options {
+	opts := main
+	opts.Profile = burn.Constant(g.cpus)
+	opts.Cores = nil
+	opts.CPUSets = nil
+	if g.cpuSet != nil {
+		opts.CPUSets = [][]int{g.cpuSet}
+	}
+	opts.Priority = nil
+	if g.nice != nil {
+		opts.Priority = &burn.Priority{Policy: burn.SchedOther, Nice: *g.nice}
+	}
+	opts.ThreadStats = false
+	opts.WorkerChurn = 0
+	opts.Isolated = true
+	return opts
+}
+
+// describe sums up the group for logs and the dry run
+func (g *burnGroup) describe() string {
+	desc := fmt.Sprintf("%.3f cpus", g.cpus)
+	if g.cpuSet != nil {
+		desc += " on cpus " + formatCPUSet(g.cpuSet)
+	}
+	if g.nice != nil {
+		desc += fmt.Sprintf(" at nice %d", *g.nice)
+	}
+	return desc
+}
+
+// Start starts burning the group until the context is done or the main burner stops
+func (g *burnGroup) Start(ctx context.Context, main burn.Options, b *burn.Burner) {
+	g.b = burn.New(g.options(main))
+	g.b.Start(ctx)
+	go func() {
+		select {
+		case <-b.Done():
+			g.b.Stop()
+		case <-g.b.Done():
+		}
+	}()
+	slog.Info("burn group started", "pid", os.Getpid(), "group", g.name, "cpus", g.cpus, "setup", g.describe())
+}
+
+// Log logs the usage of the group every time a sample is taken, until it stops
+func (g *burnGroup) Log(ctx context.Context) {
+	samples, unsubscribe := g.b.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.b.Done():
+			return
+		case s := <-samples:
+			slog.Info("group usage", "pid", os.Getpid(), "group", g.name,
+				"cpus", decimal(s.Achieved, 3),
+				"delta_pct", percent(s.DeltaPct()),
+				"target", decimal(s.Target, 3),
+			)
+		}
+	}
+}
+
+// Summarize waits for the group to stop and adds its summary to the run summary, logging it too
+func (g *burnGroup) Summarize(summary *runSummary) {
+	g.b.Wait()
+	s := g.b.Summary()
+	if summary.Groups == nil {
+		summary.Groups = map[string]groupSummary{}
+	}
+	summary.Groups[g.name] = groupSummary{
+		MeanTarget:   s.MeanTarget,
+		MeanAchieved: s.MeanAchieved,
+		AccuracyPct:  s.Accuracy(),
+		CPUSeconds:   s.CPUSeconds,
+	}
+	slog.Info("group summary", "pid", os.Getpid(), "group", g.name,
+		"cpu_seconds", decimal(s.CPUSeconds, 3),
+		"mean_cpus", decimal(s.MeanAchieved, 3),
+		"mean_target_cpus", decimal(s.MeanTarget, 3),
+		"accuracy_pct", decimal(s.Accuracy(), 1),
+	)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// grpc status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+	grpcUnavailable     = 14
+)
+
+const grpcService = "/cpuburner.v1.Burner/"
+
+// grpcMaxMessage bounds the size of request messages, which are all tiny
+const grpcMaxMessage = 64 << 10
+
+// grpcError is a failed rpc, reported to the client through the grpc-status trailer
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// newGRPCHandler exposes the grpc control api of a burner described in proto/burner.proto. It is
+// served over cleartext http/2 and encodes its handful of messages by hand, which avoids pulling
+// in grpc and protobuf for a few rpcs
+func newGRPCHandler(b *burn.Burner) http.Handler {
+	unary := map[string]func(request []byte) ([]byte, error){
+		"SetTarget": func(request []byte) ([]byte, error) {
+			fields, err := decodeProto(request)
+			if err != nil {
+				return nil, &grpcError{grpcInvalidArgument, err.Error()}
+			}
+			cpus, err := parseBurn(string(fields[1]))
+			if err != nil {
+				return nil, &grpcError{grpcInvalidArgument, err.Error()}
+			}
+			b.SetTarget(cpus)
+			return encodeTarget(cpus, b.Paused()), nil
+		},
+		"GetStats": func(request []byte) ([]byte, error) {
+			return encodeStats(b, b.Stats().Last), nil
+		},
+		"Pause": func(request []byte) ([]byte, error) {
+			b.Pause()
+			return encodeTarget(b.Target(), b.Paused()), nil
+		},
+		"Resume": func(request []byte) ([]byte, error) {
+			b.Resume()
+			return encodeTarget(b.Target(), b.Paused()), nil
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "only grpc requests are supported", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		method, found := strings.CutPrefix(r.URL.Path, grpcService)
+		if !found {
+			writeGRPCStatus(w, &grpcError{grpcUnimplemented, "unknown service"})
+			return
+		}
+		request, err := readGRPCMessage(r.Body)
+		if err != nil {
+			writeGRPCStatus(w, err)
+			return
+		}
+		if method == "StreamStats" {
+			writeGRPCStatus(w, streamStats(r.Context(), w, b))
+			return
+		}
+		handler, found := unary[method]
+		if !found {
+			writeGRPCStatus(w, &grpcError{grpcUnimplemented, "unknown method " + method})
+			return
+		}
+		response, err := handler(request)
+		if err == nil {
+			err = writeGRPCMessage(w, response)
+		}
+		writeGRPCStatus(w, err)
+	})
+}
+
+// streamStats sends the stats every time a sample is taken, until the client goes away or the
+// burner stops
+func streamStats(ctx context.Context, w http.ResponseWriter, b *burn.Burner) error {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	// send the headers right away, so clients know the stream is up before the first sample
+	w.WriteHeader(http.StatusOK)
+	http.NewResponseController(w).Flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.Done():
+			return nil
+		case s := <-samples:
+			if err := writeGRPCMessage(w, encodeStats(b, s)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readGRPCMessage reads the single message of a unary or server streaming request. Messages are
+// prefixed by a compression flag and their length
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "failed to read request: " + err.Error()}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed requests are not supported"}
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > grpcMaxMessage {
+		return nil, &grpcError{grpcInvalidArgument, "request too large"}
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "failed to read request: " + err.Error()}
+	}
+	return message, nil
+}
+
+func writeGRPCMessage(w http.ResponseWriter, message []byte) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	if _, err := w.Write(append(frame, message...)); err != nil {
+		return &grpcError{grpcUnavailable, err.Error()}
+	}
+	http.NewResponseController(w).Flush()
+	return nil
+}
+
+// writeGRPCStatus ends the rpc with the status of the error, nil meaning success
+func writeGRPCStatus(w http.ResponseWriter, err error) {
+	code, message := grpcOK, ""
+	var rpcErr *grpcError
+	if errors.As(err, &rpcErr) {
+		code, message = rpcErr.code, rpcErr.message
+	} else if err != nil {
+		code, message = grpcInternal, err.Error()
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", message)
+	}
+}
+
+func encodeTarget(cpus float64, paused bool) []byte {
+	var message []byte
+	message = appendProtoDouble(message, 1, cpus)
+	message = appendProtoBool(message, 2, paused)
+	return message
+}
+
+func encodeStats(b *burn.Burner, last burn.Sample) []byte {
+	stats := b.Stats()
+	var message []byte
+	message = appendProtoDouble(message, 1, stats.Target)
+	message = appendProtoDouble(message, 2, last.Achieved)
+	message = appendProtoDouble(message, 3, last.User)
+	message = appendProtoDouble(message, 4, last.System)
+	message = appendProtoBool(message, 5, stats.Paused)
+	message = appendProtoString(message, 6, string(b.State()))
+	message = appendProtoVarint(message, 7, uint64(stats.Workers))
+	message = appendProtoDouble(message, 8, stats.CPUSeconds)
+	message = appendProtoVarint(message, 9, uint64(stats.Uptime.Milliseconds()))
+	if !last.Time.IsZero() {
+		message = appendProtoVarint(message, 10, uint64(last.Time.UnixNano()))
+	}
+	message = appendProtoVarint(message, 11, uint64(int64(stats.Phase)))
+	return message
+}
+
+// protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+func appendProtoTag(message []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(message, uint64(field)<<3|uint64(wireType))
+}
+
+// appendProtoVarint appends an integer or enum field, skipping zero values as proto3 does
+func appendProtoVarint(message []byte, field int, value uint64) []byte {
+	if value == 0 {
+		return message
+	}
+	return binary.AppendUvarint(appendProtoTag(message, field, protoVarint), value)
+}
+
+func appendProtoBool(message []byte, field int, value bool) []byte {
+	if !value {
+		return message
+	}
+	return appendProtoVarint(message, field, 1)
+}
+
+func appendProtoDouble(message []byte, field int, value float64) []byte {
+	if value == 0 {
+		return message
+	}
+	return binary.LittleEndian.AppendUint64(appendProtoTag(message, field, protoFixed64), math.Float64bits(value))
+}
+
+func appendProtoString(message []byte, field int, value string) []byte {
+	if value == "" {
+		return message
+	}
+	message = binary.AppendUvarint(appendProtoTag(message, field, protoBytes), uint64(len(value)))
+	return append(message, value...)
+}
+
+// decodeProto returns the length delimited fields of a message, by field number, which is all
+// requests are made of. Fields of other types are skipped
+func decodeProto(message []byte) (map[int][]byte, error) {
+	fields := map[int][]byte{}
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, errors.New("invalid request message")
+		}
+		message = message[n:]
+		field, wireType := int(tag>>3), int(tag&7)
+		var size uint64
+		switch wireType {
+		case protoVarint:
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return nil, errors.New("invalid request message")
+			}
+			size = uint64(n)
+		case protoFixed64:
+			size = 8
+		case protoFixed32:
+			size = 4
+		case protoBytes:
+			length, n := binary.Uvarint(message)
+			if n <= 0 {
+				return nil, errors.New("invalid request message")
+			}
+			message = message[n:]
+			size = length
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in request message", wireType)
+		}
+		if size > uint64(len(message)) {
+			return nil, errors.New("truncated request message")
+		}
+		if wireType == protoBytes {
+			fields[field] = message[:size]
+		}
+		message = message[size:]
+	}
+	return fields, nil
+}
+
+// serveGRPC serves the handler over cleartext http/2 on the listener until the context is done
+func serveGRPC(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	server := &http.Server{Handler: handler, Protocols: &http.Protocols{}}
+	server.Protocols.SetUnencryptedHTTP2(true)
+	context.AfterFunc(ctx, func() { server.Close() })
+	slog.Info("grpc server listening", "pid", os.Getpid(), "address", listener.Addr().String())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
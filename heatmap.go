@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// heatmapMaxColumns is how many intervals a heatmap row shows at most, more are averaged together
+const heatmapMaxColumns = 60
+
+// heatmapShades draws how busy a cpu was, from idle to fully busy
+const heatmapShades = " .:-=+*#%@"
+
+// cpuTimes is the cpu time a cpu spent busy so far, and in total including idle time
+type cpuTimes struct {
+	busy  time.Duration
+	total time.Duration
+}
+
+// heatmapInterval is how busy every cpu of the host was over an interval, from 0 to 1
+type heatmapInterval struct {
+	time     time.Time
+	interval time.Duration
+	busy     map[int]float64
+}
+
+// cpuHeatmap records how busy every cpu of the host was each time usage is sampled, which tells
+// which cores the burn actually landed on. Written once the run finishes to the --cpu-heatmap file
+type cpuHeatmap struct {
+	mu        sync.Mutex
+	cpus      []int
+	last      map[int]cpuTimes
+	lastTime  time.Time
+	intervals []heatmapInterval
+}
+
+func newCPUHeatmap() (*cpuHeatmap, error) {
+	times, err := perCPUTimes()
+	if err != nil {
+		return nil, err
+	}
+	return &cpuHeatmap{cpus: slices.Sorted(maps.Keys(times)), last: times, lastTime: time.Now()}, nil
+}
+
+// Run records the usage of every cpu each time the burner samples its own, until the context is done
+func (h *cpuHeatmap) Run(ctx context.Context, b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-samples:
+			if err := h.record(); err != nil {
+				slog.Debug("failed to read per cpu usage", "pid", os.Getpid(), "error", err)
+			}
+		}
+	}
+}
+
+func (h *cpuHeatmap) record() error {
+	times, err := perCPUTimes()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	interval := heatmapInterval{time: now, interval: now.Sub(h.lastTime), busy: map[int]float64{}}
+	for _, cpu := range h.cpus {
+		before, after := h.last[cpu], times[cpu]
+		if total := after.total - before.total; total > 0 {
+			interval.busy[cpu] = min(1, max(0, float64(after.busy-before.busy)/float64(total)))
+		}
+	}
+	h.intervals = append(h.intervals, interval)
+	h.last, h.lastTime = times, now
+	return nil
+}
+
+// Means returns how busy every cpu was over the whole run, from 0 to 1, by cpu id
+func (h *cpuHeatmap) Means() map[int]float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	means := map[int]float64{}
+	for _, cpu := range h.cpus {
+		var busy, total time.Duration
+		for _, interval := range h.intervals {
+			busy += time.Duration(interval.busy[cpu] * float64(interval.interval))
+			total += interval.interval
+		}
+		if total > 0 {
+			means[cpu] = float64(busy) / float64(total)
+		}
+	}
+	return means
+}
+
+// Write writes the heatmap to path: as csv, with a row per interval and a column per cpu, when the
+// path ends in .csv, and drawn as text with a row per cpu otherwise
+func (h *cpuHeatmap) Write(path string, lockOSThread bool) error {
+	if strings.HasSuffix(path, ".csv") {
+		return h.writeCSV(path)
+	}
+	means := h.Means()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "per cpu usage of the host over the run, pid %d, lock os thread: %t\n", os.Getpid(), lockOSThread)
+	if allowed, err := allowedCPUs(); err == nil {
+		fmt.Fprintf(b, "cpus the burner may run on: %s\n", formatCPUSet(slices.Collect(maps.Keys(allowed))))
+	}
+	fmt.Fprintf(b, "each column is an interval of the run, shaded from idle to fully busy with %q\n\n", heatmapShades)
+
+	bucketSize := max(1, (len(h.intervals)+heatmapMaxColumns-1)/heatmapMaxColumns)
+	for _, cpu := range h.cpus {
+		row := []byte{}
+		for i := 0; i < len(h.intervals); i += bucketSize {
+			end := min(i+bucketSize, len(h.intervals))
+			busy := 0.0
+			for _, interval := range h.intervals[i:end] {
+				busy += interval.busy[cpu]
+			}
+			busy /= float64(end - i)
+			row = append(row, heatmapShades[min(len(heatmapShades)-1, int(busy*float64(len(heatmapShades))))])
+		}
+		fmt.Fprintf(b, "cpu%-4d |%s| %5.1f%%\n", cpu, row, means[cpu]*100)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func (h *cpuHeatmap) writeCSV(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	header := []string{"timestamp", "interval_seconds"}
+	for _, cpu := range h.cpus {
+		header = append(header, fmt.Sprintf("cpu%d_busy_pct", cpu))
+	}
+	w.Write(header)
+	for _, interval := range h.intervals {
+		row := []string{interval.time.Format(time.RFC3339Nano), strconv.FormatFloat(interval.interval.Seconds(), 'f', 3, 64)}
+		for _, cpu := range h.cpus {
+			row = append(row, strconv.FormatFloat(interval.busy[cpu]*100, 'f', 2, 64))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// runInteractive runs the commands read from r, one per line, writing their responses to w until
+// r is exhausted or the burner stops. Takes the same commands as the control socket, see
+// runCommand, plus quit as an alias of stop
+func runInteractive(r io.Reader, w io.Writer, b *burn.Burner) {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for {
+		var line string
+		select {
+		case <-b.Done():
+			return
+		case l, ok := <-lines:
+			if !ok {
+				return
+			}
+			line = strings.TrimSpace(l)
+		}
+		if line == "" {
+			continue
+		}
+		if line == "quit" {
+			line = "stop"
+		}
+		response, err := runCommand(b, line)
+		if err != nil {
+			response = "error: " + err.Error()
+		}
+		fmt.Fprintln(w, response)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ioOptions struct {
+	rate      int64 // bytes per second
+	path      string
+	blockSize int64
+	fileSize  int64
+	mode      string
+	fsync     bool
+	random    bool
+}
+
+// ioBurner generates read and/or write load against a scratch file at a target throughput
+type ioBurner struct {
+	opts ioOptions
+	file *os.File
+
+	read    atomic.Int64
+	written atomic.Int64
+}
+
+// parseRate parses a throughput like 50MB/s or 1GiB/s into bytes per second
+func parseRate(rate string) (int64, error) {
+	bytes, err := parseBytes(strings.TrimSuffix(rate, "/s"))
+	if err != nil || bytes == 0 {
+		return 0, fmt.Errorf("invalid rate: %s", rate)
+	}
+	return bytes, nil
+}
+
+// parseIOOptions parses and checks the --io options, without touching the disk yet
+func parseIOOptions(args Args) (ioOptions, error) {
+	rate, err := parseRate(args.IO)
+	if err != nil {
+		return ioOptions{}, err
+	}
+	blockSize, err := parseBytes(args.IOBlockSize)
+	if err != nil {
+		return ioOptions{}, err
+	}
+	fileSize, err := parseBytes(args.IOFileSize)
+	if err != nil {
+		return ioOptions{}, err
+	}
+	switch args.IOMode {
+	case "read", "write", "mixed":
+	default:
+		return ioOptions{}, fmt.Errorf("invalid io mode %q: must be read, write or mixed", args.IOMode)
+	}
+	if blockSize <= 0 || fileSize < blockSize {
+		return ioOptions{}, fmt.Errorf("io file size (%d) must be at least as big as the block size (%d), which must be positive", fileSize, blockSize)
+	}
+	path := args.IOPath
+	if path == "" {
+		path = os.TempDir()
+	}
+	if info, err := os.Stat(path); err != nil {
+		return ioOptions{}, err
+	} else if !info.IsDir() {
+		return ioOptions{}, fmt.Errorf("io path %s is not a directory", path)
+	}
+	return ioOptions{
+		rate:      rate,
+		path:      path,
+		blockSize: blockSize,
+		fileSize:  fileSize,
+		mode:      args.IOMode,
+		fsync:     args.IOFsync,
+		random:    args.IORandom,
+	}, nil
+}
+
+// newIOBurner creates the scratch file inside the directory of the options and fills it up so
+// there is data to be read from the start. The file is always created anew, so no existing file is
+// ever overwritten or removed
+func newIOBurner(opts ioOptions) (*ioBurner, error) {
+	file, err := os.CreateTemp(opts.path, "cpu-burner-io-*")
+	if err != nil {
+		return nil, err
+	}
+	b := &ioBurner{opts: opts, file: file}
+	block := make([]byte, opts.blockSize)
+	for offset := int64(0); offset < opts.fileSize; offset += opts.blockSize {
+		if _, err := file.WriteAt(block, offset); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Close closes and removes the scratch file, which the burner created itself
+func (b *ioBurner) Close() error {
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// Run performs io operations one block at a time, sleeping whenever it is ahead of the target
+// throughput, until the context is done
+func (b *ioBurner) Run(ctx context.Context, logEvery time.Duration, gate loadGate) {
+	slog.Info("generating io load", "pid", os.Getpid(), "path", b.file.Name(), "rate_bytes_per_sec", b.opts.rate, "mode", b.opts.mode, "block_size", b.opts.blockSize, "fsync", b.opts.fsync, "random", b.opts.random)
+
+	if logEvery > 0 {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logThroughput(ctx, "io usage", logEvery, namedCounter{"read_bytes_per_sec", &b.read}, namedCounter{"write_bytes_per_sec", &b.written})
+		}()
+		defer wg.Wait()
+	}
+
+	block := make([]byte, b.opts.blockSize)
+	blocks := b.opts.fileSize / b.opts.blockSize
+	start := time.Now()
+	var done, next int64
+	for {
+		// io operations are syscalls anyway, checking the context on each one is cheap in comparison
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if waited, open := gate.wait(ctx); !open {
+			return
+		} else if waited {
+			// pick up at the target rate rather than catching up on the time spent idle
+			start, done = time.Now(), 0
+		}
+
+		// throttle ourselves to the target rate
+		expected := int64(time.Since(start).Seconds() * float64(b.opts.rate))
+		if done >= expected {
+			ahead := time.Duration(float64(done-expected) / float64(b.opts.rate) * float64(time.Second))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(max(ahead, time.Millisecond)):
+			}
+			continue
+		}
+
+		position := next
+		if b.opts.random {
+			position = rand.Int64N(blocks)
+		}
+		next = (next + 1) % blocks
+		offset := position * b.opts.blockSize
+
+		write := b.opts.mode == "write" || (b.opts.mode == "mixed" && (b.read.Load()+b.written.Load())/b.opts.blockSize%2 == 0)
+		var err error
+		if write {
+			block[0]++
+			_, err = b.file.WriteAt(block, offset)
+			if err == nil && b.opts.fsync {
+				err = b.file.Sync()
+			}
+			b.written.Add(b.opts.blockSize)
+		} else {
+			_, err = b.file.ReadAt(block, offset)
+			if err == io.EOF {
+				err = nil
+			}
+			b.read.Add(b.opts.blockSize)
+		}
+		if err != nil {
+			slog.Error("io operation failed, stopping io load", "pid", os.Getpid(), "path", b.file.Name(), "error", err)
+			return
+		}
+		done += b.opts.blockSize
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Label is a single user provided key=value pair that gets attached to every log line and
+// to every other output the burner produces
+type Label struct {
+	Key   string
+	Value string
+}
+
+// Labels keeps the order in which labels were given in the command line so outputs are stable
+type Labels []Label
+
+var labelKeyRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelKeys are the label keys the burner attaches itself, eg to tell apart the series of
+// every worker in the metrics, which a user label of the same key would duplicate
+var reservedLabelKeys = map[string]bool{"worker": true}
+
+func parseLabels(specs []string) (Labels, error) {
+	labels := Labels{}
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		key, value, found := strings.Cut(spec, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", spec)
+		}
+		if !labelKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("invalid label key %q: must match %s", key, labelKeyRegexp)
+		}
+		if reservedLabelKeys[key] {
+			return nil, fmt.Errorf("invalid label key %q: reserved by the burner", key)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("invalid label %q: value cannot be empty", spec)
+		}
+		if strings.ContainsAny(value, ",= \t\n") {
+			return nil, fmt.Errorf("invalid label value %q: cannot contain commas, equal signs or whitespace", value)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate label key %q", key)
+		}
+		seen[key] = true
+		labels = append(labels, Label{Key: key, Value: value})
+	}
+	return labels, nil
+}
+
+// Map returns the labels as a map, which is handy for serializing them into payloads
+func (l Labels) Map() map[string]string {
+	m := make(map[string]string, len(l))
+	for _, label := range l {
+		m[label.Key] = label.Value
+	}
+	return m
+}
+
+// String returns the compact form of the labels, eg: team=payments,env=staging
+func (l Labels) String() string {
+	parts := make([]string, len(l))
+	for i, label := range l {
+		parts[i] = label.Key + "=" + label.Value
+	}
+	return strings.Join(parts, ",")
+}
+
+// labelsHandler appends the labels to every log record. Text logs get them as a single compact
+// suffix attribute, while structured logs get each label as its own field
+type labelsHandler struct {
+	slog.Handler
+	attrs []slog.Attr
+}
+
+func newLabelsHandler(handler slog.Handler, labels Labels, structured bool) slog.Handler {
+	if len(labels) == 0 {
+		return handler
+	}
+	var attrs []slog.Attr
+	if structured {
+		for _, label := range labels {
+			attrs = append(attrs, slog.String(label.Key, label.Value))
+		}
+	} else {
+		attrs = []slog.Attr{slog.String("labels", labels.String())}
+	}
+	return &labelsHandler{Handler: handler, attrs: attrs}
+}
+
+func (h *labelsHandler) Handle(ctx context.Context, record slog.Record) error {
+	record = record.Clone()
+	record.AddAttrs(h.attrs...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *labelsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &labelsHandler{Handler: h.Handler.WithAttrs(attrs), attrs: h.attrs}
+}
+
+func (h *labelsHandler) WithGroup(name string) slog.Handler {
+	return &labelsHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyBuckets is how many buckets per doubling the latency histogram has, bounding the error
+// of the percentiles of the whole run to about 9%
+const latencyBuckets = 8
+
+// latencyProbe measures scheduling latency alongside the burn: a goroutine locked to its own OS
+// thread repeatedly sleeps for a short interval, and the time it takes to wake up past the end of
+// the sleep is how long it waited to be scheduled
+type latencyProbe struct {
+	every time.Duration
+
+	mu sync.Mutex
+	// window holds every latency measured since the last Sample
+	window []time.Duration
+	// histogram counts the latencies of the whole run, by log scale bucket, see latencyBucket
+	histogram map[int]int64
+	count     int64
+	max       time.Duration
+}
+
+func newLatencyProbe(every time.Duration) *latencyProbe {
+	return &latencyProbe{every: every, histogram: map[int]int64{}}
+}
+
+// Run probes until the context is done
+func (p *latencyProbe) Run(ctx context.Context) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for ctx.Err() == nil {
+		start := time.Now()
+		time.Sleep(p.every)
+		latency := max(0, time.Since(start)-p.every)
+		p.mu.Lock()
+		p.window = append(p.window, latency)
+		p.histogram[latencyBucket(latency)]++
+		p.count++
+		p.max = max(p.max, latency)
+		p.mu.Unlock()
+	}
+}
+
+// Sample returns the latencies measured since the previous call as log attributes
+func (p *latencyProbe) Sample() []any {
+	p.mu.Lock()
+	window := p.window
+	p.window = nil
+	p.mu.Unlock()
+	if len(window) == 0 {
+		return nil
+	}
+	slices.Sort(window)
+	percentile := func(q float64) time.Duration {
+		return window[min(len(window)-1, int(q*float64(len(window))))]
+	}
+	return []any{
+		"latency_p50_us", decimal(microseconds(percentile(0.5)), 1),
+		"latency_p99_us", decimal(microseconds(percentile(0.99)), 1),
+		"latency_max_us", decimal(microseconds(window[len(window)-1]), 1),
+	}
+}
+
+// Summarize adds the latency percentiles of the whole run to the summary, returning them as log
+// attributes too
+func (p *latencyProbe) Summarize(summary *runSummary) []any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.count == 0 {
+		return nil
+	}
+	buckets := make([]int, 0, len(p.histogram))
+	for bucket := range p.histogram {
+		buckets = append(buckets, bucket)
+	}
+	slices.Sort(buckets)
+	percentile := func(q float64) float64 {
+		rank := int64(math.Ceil(q * float64(p.count)))
+		var seen int64
+		for _, bucket := range buckets {
+			seen += p.histogram[bucket]
+			if seen >= rank {
+				return min(latencyBucketBound(bucket), microseconds(p.max))
+			}
+		}
+		return microseconds(p.max)
+	}
+	p50, p99, maximum := percentile(0.5), percentile(0.99), microseconds(p.max)
+	summary.LatencyP50Us, summary.LatencyP99Us, summary.LatencyMaxUs = &p50, &p99, &maximum
+	return []any{"latency_p50_us", decimal(p50, 1), "latency_p99_us", decimal(p99, 1), "latency_max_us", decimal(maximum, 1)}
+}
+
+// latencyBucket returns the histogram bucket of a latency. Buckets grow exponentially, each one
+// latencyBuckets times narrower than a doubling, starting from 1µs
+func latencyBucket(latency time.Duration) int {
+	us := microseconds(latency)
+	if us <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log2(us) * latencyBuckets))
+}
+
+// latencyBucketBound is the upper bound of a bucket, in microseconds
+func latencyBucketBound(bucket int) float64 {
+	return math.Exp2(float64(bucket) / latencyBuckets)
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// limitTracker sets the target of a live profile to a fraction of the cpu limit of the cgroup the
+// process runs in, eg the limit of a kubernetes pod, following the limit when it is resized in
+// place
+type limitTracker struct {
+	fraction float64
+	every    time.Duration
+	live     *burn.Live
+	limit    float64 // last limit read, in cpus
+}
+
+func newLimitTracker(spec string, every time.Duration, prof burn.Profile) (*limitTracker, error) {
+	value, found := strings.CutSuffix(spec, "%")
+	pct, err := strconv.ParseFloat(value, 64)
+	if !found || err != nil || pct < 0 {
+		return nil, fmt.Errorf("invalid of limit value: %s: must be a percentage of the cgroup cpu limit, eg 75%%", spec)
+	}
+	if every <= 0 {
+		return nil, fmt.Errorf("invalid target every value: %s", every)
+	}
+	live, ok := burn.FindLive(prof)
+	if !ok {
+		return nil, errors.New("cannot burn a share of the cpu limit: the profile is not live")
+	}
+	limit, limited, err := cgroupCPUs()
+	if err != nil {
+		return nil, fmt.Errorf("cannot burn a share of the cpu limit: %w", err)
+	}
+	if !limited {
+		return nil, errors.New("cannot burn a share of the cpu limit: the cgroup has no cpu limit")
+	}
+	t := &limitTracker{fraction: pct / 100, every: every, live: live, limit: limit}
+	t.live.Set(t.fraction * limit)
+	return t, nil
+}
+
+// Run reads the limit every interval until the context is done. Failed reads, or the limit being
+// lifted, keep the current target
+func (t *limitTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		limit, limited, err := cgroupCPUs()
+		if err != nil || !limited {
+			if err == nil {
+				err = errors.New("the cgroup has no cpu limit")
+			}
+			slog.Warn("failed to read the cgroup cpu limit, keeping the current target", "pid", os.Getpid(), "error", err)
+			continue
+		}
+		if limit == t.limit {
+			continue
+		}
+		slog.Info("cgroup cpu limit changed", "pid", os.Getpid(), "previous_cpus", decimal(t.limit, 3), "limit_cpus", decimal(limit, 3))
+		t.limit = limit
+		t.live.Set(t.fraction * limit)
+	}
+}
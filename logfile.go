@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// logOutput is where logs are written: stderr, or the --log-file. Child processes write their logs
+// here too
+var logOutput io.Writer = os.Stderr
+
+// rotatingFile is a log file that is rotated once it grows over maxSize or has been written to
+// for longer than maxAge, keeping the last keep rotated files as path.1, path.2 and so on, path.1
+// being the most recent. A maxSize or maxAge of 0 disables that trigger
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	keep    int
+	file    *os.File
+	size    int64
+	opened  time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*rotatingFile, error) {
+	if maxSize < 0 {
+		return nil, fmt.Errorf("invalid log max size value: %d", maxSize)
+	}
+	if maxAge < 0 {
+		return nil, fmt.Errorf("invalid log max age value: %s", maxAge)
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("invalid log keep value: %d", keep)
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file for appending, carrying on with whatever it already has
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	full := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	old := f.maxAge > 0 && time.Since(f.opened) >= f.maxAge
+	if full || old {
+		if err := f.rotate(); err != nil {
+			// losing the rotation is better than losing logs, keep writing to the current file
+			fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %s\n", f.path, err)
+			f.opened = time.Now()
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a new log file
+func (f *rotatingFile) rotate() error {
+	if f.keep == 0 {
+		if err := f.file.Truncate(0); err != nil {
+			return err
+		}
+		f.size, f.opened = 0, time.Now()
+		return nil
+	}
+	for i := f.keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	current := f.file
+	if err := f.open(); err != nil {
+		// the current file was renamed already, keep writing to it under its new name
+		return err
+	}
+	current.Close()
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
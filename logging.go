@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// structuredLogs is set when logging in a machine readable format, in which case numbers are
+// logged as numbers instead of being formatted for humans
+var structuredLogs bool
+
+// newLogHandler builds the log handler for the given format ("text" or "json")
+func newLogHandler(w io.Writer, format string, level slog.Level, labels Labels) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: nameTraceLevel}
+	switch format {
+	case "text":
+		return newLabelsHandler(slog.NewTextHandler(w, opts), labels, false), nil
+	case "json":
+		structuredLogs = true
+		return newLabelsHandler(slog.NewJSONHandler(w, opts), labels, true), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+}
+
+// parseLogLevel parses a --log-level
+func parseLogLevel(value string) (slog.Level, error) {
+	switch value {
+	case "error":
+		return slog.LevelError, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "trace":
+		return burn.LevelTrace, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q: must be error, warn, info, debug or trace", value)
+}
+
+// nameTraceLevel logs burn.LevelTrace as TRACE rather than as an offset from debug
+func nameTraceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level <= burn.LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
+
+// expandVerbosity turns -vv into --log-level trace, before parsing, as flags cannot be repeated
+// within a single argument
+func expandVerbosity() {
+	for i, arg := range os.Args[1:] {
+		if len(arg) > 2 && strings.Trim(arg, "v") == "-" {
+			os.Args[i+1] = "--log-level=trace"
+		}
+	}
+}
+
+// logIdentifier is the program name logs are tagged with by the syslog and journald targets
+const logIdentifier = "cpu-burner"
+
+// lineSender delivers a formatted log line to a log target along with the level of its record
+type lineSender func(level slog.Level, line []byte) error
+
+// newTargetHandler builds the handler for a --log-target. stderr logs to w, while syslog and
+// journald format every record with the --log-format and send it as a single entry with the
+// priority of its level
+func newTargetHandler(target string, w io.Writer, format string, level slog.Level, labels Labels) (slog.Handler, error) {
+	var send lineSender
+	var err error
+	switch target {
+	case "stderr":
+		return newLogHandler(w, format, level, labels)
+	case "syslog":
+		send, err = newSyslogSender()
+	case "journald":
+		send, err = newJournaldSender()
+	default:
+		return nil, fmt.Errorf("invalid log target %q: must be stderr, syslog or journald", target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot log to %s: %w", target, err)
+	}
+	buf := &bytes.Buffer{}
+	handler, err := newLogHandler(buf, format, level, labels)
+	if err != nil {
+		return nil, err
+	}
+	return &lineHandler{Handler: handler, mu: &sync.Mutex{}, buf: buf, send: send}, nil
+}
+
+// lineHandler formats records with a text or json handler writing to buf, then hands every line
+// to send. Handlers derived with WithAttrs and WithGroup share the buffer and its lock
+type lineHandler struct {
+	slog.Handler
+	mu   *sync.Mutex
+	buf  *bytes.Buffer
+	send lineSender
+}
+
+func (h *lineHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.Handler.Handle(ctx, record); err != nil {
+		return err
+	}
+	return h.send(record.Level, bytes.TrimSuffix(h.buf.Bytes(), []byte("\n")))
+}
+
+func (h *lineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &lineHandler{Handler: h.Handler.WithAttrs(attrs), mu: h.mu, buf: h.buf, send: h.send}
+}
+
+func (h *lineHandler) WithGroup(name string) slog.Handler {
+	return &lineHandler{Handler: h.Handler.WithGroup(name), mu: h.mu, buf: h.buf, send: h.send}
+}
+
+// decimal formats a number with the given amount of decimal places
+func decimal(value float64, places int) any {
+	if structuredLogs {
+		scale := math.Pow(10, float64(places))
+		return math.Round(value*scale) / scale
+	}
+	return fmt.Sprintf("%.*f", places, value)
+}
+
+// percent formats a signed percentage with one decimal place
+func percent(value float64) any {
+	if structuredLogs {
+		return math.Round(value*10) / 10
+	}
+	return fmt.Sprintf("%+.1f%%", value)
+}
+
+type namedCounter struct {
+	name  string
+	value *atomic.Int64
+}
+
+// logThroughput periodically logs the per second rate of the given counters until the context is done
+func logThroughput(ctx context.Context, msg string, every time.Duration, counters ...namedCounter) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := make([]int64, len(counters))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		attrs := []any{"pid", os.Getpid()}
+		for i, counter := range counters {
+			current := counter.value.Load()
+			attrs = append(attrs, counter.name, int64(float64(current-previous[i])/every.Seconds()))
+			previous[i] = current
+		}
+		slog.Info(msg, attrs...)
+	}
+}
+
+// usageAttrs are the attributes logged for a usage sample, given the current target
+func usageAttrs(s burn.Sample, target float64) []any {
+	attrs := []any{"pid", os.Getpid(),
+		"cpus", decimal(s.Achieved, 3),
+		"delta_pct", percent(s.DeltaPct()),
+		"target", decimal(target, 3),
+		"user_cpus", decimal(s.User, 3),
+		"system_cpus", decimal(s.System, 3),
+	}
+	if s.Warmup {
+		attrs = append(attrs, "warmup", true)
+	}
+	if s.Frozen > 0 {
+		attrs = append(attrs, "frozen_ms", s.Frozen.Milliseconds())
+	}
+	return attrs
+}
+
+// usageLog logs the usage samples taken by the burner while enabled is set. Samples taken more often
+// than every, with --sample-every, are merged into a single line per log interval
+type usageLog struct {
+	enabled atomic.Bool
+	every   atomic.Int64
+	// churn adds the amount of workers and the churn rate
+	churn bool
+	// threads also logs the usage of each worker thread
+	threads bool
+	// throttling adds how much the cgroup cpu limit throttled the process during the interval
+	throttling *throttleMonitor
+	// frequency adds the current frequency of the cpus
+	frequency *frequencyMonitor
+	// psi adds the cpu pressure of the host and of the cgroup
+	psi *psiMonitor
+	// runqueue adds how long the threads of the process waited for a cpu
+	runqueue *runqueueMonitor
+	// steal adds the share of the cpu time of the host the hypervisor stole
+	steal *stealMonitor
+	// energy adds the power drawn by the cpu packages of the host
+	energy *energyMonitor
+	// perf adds the instructions per cycle and cache miss rate of the burner threads, when counting
+	perf *perfMonitor
+	// latency adds the scheduling latency measured during the interval, when probing
+	latency *latencyProbe
+	// resources adds the memory, threads and context switches of the burner itself
+	resources bool
+	// host adds the cpu usage and load average of the whole host
+	host bool
+}
+
+// processResources are the resources used by a process besides cpu, which tell the footprint of
+// the burner itself apart from the load it generates
+type processResources struct {
+	rssBytes            int64
+	threads             int64
+	voluntarySwitches   int64 // switches waiting on something, eg sleeping between work units
+	involuntarySwitches int64 // switches preempted by the scheduler, eg sharing a busy cpu
+}
+
+// Run logs until the context is done
+func (l *usageLog) Run(ctx context.Context, b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	previousChurn := int64(0)
+	previousThreads := threadsByWorker(b.Stats().Threads)
+	previousResources, _ := selfResources()
+	previousBusy, previousTotal, _, _ := hostCPUTimes()
+	var window usageWindow
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample := <-samples:
+			window.add(sample)
+			if window.interval < time.Duration(l.every.Load())-sample.Interval/2 {
+				continue
+			}
+			s := window.merge()
+			stats := b.Stats()
+			throttled, throttling := l.throttling.Sample()
+			frequency, scaling := l.frequency.Sample()
+			if !l.enabled.Load() {
+				previousThreads = threadsByWorker(stats.Threads)
+				window = usageWindow{}
+				continue
+			}
+			attrs := usageAttrs(s, stats.Target)
+			// next to the delta, as steal is what explains an undershoot on a vm
+			attrs = append(attrs, l.steal.Sample()...)
+			if len(window.samples) > 1 {
+				attrs = append(attrs, "min_cpus", decimal(window.min, 3), "max_cpus", decimal(window.max, 3), "stddev_cpus", decimal(window.stddev(), 3))
+			}
+			window = usageWindow{}
+			if l.churn {
+				currentChurn := stats.Spawned + stats.Reaped
+				churnRate := float64(currentChurn-previousChurn) / s.Interval.Seconds()
+				attrs = append(attrs, "workers", stats.Workers, "churn_per_sec", decimal(churnRate, 1))
+				previousChurn = currentChurn
+			}
+			if throttling && throttled.throttledPeriods > 0 {
+				attrs = append(attrs, "throttled_periods", throttled.throttledPeriods, "throttled_ms", throttled.throttledTime.Milliseconds())
+			}
+			if scaling {
+				attrs = append(attrs, "mhz", decimal(frequency.mean, 0), "min_mhz", decimal(frequency.min, 0), "max_mhz", decimal(frequency.max, 0))
+			}
+			attrs = append(attrs, l.psi.Sample()...)
+			attrs = append(attrs, l.runqueue.Sample()...)
+			attrs = append(attrs, l.energy.Sample()...)
+			attrs = append(attrs, l.perf.Sample()...)
+			if l.latency != nil {
+				attrs = append(attrs, l.latency.Sample()...)
+			}
+			if l.resources {
+				if current, err := selfResources(); err == nil {
+					voluntary := float64(current.voluntarySwitches-previousResources.voluntarySwitches) / s.Interval.Seconds()
+					involuntary := float64(current.involuntarySwitches-previousResources.involuntarySwitches) / s.Interval.Seconds()
+					attrs = append(attrs, "rss_bytes", current.rssBytes, "threads", current.threads,
+						"voluntary_switches_per_sec", decimal(voluntary, 1), "involuntary_switches_per_sec", decimal(involuntary, 1))
+					previousResources = current
+				}
+			}
+			if l.host {
+				if busy, total, cpus, err := hostCPUTimes(); err == nil && total > previousTotal {
+					// the share of the host capacity that was busy, turned into busy cpus, of which everything
+					// but the burn is used by others
+					share := float64(busy-previousBusy) / float64(total-previousTotal)
+					hostUsage := share * float64(cpus)
+					attrs = append(attrs, "host_cpus", decimal(hostUsage, 3), "host_busy_pct", decimal(share*100, 1),
+						"others_cpus", decimal(max(0, hostUsage-s.Achieved), 3))
+					previousBusy, previousTotal = busy, total
+				}
+				if load, err := loadAverage(); err == nil {
+					attrs = append(attrs, "loadavg", decimal(load, 2))
+				}
+			}
+			slog.Info("cpu usage", attrs...)
+			if l.threads {
+				logThreadUsage(stats.Threads, previousThreads, s.Interval)
+				previousThreads = threadsByWorker(stats.Threads)
+			}
+		}
+	}
+}
+
+// usageWindow merges the samples taken during a log interval, keeping how spread out they were
+type usageWindow struct {
+	samples  []burn.Sample
+	interval time.Duration
+	min, max float64
+}
+
+func (w *usageWindow) add(s burn.Sample) {
+	if len(w.samples) == 0 {
+		w.min, w.max = s.Achieved, s.Achieved
+	}
+	w.samples = append(w.samples, s)
+	w.interval += s.Interval
+	w.min, w.max = min(w.min, s.Achieved), max(w.max, s.Achieved)
+}
+
+// merge returns a sample covering the whole window, with its usage and target averaged over it.
+// Warmup is set when any of the samples was taken during the warmup, and Frozen adds up
+func (w *usageWindow) merge() burn.Sample {
+	last := w.samples[len(w.samples)-1]
+	if len(w.samples) == 1 {
+		return last
+	}
+	merged := burn.Sample{Time: last.Time, Interval: w.interval, Phase: last.Phase, Paused: last.Paused}
+	for _, s := range w.samples {
+		weight := float64(s.Interval) / float64(w.interval)
+		merged.Target += s.Target * weight
+		merged.Achieved += s.Achieved * weight
+		merged.User += s.User * weight
+		merged.System += s.System * weight
+		merged.Warmup = merged.Warmup || s.Warmup
+		merged.Frozen += s.Frozen
+	}
+	return merged
+}
+
+// stddev is the standard deviation of the usage of the samples in the window
+func (w *usageWindow) stddev() float64 {
+	var mean, squares float64
+	for _, s := range w.samples {
+		mean += s.Achieved
+	}
+	mean /= float64(len(w.samples))
+	for _, s := range w.samples {
+		squares += (s.Achieved - mean) * (s.Achieved - mean)
+	}
+	return math.Sqrt(squares / float64(len(w.samples)))
+}
+
+// logThreadUsage logs how much cpu each worker thread burned during the interval, compared to its
+// share, along with the cpu it runs on and how long it waited for it, when known. A thread landing
+// on a cpu busy with other work waits longer and falls short of its share. Workers spawned during
+// the interval are skipped, as there is nothing to compare with
+func logThreadUsage(threads []burn.ThreadStats, previous map[int64]burn.ThreadStats, interval time.Duration) {
+	for _, thread := range threads {
+		before, found := previous[thread.Worker]
+		if !found {
+			continue
+		}
+		achieved := float64(thread.CPUTime-before.CPUTime) / float64(interval)
+		deltaPct := 0.0
+		if thread.Share > 0 {
+			deltaPct = (achieved - thread.Share) / thread.Share * 100
+		}
+		attrs := []any{"pid", os.Getpid(), "worker", thread.Worker, "cpus", decimal(achieved, 3), "delta_pct", percent(deltaPct), "share", decimal(thread.Share, 3)}
+		if thread.CPU >= 0 {
+			attrs = append(attrs, "cpu", thread.CPU, "wait_ms", (thread.WaitTime - before.WaitTime).Milliseconds())
+		}
+		slog.Info("thread usage", attrs...)
+	}
+}
+
+func threadsByWorker(threads []burn.ThreadStats) map[int64]burn.ThreadStats {
+	byWorker := make(map[int64]burn.ThreadStats, len(threads))
+	for _, thread := range threads {
+		byWorker[thread.Worker] = thread
+	}
+	return byWorker
+}
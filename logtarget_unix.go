@@ -0,0 +1,76 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strconv"
+)
+
+// journaldSocket is where journald receives log entries over its native protocol
+const journaldSocket = "/run/systemd/journal/socket"
+
+// newSyslogSender sends log lines to the local syslog daemon with the priority of their level
+func newSyslogSender() (lineSender, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, logIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return func(level slog.Level, line []byte) error {
+		switch {
+		case level >= slog.LevelError:
+			return w.Err(string(line))
+		case level >= slog.LevelWarn:
+			return w.Warning(string(line))
+		case level >= slog.LevelInfo:
+			return w.Info(string(line))
+		default:
+			return w.Debug(string(line))
+		}
+	}, nil
+}
+
+// newJournaldSender sends log lines to journald over its native protocol, with the priority of
+// their level
+func newJournaldSender() (lineSender, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return func(level slog.Level, line []byte) error {
+		var entry bytes.Buffer
+		entry.WriteString("PRIORITY=" + strconv.Itoa(syslogPriority(level)) + "\n")
+		entry.WriteString("SYSLOG_IDENTIFIER=" + logIdentifier + "\n")
+		if bytes.IndexByte(line, '\n') < 0 {
+			entry.WriteString("MESSAGE=")
+			entry.Write(line)
+			entry.WriteByte('\n')
+		} else {
+			// values with newlines are sent as their size followed by the raw value
+			entry.WriteString("MESSAGE\n")
+			binary.Write(&entry, binary.LittleEndian, uint64(len(line)))
+			entry.Write(line)
+			entry.WriteByte('\n')
+		}
+		_, err := conn.Write(entry.Bytes())
+		return err
+	}, nil
+}
+
+// syslogPriority maps a log level to a syslog priority, which journald uses too
+func syslogPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import "errors"
+
+func newSyslogSender() (lineSender, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
+
+func newJournaldSender() (lineSender, error) {
+	return nil, errors.New("journald is not supported on windows")
+}
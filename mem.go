@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+const memChunkSize = 64 << 20 // memory is allocated in chunks to avoid requiring a single huge contiguous block
+const memPageSize = 4096
+
+var byteUnits = []struct {
+	suffix string
+	size   float64
+}{
+	// longest suffixes first so eg "MiB" is not mistaken by "B"
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseMem parses how much memory to hold. Can either be an absolute size with an optional unit
+// (eg 512MiB, 2GB, 1G) or a percentage of the total system memory (eg 30%)
+func parseMem(mem string) (int64, error) {
+	invalidInput := fmt.Errorf("invalid mem value: %s", mem)
+	if strings.HasSuffix(mem, "%") {
+		value, err := strconv.ParseFloat(mem[:len(mem)-1], 64)
+		if err != nil || value < 0 {
+			return 0, invalidInput
+		}
+		total, err := totalMemory()
+		if err != nil {
+			return 0, fmt.Errorf("cannot use percentage mem values: %w", err)
+		}
+		return int64(value / 100.0 * float64(total)), nil
+	}
+	bytes, err := parseBytes(mem)
+	if err != nil {
+		return 0, invalidInput
+	}
+	return bytes, nil
+}
+
+// parseBytes parses a size with an optional unit, eg 512MiB, 2GB, 1G or 4096
+func parseBytes(size string) (int64, error) {
+	invalidInput := fmt.Errorf("invalid size: %s", size)
+	multiplier := 1.0
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = size[:len(size)-len(unit.suffix)]
+			multiplier = unit.size
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil || value < 0 {
+		return 0, invalidInput
+	}
+	return int64(value * multiplier), nil
+}
+
+// parseMemPolicy parses a --mem-policy value: local, interleave over every numa node, or node=N
+// to bind memory to a node, or to a list of them, eg node=1 or node=0-1. The policy is tried on a
+// scratch buffer, so hosts that cannot apply it fail right away
+func parseMemPolicy(spec string) (burn.MemPolicy, error) {
+	var policy burn.MemPolicy
+	if spec == "" {
+		return policy, nil
+	}
+	nodes, err := numaNodes()
+	if err != nil {
+		return policy, fmt.Errorf("failed to detect NUMA topology: %w", err)
+	}
+	switch {
+	case spec == "local":
+		policy.Mode = burn.MemPolicyLocal
+	case spec == "interleave":
+		policy = burn.MemPolicy{Mode: burn.MemPolicyInterleave, Nodes: sortedKeys(nodes)}
+	case strings.HasPrefix(spec, "node="):
+		list, err := parseCPUSet(strings.TrimPrefix(spec, "node="))
+		if err != nil {
+			return policy, fmt.Errorf("invalid mem-policy value: %s", spec)
+		}
+		for _, node := range list {
+			if _, found := nodes[node]; !found {
+				return policy, fmt.Errorf("NUMA node %d does not exist", node)
+			}
+		}
+		policy = burn.MemPolicy{Mode: burn.MemPolicyBind, Nodes: list}
+	default:
+		return policy, fmt.Errorf("invalid mem-policy value: %s: must be local, interleave or node=N", spec)
+	}
+	if err := policy.Bind(make([]byte, 2*memPageSize)); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// holdMemory allocates the given amount of bytes where the policy says and keeps touching every
+// page of it so it stays resident, until the context is done
+func holdMemory(ctx context.Context, bytes int64, touchEvery time.Duration, policy burn.MemPolicy) {
+	var chunks [][]byte
+	for remaining := bytes; remaining > 0; remaining -= memChunkSize {
+		chunk := make([]byte, min(remaining, memChunkSize))
+		if err := policy.Bind(chunk); err != nil {
+			slog.Warn("failed to apply the memory policy", "pid", os.Getpid(), "error", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	touch := func(value byte) {
+		for _, chunk := range chunks {
+			for i := 0; i < len(chunk); i += memPageSize {
+				chunk[i] = value
+			}
+		}
+	}
+	touch(1)
+	slog.Info("memory allocated", "pid", os.Getpid(), "bytes", bytes)
+
+	if touchEvery <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := time.NewTicker(touchEvery)
+	defer ticker.Stop()
+	var value byte = 1
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			value++
+			touch(value)
+		}
+	}
+}
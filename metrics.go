@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// newMetricsHandler serves the burner metrics in the prometheus text exposition format. Labels
+// are attached to every metric
+func newMetricsHandler(b *burn.Burner, labels Labels) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, b, labels)
+	}
+}
+
+func writeMetrics(w io.Writer, b *burn.Burner, labels Labels) {
+	stats := b.Stats()
+
+	metric := func(name string, kind string, help string, value float64, extra ...Label) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		fmt.Fprintf(w, "%s%s %g\n", name, formatMetricLabels(append(append(Labels{}, labels...), extra...)), value)
+	}
+	metric("cpu_burner_target_cpus", "gauge", "Amount of cpus the burner is currently trying to burn.", stats.Target)
+	metric("cpu_burner_achieved_cpus", "gauge", "Amount of cpus burned during the last sampling interval.", stats.Last.Achieved)
+	metric("cpu_burner_delta_percent", "gauge", "Difference between achieved and target cpus during the last sampling interval, in percent of the target.", stats.Last.DeltaPct())
+	metric("cpu_burner_cpu_seconds_total", "counter", "Total cpu time consumed by the burner process, user and system.", float64(burn.CPUTime())/float64(time.Second))
+	user, system := burn.CPUTimes()
+	metric("cpu_burner_cpu_user_seconds_total", "counter", "User cpu time consumed by the burner process.", float64(user)/float64(time.Second))
+	metric("cpu_burner_cpu_system_seconds_total", "counter", "System cpu time consumed by the burner process.", float64(system)/float64(time.Second))
+	if throttled, ok, _ := cgroupThrottling(); ok {
+		metric("cpu_burner_cgroup_throttled_periods_total", "counter", "Total cfs periods in which the cgroup of the burner was throttled for exceeding its cpu limit.", float64(throttled.throttledPeriods))
+		metric("cpu_burner_cgroup_throttled_seconds_total", "counter", "Total time the cgroup of the burner was throttled for exceeding its cpu limit.", throttled.throttledTime.Seconds())
+	}
+	metric("cpu_burner_uptime_seconds", "gauge", "Time since the burner started.", stats.Uptime.Seconds())
+	metric("cpu_burner_workers", "gauge", "Amount of worker goroutines currently burning cpu.", float64(stats.Workers))
+	fmt.Fprintf(w, "# HELP cpu_burner_worker_share Share of a cpu each worker is burning.\n# TYPE cpu_burner_worker_share gauge\n")
+	for i, share := range stats.Shares {
+		workerLabels := append(append(Labels{}, labels...), Label{Key: "worker", Value: fmt.Sprint(i)})
+		fmt.Fprintf(w, "cpu_burner_worker_share%s %g\n", formatMetricLabels(workerLabels), share)
+	}
+}
+
+func formatMetricLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	sorted := append(Labels{}, labels...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	parts := make([]string, len(sorted))
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, label := range sorted {
+		parts[i] = fmt.Sprintf(`%s="%s"`, label.Key, escaper.Replace(label.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const netBlockSize = 64 << 10
+const netReconnectEvery = time.Second
+
+var bitRateUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"Kbps", 1e3}, {"Mbps", 1e6}, {"Gbps", 1e9}, {"kbps", 1e3}, {"bps", 1},
+}
+
+// parseBitRate parses a network throughput into bytes per second. Accepts bits per second units,
+// eg 100Mbps or 1Gbps, as well as byte rates like 10MB/s
+func parseBitRate(rate string) (int64, error) {
+	for _, unit := range bitRateUnits {
+		if strings.HasSuffix(rate, unit.suffix) {
+			value, err := strconv.ParseFloat(rate[:len(rate)-len(unit.suffix)], 64)
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("invalid rate: %s", rate)
+			}
+			return int64(value * unit.size / 8), nil
+		}
+	}
+	return parseRate(rate)
+}
+
+// netBurner sends data to a remote TCP endpoint at a target throughput. Anything the remote
+// end sends back (eg when talking to an echo server) is read and discarded
+type netBurner struct {
+	rate   int64 // bytes per second
+	target string
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// Run keeps a connection to the target open, reconnecting on failures, until the context is done
+func (b *netBurner) Run(ctx context.Context, logEvery time.Duration, gate loadGate) {
+	slog.Info("generating network load", "pid", os.Getpid(), "target", b.target, "rate_bytes_per_sec", b.rate)
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	if logEvery > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logThroughput(ctx, "net usage", logEvery, namedCounter{"sent_bytes_per_sec", &b.sent}, namedCounter{"received_bytes_per_sec", &b.received})
+		}()
+	}
+
+	dialer := net.Dialer{}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", b.target)
+		if err == nil {
+			err = b.send(ctx, conn, gate)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("network load connection failed, reconnecting", "pid", os.Getpid(), "target", b.target, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(netReconnectEvery):
+		}
+	}
+}
+
+func (b *netBurner) send(ctx context.Context, conn net.Conn, gate loadGate) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	go func() {
+		countingCopy(io.Discard, conn, &b.received)
+	}()
+
+	block := make([]byte, netBlockSize)
+	start := time.Now()
+	var done int64
+	for {
+		if waited, open := gate.wait(ctx); !open {
+			return nil
+		} else if waited {
+			start, done = time.Now(), 0
+		}
+		expected := int64(time.Since(start).Seconds() * float64(b.rate))
+		if done >= expected {
+			ahead := time.Duration(float64(done-expected) / float64(b.rate) * float64(time.Second))
+			time.Sleep(max(ahead, time.Millisecond))
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		n, err := conn.Write(block)
+		b.sent.Add(int64(n))
+		done += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runSink accepts TCP connections and discards everything received, or sends it back when echo is
+// set, until the context is done. It is the counterpart of --net
+func runSink(ctx context.Context, listen string, echo bool, logEvery time.Duration) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	context.AfterFunc(ctx, func() { listener.Close() })
+	slog.Info("sink listening", "pid", os.Getpid(), "address", listener.Addr().String(), "echo", echo)
+
+	var received atomic.Int64
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	if logEvery > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logThroughput(ctx, "sink usage", logEvery, namedCounter{"received_bytes_per_sec", &received})
+		}()
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		slog.Debug("sink accepted connection", "pid", os.Getpid(), "remote", conn.RemoteAddr().String())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			var dst io.Writer = io.Discard
+			if echo {
+				dst = conn
+			}
+			countingCopy(dst, conn, &received)
+		}()
+	}
+}
+
+func countingCopy(dst io.Writer, src io.Reader, counter *atomic.Int64) {
+	buf := make([]byte, netBlockSize)
+	for {
+		n, err := src.Read(buf)
+		counter.Add(int64(n))
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
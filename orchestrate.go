@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+type OrchestrateCmd struct {
+	Agents     []string      `arg:"--agent,separate,required" help:"address of an agent started with the serve subcommand, eg host1:7070. Repeat for every host"`
+	StartDelay time.Duration `arg:"--start-delay" default:"5s" help:"how far in the future the synchronized start is scheduled, giving every agent time to get ready"`
+	Token      string        `arg:"--token,env:CPU_BURNER_TOKEN,required" help:"shared secret the agents were started with"`
+}
+
+// agentPollTimeout bounds every request made to an agent
+const agentPollTimeout = 5 * time.Second
+
+// agentStopTimeout is how long agents are given to finish their runs once stopped
+const agentStopTimeout = 10 * time.Second
+
+// remoteAgent is an agent driven by the coordinator
+type remoteAgent struct {
+	address string
+	url     string
+	token   string
+	// offset is how far ahead of the local clock the agent clock is
+	offset time.Duration
+	status runStatus
+}
+
+// agentRun returns the run agents are asked for, made of the burn parameters of args. Agents
+// sample their usage every sampleEvery
+func agentRun(args *Args, sampleEvery time.Duration) runRequest {
+	req := runRequest{
+		Burn:     args.Burn,
+		Pattern:  args.Pattern,
+		Min:      args.Min,
+		Max:      args.Max,
+		Steps:    args.Steps,
+		LogEvery: sampleEvery.String(),
+	}
+	if args.Duration > 0 {
+		req.Duration = args.Duration.String()
+	}
+	if args.Period > 0 {
+		req.Period = args.Period.String()
+	}
+	return req
+}
+
+// runOrchestrate schedules a synchronized run on every agent, burning as told by the burn
+// parameters of args, then follows it logging the aggregate usage every --log-every until all
+// agents finished. Agents runs are stopped when the context is done. Returns an error if any agent
+// failed
+func runOrchestrate(ctx context.Context, cmd *OrchestrateCmd, args *Args) error {
+	// agents sample their usage as often as it is logged here, unless told otherwise
+	logEvery := args.LogEvery
+	sampleEvery := logEvery
+	if sampleEvery <= 0 {
+		sampleEvery = time.Second
+	}
+	run := agentRun(args, sampleEvery)
+	// catch mistakes in the options before reaching out to agents
+	if _, err := run.args(); err != nil {
+		return fmt.Errorf("invalid agent options: %w", err)
+	}
+	if cmd.StartDelay < 0 {
+		return errors.New("start delay cannot be negative")
+	}
+
+	client := &http.Client{Timeout: agentPollTimeout}
+	agents := make([]*remoteAgent, len(cmd.Agents))
+	for i, address := range cmd.Agents {
+		agent := &remoteAgent{address: address, url: address, token: cmd.Token}
+		if !strings.Contains(address, "://") {
+			agent.url = "http://" + address
+		}
+		if err := agent.measureOffset(ctx, client); err != nil {
+			return fmt.Errorf("agent %s is not reachable: %w", address, err)
+		}
+		slog.Debug("agent clock offset", "pid", os.Getpid(), "agent", address, "offset_ms", decimal(float64(agent.offset)/float64(time.Millisecond), 3))
+		agents[i] = agent
+	}
+
+	// every agent starts at the same instant, translated to its own clock
+	startAt := time.Now().Add(cmd.StartDelay)
+	for i, agent := range agents {
+		req := run
+		req.StartAt = startAt.Add(agent.offset)
+		if err := agent.call(ctx, client, http.MethodPost, req); err != nil {
+			for _, started := range agents[:i] {
+				started.call(context.Background(), client, http.MethodDelete, nil)
+			}
+			return fmt.Errorf("failed to schedule run on agent %s: %w", agent.address, err)
+		}
+	}
+	slog.Info("run scheduled", "pid", os.Getpid(), "agents", len(agents), "start_at", startAt.Format(time.RFC3339Nano))
+
+	// poll often regardless of the sampling interval, so failures and the end of the run are noticed
+	pollEvery := min(sampleEvery, time.Second)
+	ticker := time.NewTicker(pollEvery)
+	defer ticker.Stop()
+	var samples []burn.Sample
+	var stopDeadline time.Time
+	lastSample := startAt
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if stopDeadline.IsZero() {
+				slog.Info("stopping agents", "pid", os.Getpid(), "agents", len(agents))
+				for _, agent := range agents {
+					if err := agent.call(context.Background(), client, http.MethodDelete, nil); err != nil {
+						slog.Warn("failed to stop agent", "pid", os.Getpid(), "agent", agent.address, "error", err)
+					}
+				}
+				stopDeadline = time.Now().Add(agentStopTimeout)
+			}
+			// keep polling until every agent finished
+			time.Sleep(pollEvery)
+		}
+
+		finished, burning := 0, 0
+		s := burn.Sample{Time: time.Now(), Interval: sampleEvery, Phase: -1}
+		for _, agent := range agents {
+			if err := agent.call(context.Background(), client, http.MethodGet, nil); err != nil {
+				slog.Warn("failed to poll agent", "pid", os.Getpid(), "agent", agent.address, "error", err)
+				continue
+			}
+			switch agent.status.State {
+			case runDone, runFailed:
+				finished++
+			case runBurning:
+				if sample := agent.status.Sample; sample != nil {
+					burning++
+					s.Target += sample.Target
+					s.Achieved += sample.Achieved
+					s.User += sample.User
+					s.System += sample.System
+					s.Paused = s.Paused || sample.Paused
+					s.Warmup = s.Warmup || sample.Warmup
+				}
+			}
+		}
+		// tolerate polls landing slightly early
+		if burning > 0 && s.Time.Sub(lastSample) >= sampleEvery-pollEvery/2 {
+			lastSample = s.Time
+			samples = append(samples, s)
+			if logEvery > 0 {
+				slog.Info("cpu usage", append(usageAttrs(s, s.Target), "agents", burning)...)
+			}
+		}
+		if finished == len(agents) {
+			break
+		}
+		if !stopDeadline.IsZero() && time.Now().After(stopDeadline) {
+			return errors.New("timed out waiting for agents to stop")
+		}
+	}
+
+	s := burn.Summarize(samples)
+	s.WallTime = time.Since(startAt)
+	var errs []error
+	for _, agent := range agents {
+		s.CPUSeconds += agent.status.CPUSeconds
+		if agent.status.State == runFailed {
+			errs = append(errs, fmt.Errorf("agent %s failed: %s", agent.address, agent.status.Error))
+		}
+	}
+	if s.Samples == 0 && s.WallTime > 0 {
+		s.MeanAchieved = s.CPUSeconds / s.WallTime.Seconds()
+		s.MinAchieved = s.MeanAchieved
+		s.MaxAchieved = s.MeanAchieved
+	}
+	logSummary(s, "agents", len(agents))
+	return errors.Join(errs...)
+}
+
+// measureOffset estimates how far the agent clock is from the local one, assuming the agent read
+// its clock halfway through the request
+func (a *remoteAgent) measureOffset(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url+"/clock", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	before := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	after := time.Now()
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	var clock clockResponse
+	if err := json.NewDecoder(resp.Body).Decode(&clock); err != nil {
+		return err
+	}
+	a.offset = clock.Time.Sub(before.Add(after.Sub(before) / 2))
+	return nil
+}
+
+// call sends a request to the run endpoint of the agent, keeping the run status it responds with
+func (a *remoteAgent) call(ctx context.Context, client *http.Client, method string, body any) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+"/run", &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e errorResponse
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s: %s", resp.Status, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(&a.status)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+const otelTimeout = 5 * time.Second
+
+// otelExporter pushes usage samples to an OpenTelemetry collector using OTLP over http with the
+// json encoding, which avoids pulling in the whole OpenTelemetry sdk for a handful of gauges
+type otelExporter struct {
+	endpoint string
+	labels   Labels
+	client   *http.Client
+}
+
+func newOTelExporter(endpoint string, labels Labels) *otelExporter {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/metrics") {
+		endpoint += "/v1/metrics"
+	}
+	return &otelExporter{endpoint: endpoint, labels: labels, client: &http.Client{Timeout: otelTimeout}}
+}
+
+// Run exports every sample taken by the burner until the context is done
+func (e *otelExporter) Run(ctx context.Context, b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	slog.Info("exporting metrics to opentelemetry", "pid", os.Getpid(), "endpoint", e.endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-samples:
+			workers := b.Stats().Workers
+			if err := e.export(ctx, s, workers); err != nil {
+				slog.Warn("failed to export metrics to opentelemetry", "pid", os.Getpid(), "endpoint", e.endpoint, "error", err)
+			}
+		}
+	}
+}
+
+type otelAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otelDataPoint struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+}
+
+type otelMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Unit        string `json:"unit"`
+	Gauge       struct {
+		DataPoints []otelDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+func (e *otelExporter) export(ctx context.Context, s burn.Sample, workers int) error {
+	attributes := []otelAttribute{
+		{Key: "service.name", Value: map[string]any{"stringValue": "cpu-burner"}},
+		{Key: "process.pid", Value: map[string]any{"intValue": strconv.Itoa(os.Getpid())}},
+	}
+	for _, label := range e.labels {
+		attributes = append(attributes, otelAttribute{Key: label.Key, Value: map[string]any{"stringValue": label.Value}})
+	}
+	timestamp := strconv.FormatInt(s.Time.UnixNano(), 10)
+	gauge := func(name string, description string, unit string, value float64) otelMetric {
+		m := otelMetric{Name: name, Description: description, Unit: unit}
+		m.Gauge.DataPoints = []otelDataPoint{{TimeUnixNano: timestamp, AsDouble: value}}
+		return m
+	}
+	request := map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": attributes},
+			"scopeMetrics": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/bcap/cpu-burner"},
+				"metrics": []otelMetric{
+					gauge("cpu_burner.target", "Amount of cpus the burner is trying to burn", "{cpu}", s.Target),
+					gauge("cpu_burner.achieved", "Amount of cpus burned during the last sampling interval", "{cpu}", s.Achieved),
+					gauge("cpu_burner.workers", "Amount of worker goroutines burning cpu", "{worker}", float64(workers)),
+				},
+			}},
+		}},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
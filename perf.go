@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// perfCounts are the hardware events counted in user space by --perf-counters
+type perfCounts struct {
+	cycles          float64
+	instructions    float64
+	cacheReferences float64
+	cacheMisses     float64
+}
+
+func (c perfCounts) add(other perfCounts) perfCounts {
+	return perfCounts{
+		cycles:          c.cycles + other.cycles,
+		instructions:    c.instructions + other.instructions,
+		cacheReferences: c.cacheReferences + other.cacheReferences,
+		cacheMisses:     c.cacheMisses + other.cacheMisses,
+	}
+}
+
+func (c perfCounts) sub(other perfCounts) perfCounts {
+	return c.add(perfCounts{-other.cycles, -other.instructions, -other.cacheReferences, -other.cacheMisses})
+}
+
+// attrs returns the instructions per cycle and the share of cache references that missed as log
+// attributes, skipping those nothing was counted for
+func (c perfCounts) attrs() []any {
+	var attrs []any
+	if c.cycles > 0 {
+		attrs = append(attrs, "ipc", decimal(c.instructions/c.cycles, 2))
+	}
+	if c.cacheReferences > 0 {
+		attrs = append(attrs, "cache_miss_pct", decimal(c.cacheMisses/c.cacheReferences*100, 1))
+	}
+	return attrs
+}
+
+// perfThread is the group of hardware events counted for a thread, along with what was counted the
+// last time they were read
+type perfThread struct {
+	fds  []int // the group leader first
+	last perfCounts
+}
+
+// perfMonitor counts hardware events for every thread of the process, which tells what a workload
+// does with the cpu time it burns: the same usage can retire very different amounts of instructions
+// or miss the caches a lot more. Threads started by the runtime during the run are picked up every
+// time usage is sampled
+type perfMonitor struct {
+	mu      sync.Mutex
+	threads map[int]*perfThread
+	total   perfCounts
+	// counted since the last usage log
+	interval perfCounts
+}
+
+// newPerfMonitor opens the counters of every current thread of the process, failing when the host
+// does not allow it, eg without a pmu in virtual machines or with a strict perf_event_paranoid
+func newPerfMonitor() (*perfMonitor, error) {
+	m := &perfMonitor{threads: map[int]*perfThread{}}
+	if err := m.refresh(); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// refresh adds what every thread counted since the previous refresh, opening the counters of new
+// threads and closing the ones of threads that exited. Must be called with m.mu held, except from
+// newPerfMonitor
+func (m *perfMonitor) refresh() error {
+	tids, err := selfThreadIDs()
+	if err != nil {
+		return err
+	}
+	alive := map[int]bool{}
+	for _, tid := range tids {
+		alive[tid] = true
+		if _, found := m.threads[tid]; found {
+			continue
+		}
+		thread, err := openPerfThread(tid)
+		if err != nil {
+			if len(m.threads) == 0 {
+				return err
+			}
+			// the thread may have exited since it was listed
+			slog.Debug("failed to open thread performance counters", "pid", os.Getpid(), "tid", tid, "error", err)
+			continue
+		}
+		m.threads[tid] = thread
+	}
+	for tid, thread := range m.threads {
+		// counters of exited threads stay readable with their final counts until closed
+		if current, err := readPerfThread(thread); err == nil {
+			delta := current.sub(thread.last)
+			m.total, m.interval = m.total.add(delta), m.interval.add(delta)
+			thread.last = current
+		}
+		if !alive[tid] {
+			closePerfThread(thread)
+			delete(m.threads, tid)
+		}
+	}
+	return nil
+}
+
+// Run picks up new threads each time the burner samples its usage, until the context is done
+func (m *perfMonitor) Run(ctx context.Context, b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-samples:
+			m.mu.Lock()
+			if err := m.refresh(); err != nil {
+				slog.Debug("failed to read performance counters", "pid", os.Getpid(), "error", err)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// Sample returns what was counted since the previous sample as log attributes
+func (m *perfMonitor) Sample() []any {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.refresh(); err != nil {
+		slog.Debug("failed to read performance counters", "pid", os.Getpid(), "error", err)
+	}
+	counts := m.interval
+	m.interval = perfCounts{}
+	return counts.attrs()
+}
+
+// Summarize adds what was counted over the run to the summary, returning it as log attributes too
+func (m *perfMonitor) Summarize(summary *runSummary) []any {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.refresh(); err != nil {
+		slog.Debug("failed to read performance counters", "pid", os.Getpid(), "error", err)
+	}
+	summary.Cycles, summary.Instructions = int64(m.total.cycles), int64(m.total.instructions)
+	summary.CacheReferences, summary.CacheMisses = int64(m.total.cacheReferences), int64(m.total.cacheMisses)
+	if m.total.cycles > 0 {
+		ipc := m.total.instructions / m.total.cycles
+		summary.IPC = &ipc
+	}
+	if m.total.cacheReferences > 0 {
+		missPct := m.total.cacheMisses / m.total.cacheReferences * 100
+		summary.CacheMissPct = &missPct
+	}
+	return append([]any{"cycles", summary.Cycles, "instructions", summary.Instructions}, m.total.attrs()...)
+}
+
+// Close closes the counters of every thread
+func (m *perfMonitor) Close() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tid, thread := range m.threads {
+		closePerfThread(thread)
+		delete(m.threads, tid)
+	}
+}
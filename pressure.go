@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// pressureCheckEvery is how often the pressure guard reads the load average and host usage
+const pressureCheckEvery = time.Second
+
+// loadavgHysteresis is the fraction of --max-loadavg the load average must fall under before a
+// paused burn resumes, so it does not flap around the limit. The load average moves slowly, so
+// this is usually reached a while after pausing
+const loadavgHysteresis = 0.9
+
+// pressureGuard keeps the burner from overloading a shared host. Going over the max load average
+// pauses the burn, while the max host cpu caps it to whatever room is left by everything else
+type pressureGuard struct {
+	maxLoadavg float64 // 0 when not guarding the load average
+	maxHostCPU float64 // fraction of the host cpus, 0 when not guarding the host usage
+}
+
+func newPressureGuard(maxLoadavg float64, maxHostCPU string) (*pressureGuard, error) {
+	if maxLoadavg < 0 {
+		return nil, fmt.Errorf("invalid max loadavg value: %v", maxLoadavg)
+	}
+	guard := &pressureGuard{maxLoadavg: maxLoadavg}
+	if maxLoadavg > 0 {
+		if _, err := loadAverage(); err != nil {
+			return nil, fmt.Errorf("cannot guard the load average: %w", err)
+		}
+	}
+	if maxHostCPU != "" {
+		value, found := strings.CutSuffix(maxHostCPU, "%")
+		pct, err := strconv.ParseFloat(value, 64)
+		if !found || err != nil || pct <= 0 || pct > 100 {
+			return nil, fmt.Errorf("invalid max host cpu value: %s: must be a percentage of the host cpus, eg 90%%", maxHostCPU)
+		}
+		if _, _, _, err := hostCPUTimes(); err != nil {
+			return nil, fmt.Errorf("cannot guard the host usage: %w", err)
+		}
+		guard.maxHostCPU = pct / 100
+	}
+	return guard, nil
+}
+
+// Run checks the host pressure until the context is done. The burn is only resumed if it was the
+// guard that paused it
+func (g *pressureGuard) Run(ctx context.Context, b *burn.Burner) {
+	ticker := time.NewTicker(pressureCheckEvery)
+	defer ticker.Stop()
+	previousBusy, previousTotal, _, _ := hostCPUTimes()
+	previousOwn := time.Duration(burn.CPUTime())
+	paused, limited := false, false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if g.maxLoadavg > 0 {
+			load, err := loadAverage()
+			switch {
+			case err != nil:
+				slog.Debug("failed to read the load average", "pid", os.Getpid(), "error", err)
+			case load > g.maxLoadavg && !paused && !b.Paused():
+				slog.Warn("load average over the limit, pausing", "pid", os.Getpid(), "loadavg", decimal(load, 2), "max_loadavg", decimal(g.maxLoadavg, 2))
+				b.Pause()
+				paused = true
+			case load <= g.maxLoadavg*loadavgHysteresis && paused:
+				slog.Info("load average back under the limit, resuming", "pid", os.Getpid(), "loadavg", decimal(load, 2), "max_loadavg", decimal(g.maxLoadavg, 2))
+				b.Resume()
+				paused = false
+			}
+		}
+
+		if g.maxHostCPU == 0 {
+			continue
+		}
+		busy, total, cpus, err := hostCPUTimes()
+		if err != nil {
+			slog.Debug("failed to read the host cpu usage", "pid", os.Getpid(), "error", err)
+			continue
+		}
+		own := time.Duration(burn.CPUTime())
+		if total <= previousTotal {
+			continue
+		}
+		// host times are in the units of all cpus together, scale them back into cpus
+		interval := float64(total-previousTotal) / float64(cpus)
+		othersUsage := max(0, float64(busy-previousBusy)/interval-float64(own-previousOwn)/interval)
+		previousBusy, previousTotal, previousOwn = busy, total, own
+		limit := max(0, g.maxHostCPU*float64(cpus)-othersUsage)
+		if limit >= float64(runtime.NumCPU()) {
+			limit = math.Inf(1)
+		}
+		b.SetLimit(limit)
+		switch {
+		case !math.IsInf(limit, 1) && !limited:
+			slog.Info("host cpu usage near the limit, capping the burn", "pid", os.Getpid(), "others_cpus", decimal(othersUsage, 3), "max_cpus", decimal(limit, 3))
+			limited = true
+		case math.IsInf(limit, 1) && limited:
+			slog.Info("host cpu usage leaves room again, no longer capping the burn", "pid", os.Getpid(), "others_cpus", decimal(othersUsage, 3))
+			limited = false
+		default:
+			slog.Debug("host usage", "pid", os.Getpid(), "others_cpus", decimal(othersUsage, 3), "max_cpus", decimal(limit, 3))
+		}
+	}
+}
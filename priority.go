@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// setupPriority returns the scheduling priority of every thread of the process set by --nice,
+// --sched and --rtprio, and the one of worker threads, which differs with --idle-only. Each one is
+// nil when it is left untouched
+func setupPriority(args Args) (*burn.Priority, *burn.Priority, error) {
+	process, err := processPriority(args)
+	if err != nil || !args.IdleOnly {
+		return process, process, err
+	}
+	if runtime.GOOS != "linux" {
+		return nil, nil, errors.New("--idle-only is only supported on linux")
+	}
+	if args.Sched != "" {
+		return nil, nil, errors.New("--idle-only cannot be combined with --sched")
+	}
+	return process, &burn.Priority{Policy: burn.SchedIdle}, nil
+}
+
+// processPriority returns the scheduling priority set by --nice, --sched and --rtprio. Returns
+// nothing when the priority is left untouched
+func processPriority(args Args) (*burn.Priority, error) {
+	if args.Nice == 0 && args.Sched == "" && args.RTPrio == 0 {
+		return nil, nil
+	}
+	if args.Nice < -20 || args.Nice > 19 {
+		return nil, fmt.Errorf("invalid nice value: %d: must be between -20 and 19", args.Nice)
+	}
+	p := &burn.Priority{Policy: burn.SchedPolicy(args.Sched), Nice: args.Nice, RealtimePriority: args.RTPrio}
+	switch p.Policy {
+	case "":
+		p.Policy = burn.SchedOther
+	case burn.SchedOther, burn.SchedBatch, burn.SchedIdle, burn.SchedFIFO, burn.SchedRR:
+		if runtime.GOOS != "linux" {
+			return nil, errors.New("--sched is only supported on linux")
+		}
+	default:
+		return nil, fmt.Errorf("invalid sched value: %s", args.Sched)
+	}
+	realtime := p.Policy == burn.SchedFIFO || p.Policy == burn.SchedRR
+	switch {
+	case realtime && (args.RTPrio < 1 || args.RTPrio > 99):
+		return nil, fmt.Errorf("invalid rtprio value: %d: --sched %s needs a priority between 1 and 99", args.RTPrio, p.Policy)
+	case !realtime && args.RTPrio != 0:
+		return nil, errors.New("--rtprio requires --sched fifo or rr")
+	case realtime && args.Nice != 0:
+		return nil, errors.New("--nice cannot be combined with --sched fifo or rr")
+	}
+	return p, nil
+}
+
+// formatPriority describes a scheduling priority, eg "fifo 10", "other nice 5" or "idle"
+func formatPriority(p burn.Priority) string {
+	switch p.Policy {
+	case burn.SchedFIFO, burn.SchedRR:
+		return fmt.Sprintf("%s %d", p.Policy, p.RealtimePriority)
+	case burn.SchedIdle:
+		return string(p.Policy)
+	default:
+		return fmt.Sprintf("%s nice %d", p.Policy, p.Nice)
+	}
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// processEnv tells a process it was spawned by --processes, and which of the processes it is, eg 2/4
+const processEnv = "CPU_BURNER_PROCESS"
+
+// resumeEnv tells a process restarted by --supervise how far into the run the group is and how
+// much cpu time its previous instances burnt, as <elapsed>/<cpu seconds>, eg 1m30s/42.5, so it
+// carries on with the schedule and the --cpu-seconds budget instead of starting them over
+const resumeEnv = "CPU_BURNER_RESUME"
+
+// maxRestartDelay caps how long --supervise waits before restarting a process that keeps failing
+const maxRestartDelay = time.Minute
+
+// processSample is a usage sample a child process reports to its parent, one json document per line
+// on its stdout
+type processSample struct {
+	Time       time.Time `json:"time"`
+	IntervalMs float64   `json:"interval_ms"`
+	Target     float64   `json:"target"`
+	Achieved   float64   `json:"achieved"`
+	User       float64   `json:"user"`
+	System     float64   `json:"system"`
+	Paused     bool      `json:"paused"`
+	Warmup     bool      `json:"warmup,omitempty"`
+}
+
+func newProcessSample(s burn.Sample) processSample {
+	return processSample{
+		Time:       s.Time,
+		IntervalMs: float64(s.Interval) / float64(time.Millisecond),
+		Target:     s.Target,
+		Achieved:   s.Achieved,
+		User:       s.User,
+		System:     s.System,
+		Paused:     s.Paused,
+		Warmup:     s.Warmup,
+	}
+}
+
+// processShareUpdate changes the share of the burn a child process is responsible for. Written by
+// the parent to the stdin of its children, one json document per line
+type processShareUpdate struct {
+	Share float64 `json:"share"`
+}
+
+// shareProfile scales a profile by the share of the burn this process is responsible for, which
+// starts at processShare and changes as the parent rebalances its children
+type shareProfile struct {
+	profile burn.Profile
+	share   atomic.Uint64
+}
+
+func newShareProfile(profile burn.Profile) *shareProfile {
+	s := &shareProfile{profile: profile}
+	s.share.Store(math.Float64bits(processShare()))
+	return s
+}
+
+func (s *shareProfile) Unwrap() burn.Profile {
+	return s.profile
+}
+
+func (s *shareProfile) Target(elapsed time.Duration) float64 {
+	return s.profile.Target(elapsed) * math.Float64frombits(s.share.Load())
+}
+
+// Follow applies the share updates read from the parent until it closes the stream
+func (s *shareProfile) Follow(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var update processShareUpdate
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil || update.Share <= 0 || update.Share > 1 {
+			slog.Debug("invalid share update from parent", "pid", os.Getpid(), "line", scanner.Text())
+			continue
+		}
+		slog.Debug("process share changed", "pid", os.Getpid(), "share", decimal(update.Share, 3))
+		s.share.Store(math.Float64bits(update.Share))
+	}
+}
+
+// childProcess returns the index of this process and the total amount of processes when it was
+// spawned by --processes
+func childProcess() (int, int, bool) {
+	value, found := os.LookupEnv(processEnv)
+	if !found {
+		return 0, 0, false
+	}
+	index, total, _ := strings.Cut(value, "/")
+	i, err1 := strconv.Atoi(index)
+	n, err2 := strconv.Atoi(total)
+	if err1 != nil || err2 != nil || n <= 0 {
+		return 0, 0, false
+	}
+	return i, n, true
+}
+
+// childResume returns how far into the run this process starts and the cpu time its previous
+// instances burnt, which are only known when it was restarted by --supervise
+func childResume() (time.Duration, float64) {
+	value, found := os.LookupEnv(resumeEnv)
+	if !found {
+		return 0, 0
+	}
+	elapsed, cpu, _ := strings.Cut(value, "/")
+	offset, err1 := time.ParseDuration(elapsed)
+	cpuSeconds, err2 := strconv.ParseFloat(cpu, 64)
+	if err1 != nil || err2 != nil || offset < 0 || cpuSeconds < 0 {
+		slog.Warn("ignoring invalid resume point", "pid", os.Getpid(), "resume", value)
+		return 0, 0
+	}
+	slog.Debug("resuming the run of a restarted process", "pid", os.Getpid(), "elapsed_ms", offset.Milliseconds(), "cpu_seconds", decimal(cpuSeconds, 3))
+	return offset, cpuSeconds
+}
+
+// processShare is the fraction of the burn this process is responsible for, which is 1 unless it
+// is one of the processes spawned by --processes
+func processShare() float64 {
+	if _, n, ok := childProcess(); ok {
+		return 1 / float64(n)
+	}
+	return 1
+}
+
+// validateProcesses checks the options that cannot be combined with --processes, as they act on a
+// single burner
+func validateProcesses(args Args) error {
+	if args.Processes < 1 {
+		return fmt.Errorf("invalid processes value: %d", args.Processes)
+	}
+	if args.Processes == 1 {
+		if args.Supervise {
+			return errors.New("--supervise requires --processes")
+		}
+		return nil
+	}
+	if args.RestartDelay < 0 {
+		return fmt.Errorf("invalid restart delay value: %s", args.RestartDelay)
+	}
+	if args.MaxRestarts < 0 {
+		return fmt.Errorf("invalid max restarts value: %d", args.MaxRestarts)
+	}
+	unsupported := map[string]bool{
+		"--listen":           args.Listen != "",
+		"--metrics-listen":   args.MetricsListen != "",
+		"--grpc-listen":      args.GRPCListen != "",
+		"--control-socket":   args.ControlSocket != "",
+		"--interactive":      args.Interactive,
+		"--fill-to":          args.FillTo != "",
+		"--max-host-cpu":     args.MaxHostCPU != "",
+		"--drain":            args.Drain > 0,
+		"--otel-endpoint":    args.OTelEndpoint != "",
+		"--pprof":            args.Pprof != "",
+		"--statsd":           args.Statsd != "",
+		"--out":              args.Out != "",
+		"--report-url":       args.ReportURL != "",
+		"--report-file":      args.ReportFile != "",
+		"--pause-signals":    args.PauseSignals,
+		"--thread-stats":     args.ThreadStats,
+		"--self-stats":       args.SelfStats,
+		"--sample-every":     args.SampleEvery > 0,
+		"--fail-on-throttle": args.FailOnThrottle,
+		"--latency-probe":    args.LatencyProbe > 0,
+		"--iterations":       args.Iterations > 0,
+		"--antagonist":       args.Antagonist != "",
+		"--dashboard":        args.Dashboard,
+		"--group":            len(args.Groups) > 0,
+		"--cpuprofile":       args.CPUProfile != "",
+		"--traceprofile":     args.TraceProfile != "",
+		"--cpu-heatmap":      args.CPUHeatmap != "",
+		"--perf-counters":    args.PerfCounters,
+		"--state-file":       args.StateFile != "",
+		"a per core --burn":  strings.Contains(args.Burn, ":"),
+	}
+	options := make([]string, 0, len(unsupported))
+	for option := range unsupported {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+	for _, option := range options {
+		if unsupported[option] {
+			return fmt.Errorf("%s cannot be combined with --processes", option)
+		}
+	}
+	return nil
+}
+
+// runProcesses runs the burn split between --processes child processes, burning the other
+// resources from this process, until the context is done or the children exit. Returns the exit
+// status of the run
+func runProcesses(ctx context.Context, args Args, labels Labels, loads resources, notifier *sdNotifier, sampleEvery time.Duration) int {
+	group := &processGroup{
+		count:        args.Processes,
+		seed:         args.Seed,
+		supervise:    args.Supervise,
+		restartDelay: args.RestartDelay,
+		maxRestarts:  args.MaxRestarts,
+		encoder:      json.NewEncoder(os.Stdout),
+		psi:          newPSIMonitor(),
+		notifier:     notifier,
+		energy:       newEnergyMonitor(),
+	}
+	group.logging.Store(args.LogEvery > 0)
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	wg := sync.WaitGroup{}
+	// the schedule is burnt by the children, the loads here run for the whole duration
+	loads.Run(ctx, &wg, args, nil)
+	go group.energy.Run(ctx)
+	go notifier.Watchdog(ctx, sampleEvery)
+	if args.SignalStep > 0 && len(adjustSignals) > 0 {
+		go forwardSignals(ctx, group.Children, adjustSignals...)
+	}
+	if dumpSignal != nil {
+		// each child dumps its own state, to the logs they share with the parent
+		go forwardSignals(ctx, group.Children, dumpSignal)
+	}
+	if args.Config != "" {
+		go handleReloadSignal(ctx, func() {
+			for _, child := range group.Children() {
+				child.Signal(reloadSignal)
+			}
+			if reloaded, err := loadConfig(args.Config, os.Args[1:]); err == nil {
+				group.logging.Store(reloaded.LogEvery > 0)
+			}
+		})
+	}
+
+	err := group.Run(ctx)
+	notifier.Notify("STOPPING=1")
+	stop()
+	wg.Wait()
+	s := group.Summary()
+	summary := newRunSummary(s, labels)
+	summary.Processes = args.Processes
+	extra := []any{"processes", args.Processes}
+	if args.Supervise {
+		restarts := group.Restarts()
+		summary.Restarts = &restarts
+		extra = append(extra, "restarts", restarts)
+	}
+	extra = append(extra, loads.Summarize(&summary)...)
+	extra = append(extra, group.psi.Summarize(&summary)...)
+	extra = append(extra, group.energy.Summarize(&summary)...)
+	logSummary(s, extra...)
+	if args.SummaryJSON && !reportingToParent() {
+		summary.Write(os.Stdout)
+	} else if args.SummaryLine && !reportingToParent() {
+		summary.WriteLine(os.Stdout)
+	}
+	if err != nil {
+		slog.Error("worker processes failed", "pid", os.Getpid(), "error", err)
+		return 1
+	}
+	if args.AssertTolerance != "" {
+		if err := checkTolerance(s, args.AssertTolerance); err != nil {
+			slog.Error("assertion failed", "pid", os.Getpid(), "error", err)
+			return 1
+		}
+		slog.Info("assertion passed", "pid", os.Getpid(), "tolerance", args.AssertTolerance)
+	}
+	return 0
+}
+
+// reportToParent writes every usage sample taken by the burner to stdout, for the parent process
+// to aggregate, until the burner stops
+func reportToParent(b *burn.Burner) {
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	encoder := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case <-b.Done():
+			return
+		case s := <-samples:
+			encoder.Encode(newProcessSample(s))
+		}
+	}
+}
+
+// processGroup runs the burn split between child processes, each one burning an equal part of it.
+// Children are copies of this process started with the same arguments, and report their usage
+// samples back. Usage is aggregated over rounds: once every running child reported a sample, they
+// are summed into a single one
+type processGroup struct {
+	count   int
+	seed    uint64
+	logging atomic.Bool
+	// supervise restarts children that fail, waiting restartDelay before the first restart and
+	// backing off from there, up to maxRestarts times in total when not 0
+	supervise    bool
+	restartDelay time.Duration
+	maxRestarts  int64
+	restarts     atomic.Int64
+
+	encoder *json.Encoder // writes the aggregate samples to stdout, when reporting to a parent
+	psi     *psiMonitor
+	energy  *energyMonitor
+	// notifier tells systemd once every child started, and the usage of each round
+	notifier *sdNotifier
+
+	mu       sync.Mutex
+	children []*os.Process    // indexed by child, nil while a child is not running
+	stdins   []io.WriteCloser // indexed by child, where share updates are written to
+	cpuTimes []time.Duration  // indexed by child, the cpu time its instances that exited burnt
+	started  bool             // set once every child was started for the first time
+	running  int
+	round    map[int]processSample
+	samples  []burn.Sample
+	user     time.Duration
+	system   time.Duration
+	start    time.Time
+	end      time.Time
+}
+
+// Run spawns the children and aggregates their usage until all of them exit, stopping them once
+// the context is done. Returns an error if any child failed. When supervising, failed children are
+// restarted instead, and the running ones burn the share of the missing ones in the meantime
+func (g *processGroup) Run(ctx context.Context) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	g.round = map[int]processSample{}
+	g.children = make([]*os.Process, g.count)
+	g.stdins = make([]io.WriteCloser, g.count)
+	g.cpuTimes = make([]time.Duration, g.count)
+	g.start = time.Now()
+	// pin the seed so randomized patterns follow the same path in every child
+	childArgs := append(os.Args[1:], fmt.Sprintf("--seed=%d", g.seed))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, g.count)
+	wg := sync.WaitGroup{}
+	for i := 0; i < g.count; i++ {
+		cmd, stdout, err := g.spawn(executable, childArgs, i, false)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return fmt.Errorf("failed to start process %d: %w", i, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delay := g.restartDelay
+			for {
+				started := time.Now()
+				err := g.wait(ctx, i, cmd, stdout)
+				if err == nil || ctx.Err() != nil {
+					return
+				}
+				if !g.supervise {
+					errs <- fmt.Errorf("process %d failed: %w", i, err)
+					cancel()
+					return
+				}
+				restarts := g.restarts.Add(1)
+				if g.maxRestarts > 0 && restarts > g.maxRestarts {
+					g.restarts.Add(-1)
+					errs <- fmt.Errorf("process %d failed after %d restarts: %w", i, g.maxRestarts, err)
+					cancel()
+					return
+				}
+				// a process that ran for a while failed for a new reason, one that failed right
+				// away likely fails again and is waited for longer every time
+				if time.Since(started) > maxRestartDelay {
+					delay = g.restartDelay
+				}
+				slog.Warn("process failed, restarting it", "pid", os.Getpid(), "process", i, "error", err, "restarts", restarts, "delay_ms", delay.Milliseconds())
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(delay):
+					}
+					delay = min(max(2*delay, 100*time.Millisecond), maxRestartDelay)
+					if cmd, stdout, err = g.spawn(executable, childArgs, i, true); err == nil {
+						break
+					}
+					slog.Error("failed to restart process", "pid", os.Getpid(), "process", i, "error", err)
+				}
+			}
+		}()
+	}
+	g.mu.Lock()
+	g.started = true
+	g.notifier.Notify("READY=1")
+	g.rebalance()
+	g.mu.Unlock()
+	wg.Wait()
+
+	g.mu.Lock()
+	g.end = time.Now()
+	g.mu.Unlock()
+	close(errs)
+	return <-errs
+}
+
+// spawn starts the child with the given index. A restarted child resumes the run where it is
+func (g *processGroup) spawn(executable string, args []string, index int, restarted bool) (*exec.Cmd, io.Reader, error) {
+	cmd := exec.Command(executable, args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d/%d", processEnv, index, g.count))
+	if restarted {
+		g.mu.Lock()
+		elapsed, cpuTime := time.Since(g.start), g.cpuTimes[index]
+		g.mu.Unlock()
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s/%g", resumeEnv, elapsed, cpuTime.Seconds()))
+	}
+	cmd.Stderr = logOutput
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		stdin.Close()
+		return nil, nil, err
+	}
+	slog.Debug("process started", "pid", os.Getpid(), "process", index, "child_pid", cmd.Process.Pid)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.children[index] = cmd.Process
+	g.stdins[index] = stdin
+	g.running++
+	g.rebalance()
+	return cmd, stdout, nil
+}
+
+// wait collects the samples of the child with the given index until it exits, stopping it once
+// the context is done
+func (g *processGroup) wait(ctx context.Context, index int, cmd *exec.Cmd, stdout io.Reader) error {
+	stop := context.AfterFunc(ctx, func() { stopProcess(cmd.Process) })
+	defer stop()
+	g.collect(index, stdout)
+	err := cmd.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.user += cmd.ProcessState.UserTime()
+	g.system += cmd.ProcessState.SystemTime()
+	g.cpuTimes[index] += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	g.children[index] = nil
+	g.stdins[index].Close()
+	g.stdins[index] = nil
+	g.running--
+	delete(g.round, index)
+	if ctx.Err() == nil {
+		g.rebalance()
+	}
+	return err
+}
+
+// rebalance tells every running child which share of the burn it is responsible for, so the
+// group keeps burning the whole of it while children are missing. Only done when supervising,
+// as otherwise the group stops once a child is missing, and once every child was started, as
+// they all start with an equal share. Must be called with g.mu held
+func (g *processGroup) rebalance() {
+	if !g.supervise || !g.started || g.running == 0 {
+		return
+	}
+	share := processShareUpdate{Share: 1 / float64(g.running)}
+	for _, stdin := range g.stdins {
+		if stdin != nil {
+			json.NewEncoder(stdin).Encode(share)
+		}
+	}
+}
+
+// Restarts returns how many times children were restarted after failing
+func (g *processGroup) Restarts() int64 {
+	return g.restarts.Load()
+}
+
+// Children returns the processes currently running
+func (g *processGroup) Children() []*os.Process {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	children := make([]*os.Process, 0, len(g.children))
+	for _, child := range g.children {
+		if child != nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// collect reads the samples reported by a child until it closes its stdout
+func (g *processGroup) collect(index int, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var sample processSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			slog.Debug("invalid sample from process", "pid", os.Getpid(), "process", index, "error", err)
+			continue
+		}
+		g.mu.Lock()
+		g.round[index] = sample
+		s, complete := g.completeRound()
+		g.mu.Unlock()
+		if complete {
+			g.notifier.Usage(s)
+		}
+		if complete && g.logging.Load() {
+			attrs := append(usageAttrs(s, s.Target), "processes", g.count)
+			attrs = append(attrs, g.psi.Sample()...)
+			slog.Info("cpu usage", append(attrs, g.energy.Sample()...)...)
+		}
+	}
+}
+
+// completeRound sums the current round into a single sample once every running child reported,
+// starting a new round. Must be called with g.mu held
+func (g *processGroup) completeRound() (burn.Sample, bool) {
+	if len(g.round) < g.running {
+		return burn.Sample{}, false
+	}
+	s := burn.Sample{Phase: -1}
+	for _, sample := range g.round {
+		s.Time = sample.Time
+		s.Interval = max(s.Interval, time.Duration(sample.IntervalMs*float64(time.Millisecond)))
+		s.Target += sample.Target
+		s.Achieved += sample.Achieved
+		s.User += sample.User
+		s.System += sample.System
+		s.Paused = s.Paused || sample.Paused
+		s.Warmup = s.Warmup || sample.Warmup
+	}
+	clear(g.round)
+	g.samples = append(g.samples, s)
+	if reportingToParent() {
+		// this process was spawned by an agent, which needs the aggregate usage of the group
+		g.encoder.Encode(newProcessSample(s))
+	}
+	return s, true
+}
+
+// Summary summarizes the run, which is only complete once Run returned
+func (g *processGroup) Summary() burn.Summary {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := burn.Summarize(g.samples)
+	end := g.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	s.WallTime = end.Sub(g.start)
+	s.UserSeconds = g.user.Seconds()
+	s.SystemSeconds = g.system.Seconds()
+	s.CPUSeconds = s.UserSeconds + s.SystemSeconds
+	if s.Samples == 0 && s.WallTime > 0 {
+		// runs shorter than the sampling interval still get an overall figure
+		s.MeanAchieved = s.CPUSeconds / s.WallTime.Seconds()
+		s.MinAchieved = s.MeanAchieved
+		s.MaxAchieved = s.MeanAchieved
+		s.MedianAchieved = s.MeanAchieved
+		s.P95Achieved = s.MeanAchieved
+	}
+	return s
+}
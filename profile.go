@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// timelineProfile is a profile the run lasts for unless given a --duration, or until interrupted when
+// its Duration is 0
+type timelineProfile interface {
+	burn.Profile
+	Duration() time.Duration
+}
+
+// newProfile builds the profile described by the command line arguments. cpus is the already
+// parsed --burn value. Also returns for how long the run should last, which is --duration unless
+// the profile itself defines it
+func newProfile(args Args, cpus float64) (burn.Profile, time.Duration, error) {
+	var prof burn.Profile
+	duration := args.Duration
+	switch args.Pattern {
+	case "", "constant":
+		prof = burn.Constant(cpus)
+	case "sine":
+		minCPUs, maxCPUs, err := parseBounds(args.Min, args.Max)
+		if err != nil {
+			return nil, 0, err
+		}
+		if args.Period <= 0 {
+			return nil, 0, errors.New("sine pattern requires a positive --period")
+		}
+		prof = burn.Sine{Min: minCPUs, Max: maxCPUs, Period: args.Period}
+	case "randomwalk":
+		minCPUs, maxCPUs, err := parseBounds(args.Min, args.Max)
+		if err != nil {
+			return nil, 0, err
+		}
+		stepEvery := args.Period
+		if stepEvery <= 0 {
+			stepEvery = time.Second
+		}
+		prof = burn.NewRandomWalk(minCPUs, maxCPUs, stepEvery, args.Seed)
+	case "poisson":
+		if args.BurstRate == "" || args.BurstSize == "" {
+			return nil, 0, errors.New("poisson pattern requires both --burst-rate and --burst-size")
+		}
+		rate, err := parseArrivalRate(args.BurstRate)
+		if err != nil {
+			return nil, 0, err
+		}
+		size, err := parseBurn(args.BurstSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		if args.BurstLen <= 0 {
+			return nil, 0, fmt.Errorf("invalid burst len value: %s", args.BurstLen)
+		}
+		prof = burn.NewPoisson(cpus, size, args.BurstLen, rate, args.Seed)
+	default:
+		return nil, 0, fmt.Errorf("invalid pattern %q", args.Pattern)
+	}
+	if args.BurnRange != "" {
+		if _, ok := prof.(burn.Constant); !ok {
+			return nil, 0, errors.New("--burn-range cannot be combined with --pattern")
+		}
+		low, high, found := strings.Cut(args.BurnRange, "-")
+		if !found {
+			return nil, 0, fmt.Errorf("invalid burn range value: %s: expected <min>-<max>, eg 0.5-2.0", args.BurnRange)
+		}
+		minCPUs, maxCPUs, err := parseBounds(low, high)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid burn range value: %s: %w", args.BurnRange, err)
+		}
+		if args.ChangeEvery <= 0 {
+			return nil, 0, fmt.Errorf("invalid change every value: %s", args.ChangeEvery)
+		}
+		prof = burn.NewRandomRange(minCPUs, maxCPUs, args.ChangeEvery, args.Seed)
+	}
+
+	live := 0
+	for _, set := range []bool{args.FollowPID != 0, args.Antagonist != "", args.TargetURL != "", args.BurnFromFile != "", args.OfLimit != "", args.FillTo != ""} {
+		if set {
+			live++
+		}
+	}
+	if live > 1 {
+		return nil, 0, errors.New("--follow-pid, --antagonist, --target-url, --burn-from-file, --of-limit and --fill-to cannot be combined")
+	}
+	if live > 0 {
+		if _, ok := prof.(burn.Constant); !ok || args.Steps != "" || args.Schedule != "" || args.Replay != "" || args.Cron != "" {
+			return nil, 0, errors.New("--follow-pid, --antagonist, --target-url, --burn-from-file, --of-limit and --fill-to cannot be combined with --pattern, --burn-range, --steps, --schedule, --replay or --cron")
+		}
+		if args.BurnFromFile != "" && args.TargetQuery != "" {
+			return nil, 0, errors.New("--target-query requires --target-url")
+		}
+		// the target is set once the process is measured, the url polled, the file or the limit read
+		// or the host measured
+		prof = burn.NewLive(0)
+	} else if args.TargetQuery != "" {
+		return nil, 0, errors.New("--target-query requires --target-url")
+	}
+
+	if args.Steps != "" || args.Schedule != "" || args.Replay != "" {
+		if _, ok := prof.(burn.Constant); !ok {
+			return nil, 0, errors.New("--steps, --schedule and --replay cannot be combined with --pattern or --burn-range")
+		}
+		timelines := 0
+		for _, set := range []bool{args.Steps != "", args.Schedule != "", args.Replay != ""} {
+			if set {
+				timelines++
+			}
+		}
+		if timelines > 1 {
+			return nil, 0, errors.New("--steps, --schedule and --replay cannot be combined")
+		}
+		var timeline timelineProfile
+		var err error
+		switch {
+		case args.Steps != "":
+			timeline, err = parseSteps(args.Steps)
+		case args.Schedule != "":
+			timeline, err = loadSchedule(args.Schedule, args)
+		default:
+			timeline, err = loadTrace(args.Replay, args.ReplaySpeed)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, ok := timeline.(*burn.Markov); ok {
+			slog.Info("randomized schedule seed", "seed", args.Seed)
+		}
+		prof = timeline
+		if duration == 0 {
+			duration = timeline.Duration()
+		}
+	}
+
+	if args.Cron != "" {
+		schedule, err := burn.ParseCron(args.Cron)
+		if err != nil {
+			return nil, 0, err
+		}
+		if args.CronDuration <= 0 {
+			return nil, 0, errors.New("--cron requires a positive --cron-duration")
+		}
+		if args.CronBurn != "" {
+			if _, ok := prof.(burn.Constant); !ok {
+				return nil, 0, errors.New("--cron-burn can only be used when burning a constant target")
+			}
+			cronCPUs, err := parseBurn(args.CronBurn)
+			if err != nil {
+				return nil, 0, err
+			}
+			prof = burn.Constant(cronCPUs)
+		}
+		prof = burn.Cron{Profile: prof, Schedule: schedule, Duration: args.CronDuration, Start: time.Now()}
+	}
+
+	if args.Burst != "" {
+		on, off, err := parseBurst(args.Burst)
+		if err != nil {
+			return nil, 0, err
+		}
+		prof = burn.Burst{Profile: prof, On: on, Off: off}
+	}
+
+	if args.RampUp < 0 || args.RampDown < 0 {
+		return nil, 0, errors.New("ramp durations cannot be negative")
+	}
+	if args.RampDown > 0 && duration <= 0 {
+		return nil, 0, errors.New("--ramp-down requires --duration")
+	}
+	if duration > 0 && args.RampUp+args.RampDown > duration {
+		return nil, 0, errors.New("ramp up and ramp down cannot be longer than the whole duration")
+	}
+	if args.Drain < 0 {
+		return nil, 0, errors.New("drain cannot be negative")
+	}
+	if args.Drain > 0 && args.RampDown > 0 {
+		return nil, 0, errors.New("--drain and --ramp-down cannot be combined")
+	}
+	if duration > 0 && args.RampUp+args.Drain > duration {
+		return nil, 0, errors.New("ramp up and drain cannot be longer than the whole duration")
+	}
+	if args.RampUp > 0 || args.RampDown > 0 {
+		prof = burn.Ramp{Profile: prof, Up: args.RampUp, Down: args.RampDown, Duration: duration}
+	}
+	return prof, duration, nil
+}
+
+// parseBounds parses the --min and --max values used by patterns. Both accept the same syntax as --burn
+func parseBounds(minBurn string, maxBurn string) (float64, float64, error) {
+	if minBurn == "" || maxBurn == "" {
+		return 0, 0, errors.New("pattern requires both --min and --max")
+	}
+	minCPUs, err := parseBurn(minBurn)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxCPUs, err := parseBurn(maxBurn)
+	if err != nil {
+		return 0, 0, err
+	}
+	if minCPUs > maxCPUs {
+		return 0, 0, fmt.Errorf("--min (%v) cannot be greater than --max (%v)", minCPUs, maxCPUs)
+	}
+	return minCPUs, maxCPUs, nil
+}
+
+// parseArrivalRate parses how many times per second something happens on average, given per second,
+// minute or hour, eg 2/min or 0.5/s
+func parseArrivalRate(spec string) (float64, error) {
+	count, unit, found := strings.Cut(spec, "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if !found || err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate value: %s: expected a positive <count>/<unit>, eg 2/min", spec)
+	}
+	switch unit {
+	case "s", "sec", "second":
+		return n, nil
+	case "m", "min", "minute":
+		return n / 60, nil
+	case "h", "hour":
+		return n / 3600, nil
+	}
+	return 0, fmt.Errorf("invalid rate value: %s: unit must be s, min or hour", spec)
+}
+
+// parseSteps parses a steps specification in the burn:duration,burn:duration format, eg
+// 1:30s,2.5:2m,50%:1m. Burn levels accept the same syntax as --burn
+func parseSteps(spec string) (burn.Steps, error) {
+	var result burn.Steps
+	for _, part := range strings.Split(spec, ",") {
+		level, duration, found := strings.Cut(part, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid step %q: expected <burn>:<duration>", part)
+		}
+		cpus, err := parseBurn(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %q: %w", part, err)
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid step %q: duration must be positive", part)
+		}
+		result = append(result, burn.Step{CPUs: cpus, Duration: d})
+	}
+	return result, nil
+}
+
+// parseBurst parses a burst specification in the on=5s,off=25s format
+func parseBurst(spec string) (time.Duration, time.Duration, error) {
+	invalidInput := fmt.Errorf("invalid burst value %q: expected on=<duration>,off=<duration>", spec)
+	var on, off time.Duration
+	for _, part := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return 0, 0, invalidInput
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return 0, 0, invalidInput
+		}
+		switch key {
+		case "on":
+			on = duration
+		case "off":
+			off = duration
+		default:
+			return 0, 0, invalidInput
+		}
+	}
+	if on <= 0 || off <= 0 {
+		return 0, 0, invalidInput
+	}
+	return on, off, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// cpuPressure is the pressure stall information of cpu: the percentage of time some, or all, non
+// idle tasks were stalled waiting for a cpu over the last 10 seconds, along with the total stall
+// time so far
+type cpuPressure struct {
+	someAvg10 float64
+	fullAvg10 float64
+	someTotal time.Duration
+	fullTotal time.Duration
+}
+
+// psiMonitor tracks the cpu pressure of the host and of the cgroup the process runs in over the
+// run, which is how much the burn makes other work wait for a cpu. Either is skipped when not
+// available, eg outside of linux, on kernels without psi or on cgroup v1
+type psiMonitor struct {
+	mu          sync.Mutex
+	host        bool
+	cgroup      bool
+	hostStart   cpuPressure
+	cgroupStart cpuPressure
+	hostLast    cpuPressure
+	cgroupLast  cpuPressure
+}
+
+func newPSIMonitor() *psiMonitor {
+	m := &psiMonitor{}
+	var err error
+	m.hostStart, m.host, err = hostCPUPressure()
+	if err != nil {
+		slog.Debug("failed to read the host cpu pressure", "pid", os.Getpid(), "error", err)
+		m.host = false
+	}
+	m.cgroupStart, m.cgroup, err = cgroupCPUPressure()
+	if err != nil {
+		slog.Debug("failed to read the cgroup cpu pressure", "pid", os.Getpid(), "error", err)
+		m.cgroup = false
+	}
+	m.hostLast, m.cgroupLast = m.hostStart, m.cgroupStart
+	return m
+}
+
+// Sample reads the current pressure, returning it as log attributes
+func (m *psiMonitor) Sample() []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var attrs []any
+	if m.host {
+		if current, _, err := hostCPUPressure(); err == nil {
+			m.hostLast = current
+			attrs = append(attrs, "psi_some_avg10", decimal(current.someAvg10, 2), "psi_full_avg10", decimal(current.fullAvg10, 2))
+		}
+	}
+	if m.cgroup {
+		if current, _, err := cgroupCPUPressure(); err == nil {
+			m.cgroupLast = current
+			attrs = append(attrs, "cgroup_psi_some_avg10", decimal(current.someAvg10, 2), "cgroup_psi_full_avg10", decimal(current.fullAvg10, 2))
+		}
+	}
+	return attrs
+}
+
+// Summarize adds how long tasks were stalled waiting for a cpu during the run to the summary,
+// returning it as log attributes too
+func (m *psiMonitor) Summarize(summary *runSummary) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var attrs []any
+	if m.host {
+		if current, _, err := hostCPUPressure(); err == nil {
+			m.hostLast = current
+		}
+		some, full := (m.hostLast.someTotal - m.hostStart.someTotal).Milliseconds(), (m.hostLast.fullTotal - m.hostStart.fullTotal).Milliseconds()
+		summary.PSISomeMs, summary.PSIFullMs = &some, &full
+		attrs = append(attrs, "psi_some_ms", some, "psi_full_ms", full)
+	}
+	if m.cgroup {
+		if current, _, err := cgroupCPUPressure(); err == nil {
+			m.cgroupLast = current
+		}
+		some, full := (m.cgroupLast.someTotal - m.cgroupStart.someTotal).Milliseconds(), (m.cgroupLast.fullTotal - m.cgroupStart.fullTotal).Milliseconds()
+		summary.CgroupPSISomeMs, summary.CgroupPSIFullMs = &some, &full
+		attrs = append(attrs, "cgroup_psi_some_ms", some, "cgroup_psi_full_ms", full)
+	}
+	return attrs
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RecordCmd struct {
+	PID    int           `arg:"--pid" help:"record the cpu usage of this process instead of the whole host. The recording ends once the process exits"`
+	Every  time.Duration `arg:"--every" default:"1s" help:"how often the cpu usage is sampled"`
+	Length time.Duration `arg:"--length" default:"0" help:"for how long to record. Pass 0 to record until interrupted"`
+	Output string        `arg:"-o,--output" default:"-" help:"file to write the trace to, or - for stdout. Paths ending in .json get a JSON trace and all others a csv one, both of which --replay accepts"`
+}
+
+// traceWriter writes trace samples in one of the formats loadTrace reads, flushing every sample
+// so the trace is usable while it is being recorded
+type traceWriter struct {
+	w       *bufio.Writer
+	json    bool
+	samples int
+}
+
+func newTraceWriter(w io.Writer, json bool) (*traceWriter, error) {
+	t := &traceWriter{w: bufio.NewWriter(w), json: json}
+	if json {
+		t.w.WriteString("[")
+	} else {
+		t.w.WriteString("timestamp,cores\n")
+	}
+	return t, t.w.Flush()
+}
+
+func (t *traceWriter) Write(timestamp time.Time, cores float64) error {
+	value := strconv.FormatFloat(cores, 'f', 3, 64)
+	if t.json {
+		if t.samples > 0 {
+			t.w.WriteString(",")
+		}
+		fmt.Fprintf(t.w, "\n  {\"timestamp\": %q, \"cores\": %s}", timestamp.Format(time.RFC3339Nano), value)
+	} else {
+		fmt.Fprintf(t.w, "%s,%s\n", timestamp.Format(time.RFC3339Nano), value)
+	}
+	t.samples++
+	return t.w.Flush()
+}
+
+// Close ends the trace, which JSON traces need to be valid
+func (t *traceWriter) Close() error {
+	if t.json {
+		t.w.WriteString("\n]\n")
+	}
+	return t.w.Flush()
+}
+
+// runRecord samples the cpu usage of the host or of a process until the context is done, the
+// duration is over or the process exits, writing it as a trace. Every sample is the usage over
+// the interval starting at its timestamp, which is how replays burn them
+func runRecord(ctx context.Context, cmd *RecordCmd) error {
+	if cmd.Every <= 0 {
+		return fmt.Errorf("invalid every value: %s", cmd.Every)
+	}
+	if cmd.Length < 0 {
+		return fmt.Errorf("invalid length value: %s", cmd.Length)
+	}
+	if cmd.PID < 0 {
+		return fmt.Errorf("invalid pid value: %d", cmd.PID)
+	}
+	measure := hostCPUTime
+	if cmd.PID != 0 {
+		measure = func() (time.Duration, error) { return processCPUTime(cmd.PID) }
+	}
+	previous, err := measure()
+	if err != nil {
+		if cmd.PID != 0 {
+			return fmt.Errorf("cannot record process %d: %w", cmd.PID, err)
+		}
+		return fmt.Errorf("cannot record the host: %w", err)
+	}
+
+	out := io.Writer(os.Stdout)
+	if cmd.Output != "-" {
+		file, err := os.Create(cmd.Output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	trace, err := newTraceWriter(out, strings.HasSuffix(cmd.Output, ".json"))
+	if err != nil {
+		return err
+	}
+	defer trace.Close()
+
+	if cmd.Length > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Length)
+		defer cancel()
+	}
+	slog.Info("recording cpu usage", "pid", os.Getpid(), "record_pid", cmd.PID, "every_ms", cmd.Every.Milliseconds(), "output", cmd.Output)
+	ticker := time.NewTicker(cmd.Every)
+	defer ticker.Stop()
+	previousTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, err := measure()
+		if err != nil {
+			if cmd.PID != 0 {
+				slog.Info("recorded process is gone, stopping", "pid", os.Getpid(), "record_pid", cmd.PID, "error", err)
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		cores := max(0, float64(current-previous)/float64(now.Sub(previousTime)))
+		slog.Debug("recorded cpu usage", "pid", os.Getpid(), "record_pid", cmd.PID, "cpus", decimal(cores, 3))
+		if err := trace.Write(previousTime, cores); err != nil {
+			return err
+		}
+		previous, previousTime = current, now
+	}
+}
+
+// hostCPUTime returns the cpu time all processes of the host consumed so far, summed over all
+// cpus like the cpu time of a process
+func hostCPUTime() (time.Duration, error) {
+	busy, _, _, err := hostCPUTimes()
+	return busy, err
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+const reportChartWidth = 50
+const reportChartMaxRows = 60
+
+// writeReport writes a self-contained markdown document describing the run: how it was
+// configured, how the work was split, how accurate it was and how usage evolved over time
+func writeReport(path string, args Args, cpus float64, burner *burn.Burner, throttling *throttleMonitor, steal *stealMonitor, energy *energyMonitor, heatmap *cpuHeatmap) error {
+	stats := burner.Stats()
+	samples := burner.Samples()
+	s := burner.Summary()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# cpu-burner report\n\n")
+	fmt.Fprintf(b, "Run started at %s on pid %d and lasted %s.\n\n", stats.Start.Format(time.RFC3339), os.Getpid(), s.WallTime.Round(time.Millisecond))
+
+	fmt.Fprintf(b, "## Configuration\n\n")
+	fmt.Fprintf(b, "| Option | Value |\n|---|---|\n")
+	for _, option := range reportOptions(args) {
+		fmt.Fprintf(b, "| `%s` | `%s` |\n", option[0], option[1])
+	}
+
+	fmt.Fprintf(b, "\n## Plan\n\n")
+	fmt.Fprintf(b, "- target: %.3f cpus\n", cpus)
+	fmt.Fprintf(b, "- work unit: %s\n", stats.WorkUnit)
+	fmt.Fprintf(b, "- lock os thread: %t\n", stats.LockOSThread)
+	for i, cpuSet := range stats.CPUSets {
+		fmt.Fprintf(b, "- cpuset %d: %v\n", i, cpuSet)
+	}
+	fmt.Fprintf(b, "- workers at the end of the run: %d (spawned %d, reaped %d)\n", stats.Workers, stats.Spawned, stats.Reaped)
+
+	fmt.Fprintf(b, "\n## Summary\n\n")
+	if s.Samples == 0 {
+		fmt.Fprintf(b, "No samples were collected.\n")
+	} else {
+		fmt.Fprintf(b, "| Metric | Value |\n|---|---|\n")
+		fmt.Fprintf(b, "| samples | %d |\n", s.Samples)
+		fmt.Fprintf(b, "| cpu seconds burned | %.3f |\n", s.CPUSeconds)
+		fmt.Fprintf(b, "| user / system cpu seconds | %.3f / %.3f |\n", s.UserSeconds, s.SystemSeconds)
+		fmt.Fprintf(b, "| mean target cpus | %.3f |\n", s.MeanTarget)
+		fmt.Fprintf(b, "| mean achieved cpus | %.3f |\n", s.MeanAchieved)
+		fmt.Fprintf(b, "| min achieved cpus | %.3f |\n", s.MinAchieved)
+		fmt.Fprintf(b, "| max achieved cpus | %.3f |\n", s.MaxAchieved)
+		fmt.Fprintf(b, "| mean absolute delta | %.2f%% |\n", s.MeanAbsDeltaPct)
+		fmt.Fprintf(b, "| p50 / p90 / p99 absolute delta | %.2f%% / %.2f%% / %.2f%% |\n", s.P50AbsDeltaPct, s.P90AbsDeltaPct, s.P99AbsDeltaPct)
+		fmt.Fprintf(b, "| accuracy score | %.1f / 100 |\n", s.Accuracy())
+		if s.Frozen > 0 {
+			fmt.Fprintf(b, "| process stopped, left out | %s |\n", s.Frozen.Round(time.Millisecond))
+		}
+		if throttled, ok := throttling.Total(); ok {
+			fmt.Fprintf(b, "| cgroup throttled periods | %d of %d |\n", throttled.throttledPeriods, throttled.periods)
+			fmt.Fprintf(b, "| cgroup throttled time | %s |\n", throttled.throttledTime.Round(time.Millisecond))
+		}
+		if pct, ok := steal.Total(); ok {
+			fmt.Fprintf(b, "| busy cpu time of the host stolen by the hypervisor | %.1f%% |\n", pct)
+		}
+		if joules, watts, ok := energy.Total(); ok {
+			fmt.Fprintf(b, "| energy consumed by the cpu packages of the host | %.1f J |\n", joules)
+			fmt.Fprintf(b, "| mean power drawn by the cpu packages of the host | %.1f W |\n", watts)
+		}
+
+		if phases := samplesByPhase(samples); len(phases) > 0 {
+			fmt.Fprintf(b, "\n## Phases\n\n")
+			fmt.Fprintf(b, "| Phase | Samples | Mean target | Mean achieved | Min achieved | Max achieved | Accuracy |\n|---|---|---|---|---|---|---|\n")
+			for _, phase := range phases {
+				ps := burn.Summarize(phase)
+				fmt.Fprintf(b, "| %d | %d | %.3f | %.3f | %.3f | %.3f | %.1f |\n", phase[0].Phase, ps.Samples, ps.MeanTarget, ps.MeanAchieved, ps.MinAchieved, ps.MaxAchieved, ps.Accuracy())
+			}
+		}
+
+		if heatmap != nil {
+			fmt.Fprintf(b, "\n## Per cpu usage\n\n")
+			fmt.Fprintf(b, "How busy every cpu of the host was over the run, the burner and everything else.\n\n")
+			fmt.Fprintf(b, "| CPU | Busy |\n|---|---|\n")
+			means := heatmap.Means()
+			for _, cpu := range slices.Sorted(maps.Keys(means)) {
+				fmt.Fprintf(b, "| %d | %.1f%% |\n", cpu, means[cpu]*100)
+			}
+		}
+
+		fmt.Fprintf(b, "\n## Accuracy distribution\n\n")
+		fmt.Fprintf(b, "| Absolute delta | Intervals |\n|---|---|\n")
+		for _, bucket := range deltaHistogram(samples) {
+			fmt.Fprintf(b, "| %s | %d |\n", bucket.label, bucket.count)
+		}
+
+		fmt.Fprintf(b, "\n## Intervals\n\n")
+		fmt.Fprintf(b, "| Elapsed | Target | Achieved | Delta |\n|---|---|---|---|\n")
+		for _, sample := range samples {
+			fmt.Fprintf(b, "| %s | %.3f | %.3f | %+.1f%% |\n", sample.Time.Sub(stats.Start).Round(time.Millisecond), sample.Target, sample.Achieved, sample.DeltaPct())
+		}
+
+		fmt.Fprintf(b, "\n## Chart\n\n")
+		fmt.Fprintf(b, "Achieved usage is drawn with `#`, the target is marked with `|`.\n\n")
+		fmt.Fprintf(b, "```\n%s```\n", reportChart(stats.Start, samples))
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// samplesByPhase groups consecutive samples taken during the same phase. Returns nothing when the
+// run had no phases
+func samplesByPhase(samples []burn.Sample) [][]burn.Sample {
+	var groups [][]burn.Sample
+	for _, s := range samples {
+		if s.Phase < 0 {
+			continue
+		}
+		if len(groups) == 0 || groups[len(groups)-1][0].Phase != s.Phase {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], s)
+	}
+	return groups
+}
+
+// reportOptions lists every command line option with its value, using the long flag names
+func reportOptions(args Args) [][2]string {
+	var options [][2]string
+	v := reflect.ValueOf(args)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Contains(t.Field(i).Tag.Get("arg"), "subcommand:") {
+			continue
+		}
+		name := strings.ToLower(t.Field(i).Name)
+		for _, part := range strings.Split(t.Field(i).Tag.Get("arg"), ",") {
+			if strings.HasPrefix(part, "--") {
+				name = part
+			}
+		}
+		options = append(options, [2]string{name, fmt.Sprint(v.Field(i).Interface())})
+	}
+	return options
+}
+
+// reportChart draws an horizontal bar per sample. When there are too many samples they are
+// averaged into buckets so the chart stays readable
+func reportChart(start time.Time, samples []burn.Sample) string {
+	bucketSize := (len(samples) + reportChartMaxRows - 1) / reportChartMaxRows
+	var buckets []burn.Sample
+	for i := 0; i < len(samples); i += bucketSize {
+		end := min(i+bucketSize, len(samples))
+		bucket := burn.Sample{Time: samples[i].Time}
+		for _, s := range samples[i:end] {
+			bucket.Target += s.Target
+			bucket.Achieved += s.Achieved
+		}
+		bucket.Target /= float64(end - i)
+		bucket.Achieved /= float64(end - i)
+		buckets = append(buckets, bucket)
+	}
+
+	scale := 0.0
+	for _, bucket := range buckets {
+		scale = max(scale, bucket.Target, bucket.Achieved)
+	}
+	if scale == 0 {
+		scale = 1
+	}
+
+	b := &strings.Builder{}
+	for _, bucket := range buckets {
+		bar := []byte(strings.Repeat(" ", reportChartWidth+1))
+		for i := 0; i < int(bucket.Achieved/scale*reportChartWidth); i++ {
+			bar[i] = '#'
+		}
+		bar[int(bucket.Target/scale*reportChartWidth)] = '|'
+		fmt.Fprintf(b, "%10s %7.3f %s\n", bucket.Time.Sub(start).Round(100*time.Millisecond), bucket.Achieved, strings.TrimRight(string(bar), " "))
+	}
+	return b.String()
+}
+
+// deltaBuckets are the upper bounds, in percent, of the buckets the absolute delta of intervals
+// is counted in
+var deltaBuckets = []float64{1, 2, 5, 10, 25, 50}
+
+type histogramBucket struct {
+	label string
+	count int
+}
+
+// deltaHistogram counts how many intervals were how far off the target, skipping paused, warmup and
+// frozen ones
+func deltaHistogram(samples []burn.Sample) []histogramBucket {
+	buckets := make([]histogramBucket, len(deltaBuckets)+1)
+	low := 0.0
+	for i, high := range deltaBuckets {
+		buckets[i].label = fmt.Sprintf("%g%% to %g%%", low, high)
+		low = high
+	}
+	buckets[len(deltaBuckets)].label = fmt.Sprintf("%g%% or more", low)
+	for _, sample := range samples {
+		if sample.Paused || sample.Warmup || sample.Frozen > 0 {
+			continue
+		}
+		delta := math.Abs(sample.DeltaPct())
+		i := sort.SearchFloat64s(deltaBuckets, delta)
+		if i < len(deltaBuckets) && deltaBuckets[i] == delta {
+			// bounds are exclusive
+			i++
+		}
+		buckets[i].count++
+	}
+	return buckets
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+const (
+	reportPushTimeout = 10 * time.Second // for a single request
+	reportPushRetries = 5
+	// reportPushMaxBackoff caps the wait between retries, which doubles from a second on
+	reportPushMaxBackoff = 30 * time.Second
+	// reportPushMaxPending bounds the samples kept while the collector is unreachable, the oldest
+	// being dropped first
+	reportPushMaxPending = 10000
+	// reportPushFinalTimeout bounds how long pushing what is left and the summary delays the exit
+	reportPushFinalTimeout = time.Minute
+)
+
+// reportPush is the json body of every request of a reportPusher: the samples taken since the
+// previous push, or the summary once the run finished
+type reportPush struct {
+	Type    string            `json:"type"` // samples or summary
+	PID     int               `json:"pid"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Samples []processSample   `json:"samples,omitempty"`
+	Summary *runSummary       `json:"summary,omitempty"`
+}
+
+// reportPusher posts usage samples and the final summary of the run to a collector, retrying with
+// backoff, so runs leave a record somewhere even when their output is lost, eg in ephemeral ci
+// runners. Samples a collector could not take are kept and sent along with the next push
+type reportPusher struct {
+	url    string
+	every  time.Duration
+	labels Labels
+	client *http.Client
+	done   chan struct{}
+
+	mu      sync.Mutex
+	pending []processSample
+}
+
+func newReportPusher(url string, every time.Duration, labels Labels) *reportPusher {
+	return &reportPusher{url: url, every: every, labels: labels, client: &http.Client{Timeout: reportPushTimeout}, done: make(chan struct{})}
+}
+
+// Run pushes the samples taken by the burner every interval until the context is done, then
+// pushes whatever is left. Samples keep being collected while a push is being retried
+func (p *reportPusher) Run(ctx context.Context, b *burn.Burner) {
+	defer close(p.done)
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	slog.Info("pushing usage to a collector", "pid", os.Getpid(), "url", p.url, "every_ms", p.every.Milliseconds())
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		ticker := time.NewTicker(p.every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.flush(ctx)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			<-pushed
+			final, cancel := context.WithTimeout(context.Background(), reportPushFinalTimeout)
+			defer cancel()
+			p.flush(final)
+			return
+		case s := <-samples:
+			p.keep(newProcessSample(s))
+		}
+	}
+}
+
+// keep queues samples for the next push, dropping the oldest beyond reportPushMaxPending
+func (p *reportPusher) keep(samples ...processSample) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, samples...)
+	if len(p.pending) > reportPushMaxPending {
+		p.pending = p.pending[len(p.pending)-reportPushMaxPending:]
+	}
+}
+
+// flush pushes the pending samples, keeping them for the next push when the collector cannot take
+// them
+func (p *reportPusher) flush(ctx context.Context) {
+	p.mu.Lock()
+	samples := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(samples) == 0 {
+		return
+	}
+	if err := p.push(ctx, reportPush{Type: "samples", Samples: samples}); err != nil {
+		slog.Warn("failed to push usage to the collector", "pid", os.Getpid(), "url", p.url, "samples", len(samples), "error", err)
+		p.mu.Lock()
+		p.pending = append(samples, p.pending...)
+		p.mu.Unlock()
+		p.keep()
+	}
+}
+
+// Summary pushes the summary of the run, once the samples were
+func (p *reportPusher) Summary(summary runSummary) {
+	if p == nil {
+		return
+	}
+	<-p.done
+	ctx, cancel := context.WithTimeout(context.Background(), reportPushFinalTimeout)
+	defer cancel()
+	if err := p.push(ctx, reportPush{Type: "summary", Summary: &summary}); err != nil {
+		slog.Error("failed to push the summary to the collector", "pid", os.Getpid(), "url", p.url, "error", err)
+		return
+	}
+	slog.Debug("summary pushed to the collector", "pid", os.Getpid(), "url", p.url)
+}
+
+// push posts a body to the collector, retrying with exponential backoff on failures and on
+// responses other than 2xx, until it gets through, runs out of retries or the context is done
+func (p *reportPusher) push(ctx context.Context, body reportPush) error {
+	body.PID = os.Getpid()
+	if len(p.labels) > 0 {
+		body.Labels = p.labels.Map()
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = p.post(ctx, data)
+		if err == nil || attempt == reportPushRetries {
+			return err
+		}
+		slog.Debug("retrying push to the collector", "pid", os.Getpid(), "url", p.url, "attempt", attempt+1, "backoff_ms", backoff.Milliseconds(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, reportPushMaxBackoff)
+	}
+}
+
+func (p *reportPusher) post(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// resources are the loads burned alongside cpu: memory held resident, disk io, network and process
+// spawning. They share the duration, lifecycle and summary of the cpu burn
+type resources struct {
+	memBytes int64
+	// memPolicy is where the memory is allocated
+	memPolicy burn.MemPolicy
+	io        *ioBurner
+	net       *netBurner
+	spawn     *spawnBurner
+}
+
+// loadGate tells whether the io, network and spawn loads should be running right now. A nil gate is
+// always open
+type loadGate func() bool
+
+// loadGateCheckEvery is how often a closed gate is checked again
+const loadGateCheckEvery = 100 * time.Millisecond
+
+// burnGate makes the io, network and spawn loads follow the schedule of the cpu burn, idling whenever it
+// is paused or its target is 0, eg outside --cron windows or in --burst off periods. Runs only
+// burning the other resources, with a --burn of 0, are not gated
+func burnGate(b *burn.Burner, prof burn.Profile) loadGate {
+	if prof == burn.Constant(0) {
+		return nil
+	}
+	return func() bool {
+		return !b.Paused() && b.Target() > 0
+	}
+}
+
+// wait blocks until the gate is open, returning whether it had to wait at all, along with false
+// when the context is done first
+func (g loadGate) wait(ctx context.Context) (bool, bool) {
+	if g == nil || g() {
+		return false, true
+	}
+	ticker := time.NewTicker(loadGateCheckEvery)
+	defer ticker.Stop()
+	for !g() {
+		select {
+		case <-ctx.Done():
+			return true, false
+		case <-ticker.C:
+		}
+	}
+	return true, true
+}
+
+// Run starts burning the resources until the context is done
+func (r resources) Run(ctx context.Context, wg *sync.WaitGroup, args Args, gate loadGate) {
+	if r.memBytes > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			holdMemory(ctx, r.memBytes, args.MemTouchEvery, r.memPolicy)
+		}()
+	}
+	if r.io != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.io.Run(ctx, args.LogEvery, gate)
+		}()
+	}
+	if r.net != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.net.Run(ctx, args.LogEvery, gate)
+		}()
+	}
+	if r.spawn != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.spawn.Run(ctx, args.LogEvery, gate)
+		}()
+	}
+}
+
+// Summarize adds the totals of the resources to the summary, returning them as log attributes too
+func (r resources) Summarize(summary *runSummary) []any {
+	var attrs []any
+	if r.memBytes > 0 {
+		summary.MemBytes = r.memBytes
+		attrs = append(attrs, "mem_bytes", r.memBytes)
+	}
+	if r.io != nil {
+		summary.IOReadBytes, summary.IOWriteBytes = r.io.read.Load(), r.io.written.Load()
+		attrs = append(attrs, "io_read_bytes", summary.IOReadBytes, "io_write_bytes", summary.IOWriteBytes)
+	}
+	if r.net != nil {
+		summary.NetSentBytes, summary.NetReceivedBytes = r.net.sent.Load(), r.net.received.Load()
+		attrs = append(attrs, "net_sent_bytes", summary.NetSentBytes, "net_received_bytes", summary.NetReceivedBytes)
+	}
+	if r.spawn != nil {
+		summary.SpawnedProcesses, summary.SpawnFailures = r.spawn.spawned.Load(), r.spawn.failed.Load()
+		attrs = append(attrs, "spawned_processes", summary.SpawnedProcesses, "spawn_failures", summary.SpawnFailures)
+	}
+	return attrs
+}
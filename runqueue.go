@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// runqueueMonitor tracks how long the threads of the process spent runnable but waiting for a cpu.
+// When the burn falls short of its target, this tells the scheduler delaying the workers apart from
+// the workers sleeping too much: waiting for a cpu adds up close to the shortfall in the first case
+// and stays low in the second. It is a no-op when the kernel does not expose it, eg outside of
+// linux or without schedstats
+type runqueueMonitor struct {
+	mu        sync.Mutex
+	available bool
+	last      map[int]time.Duration // by thread id
+	total     time.Duration
+	lastTime  time.Time
+}
+
+func newRunqueueMonitor() *runqueueMonitor {
+	m := &runqueueMonitor{lastTime: time.Now()}
+	waits, available, err := threadWaitTimes()
+	if err != nil {
+		slog.Debug("failed to read thread run queue delays", "pid", os.Getpid(), "error", err)
+	}
+	m.available = available && err == nil
+	m.last = waits
+	return m
+}
+
+// read returns the time every thread waited for a cpu since the previous read, adding it to the
+// total. Threads exiting between reads lose what they waited since the previous one. Must be called
+// with m.mu held
+func (m *runqueueMonitor) read() (time.Duration, bool) {
+	waits, _, err := threadWaitTimes()
+	if err != nil {
+		slog.Debug("failed to read thread run queue delays", "pid", os.Getpid(), "error", err)
+		return 0, false
+	}
+	var delta time.Duration
+	for tid, wait := range waits {
+		// threads started since the previous read waited all of their time during the interval
+		delta += wait - m.last[tid]
+	}
+	m.total += delta
+	m.last = waits
+	return delta, true
+}
+
+// Sample returns how long threads waited for a cpu since the previous sample as log attributes: in
+// total, and as the amount of cpus that would have been busy had they not waited
+func (m *runqueueMonitor) Sample() []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return nil
+	}
+	now := time.Now()
+	interval := now.Sub(m.lastTime)
+	wait, ok := m.read()
+	if !ok || interval <= 0 {
+		return nil
+	}
+	m.lastTime = now
+	return []any{"runq_wait_ms", wait.Milliseconds(), "runq_wait_cpus", decimal(float64(wait)/float64(interval), 3)}
+}
+
+// Summarize adds how long threads waited for a cpu during the run to the summary, returning it as log
+// attributes too
+func (m *runqueueMonitor) Summarize(summary *runSummary) []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return nil
+	}
+	m.read()
+	ms := m.total.Milliseconds()
+	summary.RunqWaitMs = &ms
+	return []any{"runq_wait_ms", ms}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+	"gopkg.in/yaml.v3"
+)
+
+// scheduleFile is the format of the file passed to --schedule. As JSON is a subset of YAML, both
+// formats are accepted. Eg:
+//
+//	phases:
+//	  - name: warm
+//	    burn: 1
+//	    duration: 30s
+//	  - burn: 50%
+//	    duration: 2h
+//	    lock_os_thread: false
+//
+// Phases and states can also burn with another workload, sleep strategy or cpuset than the rest of
+// the run, where a cpuset of all leaves workers unpinned:
+//
+//	phases:
+//	  - name: fp
+//	    burn: 2
+//	    duration: 5m
+//	    workload: float
+//	    cpuset: 0-3
+//	  - name: churn
+//	    burn: 1
+//	    duration: 5m
+//	    workload: syscall
+//	    cpuset: all
+//
+// Instead of phases, it may list load states switching at random, each held for its dwell time, a
+// fixed duration or a range picked from uniformly, before moving on to the next one drawn from its
+// transition probabilities. The run starts in the initial state, or the first one:
+//
+//	initial: quiet
+//	states:
+//	  - name: quiet
+//	    burn: 0.5
+//	    dwell: 1m-5m
+//	    next: {quiet: 0.5, busy: 0.4, spike: 0.1}
+//	  - name: busy
+//	    burn: 2
+//	    dwell: 2m
+//	    next: {quiet: 0.7, spike: 0.3}
+//	  - name: spike
+//	    burn: 100%
+//	    dwell: 10s-30s
+//	    next: {busy: 1}
+type scheduleFile struct {
+	Phases  []schedulePhase `yaml:"phases"`
+	Initial string          `yaml:"initial"`
+	States  []scheduleState `yaml:"states"`
+}
+
+type schedulePhase struct {
+	Name            string `yaml:"name"`
+	Burn            string `yaml:"burn"`
+	Duration        string `yaml:"duration"`
+	scheduleOptions `yaml:",inline"`
+}
+
+type scheduleState struct {
+	Name            string             `yaml:"name"`
+	Burn            string             `yaml:"burn"`
+	Dwell           string             `yaml:"dwell"`
+	Next            map[string]float64 `yaml:"next"`
+	scheduleOptions `yaml:",inline"`
+}
+
+// scheduleOptions are the burn options a phase or a state can override
+type scheduleOptions struct {
+	LockOSThread  *bool   `yaml:"lock_os_thread"`
+	Workload      string  `yaml:"workload"`
+	SleepStrategy string  `yaml:"sleep_strategy"`
+	CPUSet        *string `yaml:"cpuset"`
+}
+
+// phaseOptions turns the options of a phase or a state into the ones of the burner, building
+// workloads from args as --workload would
+func (o scheduleOptions) phaseOptions(name string, args Args) (burn.PhaseOptions, error) {
+	options := burn.PhaseOptions{Name: name, LockOSThread: o.LockOSThread}
+	if o.Workload != "" {
+		workloadArgs := args
+		workloadArgs.Workload = o.Workload
+		workload, err := newWorkload(workloadArgs)
+		if err != nil {
+			return burn.PhaseOptions{}, err
+		}
+		options.Workload = workload
+	}
+	switch burn.SleepStrategy(o.SleepStrategy) {
+	case "", burn.SleepStrategySleep, burn.SleepStrategyYield, burn.SleepStrategySpinWait:
+		options.SleepStrategy = burn.SleepStrategy(o.SleepStrategy)
+	default:
+		return burn.PhaseOptions{}, fmt.Errorf("invalid sleep strategy %q", o.SleepStrategy)
+	}
+	if o.CPUSet == nil {
+		return options, nil
+	}
+	if strings.Contains(args.Burn, ":") {
+		return burn.PhaseOptions{}, errors.New("cpusets cannot be combined with a per core --burn")
+	}
+	if *o.CPUSet == "all" {
+		options.CPUSets = [][]int{}
+		return options, nil
+	}
+	if runtime.GOOS != "linux" {
+		return burn.PhaseOptions{}, errors.New("cpusets are only supported on linux")
+	}
+	cpuSet, err := parseCPUSet(*o.CPUSet)
+	if err != nil {
+		return burn.PhaseOptions{}, err
+	}
+	allowed, err := allowedCPUs()
+	if err != nil {
+		return burn.PhaseOptions{}, err
+	}
+	for _, cpu := range cpuSet {
+		if !allowed[cpu] {
+			return burn.PhaseOptions{}, fmt.Errorf("cpu %d of cpuset %s is not available to this process", cpu, *o.CPUSet)
+		}
+	}
+	options.CPUSets = [][]int{cpuSet}
+	return options, nil
+}
+
+// loadSchedule reads a schedule file into a Steps profile, or a Markov one seeded with --seed when
+// it lists states
+func loadSchedule(path string, args Args) (timelineProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file scheduleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid schedule file %s: %w", path, err)
+	}
+	if len(file.States) > 0 {
+		if len(file.Phases) > 0 {
+			return nil, errors.New("schedule file cannot have both phases and states")
+		}
+		return loadStates(file, args)
+	}
+	if len(file.Phases) == 0 {
+		return nil, errors.New("schedule file has no phases")
+	}
+	var result burn.Steps
+	for i, phase := range file.Phases {
+		cpus, err := parseBurn(phase.Burn)
+		if err != nil {
+			return nil, fmt.Errorf("schedule phase %d: %w", i, err)
+		}
+		duration, err := time.ParseDuration(phase.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("schedule phase %d: invalid duration %q", i, phase.Duration)
+		}
+		options, err := phase.phaseOptions(phase.Name, args)
+		if err != nil {
+			return nil, fmt.Errorf("schedule phase %d: %w", i, err)
+		}
+		result = append(result, burn.Step{CPUs: cpus, Duration: duration, Options: options})
+	}
+	return result, nil
+}
+
+// loadStates turns the states of a schedule file into a Markov profile
+func loadStates(file scheduleFile, args Args) (*burn.Markov, error) {
+	indexes := map[string]int{}
+	for i, state := range file.States {
+		if state.Name == "" {
+			return nil, fmt.Errorf("schedule state %d has no name", i)
+		}
+		if _, found := indexes[state.Name]; found {
+			return nil, fmt.Errorf("schedule state %s defined twice", state.Name)
+		}
+		indexes[state.Name] = i
+	}
+	initial := 0
+	if file.Initial != "" {
+		var found bool
+		if initial, found = indexes[file.Initial]; !found {
+			return nil, fmt.Errorf("unknown initial schedule state %s", file.Initial)
+		}
+	}
+	var states []burn.MarkovState
+	for _, state := range file.States {
+		cpus, err := parseBurn(state.Burn)
+		if err != nil {
+			return nil, fmt.Errorf("schedule state %s: %w", state.Name, err)
+		}
+		minDwell, maxDwell, err := parseDwell(state.Dwell)
+		if err != nil {
+			return nil, fmt.Errorf("schedule state %s: %w", state.Name, err)
+		}
+		var next []float64
+		total := 0.0
+		for name, probability := range state.Next {
+			to, found := indexes[name]
+			if !found {
+				return nil, fmt.Errorf("schedule state %s: unknown next state %s", state.Name, name)
+			}
+			if probability < 0 {
+				return nil, fmt.Errorf("schedule state %s: invalid probability %v for %s", state.Name, probability, name)
+			}
+			if next == nil {
+				next = make([]float64, len(file.States))
+			}
+			next[to] = probability
+			total += probability
+		}
+		if next != nil && math.Abs(total-1) > 1e-3 {
+			return nil, fmt.Errorf("schedule state %s: next state probabilities add up to %v instead of 1", state.Name, total)
+		}
+		options, err := state.phaseOptions(state.Name, args)
+		if err != nil {
+			return nil, fmt.Errorf("schedule state %s: %w", state.Name, err)
+		}
+		states = append(states, burn.MarkovState{
+			CPUs:     cpus,
+			MinDwell: minDwell,
+			MaxDwell: maxDwell,
+			Next:     next,
+			Options:  options,
+		})
+	}
+	return burn.NewMarkov(states, initial, args.Seed), nil
+}
+
+// parseDwell parses how long a schedule state lasts, either a duration or a range of them, eg 2m or
+// 1m-5m
+func parseDwell(spec string) (time.Duration, time.Duration, error) {
+	low, high, isRange := strings.Cut(spec, "-")
+	minDwell, err := time.ParseDuration(low)
+	if err != nil || minDwell <= 0 {
+		return 0, 0, fmt.Errorf("invalid dwell %q", spec)
+	}
+	if !isRange {
+		return minDwell, minDwell, nil
+	}
+	maxDwell, err := time.ParseDuration(high)
+	if err != nil || maxDwell < minDwell {
+		return 0, 0, fmt.Errorf("invalid dwell %q", spec)
+	}
+	return minDwell, maxDwell, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadStates(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		err  string
+	}{
+		{name: "valid", file: `
+initial: busy
+states:
+  - name: quiet
+    burn: 0.5
+    dwell: 1m-5m
+    next: {quiet: 0.5, busy: 0.4, spike: 0.1}
+  - name: busy
+    burn: 2
+    dwell: 2m
+    next: {quiet: 1}
+  - name: spike
+    burn: 1500m
+    dwell: 10s
+`},
+		{name: "negative probability", err: "invalid probability -0.5 for b", file: `
+states:
+  - {name: a, burn: 1, dwell: 1m, next: {a: 1.5, b: -0.5}}
+  - {name: b, burn: 1, dwell: 1m}
+`},
+		{name: "probabilities not adding up to 1", err: "add up to 0.9 instead of 1", file: `
+states:
+  - {name: a, burn: 1, dwell: 1m, next: {a: 0.5, b: 0.4}}
+  - {name: b, burn: 1, dwell: 1m}
+`},
+		{name: "probabilities over 1", err: "add up to 1.5 instead of 1", file: `
+states:
+  - {name: a, burn: 1, dwell: 1m, next: {a: 1, b: 0.5}}
+  - {name: b, burn: 1, dwell: 1m}
+`},
+		{name: "unknown next state", err: "unknown next state c", file: `
+states:
+  - {name: a, burn: 1, dwell: 1m, next: {c: 1}}
+`},
+		{name: "unknown initial state", err: "unknown initial schedule state c", file: `
+initial: c
+states:
+  - {name: a, burn: 1, dwell: 1m}
+`},
+		{name: "unnamed state", err: "schedule state 0 has no name", file: `
+states:
+  - {burn: 1, dwell: 1m}
+`},
+		{name: "state defined twice", err: "schedule state a defined twice", file: `
+states:
+  - {name: a, burn: 1, dwell: 1m}
+  - {name: a, burn: 2, dwell: 1m}
+`},
+		{name: "zero dwell", err: `invalid dwell "0s"`, file: `
+states:
+  - {name: a, burn: 1, dwell: 0s}
+`},
+		{name: "negative dwell", err: `invalid dwell "-1m"`, file: `
+states:
+  - {name: a, burn: 1, dwell: -1m}
+`},
+		{name: "missing dwell", err: `invalid dwell ""`, file: `
+states:
+  - {name: a, burn: 1}
+`},
+		{name: "invalid burn", err: "invalid burn value", file: `
+states:
+  - {name: a, burn: lots, dwell: 1m}
+`},
+	}
+	for _, test := range tests {
+		var file scheduleFile
+		if err := yaml.Unmarshal([]byte(test.file), &file); err != nil {
+			t.Fatalf("%s: invalid test file: %v", test.name, err)
+		}
+		m, err := loadStates(file, Args{Seed: 1})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: loadStates returned %v, want an error with %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: loadStates returned %v", test.name, err)
+			continue
+		}
+		// starts in the initial state, held for its dwell
+		if target := m.Target(0); target != 2 {
+			t.Errorf("%s: initial target is %v, want 2", test.name, target)
+		}
+		if _, options := m.Phase(2*time.Minute - time.Millisecond); options.Name != "busy" {
+			t.Errorf("%s: phase before the dwell is over is %s, want busy", test.name, options.Name)
+		}
+		if _, options := m.Phase(2 * time.Minute); options.Name != "quiet" {
+			t.Errorf("%s: phase once the dwell is over is %s, want quiet", test.name, options.Name)
+		}
+	}
+}
+
+func TestParseDwell(t *testing.T) {
+	tests := []struct {
+		spec     string
+		min, max time.Duration
+		valid    bool
+	}{
+		{"2m", 2 * time.Minute, 2 * time.Minute, true},
+		{"1m-5m", time.Minute, 5 * time.Minute, true},
+		{"10s-10s", 10 * time.Second, 10 * time.Second, true},
+		{"500ms-1s", 500 * time.Millisecond, time.Second, true},
+		{"", 0, 0, false},
+		{"0s", 0, 0, false},
+		{"0s-1m", 0, 0, false},
+		{"5m-1m", 0, 0, false},
+		{"1m-", 0, 0, false},
+		{"1m-x", 0, 0, false},
+		{"soon", 0, 0, false},
+	}
+	for _, test := range tests {
+		minDwell, maxDwell, err := parseDwell(test.spec)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parseDwell(%q) = %v, %v, want an error", test.spec, minDwell, maxDwell)
+			}
+			continue
+		}
+		if err != nil || minDwell != test.min || maxDwell != test.max {
+			t.Errorf("parseDwell(%q) = %v, %v, %v, want %v, %v", test.spec, minDwell, maxDwell, err, test.min, test.max)
+		}
+	}
+}
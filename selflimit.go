@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cgroupPeriod is the cfs period of the cgroup created by --self-limit, in microseconds
+const cgroupPeriod = 100000
+
+// limitCgroup is the cgroup created by --self-limit, which the process moved into from home
+type limitCgroup struct {
+	path string
+	home string
+	v2   bool
+	// enabledIn is the cgroup the cpu controller was enabled in for the limit, if any, where it is
+	// disabled again when leaving
+	enabledIn string
+}
+
+// parseSelfLimit parses a --self-limit value: a number of cpus, optionally followed by cpu or
+// cpus, or millicores as in kubernetes, eg 2cpus, 1.5 or 500m. Returns 0 when not limiting
+func parseSelfLimit(spec string) (float64, error) {
+	if spec == "" {
+		return 0, nil
+	}
+	value, scale := spec, 1.0
+	if cpus, found := strings.CutSuffix(spec, "cpus"); found {
+		value = cpus
+	} else if cpus, found := strings.CutSuffix(spec, "cpu"); found {
+		value = cpus
+	} else if millis, found := strings.CutSuffix(spec, "m"); found {
+		value, scale = millis, 0.001
+	}
+	cpus, err := strconv.ParseFloat(value, 64)
+	if err != nil || cpus*scale*cgroupPeriod < 1000 {
+		return 0, fmt.Errorf("invalid self limit value: %s: must be at least 0.01 cpus, eg 2cpus, 1.5 or 500m", spec)
+	}
+	return cpus * scale, nil
+}
+
+// enterSelfLimit moves the process, along with anything it starts from then on, into a cgroup of
+// its own with a cpu limit
+func enterSelfLimit(cpus float64) (*limitCgroup, error) {
+	c, err := enterLimitCgroup(fmt.Sprintf("cpu-burner-%d", os.Getpid()), cpus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up --self-limit: %w", err)
+	}
+	slog.Info("running under a cgroup cpu limit", "pid", os.Getpid(), "cpus", cpus, "cgroup", c.path)
+	return c, nil
+}
+
+// Leave moves the process back to the cgroup it came from and removes the one of the limit. Does
+// nothing when called again
+func (c *limitCgroup) Leave() {
+	if c == nil || c.path == "" {
+		return
+	}
+	if err := leaveLimitCgroup(c); err != nil {
+		slog.Warn("failed to remove the self limit cgroup", "pid", os.Getpid(), "cgroup", c.path, "error", err)
+	} else {
+		slog.Debug("removed the self limit cgroup", "pid", os.Getpid(), "cgroup", c.path)
+	}
+	c.path = ""
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseSelfLimit(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  float64
+		valid bool
+	}{
+		{"", 0, true},
+		{"2", 2, true},
+		{"1.5", 1.5, true},
+		{"2cpus", 2, true},
+		{"1cpu", 1, true},
+		{"0.5cpus", 0.5, true},
+		{"500m", 0.5, true},
+		{"10m", 0.01, true},
+		{"2s", 0, false},
+		{"2cpuss", 0, false},
+		{"2cpusm", 0, false},
+		{"2cores", 0, false},
+		{"cpus", 0, false},
+		{"5m0s", 0, false},
+		{"0", 0, false},
+		{"1m", 0, false},
+		{"-2", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseSelfLimit(test.spec)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parseSelfLimit(%q) = %v, want an error", test.spec, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseSelfLimit(%q) = %v, %v, want %v", test.spec, got, err, test.want)
+		}
+	}
+}
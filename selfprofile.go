@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// selfProfile records the burner own execution over the run into the --cpuprofile and
+// --traceprofile files, to be inspected with go tool pprof and go tool trace
+type selfProfile struct {
+	cpu   *os.File // nil without --cpuprofile
+	trace *os.File // nil without --traceprofile
+}
+
+func startSelfProfile(cpuPath, tracePath string) (*selfProfile, error) {
+	p := &selfProfile{}
+	if cpuPath != "" {
+		file, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+		p.cpu = file
+	}
+	if tracePath != "" {
+		file, err := os.Create(tracePath)
+		if err != nil {
+			p.Stop()
+			return nil, err
+		}
+		if err := trace.Start(file); err != nil {
+			file.Close()
+			p.Stop()
+			return nil, err
+		}
+		p.trace = file
+	}
+	return p, nil
+}
+
+// Stop stops recording and closes the files, logging where they were written
+func (p *selfProfile) Stop() {
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		p.close(p.cpu, "cpu profile written")
+		p.cpu = nil
+	}
+	if p.trace != nil {
+		trace.Stop()
+		p.close(p.trace, "execution trace written")
+		p.trace = nil
+	}
+}
+
+func (p *selfProfile) close(file *os.File, msg string) {
+	if err := errors.Join(file.Sync(), file.Close()); err != nil {
+		slog.Error("failed to write profile", "pid", os.Getpid(), "path", file.Name(), "error", err)
+		return
+	}
+	slog.Info(msg, "pid", os.Getpid(), "path", file.Name())
+}
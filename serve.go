@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/alexflint/go-arg"
+)
+
+type ServeCmd struct {
+	Address string `arg:"--address" default:"127.0.0.1:7070" help:"address to listen on for runs scheduled by the orchestrate subcommand. Listens on loopback only by default, eg use :7070 to accept coordinators from other hosts"`
+	Token   string `arg:"--token,env:CPU_BURNER_TOKEN,required" help:"shared secret coordinators must present, as a bearer token, on every request"`
+}
+
+// reportEnv makes a process report its usage samples as json lines on stdout, see reportToParent
+const reportEnv = "CPU_BURNER_REPORT"
+
+// startEnv makes a process wait until this time, in RFC 3339 format, before it starts burning
+const startEnv = "CPU_BURNER_START_AT"
+
+// reportingToParent returns whether this process was asked to report its usage to its parent
+func reportingToParent() bool {
+	return os.Getenv(reportEnv) != ""
+}
+
+// waitForStart blocks until the start time requested by the parent process, if any. Returns false
+// if the context was done before that
+func waitForStart(ctx context.Context) bool {
+	value := os.Getenv(startEnv)
+	if value == "" {
+		return true
+	}
+	startAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		slog.Warn("ignoring invalid start time", "pid", os.Getpid(), "start_at", value)
+		return true
+	}
+	return waitStart(ctx, startAt)
+}
+
+type clockResponse struct {
+	Time time.Time `json:"time"`
+}
+
+// runRequest is a run scheduled by a coordinator. It only carries burn parameters, which agents
+// turn into the command line of the run, so coordinators cannot make agents run commands or touch
+// files
+type runRequest struct {
+	Burn     string    `json:"burn,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Pattern  string    `json:"pattern,omitempty"`
+	Min      string    `json:"min,omitempty"`
+	Max      string    `json:"max,omitempty"`
+	Period   string    `json:"period,omitempty"`
+	Steps    string    `json:"steps,omitempty"`
+	LogEvery string    `json:"log_every,omitempty"`
+	StartAt  time.Time `json:"start_at"`
+}
+
+// args returns the command line of the run, failing if the parameters do not parse. Values are
+// attached to their flags so none of them is taken for another flag
+func (r runRequest) args() ([]string, error) {
+	var args []string
+	for _, opt := range []struct{ flag, value string }{
+		{"--burn", r.Burn},
+		{"--duration", r.Duration},
+		{"--pattern", r.Pattern},
+		{"--min", r.Min},
+		{"--max", r.Max},
+		{"--period", r.Period},
+		{"--steps", r.Steps},
+		{"--log-every", r.LogEvery},
+	} {
+		if opt.value != "" {
+			args = append(args, opt.flag+"="+opt.value)
+		}
+	}
+	parser, err := arg.NewParser(arg.Config{}, &Args{})
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.Parse(args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// run states reported by agents
+const (
+	runIdle    = "idle"
+	runWaiting = "waiting"
+	runBurning = "burning"
+	runDone    = "done"
+	runFailed  = "failed"
+)
+
+type runStatus struct {
+	State      string         `json:"state"`
+	Error      string         `json:"error,omitempty"`
+	StartAt    time.Time      `json:"start_at,omitzero"`
+	Sample     *processSample `json:"sample,omitempty"`
+	CPUSeconds float64        `json:"cpu_seconds"`
+}
+
+// agent runs burns scheduled by a coordinator, one at a time. Each run is a child process started
+// with the burn parameters given by the coordinator, which waits for the scheduled start time and
+// reports its usage back to the agent
+type agent struct {
+	ctx        context.Context
+	executable string
+
+	mu      sync.Mutex
+	process *os.Process
+	status  runStatus
+}
+
+// runServe runs an agent serving the given address until the context is done
+func runServe(ctx context.Context, cmd *ServeCmd) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", cmd.Address)
+	if err != nil {
+		return err
+	}
+	a := &agent{ctx: ctx, executable: executable, status: runStatus{State: runIdle}}
+	context.AfterFunc(ctx, a.Stop)
+	return serveHTTP(ctx, listener, authorize(cmd.Token, a.handler()))
+}
+
+// authorize only lets through requests bearing the shared token
+func authorize(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			slog.Warn("rejected unauthorized request", "pid", os.Getpid(), "remote", r.RemoteAddr, "path", r.URL.Path)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handler exposes the http api of the agent. Every request must bear the shared token:
+//
+//	GET    /clock returns the current time of the agent host, to estimate clock offsets
+//	POST   /run   schedules a run, eg {"burn":"2","duration":"1m","start_at":"..."}
+//	GET    /run   returns the state of the latest run along with its latest usage sample
+//	DELETE /run   stops the current run
+func (a *agent) handler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clock", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, clockResponse{Time: time.Now()})
+	})
+	mux.HandleFunc("POST /run", func(w http.ResponseWriter, r *http.Request) {
+		var req runRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+			return
+		}
+		args, err := req.args()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid burn parameters: " + err.Error()})
+			return
+		}
+		status, err := a.Start(args, req.StartAt)
+		if err != nil {
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+			return
+		}
+		slog.Info("run scheduled", "pid", os.Getpid(), "remote", r.RemoteAddr, "start_at", req.StartAt.Format(time.RFC3339Nano), "args", args)
+		writeJSON(w, http.StatusAccepted, status)
+	})
+	mux.HandleFunc("GET /run", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.Status())
+	})
+	mux.HandleFunc("DELETE /run", func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("run stop requested", "pid", os.Getpid(), "remote", r.RemoteAddr)
+		a.Stop()
+		writeJSON(w, http.StatusAccepted, a.Status())
+	})
+	return mux
+}
+
+// Start starts a run with the given arguments at the given time, failing if another one has not
+// finished yet
+func (a *agent) Start(args []string, startAt time.Time) (runStatus, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.process != nil {
+		return runStatus{}, fmt.Errorf("a run is already %s", a.state())
+	}
+	if a.ctx.Err() != nil {
+		return runStatus{}, fmt.Errorf("agent is stopping")
+	}
+	cmd := exec.Command(a.executable, args...)
+	cmd.Env = append(os.Environ(), reportEnv+"=1", startEnv+"="+startAt.Format(time.RFC3339Nano))
+	// keep the last line logged by the run, which explains why it failed when it does
+	stderr := &lastLine{}
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		return runStatus{}, err
+	}
+	a.process = cmd.Process
+	a.status = runStatus{State: runWaiting, StartAt: startAt}
+
+	go func() {
+		a.collect(stdout, cmd.Stderr)
+		err := cmd.Wait()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.process = nil
+		a.status.State = runDone
+		a.status.CPUSeconds = (cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()).Seconds()
+		if err != nil {
+			a.status.State = runFailed
+			a.status.Error = err.Error()
+			if line := stderr.String(); line != "" {
+				a.status.Error += ": " + line
+			}
+		}
+		slog.Info("run finished", "pid", os.Getpid(), "state", a.status.State, "cpu_seconds", decimal(a.status.CPUSeconds, 3))
+	}()
+	return a.status, nil
+}
+
+// collect reads the samples reported by the run until it closes its stdout. Anything else printed
+// there, like usage errors, goes to output
+func (a *agent) collect(r io.Reader, output io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var sample processSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			fmt.Fprintln(output, scanner.Text())
+			continue
+		}
+		a.mu.Lock()
+		a.status.Sample = &sample
+		a.mu.Unlock()
+	}
+}
+
+// Status returns the state of the latest run
+func (a *agent) Status() runStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := a.status
+	status.State = a.state()
+	return status
+}
+
+// state returns the state of the latest run. Must be called with a.mu held
+func (a *agent) state() string {
+	if a.status.State == runWaiting && !time.Now().Before(a.status.StartAt) {
+		return runBurning
+	}
+	return a.status.State
+}
+
+// Stop stops the current run, if any
+func (a *agent) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.process != nil {
+		stopProcess(a.process)
+	}
+}
+
+// lastLine is a writer that keeps the last complete line written to it
+type lastLine struct {
+	mu      sync.Mutex
+	pending []byte
+	last    string
+}
+
+func (l *lastLine) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = append(l.pending, p...)
+	if i := bytes.LastIndexByte(l.pending, '\n'); i >= 0 {
+		lines := bytes.Split(l.pending[:i], []byte("\n"))
+		l.last = string(lines[len(lines)-1])
+		l.pending = append([]byte(nil), l.pending[i+1:]...)
+	}
+	return len(p), nil
+}
+
+func (l *lastLine) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
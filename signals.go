@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// cancelOnSignal calls cancel once SIGINT or SIGTERM is received. After that the default behavior
+// is restored, so a second signal kills the process right away
+func cancelOnSignal(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		slog.Info("received signal, stopping", "pid", os.Getpid(), "signal", sig.String())
+		cancel()
+	}()
+}
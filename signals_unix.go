@@ -0,0 +1,117 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// handleAdjustSignals increases the burner target by step cpus on every SIGUSR1 and decreases it
+// on every SIGUSR2, until the context is done
+func handleAdjustSignals(ctx context.Context, b *burn.Burner, step float64) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			delta := step
+			if sig == syscall.SIGUSR2 {
+				delta = -step
+			}
+			slog.Debug("adjusting target by signal", "pid", os.Getpid(), "signal", sig.String(), "delta", delta)
+			b.AdjustTarget(delta)
+		}
+	}
+}
+
+// handlePauseSignals pauses the burner on SIGTSTP and resumes it on SIGCONT, until the context is done
+func handlePauseSignals(ctx context.Context, b *burn.Burner) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTSTP, syscall.SIGCONT)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGTSTP {
+				b.Pause()
+			} else {
+				b.Resume()
+			}
+		}
+	}
+}
+
+// handleReloadSignal calls reload on every SIGHUP, until the context is done
+func handleReloadSignal(ctx context.Context, reload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			reload()
+		}
+	}
+}
+
+// handleDumpSignal calls dump on every SIGQUIT, until the context is done. This replaces the
+// goroutine dump the go runtime prints and exits with, which the state dump is more useful than
+// for a burner that drifted
+func handleDumpSignal(ctx context.Context, dump func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			dump()
+		}
+	}
+}
+
+// stopProcess asks a child process to stop, letting it finish gracefully
+func stopProcess(process *os.Process) {
+	process.Signal(os.Interrupt)
+}
+
+// forwardSignals relays the given signals to the processes returned by children, until the context
+// is done
+func forwardSignals(ctx context.Context, children func() []*os.Process, sigs ...os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sigs...)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			for _, child := range children() {
+				child.Signal(sig)
+			}
+		}
+	}
+}
+
+// adjustSignals are the signals handled by handleAdjustSignals
+var adjustSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+
+// reloadSignal is the signal handled by handleReloadSignal
+var reloadSignal os.Signal = syscall.SIGHUP
+
+// dumpSignal is the signal handled by handleDumpSignal
+var dumpSignal os.Signal = syscall.SIGQUIT
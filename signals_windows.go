@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// handleAdjustSignals does nothing, as windows has no SIGUSR1 and SIGUSR2
+func handleAdjustSignals(ctx context.Context, b *burn.Burner, step float64) {}
+
+// handlePauseSignals does nothing, as windows has no SIGTSTP and SIGCONT
+func handlePauseSignals(ctx context.Context, b *burn.Burner) {
+	slog.Warn("pause signals are not supported on windows", "pid", os.Getpid())
+}
+
+// handleReloadSignal does nothing, as windows has no SIGHUP
+func handleReloadSignal(ctx context.Context, reload func()) {}
+
+// handleDumpSignal does nothing, as windows has no SIGQUIT
+func handleDumpSignal(ctx context.Context, dump func()) {}
+
+// stopProcess kills a child process, as windows cannot deliver interrupts to other processes
+func stopProcess(process *os.Process) {
+	process.Kill()
+}
+
+// forwardSignals does nothing, as there are no signals to forward on windows
+func forwardSignals(ctx context.Context, children func() []*os.Process, sigs ...os.Signal) {}
+
+// adjustSignals is empty, as windows has no SIGUSR1 and SIGUSR2
+var adjustSignals []os.Signal
+
+// reloadSignal is nil, as windows has no SIGHUP
+var reloadSignal os.Signal
+
+// dumpSignal is nil, as windows has no SIGQUIT
+var dumpSignal os.Signal
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+	"github.com/bcap/cpu-burner/client"
+)
+
+type CtlCmd struct {
+	Socket  string   `arg:"--socket" help:"path of the control socket of the burner, as given to --control-socket"`
+	Address string   `arg:"--address" help:"address of the http control api of the burner, as given to --listen, eg host:8080, instead of a control socket. Works with remote burners"`
+	Command []string `arg:"positional,required" help:"command to send: set <burn>, eg set 2.5 or set 50%; status; pause; resume; stop"`
+}
+
+const ctlTimeout = 5 * time.Second
+
+// listenControlSocket listens on a unix socket at the path, replacing a socket left behind by a
+// process that is gone. Only the user running the burner can connect to it
+func listenControlSocket(path string) (net.Listener, error) {
+	listener, err := listenUnix(path)
+	if err != nil {
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another process", path)
+		}
+		if info, statErr := os.Stat(path); statErr != nil || info.Mode()&os.ModeSocket == 0 {
+			return nil, err
+		}
+		os.Remove(path)
+		if listener, err = listenUnix(path); err != nil {
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// serveControlSocket answers the commands sent to the listener, one per line, until the context
+// is done. See runCommand for the commands
+func serveControlSocket(ctx context.Context, listener net.Listener, b *burn.Burner) {
+	context.AfterFunc(ctx, func() { listener.Close() })
+	slog.Info("control socket listening", "pid", os.Getpid(), "path", listener.Addr().String())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				slog.Error("control socket failed", "pid", os.Getpid(), "error", err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				if strings.TrimSpace(scanner.Text()) == "" {
+					continue
+				}
+				response, err := runCommand(b, scanner.Text())
+				if err != nil {
+					response = "error: " + err.Error()
+				}
+				if _, err := fmt.Fprintln(conn, response); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// commandUsage is the syntax of every control command, see runCommand
+var commandUsage = map[string]string{
+	"set":    "set <burn>",
+	"status": "status",
+	"pause":  "pause",
+	"resume": "resume",
+	"stop":   "stop",
+}
+
+// runCommand runs a control command against the burner, returning a single line response:
+//
+//	set <burn>  changes the target, in the same format as --burn
+//	status      describes the state, target and latest usage of the run
+//	pause       makes all workers go idle
+//	resume      resumes burning after a pause
+//	stop        stops the run
+func runCommand(b *burn.Burner, line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", errors.New("empty command")
+	}
+	command, params := fields[0], fields[1:]
+	usage, found := commandUsage[command]
+	if !found {
+		return "", fmt.Errorf("unknown command %q", command)
+	}
+	if len(params) != len(strings.Fields(usage))-1 {
+		return "", fmt.Errorf("usage: %s", usage)
+	}
+	switch command {
+	case "set":
+		cpus, err := parseBurn(params[0])
+		if err != nil {
+			return "", err
+		}
+		b.SetTarget(cpus)
+		return fmt.Sprintf("target %.3f cpus", cpus), nil
+	case "pause":
+		b.Pause()
+		return "paused", nil
+	case "resume":
+		b.Resume()
+		return "resumed", nil
+	case "stop":
+		slog.Info("stop requested through a command", "pid", os.Getpid())
+		b.Stop()
+		return "stopping", nil
+	default:
+		stats := b.Stats()
+		return formatStatus(b.State(), stats.Target, stats.Last.Achieved, stats.Paused, stats.Workers, stats.Uptime, stats.CPUSeconds), nil
+	}
+}
+
+// formatStatus is the response to the status command, the same whether the burner is reached
+// through its control socket or its http control api
+func formatStatus(state burn.State, target float64, achieved float64, paused bool, workers int, uptime time.Duration, cpuSeconds float64) string {
+	return fmt.Sprintf("state=%s target=%.3f achieved=%.3f paused=%t workers=%d uptime=%s cpu_seconds=%.3f",
+		state, target, achieved, paused, workers, uptime.Round(time.Millisecond), cpuSeconds)
+}
+
+// runCtl sends a command to the control socket or the http control api of a burner and writes its
+// response
+func runCtl(w io.Writer, cmd *CtlCmd) error {
+	if (cmd.Socket == "") == (cmd.Address == "") {
+		return errors.New("ctl requires either --socket or --address")
+	}
+	if cmd.Address != "" {
+		return runCtlAddress(w, cmd)
+	}
+	conn, err := net.DialTimeout("unix", cmd.Socket, ctlTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ctlTimeout))
+	if _, err := fmt.Fprintln(conn, strings.Join(cmd.Command, " ")); err != nil {
+		return err
+	}
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no response from the burner: %w", err)
+	}
+	response = strings.TrimSuffix(response, "\n")
+	if message, failed := strings.CutPrefix(response, "error: "); failed {
+		return errors.New(message)
+	}
+	_, err = fmt.Fprintln(w, response)
+	return err
+}
+
+// runCtlAddress sends a command to the http control api of a burner, writing the same responses as
+// the control socket
+func runCtlAddress(w io.Writer, cmd *CtlCmd) error {
+	command, params := cmd.Command[0], cmd.Command[1:]
+	usage, found := commandUsage[command]
+	if !found {
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if len(params) != len(strings.Fields(usage))-1 {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ctlTimeout)
+	defer cancel()
+	c := client.New(cmd.Address, nil)
+	var response string
+	switch command {
+	case "set":
+		target, err := c.SetTarget(ctx, params[0])
+		if err != nil {
+			return err
+		}
+		response = fmt.Sprintf("target %.3f cpus", target.CPUs)
+	case "pause":
+		if err := c.Pause(ctx); err != nil {
+			return err
+		}
+		response = "paused"
+	case "resume":
+		if err := c.Resume(ctx); err != nil {
+			return err
+		}
+		response = "resumed"
+	case "stop":
+		if err := c.Stop(ctx); err != nil {
+			return err
+		}
+		response = "stopping"
+	default:
+		stats, err := c.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		response = formatStatus(stats.State, stats.Target, stats.Achieved, stats.Paused, stats.Workers, time.Duration(stats.UptimeMs)*time.Millisecond, stats.CPUSeconds)
+	}
+	_, err := fmt.Fprintln(w, response)
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on a unix socket at the path, creating it readable and writable by the
+// owner alone from the start, so nobody else can connect before its mode is set. The umask is
+// process wide, so files other goroutines create meanwhile may end up more restricted, never less
+func listenUnix(path string) (net.Listener, error) {
+	previous := syscall.Umask(0o177)
+	defer syscall.Umask(previous)
+	return net.Listen("unix", path)
+}
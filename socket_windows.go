@@ -0,0 +1,9 @@
+package main
+
+import "net"
+
+// listenUnix listens on a unix socket at the path. Windows ignores its mode, its access is
+// governed by the permissions of the directory it is in
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
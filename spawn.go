@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// spawnEnv makes a process exit as soon as it starts, which is what the children of --spawn do
+// unless given a --spawn-command
+const spawnEnv = "CPU_BURNER_SPAWNED"
+
+// spawnTickEvery is how often the children due by the rate of --spawn are started
+const spawnTickEvery = 10 * time.Millisecond
+
+// spawnBurner starts short lived child processes at a target rate, stressing process creation,
+// exec and reaping alongside the cpu burn, like ci agents or cron storms do. At most maxLive
+// children run at once, so a slow command cannot pile processes up
+type spawnBurner struct {
+	rate    float64 // per second
+	maxLive int64
+	command []string
+
+	live    atomic.Int64
+	spawned atomic.Int64
+	failed  atomic.Int64
+	// skipped counts the children not started because maxLive were running. They are not made up
+	// for later
+	skipped atomic.Int64
+}
+
+// newSpawnBurner spawns children running the given command, split on spaces, or copies of this
+// executable exiting right away when empty
+func newSpawnBurner(rate float64, maxLive int, command string) (*spawnBurner, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		fields = []string{executable}
+	}
+	return &spawnBurner{rate: rate, maxLive: int64(maxLive), command: fields}, nil
+}
+
+// Run spawns children at the target rate until the context is done, then kills those still
+// running
+func (b *spawnBurner) Run(ctx context.Context, logEvery time.Duration, gate loadGate) {
+	slog.Info("spawning processes", "pid", os.Getpid(), "rate_per_sec", b.rate, "max_live", b.maxLive, "command", strings.Join(b.command, " "))
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	if logEvery > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logThroughput(ctx, "spawn usage", logEvery, namedCounter{"spawned_per_sec", &b.spawned}, namedCounter{"failed_per_sec", &b.failed}, namedCounter{"skipped_per_sec", &b.skipped})
+		}()
+	}
+
+	ticker := time.NewTicker(spawnTickEvery)
+	defer ticker.Stop()
+	start := time.Now()
+	var due int64
+	for {
+		waited, open := gate.wait(ctx)
+		if !open {
+			return
+		}
+		if waited {
+			// children due while gated are not made up for
+			start, due = time.Now(), 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for ; due < int64(b.rate*now.Sub(start).Seconds()); due++ {
+				if b.live.Load() >= b.maxLive {
+					b.skipped.Add(1)
+					continue
+				}
+				b.spawn(ctx, &wg)
+			}
+		}
+	}
+}
+
+// spawn starts a single child, reaping it once it exits
+func (b *spawnBurner) spawn(ctx context.Context, wg *sync.WaitGroup) {
+	cmd := exec.CommandContext(ctx, b.command[0], b.command[1:]...)
+	cmd.Env = append(os.Environ(), spawnEnv+"=1")
+	if err := cmd.Start(); err != nil {
+		if b.failed.Add(1) == 1 {
+			slog.Warn("failed to spawn process", "pid", os.Getpid(), "command", strings.Join(b.command, " "), "error", err)
+		}
+		return
+	}
+	b.live.Add(1)
+	b.spawned.Add(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer b.live.Add(-1)
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			b.failed.Add(1)
+		}
+	}()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// stateCheckpointEvery is how often the --state-file is written while burning
+const stateCheckpointEvery = 10 * time.Second
+
+// runState is what the --state-file holds about a run, to resume it where it left off once the
+// burner is restarted, eg after a reboot or being killed for lack of memory
+type runState struct {
+	// Args identifies the arguments of the run, so a state is never resumed by a different run
+	Args       string    `json:"args"`
+	ElapsedMs  int64     `json:"elapsed_ms"`  // into the schedule
+	CPUSeconds float64   `json:"cpu_seconds"` // over every attempt
+	Resumes    int       `json:"resumes"`
+	Finished   bool      `json:"finished"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// stateCheckpointer resumes a run from its --state-file and keeps it up to date while burning
+type stateCheckpointer struct {
+	path  string
+	mu    sync.Mutex
+	state runState
+	// prior is the state the run resumed from, zero when starting over
+	prior runState
+}
+
+// argsFingerprint identifies a run by its arguments
+func argsFingerprint(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// newStateCheckpointer reads the state file at path, if any, to resume the run from it. A state
+// left by a run with other arguments is ignored, and overwritten once burning
+func newStateCheckpointer(path string, args []string) (*stateCheckpointer, error) {
+	c := &stateCheckpointer{path: path, state: runState{Args: argsFingerprint(args)}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var prior runState
+	if err := json.Unmarshal(data, &prior); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if prior.Args != c.state.Args {
+		slog.Warn("state file is from a run with other arguments, starting over", "pid", os.Getpid(), "path", path)
+		return c, nil
+	}
+	c.prior = prior
+	c.state = prior
+	if !prior.Finished {
+		c.state.Resumes++
+	}
+	return c, nil
+}
+
+// Resuming tells whether the run resumes from a previous attempt
+func (c *stateCheckpointer) Resuming() bool {
+	return c != nil && c.prior.Args != ""
+}
+
+// Finished tells whether the run already finished in a previous attempt
+func (c *stateCheckpointer) Finished() bool {
+	return c.Resuming() && c.prior.Finished
+}
+
+// Offset is how far into the schedule the run resumes
+func (c *stateCheckpointer) Offset() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return time.Duration(c.prior.ElapsedMs) * time.Millisecond
+}
+
+// PriorCPUSeconds is the cpu time burnt by previous attempts
+func (c *stateCheckpointer) PriorCPUSeconds() float64 {
+	if c == nil {
+		return 0
+	}
+	return c.prior.CPUSeconds
+}
+
+// Run writes the state of the burner every stateCheckpointEvery until the context is done
+func (c *stateCheckpointer) Run(ctx context.Context, b *burn.Burner) {
+	ticker := time.NewTicker(stateCheckpointEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Save(b, false); err != nil {
+				slog.Error("failed to write state file", "pid", os.Getpid(), "path", c.path, "error", err)
+			}
+		}
+	}
+}
+
+// Save writes the current state of the burner, replacing the state file at once so a crash
+// while writing never leaves it truncated
+func (c *stateCheckpointer) Save(b *burn.Burner, finished bool) error {
+	stats := b.Stats()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.ElapsedMs = stats.Elapsed.Milliseconds()
+	c.state.CPUSeconds = c.prior.CPUSeconds + stats.CPUSeconds
+	c.state.Finished = finished
+	c.state.UpdatedAt = time.Now()
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := errors.Join(tmp.Sync(), tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Summarize adds the attempts the run took to the summary, returning them as log attributes too
+func (c *stateCheckpointer) Summarize(summary *runSummary) []any {
+	if !c.Resuming() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := c.state.CPUSeconds
+	summary.Resumes, summary.TotalCPUSeconds = c.state.Resumes, &total
+	return []any{"resumes", c.state.Resumes, "total_cpu_seconds", decimal(c.state.CPUSeconds, 3)}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// statsdExporter pushes usage gauges over udp to a statsd or dogstatsd agent. Labels are sent as
+// tags when using the dogstatsd format, as plain statsd has no support for them
+type statsdExporter struct {
+	address string
+	format  string
+	labels  Labels
+}
+
+func newStatsdExporter(address string, format string, labels Labels) (*statsdExporter, error) {
+	if format != "statsd" && format != "dogstatsd" {
+		return nil, fmt.Errorf("invalid statsd format %q: must be statsd or dogstatsd", format)
+	}
+	return &statsdExporter{address: address, format: format, labels: labels}, nil
+}
+
+// Run sends gauges for every sample taken by the burner until the context is done
+func (e *statsdExporter) Run(ctx context.Context, b *burn.Burner) {
+	conn, err := net.Dial("udp", e.address)
+	if err != nil {
+		slog.Error("failed to setup statsd exporter", "pid", os.Getpid(), "address", e.address, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	slog.Info("exporting metrics to statsd", "pid", os.Getpid(), "address", e.address, "format", e.format)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-samples:
+			workers := b.Stats().Workers
+			payload := e.gauge("cpu_burner.target_cpus", s.Target) +
+				e.gauge("cpu_burner.achieved_cpus", s.Achieved) +
+				e.gauge("cpu_burner.delta_pct", s.DeltaPct()) +
+				e.gauge("cpu_burner.workers", float64(workers))
+			if _, err := conn.Write([]byte(payload)); err != nil {
+				slog.Warn("failed to export metrics to statsd", "pid", os.Getpid(), "address", e.address, "error", err)
+			}
+		}
+	}
+}
+
+// gauge formats the lines setting a gauge. Plain statsd takes a signed value as a change to the
+// gauge rather than a value to set it to, so negative values are sent as a reset to 0 followed by
+// the change
+func (e *statsdExporter) gauge(name string, value float64) string {
+	var tags string
+	if e.format == "dogstatsd" && len(e.labels) > 0 {
+		pairs := make([]string, len(e.labels))
+		for i, label := range e.labels {
+			pairs[i] = label.Key + ":" + label.Value
+		}
+		tags = "|#" + strings.Join(pairs, ",")
+	}
+	line := fmt.Sprintf("%s:%g|g%s\n", name, value, tags)
+	if value < 0 {
+		line = fmt.Sprintf("%s:0|g%s\n", name, tags) + line
+	}
+	return line
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+const (
+	// stealWarnPct is the steal over a log interval past which the run warns the burn may fall short
+	stealWarnPct = 5
+	// stealCompensateEvery is the least time steal is measured over before compensating for it, as
+	// /proc/stat only counts it in clock ticks
+	stealCompensateEvery = time.Second
+)
+
+// stealMonitor tracks the cpu time the hypervisor steals from the host, which workers on an
+// oversubscribed vm lose while running, so a burn falling short of its target is explained. Steal
+// only shows once some was seen, as it stays at 0 on bare metal. It is a no-op outside of linux
+type stealMonitor struct {
+	mu        sync.Mutex
+	available bool
+	// compensating tells whether --steal-compensate makes up for the steal, which the warning
+	// suggests otherwise
+	compensating bool
+	warned       bool
+	seen         bool
+	firstSteal   time.Duration
+	firstBusy    time.Duration
+	lastSteal    time.Duration
+	lastBusy     time.Duration
+}
+
+func newStealMonitor(compensating bool) *stealMonitor {
+	m := &stealMonitor{compensating: compensating}
+	steal, busy, err := hostStealTime()
+	if err != nil {
+		slog.Debug("failed to read the cpu time stolen by the hypervisor", "pid", os.Getpid(), "error", err)
+		return m
+	}
+	m.available = true
+	m.firstSteal, m.firstBusy, m.lastSteal, m.lastBusy = steal, busy, steal, busy
+	return m
+}
+
+// Sample returns the share of the busy cpu time of the host stolen since the previous sample as log
+// attributes, warning once when it is enough to make the burn fall short. Idle time is left out,
+// as nothing can be stolen from idle cpus
+func (m *stealMonitor) Sample() []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return nil
+	}
+	steal, busy, err := hostStealTime()
+	if err != nil || busy <= m.lastBusy {
+		return nil
+	}
+	pct := float64(steal-m.lastSteal) / float64(busy-m.lastBusy) * 100
+	m.seen = m.seen || steal > m.lastSteal
+	m.lastSteal, m.lastBusy = steal, busy
+	if !m.seen {
+		return nil
+	}
+	if pct >= stealWarnPct && !m.warned {
+		m.warned = true
+		if m.compensating {
+			slog.Warn("the hypervisor is stealing cpu time, running workers longer to make up for it", "pid", os.Getpid(), "steal_pct", decimal(pct, 1))
+		} else {
+			slog.Warn("the hypervisor is stealing cpu time, the burn may fall short of the target, see --steal-compensate", "pid", os.Getpid(), "steal_pct", decimal(pct, 1))
+		}
+	}
+	return []any{"steal_pct", decimal(pct, 1)}
+}
+
+// Total returns the share of the busy cpu time of the host stolen during the run, in percent.
+// Returns false when it cannot be measured or nothing was stolen
+func (m *stealMonitor) Total() (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return 0, false
+	}
+	steal, busy, err := hostStealTime()
+	if err != nil || steal <= m.firstSteal || busy <= m.firstBusy {
+		return 0, false
+	}
+	return math.Round(float64(steal-m.firstSteal)/float64(busy-m.firstBusy)*1000) / 10, true
+}
+
+// Summarize adds the share of the busy cpu time of the host stolen during the run to the summary,
+// returning it as log attributes too. Runs nothing was stolen from leave it out
+func (m *stealMonitor) Summarize(summary *runSummary) []any {
+	pct, ok := m.Total()
+	if !ok {
+		return nil
+	}
+	summary.StealPct = &pct
+	return []any{"steal_pct", pct}
+}
+
+// compensateSteal measures the share of the busy cpu time of the host the hypervisor steals every
+// interval, until the context is done, and has the burners make up for it. Steal is measured over
+// the whole host rather than the cpus the workers run on, leaving idle cpus out as they lose
+// nothing, and rounded to whole percents so noise does not resize the pool on every interval
+func compensateSteal(ctx context.Context, every time.Duration, burners []*burn.Burner) {
+	every = max(every, stealCompensateEvery)
+	lastSteal, lastBusy, err := hostStealTime()
+	if err != nil {
+		slog.Error("failed to read the cpu time stolen by the hypervisor, not compensating for it", "pid", os.Getpid(), "error", err)
+		return
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		steal, busy, err := hostStealTime()
+		if err != nil {
+			slog.Debug("failed to read the cpu time stolen by the hypervisor", "pid", os.Getpid(), "error", err)
+			continue
+		}
+		if busy <= lastBusy {
+			continue
+		}
+		fraction := math.Round(float64(steal-lastSteal)/float64(busy-lastBusy)*100) / 100
+		lastSteal, lastBusy = steal, busy
+		for _, b := range burners {
+			b.SetSteal(fraction)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stressNGCommand is the name that makes cpu-burner take stress-ng options instead of its own, either
+// as the name of the binary, eg through a symlink, or as the first argument
+const stressNGCommand = "stress-ng"
+
+// stressNGIgnored are stress-ng options with no effect on the cpu stressor, accepted so existing
+// invocations keep working: the summary is always logged and workers always spin
+var stressNGIgnored = map[string]bool{
+	"--metrics":       true,
+	"--metrics-brief": true,
+	"--times":         true,
+	"--cpu-method":    true,
+}
+
+// stressNGArgs translates a stress-ng invocation into the chaos subcommand, which burns the same:
+// --cpu workers, each at --cpu-load percent, for --timeout. Returns false when not invoked as stress-ng
+func stressNGArgs(argv []string) ([]string, bool, error) {
+	var options []string
+	switch {
+	case filepath.Base(argv[0]) == stressNGCommand:
+		options = argv[1:]
+	case len(argv) > 1 && argv[1] == stressNGCommand:
+		options = argv[2:]
+	default:
+		return nil, false, nil
+	}
+	translated := []string{argv[0], "chaos"}
+	for i := 0; i < len(options); i++ {
+		name, value, inline := strings.Cut(options[i], "=")
+		// the value of an option either follows it or is given inline, as in --cpu=2
+		next := func() (string, error) {
+			if inline {
+				return value, nil
+			}
+			if i+1 >= len(options) {
+				return "", fmt.Errorf("stress-ng option %s requires a value", name)
+			}
+			i++
+			return options[i], nil
+		}
+		switch {
+		case name == "-c" || name == "--cpu":
+			workers, err := next()
+			if err != nil {
+				return nil, true, err
+			}
+			translated = append(translated, "--workers", workers)
+		case name == "-l" || name == "--cpu-load":
+			load, err := next()
+			if err != nil {
+				return nil, true, err
+			}
+			translated = append(translated, "--load", load)
+		case name == "-t" || name == "--timeout":
+			value, err := next()
+			if err != nil {
+				return nil, true, err
+			}
+			timeout, err := parseStressNGTimeout(value)
+			if err != nil {
+				return nil, true, err
+			}
+			translated = append(translated, "--timeout", strconv.Itoa(int(math.Ceil(timeout.Seconds()))))
+		case name == "-q" || name == "--quiet":
+			translated = append(translated, "--quiet")
+		case name == "-v" || name == "--verbose":
+			translated = append(translated, "--verbose")
+		case name == "-n" || name == "--dry-run":
+			translated = append(translated, "--dry-run")
+		case stressNGIgnored[name]:
+			if name == "--cpu-method" {
+				if _, err := next(); err != nil {
+					return nil, true, err
+				}
+			}
+		default:
+			return nil, true, fmt.Errorf("unsupported stress-ng option %s: only the cpu stressor is supported, with --cpu, --cpu-load and --timeout", name)
+		}
+	}
+	return translated, true, nil
+}
+
+// parseStressNGTimeout parses a stress-ng timeout: seconds, or a number followed by s, m, h, d or y
+func parseStressNGTimeout(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	unit := time.Second
+	number := value
+	if len(value) > 0 {
+		if u, found := units[value[len(value)-1]]; found {
+			unit, number = u, value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid stress-ng timeout value: %s", value)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// applyStressNG replaces os.Args with its translation when invoked as stress-ng, failing the way the
+// parser does on invalid options
+func applyStressNG() {
+	translated, ok, err := stressNGArgs(os.Args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(2)
+	}
+	if ok {
+		os.Args = translated
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// runSummary is the summary of the run printed by --summary-json
+type runSummary struct {
+	WallTimeMs       int64                   `json:"wall_time_ms"`
+	MeanTarget       float64                 `json:"mean_target_cpus"`
+	MeanAchieved     float64                 `json:"mean_cpus"`
+	MedianAchieved   float64                 `json:"median_cpus"`
+	P95Achieved      float64                 `json:"p95_cpus"`
+	MinAchieved      float64                 `json:"min_cpus"`
+	MaxAchieved      float64                 `json:"max_cpus"`
+	AccuracyPct      float64                 `json:"accuracy_pct"`
+	P50AbsDeltaPct   float64                 `json:"p50_abs_delta_pct"`
+	P90AbsDeltaPct   float64                 `json:"p90_abs_delta_pct"`
+	P99AbsDeltaPct   float64                 `json:"p99_abs_delta_pct"`
+	CPUSeconds       float64                 `json:"cpu_seconds"`
+	UserSeconds      float64                 `json:"user_seconds"`
+	SystemSeconds    float64                 `json:"system_seconds"`
+	Samples          int                     `json:"samples"`
+	FrozenMs         int64                   `json:"frozen_ms,omitempty"`
+	Resumes          int                     `json:"resumes,omitempty"`
+	TotalCPUSeconds  *float64                `json:"total_cpu_seconds,omitempty"`
+	Processes        int                     `json:"processes,omitempty"`
+	Restarts         *int64                  `json:"restarts,omitempty"`
+	ThrottledPeriods *int64                  `json:"throttled_periods,omitempty"`
+	ThrottledMs      *int64                  `json:"throttled_ms,omitempty"`
+	MeanMHz          *float64                `json:"mean_mhz,omitempty"`
+	PSISomeMs        *int64                  `json:"psi_some_ms,omitempty"`
+	PSIFullMs        *int64                  `json:"psi_full_ms,omitempty"`
+	CgroupPSISomeMs  *int64                  `json:"cgroup_psi_some_ms,omitempty"`
+	CgroupPSIFullMs  *int64                  `json:"cgroup_psi_full_ms,omitempty"`
+	RunqWaitMs       *int64                  `json:"runq_wait_ms,omitempty"`
+	StealPct         *float64                `json:"steal_pct,omitempty"`
+	EnergyJoules     *float64                `json:"energy_joules,omitempty"`
+	MeanWatts        *float64                `json:"mean_watts,omitempty"`
+	LatencyP50Us     *float64                `json:"latency_p50_us,omitempty"`
+	LatencyP99Us     *float64                `json:"latency_p99_us,omitempty"`
+	LatencyMaxUs     *float64                `json:"latency_max_us,omitempty"`
+	Cycles           int64                   `json:"cycles,omitempty"`
+	Instructions     int64                   `json:"instructions,omitempty"`
+	IPC              *float64                `json:"ipc,omitempty"`
+	CacheReferences  int64                   `json:"cache_references,omitempty"`
+	CacheMisses      int64                   `json:"cache_misses,omitempty"`
+	CacheMissPct     *float64                `json:"cache_miss_pct,omitempty"`
+	Iterations       int64                   `json:"iterations,omitempty"`
+	MemBytes         int64                   `json:"mem_bytes,omitempty"`
+	IOReadBytes      int64                   `json:"io_read_bytes,omitempty"`
+	IOWriteBytes     int64                   `json:"io_write_bytes,omitempty"`
+	NetSentBytes     int64                   `json:"net_sent_bytes,omitempty"`
+	NetReceivedBytes int64                   `json:"net_received_bytes,omitempty"`
+	SpawnedProcesses int64                   `json:"spawned_processes,omitempty"`
+	SpawnFailures    int64                   `json:"spawn_failures,omitempty"`
+	Groups           map[string]groupSummary `json:"groups,omitempty"`
+	Labels           map[string]string       `json:"labels,omitempty"`
+}
+
+func newRunSummary(s burn.Summary, labels Labels) runSummary {
+	summary := runSummary{
+		WallTimeMs:     s.WallTime.Milliseconds(),
+		MeanTarget:     s.MeanTarget,
+		MeanAchieved:   s.MeanAchieved,
+		MedianAchieved: s.MedianAchieved,
+		P95Achieved:    s.P95Achieved,
+		MinAchieved:    s.MinAchieved,
+		MaxAchieved:    s.MaxAchieved,
+		AccuracyPct:    s.Accuracy(),
+		P50AbsDeltaPct: s.P50AbsDeltaPct,
+		P90AbsDeltaPct: s.P90AbsDeltaPct,
+		P99AbsDeltaPct: s.P99AbsDeltaPct,
+		CPUSeconds:     s.CPUSeconds,
+		UserSeconds:    s.UserSeconds,
+		SystemSeconds:  s.SystemSeconds,
+		Samples:        s.Samples,
+		FrozenMs:       s.Frozen.Milliseconds(),
+	}
+	if len(labels) > 0 {
+		summary.Labels = map[string]string{}
+		for _, label := range labels {
+			summary.Labels[label.Key] = label.Value
+		}
+	}
+	return summary
+}
+
+// Write prints the summary as a single json document
+func (s runSummary) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// WriteLine prints the main figures of the summary as a single line of key=value pairs, using the
+// same keys as the json summary
+func (s runSummary) WriteLine(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "mean_cpus=%.3f mean_target_cpus=%.3f p95_cpus=%.3f accuracy_pct=%.1f cpu_seconds=%.3f wall_time_ms=%d samples=%d\n",
+		s.MeanAchieved, s.MeanTarget, s.P95Achieved, s.AccuracyPct, s.CPUSeconds, s.WallTimeMs, s.Samples)
+	return err
+}
+
+// parseTolerance parses the --assert-tolerance percentage into a fraction of the target
+func parseTolerance(spec string) (float64, error) {
+	value, found := strings.CutSuffix(spec, "%")
+	pct, err := strconv.ParseFloat(value, 64)
+	if !found || err != nil || pct < 0 {
+		return 0, fmt.Errorf("invalid assert tolerance value: %s: must be a percentage of the target, eg 5%%", spec)
+	}
+	return pct / 100, nil
+}
+
+// checkTolerance returns an error when the mean achieved usage of the run deviates from its mean
+// target by more than the --assert-tolerance given
+func checkTolerance(s burn.Summary, spec string) error {
+	tolerance, err := parseTolerance(spec)
+	if err != nil {
+		return err
+	}
+	if s.MeanTarget <= 0 {
+		return errors.New("the run had no target to assert against")
+	}
+	deviation := (s.MeanAchieved - s.MeanTarget) / s.MeanTarget
+	if math.Abs(deviation) > tolerance {
+		return fmt.Errorf("mean usage of %.3f cpus is %+.1f%% off the mean target of %.3f cpus, over the tolerance of %s", s.MeanAchieved, deviation*100, s.MeanTarget, spec)
+	}
+	return nil
+}
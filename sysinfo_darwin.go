@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// totalMemory returns the total amount of physical memory in the system, in bytes
+func totalMemory() (uint64, error) {
+	return unix.SysctlUint64("hw.memsize")
+}
+
+// allowedCPUs is not supported, as darwin offers no way to bind threads to specific cpus
+func allowedCPUs() (map[int]bool, error) {
+	return nil, errors.New("cpu affinity is not supported on darwin")
+}
+
+// threadSiblings is not supported on darwin
+func threadSiblings() (map[int][]int, error) {
+	return nil, errors.New("cpu topology is not supported on darwin")
+}
+
+// readTopology is not supported on darwin
+func readTopology() (cpuTopology, error) {
+	return nil, errors.New("cpu topology is not supported on darwin")
+}
+
+// numaNodes is not supported on darwin
+func numaNodes() (map[int][]int, error) {
+	return nil, errors.New("NUMA topology is not supported on darwin")
+}
+
+// cgroupCPUs always reports no limit, as cgroups only exist on linux
+func cgroupCPUs() (float64, bool, error) {
+	return 0, false, nil
+}
+
+// cgroupThrottling always reports no statistics, as cgroups only exist on linux
+func cgroupThrottling() (cpuThrottling, bool, error) {
+	return cpuThrottling{}, false, nil
+}
+
+// cpuTemperature always reports no sensor, as temperatures are only read from linux sysfs
+func cpuTemperature() (float64, bool, error) {
+	return 0, false, nil
+}
+
+// cpuFrequencies always reports no frequencies, as they are only read from linux sysfs
+func cpuFrequencies() (map[int]float64, bool, error) {
+	return nil, false, nil
+}
+
+// processCPUTime is not supported on darwin
+func processCPUTime(pid int) (time.Duration, error) {
+	return 0, errors.New("reading the cpu time of other processes is not supported on darwin")
+}
+
+// processTreeCPUTime is not supported on darwin
+func processTreeCPUTime(pid int) (time.Duration, error) {
+	return processCPUTime(pid)
+}
+
+// hostCPUTimes is not supported on darwin
+func hostCPUTimes() (time.Duration, time.Duration, int, error) {
+	return 0, 0, 0, errors.New("reading the cpu usage of the host is not supported on darwin")
+}
+
+// hostStealTime is not supported on darwin
+func hostStealTime() (time.Duration, time.Duration, error) {
+	return 0, 0, errors.New("reading the cpu time stolen by the hypervisor is not supported on darwin")
+}
+
+// perCPUTimes is not supported on darwin
+func perCPUTimes() (map[int]cpuTimes, error) {
+	return nil, errors.New("reading the usage of every cpu is not supported on darwin")
+}
+
+// loadAverage returns the 1 minute load average of the host, read from the vm.loadavg sysctl,
+// which holds the fixed point averages followed by their scale
+func loadAverage() (float64, error) {
+	data, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 24 {
+		return 0, errors.New("invalid vm.loadavg")
+	}
+	scale := binary.LittleEndian.Uint64(data[16:24])
+	if scale == 0 {
+		return 0, errors.New("invalid vm.loadavg")
+	}
+	return float64(binary.LittleEndian.Uint32(data[0:4])) / float64(scale), nil
+}
+
+// selfResources is not supported on darwin
+func selfResources() (processResources, error) {
+	return processResources{}, errors.New("reading the resources of the process is not supported on darwin")
+}
+
+// openPerfThread is not supported on darwin
+func openPerfThread(tid int) (*perfThread, error) {
+	return nil, errors.New("hardware performance counters are not supported on darwin")
+}
+
+func readPerfThread(thread *perfThread) (perfCounts, error) {
+	return perfCounts{}, errors.New("hardware performance counters are not supported on darwin")
+}
+
+func closePerfThread(thread *perfThread) {}
+
+// threadWaitTimes is not supported on darwin
+func threadWaitTimes() (map[int]time.Duration, bool, error) {
+	return nil, false, nil
+}
+
+// selfThreadIDs is not supported on darwin
+func selfThreadIDs() ([]int, error) {
+	return nil, errors.New("listing threads is not supported on darwin")
+}
+
+// enterLimitCgroup is not supported on darwin, which has no cgroups
+func enterLimitCgroup(name string, cpus float64) (*limitCgroup, error) {
+	return nil, errors.New("cgroups are not supported on darwin")
+}
+
+func leaveLimitCgroup(c *limitCgroup) error {
+	return errors.New("cgroups are not supported on darwin")
+}
+
+// raplCounters is not supported on darwin
+func raplCounters() (map[string]raplCounter, bool, error) {
+	return nil, false, nil
+}
+
+// hostCPUPressure is not supported on darwin, which has no pressure stall information
+func hostCPUPressure() (cpuPressure, bool, error) {
+	return cpuPressure{}, false, nil
+}
+
+// cgroupCPUPressure is not supported on darwin, which has no cgroups
+func cgroupCPUPressure() (cpuPressure, bool, error) {
+	return cpuPressure{}, false, nil
+}
@@ -0,0 +1,986 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// totalMemory returns the total amount of physical memory in the system, in bytes
+func totalMemory() (uint64, error) {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	return uint64(info.Totalram) * uint64(info.Unit), nil
+}
+
+// allowedCPUs returns the ids of the cpus the process is allowed to run on
+func allowedCPUs() (map[int]bool, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+	allowed := map[int]bool{}
+	for cpu := 0; cpu < maxCPUSetCPU; cpu++ {
+		if set.IsSet(cpu) {
+			allowed[cpu] = true
+		}
+	}
+	return allowed, nil
+}
+
+// numaNodes returns the cpus of each NUMA node, by node id. Systems without NUMA support report
+// every cpu as part of node 0
+func numaNodes() (map[int][]int, error) {
+	dirs, err := filepath.Glob("/sys/devices/system/node/node[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		allowed, err := allowedCPUs()
+		if err != nil {
+			return nil, err
+		}
+		var cpus []int
+		for cpu := range allowed {
+			cpus = append(cpus, cpu)
+		}
+		sort.Ints(cpus)
+		return map[int][]int{0: cpus}, nil
+	}
+	nodes := map[int][]int{}
+	for _, dir := range dirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		list := strings.TrimSpace(string(data))
+		if list == "" {
+			// memory only nodes have no cpus
+			continue
+		}
+		cpus, err := parseCPUSet(list)
+		if err != nil {
+			return nil, err
+		}
+		nodes[node] = cpus
+	}
+	return nodes, nil
+}
+
+// cgroupCPUs returns the cpu limit of the cgroup the process runs in, in cpus. Supports both
+// cgroup v2 (cpu.max) and v1 (cpu.cfs_quota_us and cpu.cfs_period_us). Returns false when the
+// cgroup has no limit
+func cgroupCPUs() (float64, bool, error) {
+	v2Paths, v1Paths, err := cgroupPaths()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, path := range v2Paths {
+		data, err := os.ReadFile(filepath.Join(cgroupRoot, path, "cpu.max"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		quota, period, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+		return cgroupQuota(quota, period)
+	}
+	for _, path := range v1Paths {
+		quota, err := os.ReadFile(filepath.Join(path, "cpu.cfs_quota_us"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		period, err := os.ReadFile(filepath.Join(path, "cpu.cfs_period_us"))
+		if err != nil {
+			return 0, false, err
+		}
+		return cgroupQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+	}
+	return 0, false, nil
+}
+
+// cgroupThrottling returns the cfs bandwidth statistics of the cgroup the process runs in, from
+// cpu.stat. Returns false when they are not available
+func cgroupThrottling() (cpuThrottling, bool, error) {
+	v2Paths, v1Paths, err := cgroupPaths()
+	if err != nil {
+		return cpuThrottling{}, false, err
+	}
+	// cgroup v2 reports throttled time in microseconds, v1 in nanoseconds
+	type statFile struct {
+		path     string
+		timeKey  string
+		timeUnit time.Duration
+	}
+	var candidates []statFile
+	for _, path := range v2Paths {
+		candidates = append(candidates, statFile{filepath.Join(cgroupRoot, path, "cpu.stat"), "throttled_usec", time.Microsecond})
+	}
+	for _, path := range v1Paths {
+		candidates = append(candidates, statFile{filepath.Join(path, "cpu.stat"), "throttled_time", time.Nanosecond})
+	}
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return cpuThrottling{}, false, err
+		}
+		stats := map[string]int64{}
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, found := strings.Cut(line, " ")
+			if !found {
+				continue
+			}
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				stats[key] = n
+			}
+		}
+		if _, found := stats["nr_throttled"]; !found {
+			// without the cpu controller enabled cpu.stat only has usage statistics
+			continue
+		}
+		return cpuThrottling{
+			periods:          stats["nr_periods"],
+			throttledPeriods: stats["nr_throttled"],
+			throttledTime:    time.Duration(stats[candidate.timeKey]) * candidate.timeUnit,
+		}, true, nil
+	}
+	return cpuThrottling{}, false, nil
+}
+
+// cgroupPaths lists where the cpu controller files of the process cgroup may be, first for
+// cgroup v2 (relative to the cgroup root) and then for cgroup v1 (absolute). Inside containers
+// the cgroup of the process is usually mounted as the root, so the root itself is also a candidate
+func cgroupPaths() ([]string, []string, error) {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var v2Paths, v1Paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// each line is hierarchy-id:controllers:path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2Paths = append(v2Paths, parts[2], "/")
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller != "cpu" {
+				continue
+			}
+			for _, mount := range []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"} {
+				v1Paths = append(v1Paths, filepath.Join(cgroupRoot, mount, parts[2]), filepath.Join(cgroupRoot, mount))
+			}
+		}
+	}
+	return v2Paths, v1Paths, scanner.Err()
+}
+
+// enterLimitCgroup creates a cgroup with a cpu limit and moves the process into it. On cgroup v2 the
+// cgroup is created next to the one of the process when the cpu controller is available there, and
+// under it otherwise, which needs the process to be alone in its cgroup, eg in a container, as
+// cgroups with controllers enabled for their children cannot have processes of their own
+func enterLimitCgroup(name string, cpus float64) (*limitCgroup, error) {
+	v2Paths, v1Paths, err := cgroupPaths()
+	if err != nil {
+		return nil, err
+	}
+	quota := int64(cpus * cgroupPeriod)
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil && len(v2Paths) > 0 {
+		c := &limitCgroup{home: filepath.Join(cgroupRoot, v2Paths[0]), v2: true}
+		parent := c.home
+		if v2Paths[0] != "/" && cgroupHasController(filepath.Dir(c.home), "cgroup.subtree_control", "cpu") {
+			parent = filepath.Dir(c.home)
+		} else if !cgroupHasController(c.home, "cgroup.controllers", "cpu") {
+			return nil, fmt.Errorf("the cpu controller is not available to cgroup %s", c.home)
+		}
+		removeStaleCgroups(parent)
+		c.path = filepath.Join(parent, name)
+		if err := os.Mkdir(c.path, 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(c.path, "cgroup.procs"), pid, 0o644); err != nil {
+			os.Remove(c.path)
+			return nil, fmt.Errorf("failed to move into cgroup %s: %w", c.path, err)
+		}
+		if !cgroupHasController(parent, "cgroup.subtree_control", "cpu") {
+			if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+cpu"), 0o644); err != nil {
+				leaveLimitCgroup(c)
+				return nil, fmt.Errorf("failed to enable the cpu controller in %s, which must have no processes besides this one: %w", parent, err)
+			}
+			c.enabledIn = parent
+		}
+		limit := fmt.Sprintf("%d %d", quota, cgroupPeriod)
+		if err := os.WriteFile(filepath.Join(c.path, "cpu.max"), []byte(limit), 0o644); err != nil {
+			leaveLimitCgroup(c)
+			return nil, fmt.Errorf("failed to set the cpu limit of %s: %w", c.path, err)
+		}
+		return c, nil
+	}
+
+	for _, home := range v1Paths {
+		if _, err := os.Stat(filepath.Join(home, "cpu.cfs_quota_us")); err != nil {
+			continue
+		}
+		removeStaleCgroups(home)
+		c := &limitCgroup{path: filepath.Join(home, name), home: home}
+		if err := os.Mkdir(c.path, 0o755); err != nil {
+			return nil, err
+		}
+		for _, setting := range [][2]string{{"cpu.cfs_period_us", strconv.Itoa(cgroupPeriod)}, {"cpu.cfs_quota_us", strconv.FormatInt(quota, 10)}} {
+			if err := os.WriteFile(filepath.Join(c.path, setting[0]), []byte(setting[1]), 0o644); err != nil {
+				os.Remove(c.path)
+				return nil, fmt.Errorf("failed to set the cpu limit of %s: %w", c.path, err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(c.path, "cgroup.procs"), pid, 0o644); err != nil {
+			os.Remove(c.path)
+			return nil, fmt.Errorf("failed to move into cgroup %s: %w", c.path, err)
+		}
+		return c, nil
+	}
+	return nil, errors.New("no cgroup with the cpu controller found")
+}
+
+// leaveLimitCgroup moves the process back to the cgroup it came from and removes the cgroup of the
+// limit, along with the cpu controller when it was enabled for it
+func leaveLimitCgroup(c *limitCgroup) error {
+	if c.enabledIn != "" {
+		if err := os.WriteFile(filepath.Join(c.enabledIn, "cgroup.subtree_control"), []byte("-cpu"), 0o644); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(c.home, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+		return err
+	}
+	return os.Remove(c.path)
+}
+
+// cgroupHasController tells whether a controller is listed in a cgroup file, either
+// cgroup.controllers for the ones available or cgroup.subtree_control for the ones enabled for
+// children
+func cgroupHasController(path string, file string, controller string) bool {
+	data, err := os.ReadFile(filepath.Join(path, file))
+	return err == nil && slices.Contains(strings.Fields(string(data)), controller)
+}
+
+// removeStaleCgroups removes the cgroups left behind by burners that exited without leaving their
+// --self-limit cgroup. Removing the ones still in use fails, as they have processes
+func removeStaleCgroups(parent string) {
+	stale, _ := filepath.Glob(filepath.Join(parent, "cpu-burner-[0-9]*"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+}
+
+// cgroupQuota converts a cfs quota and period, both in microseconds, into cpus. A quota of max
+// (v2) or -1 (v1) means the cgroup is not limited
+func cgroupQuota(quota string, period string) (float64, bool, error) {
+	if quota == "max" || quota == "-1" {
+		return 0, false, nil
+	}
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid cgroup cpu quota %q", quota)
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false, fmt.Errorf("invalid cgroup cpu period %q", period)
+	}
+	return q / p, true, nil
+}
+
+const hwmonRoot = "/sys/class/hwmon"
+const thermalZoneRoot = "/sys/class/thermal"
+
+// cpuHwmonChips are the hwmon drivers reporting cpu temperatures
+var cpuHwmonChips = map[string]bool{"coretemp": true, "k10temp": true, "zenpower": true, "cpu_thermal": true}
+
+// cpuTemperature returns the temperature of the hottest cpu sensor, in degrees celsius. Reads the
+// hwmon sensors of cpu drivers, falling back to thermal zones of cpu type. Returns false when no
+// sensor was found, eg in virtual machines
+func cpuTemperature() (float64, bool, error) {
+	var inputs []string
+	chips, err := filepath.Glob(filepath.Join(hwmonRoot, "hwmon*"))
+	if err != nil {
+		return 0, false, err
+	}
+	for _, chip := range chips {
+		name, err := os.ReadFile(filepath.Join(chip, "name"))
+		if err != nil || !cpuHwmonChips[strings.TrimSpace(string(name))] {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(chip, "temp*_input"))
+		inputs = append(inputs, files...)
+	}
+	if len(inputs) == 0 {
+		zones, err := filepath.Glob(filepath.Join(thermalZoneRoot, "thermal_zone*"))
+		if err != nil {
+			return 0, false, err
+		}
+		for _, zone := range zones {
+			kind, err := os.ReadFile(filepath.Join(zone, "type"))
+			if err != nil {
+				continue
+			}
+			if k := strings.ToLower(strings.TrimSpace(string(kind))); k == "x86_pkg_temp" || strings.Contains(k, "cpu") {
+				inputs = append(inputs, filepath.Join(zone, "temp"))
+			}
+		}
+	}
+
+	hottest, found := 0.0, false
+	for _, input := range inputs {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			continue
+		}
+		// sysfs reports millidegrees
+		millis, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue
+		}
+		if celsius := float64(millis) / 1000; !found || celsius > hottest {
+			hottest, found = celsius, true
+		}
+	}
+	return hottest, found, nil
+}
+
+const cpuRoot = "/sys/devices/system/cpu"
+
+// perfEvents are the hardware events opened for every thread by --perf-counters, in the order
+// perfCounts holds them
+var perfEvents = []uint64{
+	unix.PERF_COUNT_HW_CPU_CYCLES,
+	unix.PERF_COUNT_HW_INSTRUCTIONS,
+	unix.PERF_COUNT_HW_CACHE_REFERENCES,
+	unix.PERF_COUNT_HW_CACHE_MISSES,
+}
+
+// openPerfThread opens the hardware events of a thread as a single group, so they are counted over
+// the same time when the pmu has to multiplex them. Only user space is counted, which is allowed
+// unprivileged up to a perf_event_paranoid of 2
+func openPerfThread(tid int) (*perfThread, error) {
+	thread := &perfThread{}
+	for _, event := range perfEvents {
+		attr := unix.PerfEventAttr{
+			Type:        unix.PERF_TYPE_HARDWARE,
+			Config:      event,
+			Read_format: unix.PERF_FORMAT_GROUP | unix.PERF_FORMAT_TOTAL_TIME_ENABLED | unix.PERF_FORMAT_TOTAL_TIME_RUNNING,
+			Bits:        unix.PerfBitExcludeKernel | unix.PerfBitExcludeHv,
+		}
+		attr.Size = uint32(unsafe.Sizeof(attr))
+		leader := -1
+		if len(thread.fds) > 0 {
+			leader = thread.fds[0]
+		}
+		fd, err := unix.PerfEventOpen(&attr, tid, -1, leader, unix.PERF_FLAG_FD_CLOEXEC)
+		if err != nil {
+			closePerfThread(thread)
+			return nil, fmt.Errorf("failed to open hardware performance counters, which needs a pmu and a perf_event_paranoid of 2 or less: %w", err)
+		}
+		thread.fds = append(thread.fds, fd)
+	}
+	return thread, nil
+}
+
+// readPerfThread returns what the events of a thread counted so far, scaled up to the whole time
+// they were enabled when multiplexed
+func readPerfThread(thread *perfThread) (perfCounts, error) {
+	// the number of events, the time enabled and running, then a value per event
+	buf := make([]byte, 8*(3+len(perfEvents)))
+	if _, err := unix.Read(thread.fds[0], buf); err != nil {
+		return perfCounts{}, err
+	}
+	values := make([]float64, 3+len(perfEvents))
+	for i := range values {
+		values[i] = float64(binary.NativeEndian.Uint64(buf[i*8:]))
+	}
+	enabled, running := values[1], values[2]
+	if running == 0 {
+		return thread.last, nil
+	}
+	scale := enabled / running
+	return perfCounts{
+		cycles:          values[3] * scale,
+		instructions:    values[4] * scale,
+		cacheReferences: values[5] * scale,
+		cacheMisses:     values[6] * scale,
+	}, nil
+}
+
+func closePerfThread(thread *perfThread) {
+	for _, fd := range thread.fds {
+		unix.Close(fd)
+	}
+	thread.fds = nil
+}
+
+// threadWaitTimes returns how long every thread of the process spent runnable but waiting for a
+// cpu so far, by thread id, from the second field of its schedstat. Returns false when the kernel
+// has no schedstats
+func threadWaitTimes() (map[int]time.Duration, bool, error) {
+	tids, err := selfThreadIDs()
+	if err != nil {
+		return nil, false, err
+	}
+	waits := make(map[int]time.Duration, len(tids))
+	for _, tid := range tids {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/self/task/%d/schedstat", tid))
+		if errors.Is(err, os.ErrNotExist) {
+			// either the thread exited since it was listed, or there are no schedstats at all
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			return nil, false, fmt.Errorf("invalid schedstat: %q", data)
+		}
+		wait, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid schedstat: %q", data)
+		}
+		waits[tid] = time.Duration(wait)
+	}
+	return waits, len(waits) > 0, nil
+}
+
+// selfThreadIDs returns the id of every thread of the process
+func selfThreadIDs() ([]int, error) {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	var tids []int
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
+
+const powercapRoot = "/sys/class/powercap"
+
+// raplCounters returns the energy counters of the rapl package zones, by zone. Sub zones, such as
+// core or dram, are already accounted in their package. Returns false when the host has none
+func raplCounters() (map[string]raplCounter, bool, error) {
+	zones, err := filepath.Glob(filepath.Join(powercapRoot, "*-rapl:*"))
+	if err != nil {
+		return nil, false, err
+	}
+	counters := map[string]raplCounter{}
+	for _, zone := range zones {
+		name, err := os.ReadFile(filepath.Join(zone, "name"))
+		if err != nil || !strings.HasPrefix(string(name), "package") {
+			continue
+		}
+		readUint := func(file string) (uint64, error) {
+			data, err := os.ReadFile(filepath.Join(zone, file))
+			if err != nil {
+				return 0, err
+			}
+			return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		}
+		energy, err := readUint("energy_uj")
+		if err != nil {
+			return nil, false, err
+		}
+		maxRange, err := readUint("max_energy_range_uj")
+		if err != nil {
+			return nil, false, err
+		}
+		counters[filepath.Base(zone)] = raplCounter{energy: energy, maxRange: maxRange}
+	}
+	return counters, len(counters) > 0, nil
+}
+
+// cpuFrequencies returns the current frequency of every cpu with cpufreq support, in MHz, by cpu
+// id. Returns false when cpufreq is not available, eg in most virtual machines
+func cpuFrequencies() (map[int]float64, bool, error) {
+	files, err := filepath.Glob(filepath.Join(cpuRoot, "cpu[0-9]*", "cpufreq", "scaling_cur_freq"))
+	if err != nil {
+		return nil, false, err
+	}
+	frequencies := map[int]float64{}
+	for _, file := range files {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(filepath.Dir(file))), "cpu"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		// cpufreq reports kHz
+		khz, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue
+		}
+		frequencies[cpu] = float64(khz) / 1000
+	}
+	return frequencies, len(frequencies) > 0, nil
+}
+
+// threadSiblings returns the hardware threads sharing a physical core with every cpu, itself
+// included, by cpu id. Cpus without smt have no siblings but themselves
+func threadSiblings() (map[int][]int, error) {
+	files, err := filepath.Glob(filepath.Join(cpuRoot, "cpu[0-9]*", "topology", "thread_siblings_list"))
+	if err != nil {
+		return nil, err
+	}
+	siblings := map[int][]int{}
+	for _, file := range files {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(filepath.Dir(file))), "cpu"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := parseCPUSet(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		siblings[cpu] = cpus
+	}
+	if len(siblings) == 0 {
+		return nil, errors.New("no cpu topology found in " + cpuRoot)
+	}
+	return siblings, nil
+}
+
+// readTopology returns where every cpu of the host sits, read from the topology and cache
+// directories of every cpu in sysfs
+func readTopology() (cpuTopology, error) {
+	dirs, err := filepath.Glob(filepath.Join(cpuRoot, "cpu[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	readInt := func(path string) (int, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	var topology cpuTopology
+	for _, dir := range dirs {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "cpu"))
+		if err != nil {
+			continue
+		}
+		socket, err := readInt(filepath.Join(dir, "topology", "physical_package_id"))
+		if err != nil {
+			// offline cpus have no topology
+			continue
+		}
+		core, err := readInt(filepath.Join(dir, "topology", "core_id"))
+		if err != nil {
+			return nil, err
+		}
+		// older kernels have no dies, which is the same as a single one per socket
+		die, _ := readInt(filepath.Join(dir, "topology", "die_id"))
+		l := cpuLocation{cpu: cpu, socket: socket, die: die, core: core, l3: -1}
+		caches, _ := filepath.Glob(filepath.Join(dir, "cache", "index[0-9]*"))
+		for _, cache := range caches {
+			if level, err := readInt(filepath.Join(cache, "level")); err != nil || level != 3 {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(cache, "shared_cpu_list"))
+			if err != nil {
+				return nil, err
+			}
+			shared, err := parseCPUSet(strings.TrimSpace(string(data)))
+			if err != nil {
+				return nil, err
+			}
+			l.l3 = slices.Min(shared)
+		}
+		topology = append(topology, l)
+	}
+	if len(topology) == 0 {
+		return nil, errors.New("no cpu topology found in " + cpuRoot)
+	}
+	sort.Slice(topology, func(i, j int) bool { return topology[i].cpu < topology[j].cpu })
+	return topology, nil
+}
+
+// clockTicks is the unit of the cpu times in /proc, USER_HZ, which is 100 on every architecture
+// linux supports
+const clockTicks = 100
+
+// processStat is what the cpu time readers need from /proc/<pid>/stat, times in clock ticks
+type processStat struct {
+	ppid                         int
+	utime, stime, cutime, cstime int64
+}
+
+func readProcessStat(pid int) (processStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return processStat{}, err
+	}
+	// the command name is in parentheses and may contain spaces, fields are counted from its end
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return processStat{}, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 15 {
+		return processStat{}, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	if fields[0] == "Z" || fields[0] == "X" {
+		return processStat{}, errors.New("process exited")
+	}
+	var stat processStat
+	var errs [5]error
+	stat.ppid, errs[0] = strconv.Atoi(fields[1])
+	stat.utime, errs[1] = strconv.ParseInt(fields[11], 10, 64)
+	stat.stime, errs[2] = strconv.ParseInt(fields[12], 10, 64)
+	stat.cutime, errs[3] = strconv.ParseInt(fields[13], 10, 64)
+	stat.cstime, errs[4] = strconv.ParseInt(fields[14], 10, 64)
+	if err := errors.Join(errs[:]...); err != nil {
+		return processStat{}, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	return stat, nil
+}
+
+// processCPUTime returns the user and system cpu time consumed so far by the given process
+func processCPUTime(pid int) (time.Duration, error) {
+	stat, err := readProcessStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(stat.utime+stat.stime) * time.Second / clockTicks, nil
+}
+
+// processTreeCPUTime returns the user and system cpu time consumed so far by the given process and
+// all its descendants. Descendants that exited count too, once their parent in the tree waited for
+// them, as the kernel then adds their time to it
+func processTreeCPUTime(pid int) (time.Duration, error) {
+	root, err := readProcessStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+	stats := map[int]processStat{pid: root}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		other, err := strconv.Atoi(entry.Name())
+		if err != nil || other == pid {
+			continue
+		}
+		// processes come and go while walking /proc, those gone are simply left out
+		stat, err := readProcessStat(other)
+		if err != nil {
+			continue
+		}
+		stats[other] = stat
+		children[stat.ppid] = append(children[stat.ppid], other)
+	}
+	var ticks int64
+	for pending := []int{pid}; len(pending) > 0; {
+		current := pending[len(pending)-1]
+		pending = append(pending[:len(pending)-1], children[current]...)
+		stat := stats[current]
+		ticks += stat.utime + stat.stime + stat.cutime + stat.cstime
+	}
+	return time.Duration(ticks) * time.Second / clockTicks, nil
+}
+
+// hostCPUTimes returns the cpu time all processes of the host consumed so far, in total and
+// including idle time, along with the amount of cpus of the host. Read from /proc/stat, which
+// covers the whole host even inside containers
+func hostCPUTimes() (time.Duration, time.Duration, int, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer file.Close()
+	var busy, total int64
+	cpus := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		busy, total, err = parseCPUTicks(fields)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, 0, err
+	}
+	if total == 0 || cpus == 0 {
+		return 0, 0, 0, errors.New("invalid /proc/stat")
+	}
+	return time.Duration(busy) * time.Second / clockTicks, time.Duration(total) * time.Second / clockTicks, cpus, nil
+}
+
+// hostStealTime returns the cpu time the hypervisor stole from the host so far, running other
+// guests while this one had work to run, along with the busy cpu time of the host, which includes
+// the steal and leaves idle time out. Read from the steal column of /proc/stat, which stays at 0
+// on bare metal
+func hostStealTime() (time.Duration, time.Duration, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		busy, _, err := parseCPUTicks(fields)
+		if err != nil {
+			return 0, 0, err
+		}
+		steal, err := strconv.ParseInt(fields[8], 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("invalid /proc/stat")
+		}
+		return time.Duration(steal) * time.Second / clockTicks, time.Duration(busy) * time.Second / clockTicks, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, errors.New("invalid /proc/stat")
+}
+
+// perCPUTimes returns the cpu time every cpu of the host spent busy so far, and in total including
+// idle time, by cpu id. Read from /proc/stat, which covers the whole host even inside containers
+func perCPUTimes() (map[int]cpuTimes, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	times := map[int]cpuTimes{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		cpu, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu"))
+		if err != nil {
+			return nil, errors.New("invalid /proc/stat")
+		}
+		busy, total, err := parseCPUTicks(fields)
+		if err != nil {
+			return nil, err
+		}
+		times[cpu] = cpuTimes{busy: time.Duration(busy) * time.Second / clockTicks, total: time.Duration(total) * time.Second / clockTicks}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return nil, errors.New("invalid /proc/stat")
+	}
+	return times, nil
+}
+
+// parseCPUTicks parses a cpu line of /proc/stat into the clock ticks spent busy and in total
+func parseCPUTicks(fields []string) (int64, int64, error) {
+	// user nice system idle iowait irq softirq steal, guest time is already part of user
+	if len(fields) < 9 {
+		return 0, 0, errors.New("invalid /proc/stat")
+	}
+	var busy, total int64
+	for i, field := range fields[1:9] {
+		ticks, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("invalid /proc/stat")
+		}
+		total += ticks
+		if i != 3 && i != 4 {
+			busy += ticks
+		}
+	}
+	return busy, total, nil
+}
+
+// loadAverage returns the 1 minute load average of the host, read from /proc/loadavg
+func loadAverage() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, errors.New("invalid /proc/loadavg")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, errors.New("invalid /proc/loadavg")
+	}
+	return load, nil
+}
+
+// selfResources returns the resident memory and threads of this process, read from
+// /proc/self/status, along with its context switches so far. Switches come from getrusage, as
+// /proc/self/status only counts those of the main thread
+func selfResources() (processResources, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return processResources{}, err
+	}
+	var r processResources
+	found := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || (key != "VmRSS" && key != "Threads") {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if key == "VmRSS" {
+			// reported in kB
+			r.rssBytes = n * 1024
+		} else {
+			r.threads = n
+		}
+		found++
+	}
+	if found < 2 {
+		return processResources{}, errors.New("invalid /proc/self/status")
+	}
+	var usage unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &usage); err != nil {
+		return processResources{}, err
+	}
+	r.voluntarySwitches, r.involuntarySwitches = int64(usage.Nvcsw), int64(usage.Nivcsw)
+	return r, nil
+}
+
+// hostCPUPressure returns the cpu pressure of the whole host, from /proc/pressure/cpu. Returns
+// false when the kernel has no pressure stall information
+func hostCPUPressure() (cpuPressure, bool, error) {
+	data, err := os.ReadFile("/proc/pressure/cpu")
+	if errors.Is(err, os.ErrNotExist) {
+		return cpuPressure{}, false, nil
+	}
+	if err != nil {
+		return cpuPressure{}, false, err
+	}
+	p, err := parsePressure(string(data))
+	return p, err == nil, err
+}
+
+// cgroupCPUPressure returns the cpu pressure of the cgroup the process runs in, from cpu.pressure.
+// Only cgroup v2 has it. Returns false when it is not available
+func cgroupCPUPressure() (cpuPressure, bool, error) {
+	v2Paths, _, err := cgroupPaths()
+	if err != nil {
+		return cpuPressure{}, false, err
+	}
+	for _, path := range v2Paths {
+		data, err := os.ReadFile(filepath.Join(cgroupRoot, path, "cpu.pressure"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return cpuPressure{}, false, err
+		}
+		p, err := parsePressure(string(data))
+		return p, err == nil, err
+	}
+	return cpuPressure{}, false, nil
+}
+
+// parsePressure parses a psi file, made of some and full lines such as
+//
+//	some avg10=1.53 avg60=0.87 avg300=0.28 total=1234567
+//
+// with totals in microseconds. Older kernels have no full line for cpu
+func parsePressure(data string) (cpuPressure, error) {
+	var p cpuPressure
+	found := false
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var avg10, total float64
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return cpuPressure{}, fmt.Errorf("invalid pressure line %q", line)
+			}
+			switch key {
+			case "avg10":
+				avg10 = n
+			case "total":
+				total = n
+			}
+		}
+		switch fields[0] {
+		case "some":
+			p.someAvg10, p.someTotal = avg10, time.Duration(total)*time.Microsecond
+			found = true
+		case "full":
+			p.fullAvg10, p.fullTotal = avg10, time.Duration(total)*time.Microsecond
+		}
+	}
+	if !found {
+		return cpuPressure{}, errors.New("invalid pressure file: no some line")
+	}
+	return p, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+var globalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+var getSystemTimes = kernel32.NewProc("GetSystemTimes")
+
+// memoryStatusEx mirrors the MEMORYSTATUSEX struct filled in by GlobalMemoryStatusEx
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// totalMemory returns the total amount of physical memory in the system, in bytes
+func totalMemory() (uint64, error) {
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	if ok, _, err := globalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ok == 0 {
+		return 0, err
+	}
+	return status.totalPhys, nil
+}
+
+// allowedCPUs is not supported, as cpu affinity is only supported on linux
+func allowedCPUs() (map[int]bool, error) {
+	return nil, errors.New("cpu affinity is not supported on windows")
+}
+
+// threadSiblings is not supported on windows
+func threadSiblings() (map[int][]int, error) {
+	return nil, errors.New("cpu topology is not supported on windows")
+}
+
+// openPerfThread is not supported on windows
+func openPerfThread(tid int) (*perfThread, error) {
+	return nil, errors.New("hardware performance counters are not supported on windows")
+}
+
+func readPerfThread(thread *perfThread) (perfCounts, error) {
+	return perfCounts{}, errors.New("hardware performance counters are not supported on windows")
+}
+
+func closePerfThread(thread *perfThread) {}
+
+// threadWaitTimes is not supported on windows
+func threadWaitTimes() (map[int]time.Duration, bool, error) {
+	return nil, false, nil
+}
+
+// selfThreadIDs is not supported on windows
+func selfThreadIDs() ([]int, error) {
+	return nil, errors.New("listing threads is not supported on windows")
+}
+
+// enterLimitCgroup is not supported on windows, which has no cgroups
+func enterLimitCgroup(name string, cpus float64) (*limitCgroup, error) {
+	return nil, errors.New("cgroups are not supported on windows")
+}
+
+func leaveLimitCgroup(c *limitCgroup) error {
+	return errors.New("cgroups are not supported on windows")
+}
+
+// raplCounters is not supported on windows
+func raplCounters() (map[string]raplCounter, bool, error) {
+	return nil, false, nil
+}
+
+// readTopology is not supported on windows
+func readTopology() (cpuTopology, error) {
+	return nil, errors.New("cpu topology is not supported on windows")
+}
+
+// numaNodes is not supported on windows
+func numaNodes() (map[int][]int, error) {
+	return nil, errors.New("NUMA topology is not supported on windows")
+}
+
+// cgroupCPUs always reports no limit, as cgroups only exist on linux
+func cgroupCPUs() (float64, bool, error) {
+	return 0, false, nil
+}
+
+// cgroupThrottling always reports no statistics, as cgroups only exist on linux
+func cgroupThrottling() (cpuThrottling, bool, error) {
+	return cpuThrottling{}, false, nil
+}
+
+// cpuTemperature always reports no sensor, as temperatures are only read from linux sysfs
+func cpuTemperature() (float64, bool, error) {
+	return 0, false, nil
+}
+
+// cpuFrequencies always reports no frequencies, as they are only read from linux sysfs
+func cpuFrequencies() (map[int]float64, bool, error) {
+	return nil, false, nil
+}
+
+// processCPUTime returns the user and system cpu time consumed so far by the given process
+func processCPUTime(pid int) (time.Duration, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(handle)
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	if exit.HighDateTime != 0 || exit.LowDateTime != 0 {
+		return 0, errors.New("process exited")
+	}
+	// filetimes are in 100ns units
+	ticks := func(ft windows.Filetime) int64 { return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime) }
+	return time.Duration(ticks(kernel)+ticks(user)) * 100, nil
+}
+
+// processTreeCPUTime returns the cpu time consumed so far by the given process only, descendants
+// are not tracked on windows
+func processTreeCPUTime(pid int) (time.Duration, error) {
+	return processCPUTime(pid)
+}
+
+// hostCPUTimes returns the cpu time all processes of the host consumed so far, in total and
+// including idle time, along with the amount of cpus of the host
+func hostCPUTimes() (time.Duration, time.Duration, int, error) {
+	var idle, kernel, user windows.Filetime
+	if ok, _, err := getSystemTimes.Call(uintptr(unsafe.Pointer(&idle)), uintptr(unsafe.Pointer(&kernel)), uintptr(unsafe.Pointer(&user))); ok == 0 {
+		return 0, 0, 0, err
+	}
+	// filetimes are in 100ns units, and kernel time includes idle time
+	ticks := func(ft windows.Filetime) int64 { return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime) }
+	total := time.Duration(ticks(kernel)+ticks(user)) * 100
+	return total - time.Duration(ticks(idle))*100, total, runtime.NumCPU(), nil
+}
+
+// hostStealTime is not supported on windows
+func hostStealTime() (time.Duration, time.Duration, error) {
+	return 0, 0, errors.New("reading the cpu time stolen by the hypervisor is not supported on windows")
+}
+
+// perCPUTimes is not supported on windows
+func perCPUTimes() (map[int]cpuTimes, error) {
+	return nil, errors.New("reading the usage of every cpu is not supported on windows")
+}
+
+// loadAverage is not supported on windows, which has no load average
+func loadAverage() (float64, error) {
+	return 0, errors.New("load average is not supported on windows")
+}
+
+// selfResources is not supported on windows
+func selfResources() (processResources, error) {
+	return processResources{}, errors.New("reading the resources of the process is not supported on windows")
+}
+
+// hostCPUPressure is not supported on windows, which has no pressure stall information
+func hostCPUPressure() (cpuPressure, bool, error) {
+	return cpuPressure{}, false, nil
+}
+
+// cgroupCPUPressure is not supported on windows, which has no cgroups
+func cgroupCPUPressure() (cpuPressure, bool, error) {
+	return cpuPressure{}, false, nil
+}
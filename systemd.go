@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// sdNotifier tells systemd how the run is going when the burner runs as a unit of type notify:
+// that it is ready once workers started, its usage as the unit status, and that it is still alive
+// through watchdog heartbeats when the unit has WatchdogSec
+type sdNotifier struct {
+	conn     net.Conn
+	watchdog time.Duration // 0 when the unit has no watchdog
+
+	mu         sync.Mutex
+	lastSample time.Time
+}
+
+// newSDNotifier connects to the notification socket of systemd, returning nil when not run by
+// systemd. The environment it is given through is cleared, so commands and --processes children
+// do not notify on behalf of the unit
+func newSDNotifier() *sdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	watchdog := time.Duration(0)
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		if pid := os.Getenv("WATCHDOG_PID"); pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	os.Unsetenv("NOTIFY_SOCKET")
+	os.Unsetenv("WATCHDOG_USEC")
+	os.Unsetenv("WATCHDOG_PID")
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		slog.Warn("failed to connect to the systemd notification socket", "pid", os.Getpid(), "socket", socket, "error", err)
+		return nil
+	}
+	slog.Debug("notifying systemd", "pid", os.Getpid(), "socket", socket, "watchdog_ms", watchdog.Milliseconds())
+	return &sdNotifier{conn: conn, watchdog: watchdog, lastSample: time.Now()}
+}
+
+// Notify sends a state to systemd, eg READY=1. Does nothing when not run by systemd
+func (n *sdNotifier) Notify(state string) {
+	if n == nil {
+		return
+	}
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		slog.Debug("failed to notify systemd", "pid", os.Getpid(), "state", state, "error", err)
+	}
+}
+
+// Usage reports a sample of usage as the status of the unit, which also tells the watchdog the
+// burner is still measuring itself
+func (n *sdNotifier) Usage(s burn.Sample) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.lastSample = time.Now()
+	n.mu.Unlock()
+	n.Notify(fmt.Sprintf("STATUS=burning %.3f cpus of a %.3f target (%s)", s.Achieved, s.Target, percent(s.DeltaPct())))
+}
+
+// Follow reports every sample of the burner as the status of the unit until the context is done
+func (n *sdNotifier) Follow(ctx context.Context, b *burn.Burner) {
+	if n == nil {
+		return
+	}
+	samples, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-samples:
+			n.Usage(s)
+		}
+	}
+}
+
+// Watchdog sends heartbeats at half the watchdog interval until the context is done, as long as
+// usage was sampled within the last few sample intervals. A burner stuck long enough to stop
+// sampling then misses its heartbeats and gets restarted by systemd
+func (n *sdNotifier) Watchdog(ctx context.Context, sampleEvery time.Duration) {
+	if n == nil || n.watchdog == 0 {
+		return
+	}
+	stale := max(3*sampleEvery, n.watchdog)
+	ticker := time.NewTicker(n.watchdog / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n.mu.Lock()
+		since := time.Since(n.lastSample)
+		n.mu.Unlock()
+		if since > stale {
+			slog.Warn("usage was not sampled recently, skipping the systemd watchdog heartbeat", "pid", os.Getpid(), "since_ms", since.Milliseconds())
+			continue
+		}
+		n.Notify("WATCHDOG=1")
+	}
+}
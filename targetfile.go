@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// targetFileCheckEvery is how often the --target-file is read for changes
+const targetFileCheckEvery = time.Second
+
+// watchTargetFile sets the target to the contents of the file whenever they change, until the
+// context is done. A missing or empty file leaves the target alone, so the file can be created
+// later on, once the run needs steering. Contents accept the same syntax as --burn
+func watchTargetFile(ctx context.Context, b *burn.Burner, path string) {
+	ticker := time.NewTicker(targetFileCheckEvery)
+	defer ticker.Stop()
+	previous := ""
+	for {
+		data, err := os.ReadFile(path)
+		value := strings.TrimSpace(string(data))
+		if err == nil && value != "" && value != previous {
+			if cpus, err := parseBurn(value); err != nil {
+				slog.Warn("invalid target file, keeping the current target", "pid", os.Getpid(), "path", path, "error", err)
+			} else {
+				b.SetTarget(cpus * processShare())
+			}
+		}
+		previous = value
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
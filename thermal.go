@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// thermalCheckEvery is how often the thermal guard reads the cpu temperature
+const thermalCheckEvery = time.Second
+
+// thermalHysteresis is how many degrees below the limit the temperature must fall before a paused
+// burn resumes, so it does not flap around the limit
+const thermalHysteresis = 5.0
+
+// thermal guard actions taken once the temperature goes over the limit
+const (
+	thermalPause = "pause"
+	thermalStop  = "stop"
+)
+
+// thermalGuard keeps the cpu temperature under a limit, pausing the burn while it is over it or
+// stopping the run altogether
+type thermalGuard struct {
+	limit  float64
+	action string
+}
+
+func newThermalGuard(maxTemp string, action string) (*thermalGuard, error) {
+	limit, err := parseTemperature(maxTemp)
+	if err != nil {
+		return nil, err
+	}
+	if action != thermalPause && action != thermalStop {
+		return nil, fmt.Errorf("invalid max temp action value: %s", action)
+	}
+	return &thermalGuard{limit: limit, action: action}, nil
+}
+
+// parseTemperature parses a temperature in degrees celsius, eg 85C or 85
+func parseTemperature(value string) (float64, error) {
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(value), "C"), "°")
+	celsius, err := strconv.ParseFloat(number, 64)
+	if err != nil || celsius <= 0 {
+		return 0, fmt.Errorf("invalid max temp value: %s", value)
+	}
+	return celsius, nil
+}
+
+// Run checks the cpu temperature until the context is done. The burn is only resumed if it was
+// the guard that paused it
+func (g *thermalGuard) Run(ctx context.Context, b *burn.Burner) {
+	if _, found, err := cpuTemperature(); err != nil {
+		slog.Warn("failed to read cpu temperature, --max-temp has no effect", "pid", os.Getpid(), "error", err)
+		return
+	} else if !found {
+		slog.Warn("no cpu temperature sensor found, --max-temp has no effect", "pid", os.Getpid())
+		return
+	}
+	ticker := time.NewTicker(thermalCheckEvery)
+	defer ticker.Stop()
+	paused := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		celsius, found, err := cpuTemperature()
+		if err != nil || !found {
+			slog.Debug("failed to read cpu temperature", "pid", os.Getpid(), "error", err)
+			continue
+		}
+		switch {
+		case celsius >= g.limit && g.action == thermalStop:
+			slog.Error("cpu temperature over the limit, stopping", "pid", os.Getpid(), "celsius", decimal(celsius, 1), "max_celsius", decimal(g.limit, 1))
+			b.Stop()
+			return
+		case celsius >= g.limit && !paused && !b.Paused():
+			slog.Warn("cpu temperature over the limit, pausing", "pid", os.Getpid(), "celsius", decimal(celsius, 1), "max_celsius", decimal(g.limit, 1))
+			b.Pause()
+			paused = true
+		case celsius <= g.limit-thermalHysteresis && paused:
+			slog.Info("cpu temperature back under the limit, resuming", "pid", os.Getpid(), "celsius", decimal(celsius, 1), "max_celsius", decimal(g.limit, 1))
+			b.Resume()
+			paused = false
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// throttledExitCode is the exit status of runs failed by --fail-on-throttle, telling them apart
+// from other failures
+const throttledExitCode = 3
+
+// throttleCheckEvery is how often --fail-on-throttle checks for throttling
+const throttleCheckEvery = time.Second
+
+// cpuThrottling holds the cfs bandwidth statistics of a cgroup: how many enforcement periods went
+// by, in how many of them the cgroup was throttled for exceeding its cpu limit and for how long
+type cpuThrottling struct {
+	periods          int64
+	throttledPeriods int64
+	throttledTime    time.Duration
+}
+
+func (t cpuThrottling) sub(other cpuThrottling) cpuThrottling {
+	return cpuThrottling{
+		periods:          t.periods - other.periods,
+		throttledPeriods: t.throttledPeriods - other.throttledPeriods,
+		throttledTime:    t.throttledTime - other.throttledTime,
+	}
+}
+
+// throttleMonitor tracks the throttling of the cgroup the process runs in over the run. It is a
+// no-op when the cgroup has no cpu limit, as then it is never throttled, or when there are no
+// cgroups at all, eg outside of linux
+type throttleMonitor struct {
+	mu        sync.Mutex
+	available bool
+	warned    bool
+	start     cpuThrottling
+	last      cpuThrottling
+}
+
+func newThrottleMonitor() *throttleMonitor {
+	m := &throttleMonitor{}
+	if _, limited, err := cgroupCPUs(); err != nil || !limited {
+		return m
+	}
+	current, available, err := cgroupThrottling()
+	if err != nil {
+		slog.Debug("failed to read cgroup cpu statistics", "pid", os.Getpid(), "error", err)
+	}
+	m.available = available && err == nil
+	m.start = current
+	m.last = current
+	return m
+}
+
+// Sample returns the throttling since the previous call. Warns the first time the process is
+// throttled, as from then on usage falling short of the target is likely due to the cgroup limit
+func (m *throttleMonitor) Sample() (cpuThrottling, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return cpuThrottling{}, false
+	}
+	current, _, err := cgroupThrottling()
+	if err != nil {
+		slog.Debug("failed to read cgroup cpu statistics", "pid", os.Getpid(), "error", err)
+		return cpuThrottling{}, false
+	}
+	delta := current.sub(m.last)
+	m.last = current
+	if delta.throttledPeriods > 0 && !m.warned {
+		slog.Warn("throttled by the cgroup cpu limit, usage may fall short of the target", "pid", os.Getpid(), "throttled_periods", delta.throttledPeriods, "throttled_ms", delta.throttledTime.Milliseconds())
+		m.warned = true
+	}
+	return delta, true
+}
+
+// Total returns the throttling since the monitor was created
+func (m *throttleMonitor) Total() (cpuThrottling, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.available {
+		return cpuThrottling{}, false
+	}
+	current, _, err := cgroupThrottling()
+	if err != nil {
+		return m.last.sub(m.start), true
+	}
+	return current.sub(m.start), true
+}
+
+// Available tells whether the cgroup has a cpu limit whose throttling can be tracked
+func (m *throttleMonitor) Available() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.available
+}
+
+// StopOnThrottle stops the burner the first time the cgroup throttles the process, checking every
+// second until the context is done
+func (m *throttleMonitor) StopOnThrottle(ctx context.Context, b *burn.Burner) {
+	ticker := time.NewTicker(throttleCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if total, ok := m.Total(); ok && total.throttledPeriods > 0 {
+			slog.Error("throttled by the cgroup cpu limit, stopping", "pid", os.Getpid(), "throttled_periods", total.throttledPeriods, "periods", total.periods, "throttled_ms", total.throttledTime.Milliseconds())
+			b.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+)
+
+// cpuLocation is where a cpu sits in the topology of the host
+type cpuLocation struct {
+	cpu    int
+	socket int
+	die    int // unique within its socket
+	core   int // unique within its socket
+	l3     int // lowest cpu sharing its l3 cache, -1 when unknown
+}
+
+// cpuTopology is the location of every cpu of the host, sorted by cpu
+type cpuTopology []cpuLocation
+
+// counts returns how many sockets, dies, physical cores, hardware threads and l3 cache domains
+// the host has
+func (t cpuTopology) counts() (sockets, dies, cores, threads, l3s int) {
+	socketSet, dieSet, coreSet, l3Set := map[int]bool{}, map[[2]int]bool{}, map[[2]int]bool{}, map[int]bool{}
+	for _, l := range t {
+		socketSet[l.socket] = true
+		dieSet[[2]int{l.socket, l.die}] = true
+		coreSet[[2]int{l.socket, l.core}] = true
+		if l.l3 >= 0 {
+			l3Set[l.l3] = true
+		}
+	}
+	return len(socketSet), len(dieSet), len(coreSet), len(t), len(l3Set)
+}
+
+func (t cpuTopology) describe() string {
+	sockets, dies, cores, threads, l3s := t.counts()
+	return fmt.Sprintf("%d sockets, %d dies, %d cores, %d threads, %d l3 cache domains", sockets, dies, cores, threads, l3s)
+}
+
+// placementCPUSets places workers according to --placement among the cpus of cpuSets, or all the
+// allowed cpus when nil. Workers fill the sets returned in order, one each before doubling up:
+//   - spread-by-socket and spread-by-l3 give every socket or l3 cache domain a set of its own, so
+//     workers are balanced between them
+//   - pack-by-socket and pack-by-l3 give every cpu a set of its own, ordered domain by domain, so
+//     workers fill a socket or l3 cache domain before moving on to the next one
+func placementCPUSets(policy string, cpuSets [][]int) ([][]int, error) {
+	var domain func(cpuLocation) int
+	switch policy {
+	case "spread-by-socket", "pack-by-socket":
+		domain = func(l cpuLocation) int { return l.socket }
+	case "spread-by-l3", "pack-by-l3":
+		domain = func(l cpuLocation) int { return l.l3 }
+	default:
+		return nil, fmt.Errorf("invalid placement value: %s: must be spread-by-socket, pack-by-socket, spread-by-l3 or pack-by-l3", policy)
+	}
+	spread := policy == "spread-by-socket" || policy == "spread-by-l3"
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("--placement is only supported on linux")
+	}
+	candidates := map[int]bool{}
+	for _, cpuSet := range cpuSets {
+		for _, cpu := range cpuSet {
+			candidates[cpu] = true
+		}
+	}
+	if len(candidates) == 0 {
+		allowed, err := allowedCPUs()
+		if err != nil {
+			return nil, err
+		}
+		candidates = allowed
+	}
+	topology, err := readTopology()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect cpu topology: %w", err)
+	}
+
+	domains := map[int][]int{}
+	for _, l := range topology {
+		if !candidates[l.cpu] {
+			continue
+		}
+		if domain(l) < 0 {
+			return nil, fmt.Errorf("cpu %d has no l3 cache domain", l.cpu)
+		}
+		domains[domain(l)] = append(domains[domain(l)], l.cpu)
+	}
+	var result [][]int
+	for _, key := range sortedKeys(domains) {
+		cpus := domains[key]
+		sort.Ints(cpus)
+		if spread {
+			result = append(result, cpus)
+			continue
+		}
+		for _, cpu := range cpus {
+			result = append(result, []int{cpu})
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no cpu of the topology is available to this process")
+	}
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+	"gopkg.in/yaml.v3"
+)
+
+// traceSample is a single sample of the trace files passed to --replay. Traces are either csv
+// files with a timestamp and a cores column, or JSON lists of samples. Eg:
+//
+//	timestamp,cores
+//	2024-05-01T10:00:00Z,1.5
+//	2024-05-01T10:00:05Z,3.25
+//
+//	[{"timestamp": 0, "cores": 1.5}, {"timestamp": 5, "cores": 3.25}]
+//
+// Timestamps are RFC3339 times, seconds (eg unix times) or durations such as 1m30s, only the time
+// between them matters. Cores accept the same syntax as --burn
+type traceSample struct {
+	Timestamp string `yaml:"timestamp"`
+	Cores     string `yaml:"cores"`
+}
+
+// traceCoresColumns are the csv columns read as the cores of a sample, in order of preference.
+// achieved_cpus makes the files written by --out replayable
+var traceCoresColumns = []string{"cores", "cpus", "achieved_cpus"}
+
+// loadTrace reads a trace file into a Trace profile, replaying it speed times faster than it was
+// recorded. Every sample lasts until the next one, and the last one as long as the one before it
+func loadTrace(path string, speed float64) (burn.Trace, error) {
+	if speed <= 0 {
+		return burn.Trace{}, fmt.Errorf("invalid replay speed value: %v", speed)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return burn.Trace{}, err
+	}
+	var samples []traceSample
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		err = yaml.Unmarshal(data, &samples)
+	} else {
+		samples, err = readTraceCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return burn.Trace{}, fmt.Errorf("invalid trace file %s: %w", path, err)
+	}
+	if len(samples) < 2 {
+		return burn.Trace{}, fmt.Errorf("trace file %s needs at least 2 samples", path)
+	}
+
+	var trace burn.Trace
+	var first, previous time.Duration
+	for i, sample := range samples {
+		timestamp, err := parseTraceTimestamp(sample.Timestamp)
+		if err != nil {
+			return burn.Trace{}, fmt.Errorf("trace sample %d: %w", i, err)
+		}
+		if i == 0 {
+			first = timestamp
+		} else if timestamp <= previous {
+			return burn.Trace{}, fmt.Errorf("trace sample %d: timestamps must be increasing", i)
+		}
+		cpus, err := parseBurn(sample.Cores)
+		if err != nil {
+			return burn.Trace{}, fmt.Errorf("trace sample %d: %w", i, err)
+		}
+		trace.Points = append(trace.Points, burn.TracePoint{Offset: scaleTraceTime(timestamp-first, speed), CPUs: cpus})
+		if i == len(samples)-1 {
+			trace.End = scaleTraceTime(2*timestamp-previous-first, speed)
+		}
+		previous = timestamp
+	}
+	return trace, nil
+}
+
+// readTraceCSV reads the samples of a csv trace. Files with a header row can have other columns,
+// otherwise the timestamp and the cores are the first two
+func readTraceCSV(r io.Reader) ([]traceSample, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	timestampColumn, coresColumn := 0, 1
+	if _, err := parseTraceTimestamp(records[0][0]); err != nil {
+		header := records[0]
+		records = records[1:]
+		timestampColumn = slices.IndexFunc(header, func(column string) bool {
+			return column == "timestamp" || column == "time"
+		})
+		coresColumn = -1
+		for _, name := range traceCoresColumns {
+			if coresColumn = slices.Index(header, name); coresColumn >= 0 {
+				break
+			}
+		}
+		if timestampColumn < 0 || coresColumn < 0 {
+			return nil, fmt.Errorf("header needs a timestamp column and one of %s", strings.Join(traceCoresColumns, ", "))
+		}
+	}
+	samples := make([]traceSample, 0, len(records))
+	for i, record := range records {
+		if len(record) <= max(timestampColumn, coresColumn) {
+			return nil, fmt.Errorf("row %d has too few columns", i+1)
+		}
+		samples = append(samples, traceSample{Timestamp: record[timestampColumn], Cores: record[coresColumn]})
+	}
+	return samples, nil
+}
+
+// parseTraceTimestamp parses the timestamp of a trace sample into the time since some origin,
+// which is only meaningful relative to the other samples
+func parseTraceTimestamp(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return time.Duration(t.UnixNano()), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	if value == "" {
+		return 0, errors.New("missing timestamp")
+	}
+	return 0, fmt.Errorf("invalid timestamp %q: expected an RFC3339 time, seconds or a duration", value)
+}
+
+func scaleTraceTime(d time.Duration, speed float64) time.Duration {
+	return time.Duration(float64(d) / speed)
+}
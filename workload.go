@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bcap/cpu-burner/burn"
+)
+
+// newWorkload builds what workers do while burning from the --workload options. The rates the
+// workloads are capped at are split between the processes of --processes like the burn is
+func newWorkload(args Args) (burn.Workload, error) {
+	share := processShare()
+	if args.Iterations < 0 {
+		return nil, fmt.Errorf("invalid iterations value: %v", args.Iterations)
+	}
+	if args.Iterations > 0 {
+		if args.Workload != "spin" {
+			return nil, fmt.Errorf("--iterations only works with the spin workload, not %s", args.Workload)
+		}
+		return burn.NewIterations(args.Iterations * share), nil
+	}
+	switch args.Workload {
+	case "matrix":
+		if args.MatrixSize <= 0 {
+			return nil, fmt.Errorf("invalid matrix size: %d", args.MatrixSize)
+		}
+		return burn.NewMatrix(burn.MatrixOptions{Size: args.MatrixSize}), nil
+	case "alloc":
+		objectSize, err := parseBytes(args.AllocObjectSize)
+		if err != nil || objectSize <= 0 {
+			return nil, fmt.Errorf("invalid alloc object size: %s", args.AllocObjectSize)
+		}
+		liveSet, err := parseBytes(args.AllocLiveSet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alloc live set: %s", args.AllocLiveSet)
+		}
+		var rate int64
+		if args.AllocRate != "" {
+			rate, err = parseRate(args.AllocRate)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return burn.NewAlloc(burn.AllocOptions{ObjectSize: int(objectSize), LiveSet: liveSet, Rate: float64(rate) * share}), nil
+	case "goroutines":
+		if args.GoroutineRate < 0 {
+			return nil, fmt.Errorf("invalid goroutine rate: %v", args.GoroutineRate)
+		}
+		if args.GoroutineWork <= 0 {
+			return nil, fmt.Errorf("invalid goroutine work: %s", args.GoroutineWork)
+		}
+		return burn.NewGoroutines(burn.GoroutinesOptions{Work: args.GoroutineWork, Rate: args.GoroutineRate * share}), nil
+	case "switch":
+		if args.SwitchRate < 0 {
+			return nil, fmt.Errorf("invalid switch rate: %v", args.SwitchRate)
+		}
+		return burn.NewSwitch(burn.SwitchOptions{Rate: args.SwitchRate * share})
+	case "contend":
+		mode := burn.ContendMode(args.ContendMode)
+		if mode != burn.ContendMutex && mode != burn.ContendAtomic {
+			return nil, fmt.Errorf("invalid contend mode: %s", args.ContendMode)
+		}
+		if args.ContendRatio < 0 || args.ContendRatio > 1 {
+			return nil, fmt.Errorf("invalid contend ratio: %v", args.ContendRatio)
+		}
+		if args.ContendLocks <= 0 {
+			return nil, fmt.Errorf("invalid contend locks: %d", args.ContendLocks)
+		}
+		return burn.NewContend(burn.ContendOptions{Mode: mode, Ratio: args.ContendRatio, Locks: args.ContendLocks}), nil
+	case "syscall":
+		if args.SyscallSystem < 0 || args.SyscallSystem > 1 {
+			return nil, fmt.Errorf("invalid syscall system share: %v", args.SyscallSystem)
+		}
+		return burn.NewSyscalls(burn.SyscallsOptions{Kind: burn.SyscallKind(args.Syscall), System: args.SyscallSystem})
+	case "fd":
+		if args.FDRate < 0 {
+			return nil, fmt.Errorf("invalid fd rate: %v", args.FDRate)
+		}
+		return burn.NewFD(burn.FDOptions{Mode: burn.FDMode(args.FDMode), Dir: args.FDDir, Rate: args.FDRate * share})
+	case "timer":
+		if args.TimerRate < 0 {
+			return nil, fmt.Errorf("invalid timer rate: %v", args.TimerRate)
+		}
+		if args.TimerInterval <= 0 {
+			return nil, fmt.Errorf("invalid timer interval: %s", args.TimerInterval)
+		}
+		return burn.NewTimer(burn.TimerOptions{Rate: args.TimerRate * share, Interval: args.TimerInterval})
+	case "cache":
+		size, err := parseBytes(args.CacheSize)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid cache size: %s", args.CacheSize)
+		}
+		stride, err := parseBytes(args.CacheStride)
+		if err != nil || stride <= 0 || stride > size {
+			return nil, fmt.Errorf("invalid cache stride: %s", args.CacheStride)
+		}
+		policy, err := parseMemPolicy(args.MemPolicy)
+		if err != nil {
+			return nil, err
+		}
+		return burn.NewCache(burn.CacheOptions{Size: size, Stride: int(stride), MemPolicy: policy}), nil
+	case "stream":
+		size, err := parseBytes(args.StreamSize)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid stream size: %s", args.StreamSize)
+		}
+		var rate int64
+		if args.StreamRate != "" {
+			rate, err = parseRate(args.StreamRate)
+			if err != nil {
+				return nil, err
+			}
+		}
+		policy, err := parseMemPolicy(args.MemPolicy)
+		if err != nil {
+			return nil, err
+		}
+		return burn.NewStream(burn.StreamOptions{Size: size, Rate: float64(rate) * share, MemPolicy: policy}), nil
+	case "power":
+		if !args.AllowPowerVirus {
+			return nil, errors.New("the power workload draws as much power as the cpu can and needs --allow-power-virus")
+		}
+		return burn.NewPower(), nil
+	default:
+		// workloads without options of their own, built in or compiled in
+		workload, err := burn.NewWorkload(args.Workload)
+		if errors.Is(err, burn.ErrUnknownWorkload) {
+			return nil, fmt.Errorf("invalid workload value: %s", args.Workload)
+		}
+		return workload, err
+	}
+}
+
+// logWorkload periodically logs what the workload is doing besides consuming cpu, for workloads
+// that have something to tell, until the context is done
+func logWorkload(ctx context.Context, workload burn.Workload, every time.Duration) {
+	switch workload := workload.(type) {
+	case *burn.Alloc:
+		logAllocs(ctx, workload, every)
+	case *burn.Goroutines:
+		logGoroutines(ctx, workload, every)
+	case *burn.Switch:
+		logSwitches(ctx, workload, every)
+	case *burn.Contend:
+		logContention(ctx, workload, every)
+	case *burn.Syscalls:
+		logSyscalls(ctx, workload, every)
+	case *burn.FD:
+		logFDs(ctx, workload, every)
+	case *burn.Timer:
+		logTimers(ctx, workload, every)
+	case *burn.Int:
+		logInt(ctx, workload, every)
+	case *burn.Float:
+		logFloat(ctx, workload, every)
+	case *burn.SHA256:
+		logSHA256(ctx, workload, every)
+	case *burn.Branch:
+		logBranch(ctx, workload, every)
+	case *burn.Matrix:
+		logMatrix(ctx, workload, every)
+	case *burn.Cache:
+		logCache(ctx, workload, every)
+	case *burn.Stream:
+		logStream(ctx, workload, every)
+	case *burn.Power:
+		logPower(ctx, workload, every)
+	case *burn.Iterations:
+		logIterations(ctx, workload, every)
+	}
+}
+
+func logAllocs(ctx context.Context, alloc *burn.Alloc, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	previousAllocated, previousGC := alloc.Allocated(), stats.NumGC
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		runtime.ReadMemStats(&stats)
+		allocated := alloc.Allocated()
+		slog.Info("alloc usage", "pid", os.Getpid(),
+			"alloc_bytes_per_sec", int64(float64(allocated-previousAllocated)/every.Seconds()),
+			"gc_per_sec", decimal(float64(stats.NumGC-previousGC)/every.Seconds(), 1),
+			"heap_bytes", stats.HeapAlloc,
+		)
+		previousAllocated, previousGC = allocated, stats.NumGC
+	}
+}
+
+func logGoroutines(ctx context.Context, goroutines *burn.Goroutines, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := goroutines.Spawned()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		spawned := goroutines.Spawned()
+		slog.Info("goroutine usage", "pid", os.Getpid(),
+			"spawned_per_sec", int64(float64(spawned-previous)/every.Seconds()),
+			"live", goroutines.Live(),
+			"goroutines", runtime.NumGoroutine(),
+		)
+		previous = spawned
+	}
+}
+
+func logSwitches(ctx context.Context, switches *burn.Switch, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := switches.Switches()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := switches.Switches()
+		slog.Info("switch usage", "pid", os.Getpid(), "switches_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logContention(ctx context.Context, contend *burn.Contend, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previousOps, previousShared := contend.Ops(), contend.SharedOps()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ops, shared := contend.Ops(), contend.SharedOps()
+		slog.Info("contend usage", "pid", os.Getpid(),
+			"ops_per_sec", int64(float64(ops-previousOps)/every.Seconds()),
+			"shared_ops_per_sec", int64(float64(shared-previousShared)/every.Seconds()),
+		)
+		previousOps, previousShared = ops, shared
+	}
+}
+
+func logSyscalls(ctx context.Context, syscalls *burn.Syscalls, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := syscalls.Calls()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := syscalls.Calls()
+		slog.Info("syscall usage", "pid", os.Getpid(), "calls_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logFDs(ctx context.Context, fd *burn.FD, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previousOpens, previousFailed := fd.Opens(), fd.Failed()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		opens, failed := fd.Opens(), fd.Failed()
+		slog.Info("fd usage", "pid", os.Getpid(),
+			"opens_per_sec", int64(float64(opens-previousOpens)/every.Seconds()),
+			"failures_per_sec", int64(float64(failed-previousFailed)/every.Seconds()),
+		)
+		previousOpens, previousFailed = opens, failed
+	}
+}
+
+func logTimers(ctx context.Context, timer *burn.Timer, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previousArmed, previousFired := timer.Armed(), timer.Fired()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		armed, fired := timer.Armed(), timer.Fired()
+		slog.Info("timer usage", "pid", os.Getpid(),
+			"armed_per_sec", int64(float64(armed-previousArmed)/every.Seconds()),
+			"fired_per_sec", int64(float64(fired-previousFired)/every.Seconds()),
+		)
+		previousArmed, previousFired = armed, fired
+	}
+}
+
+func logCache(ctx context.Context, cache *burn.Cache, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := cache.Accesses()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := cache.Accesses()
+		slog.Info("cache usage", "pid", os.Getpid(), "accesses_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logStream(ctx context.Context, stream *burn.Stream, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := stream.Moved()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := stream.Moved()
+		slog.Info("stream usage", "pid", os.Getpid(), "bytes_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logPower(ctx context.Context, power *burn.Power, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previousOps, previousMoved := power.Ops(), power.Moved()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ops, moved := power.Ops(), power.Moved()
+		slog.Info("power usage", "pid", os.Getpid(),
+			"flops", int64(float64(ops-previousOps)/every.Seconds()),
+			"bytes_per_sec", int64(float64(moved-previousMoved)/every.Seconds()),
+		)
+		previousOps, previousMoved = ops, moved
+	}
+}
+
+func logIterations(ctx context.Context, iterations *burn.Iterations, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := iterations.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := iterations.Done()
+		slog.Info("iterations usage", "pid", os.Getpid(), "iterations_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logFloat(ctx context.Context, float *burn.Float, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := float.Ops()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := float.Ops()
+		slog.Info("float usage", "pid", os.Getpid(), "flops", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logInt(ctx context.Context, n *burn.Int, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := n.Ops()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := n.Ops()
+		slog.Info("int usage", "pid", os.Getpid(), "ops_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logSHA256(ctx context.Context, sha *burn.SHA256, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := sha.Hashed()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := sha.Hashed()
+		slog.Info("sha256 usage", "pid", os.Getpid(), "bytes_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logMatrix(ctx context.Context, matrix *burn.Matrix, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := matrix.Flops()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := matrix.Flops()
+		slog.Info("matrix usage", "pid", os.Getpid(), "flops", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
+
+func logBranch(ctx context.Context, branch *burn.Branch, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	previous := branch.Branches()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := branch.Branches()
+		slog.Info("branch usage", "pid", os.Getpid(), "branches_per_sec", int64(float64(current-previous)/every.Seconds()))
+		previous = current
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// commandSeparator separates the burner options from the command to run while burning
+const commandSeparator = "--"
+
+func (Args) Epilogue() string {
+	return "Options can be followed by " + commandSeparator + " and a command to run while burning, eg cpu-burner --burn 2 -- ./benchmark --flag. The burn stops once the command exits, and cpu-burner exits with its status"
+}
+
+// splitCommand cuts os.Args at the first --, returning what follows as the command to run while
+// burning. Everything else, eg config reloads and child processes, only sees the burner options
+func splitCommand() []string {
+	for i, arg := range os.Args[1:] {
+		if arg == commandSeparator {
+			command := os.Args[i+2:]
+			os.Args = os.Args[:i+1]
+			return command
+		}
+	}
+	return nil
+}
+
+// wrappedCommand is the command given after -- running alongside the burn
+type wrappedCommand struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// startCommand starts the command with the stdin, stdout and stderr of the burner, calling stop
+// once it exits. Terminations are forwarded to it, interrupts from the terminal reach it directly
+func startCommand(command []string, stop context.CancelFunc) (*wrappedCommand, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	slog.Info("started command", "pid", os.Getpid(), "command_pid", cmd.Process.Pid, "command", strings.Join(command, " "))
+	w := &wrappedCommand{cmd: cmd, done: make(chan struct{})}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	go func() {
+		// the exit status is read from the process state, the error adds nothing to it
+		cmd.Wait()
+		slog.Info("command exited, stopping", "pid", os.Getpid(), "command_pid", cmd.Process.Pid, "exit_code", w.exitCode())
+		close(w.done)
+		stop()
+	}()
+	return w, nil
+}
+
+// exitCode returns the exit status of the command, or 128 plus the signal number when a signal
+// killed it, like shells do
+func (w *wrappedCommand) exitCode() int {
+	state := w.cmd.ProcessState
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// Wait waits for the command to exit, in case the burn ended first, and returns its exit status
+func (w *wrappedCommand) Wait() int {
+	select {
+	case <-w.done:
+	default:
+		slog.Info("burn finished, waiting for the command", "pid", os.Getpid(), "command_pid", w.cmd.Process.Pid)
+		<-w.done
+	}
+	return w.exitCode()
+}